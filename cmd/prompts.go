@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alantheprice/agent/pkg/generic"
+	"github.com/alantheprice/agent/pkg/providers/prompts"
+	"github.com/spf13/cobra"
+)
+
+var (
+	promptsDir    string
+	promptsConfig string
+)
+
+// promptsCmd represents the prompts command
+var promptsCmd = &cobra.Command{
+	Use:   "prompts",
+	Short: "Inspect managed prompts referenced by prompt_ref",
+	Long: `Lists, shows and compares the managed prompt files that workflow steps
+reference with prompt_ref. Prompts are read from --dir, from the prompts_dir of
+the agent given with --config, or from ./prompts.
+
+Versioned prompts are stored as <name>@<version>.txt and referenced as
+"name@version"; a reference without a version resolves to the latest one.
+
+Examples:
+  agent prompts list
+  agent prompts show code_review@2
+  agent prompts diff code_review@1 code_review@2
+  agent prompts diff code_review --config examples/git_workflow/git_workflow_assistant.json`,
+}
+
+var promptsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List managed prompts and their versions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, dir, err := promptsManager()
+		if err != nil {
+			return err
+		}
+
+		names := make(map[string]bool)
+		for _, key := range manager.ListPrompts() {
+			name, _ := prompts.ParseRef(key)
+			names[name] = true
+		}
+		if len(names) == 0 {
+			fmt.Printf("No prompts found in %s\n", dir)
+			return nil
+		}
+
+		sorted := make([]string, 0, len(names))
+		for name := range names {
+			sorted = append(sorted, name)
+		}
+		sort.Strings(sorted)
+
+		fmt.Printf("Prompts in %s:\n", dir)
+		for _, name := range sorted {
+			latest, err := manager.Resolve(name)
+			if err != nil {
+				return err
+			}
+			content, err := manager.LoadPrompt(latest)
+			if err != nil {
+				return err
+			}
+
+			versions := manager.Versions(name)
+			if len(versions) == 0 {
+				fmt.Printf("  %-30s %6d bytes\n", name, len(content))
+				continue
+			}
+			fmt.Printf("  %-30s %6d bytes  versions: %s\n", name, len(content), strings.Join(versions, ", "))
+		}
+		return nil
+	},
+}
+
+var promptsShowCmd = &cobra.Command{
+	Use:   "show <name[@version]>",
+	Short: "Print a managed prompt",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, _, err := promptsManager()
+		if err != nil {
+			return err
+		}
+
+		content, resolved, err := manager.LoadRef(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("# %s\n", resolved)
+		fmt.Println(content)
+		return nil
+	},
+}
+
+var promptsDiffCmd = &cobra.Command{
+	Use:   "diff <name[@version]> [name[@version]]",
+	Short: "Compare two managed prompts",
+	Long: `Shows a line diff between two prompt references. With a single name,
+compares its two most recent versions.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, _, err := promptsManager()
+		if err != nil {
+			return err
+		}
+
+		from, to := args[0], ""
+		if len(args) == 2 {
+			to = args[1]
+		} else {
+			name, _ := prompts.ParseRef(from)
+			versions := manager.Versions(name)
+			if len(versions) < 2 {
+				return fmt.Errorf("prompt '%s' has fewer than two versions to compare", name)
+			}
+			from = name + "@" + versions[len(versions)-2]
+			to = name + "@" + versions[len(versions)-1]
+		}
+
+		fromContent, fromKey, err := manager.LoadRef(from)
+		if err != nil {
+			return err
+		}
+		toContent, toKey, err := manager.LoadRef(to)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("--- %s\n+++ %s\n", fromKey, toKey)
+		if fromContent == toContent {
+			fmt.Println("(no differences)")
+			return nil
+		}
+		fmt.Print(diffLines(fromContent, toContent, 3))
+		return nil
+	},
+}
+
+// promptsManager opens the prompts directory selected by the flags
+func promptsManager() (*prompts.Manager, string, error) {
+	dir := promptsDir
+	if dir == "" && promptsConfig != "" {
+		config, err := generic.LoadConfig(promptsConfig)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load agent config: %w", err)
+		}
+		dir = config.Agent.PromptsDir
+	}
+	if dir == "" {
+		dir = "prompts"
+	}
+	return prompts.NewManager(dir), dir, nil
+}
+
+// diffLines renders a unified-style line diff with the given lines of context
+func diffLines(from, to string, context int) string {
+	a := strings.Split(strings.TrimSuffix(from, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(to, "\n"), "\n")
+
+	// Longest common subsequence table, filled from the end
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte
+		text string
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+
+	// Only print changed lines and the context around them
+	show := make([]bool, len(lines))
+	for k, line := range lines {
+		if line.op == ' ' {
+			continue
+		}
+		for c := max(0, k-context); c <= min(len(lines)-1, k+context); c++ {
+			show[c] = true
+		}
+	}
+
+	var sb strings.Builder
+	for k, line := range lines {
+		if !show[k] {
+			continue
+		}
+		if k == 0 || !show[k-1] {
+			sb.WriteString("@@\n")
+		}
+		sb.WriteByte(line.op)
+		sb.WriteString(line.text)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func init() {
+	promptsCmd.PersistentFlags().StringVar(&promptsDir, "dir", "", "Prompts directory (default ./prompts)")
+	promptsCmd.PersistentFlags().StringVar(&promptsConfig, "config", "", "Agent config whose prompts_dir to use")
+
+	promptsCmd.AddCommand(promptsListCmd)
+	promptsCmd.AddCommand(promptsShowCmd)
+	promptsCmd.AddCommand(promptsDiffCmd)
+	rootCmd.AddCommand(promptsCmd)
+}
@@ -24,13 +24,14 @@ type Agent struct {
 
 // ExecutionContext holds context for agent execution
 type ExecutionContext struct {
-	Context     context.Context
-	SessionID   string
-	StartTime   time.Time
-	Data        map[string]interface{}
-	Variables   map[string]string
-	StepResults map[string]*StepResult
-	Metrics     *ExecutionMetrics
+	Context       context.Context
+	SessionID     string
+	StartTime     time.Time
+	Data          map[string]interface{}
+	Variables     map[string]string
+	StepResults   map[string]*StepResult
+	Metrics       *ExecutionMetrics
+	Conversations *ConversationStore
 }
 
 // StepResult holds the result of a workflow step
@@ -94,6 +95,15 @@ func NewAgent(config *AgentConfig, logger *slog.Logger) (*Agent, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create workflow engine: %w", err)
 	}
+	agent.workflow.SetInteractive(config.Agent.Interactive)
+	agent.workflow.SetPromptsDir(config.Agent.PromptsDir)
+	agent.workflow.SetStrictTemplates(config.Agent.StrictTemplates)
+	if err := agent.workflow.RegisterTemplateMacros(config.TemplateFunctions); err != nil {
+		return nil, fmt.Errorf("failed to register template functions: %w", err)
+	}
+	if err := agent.workflow.RegisterExtensions(config.Extensions); err != nil {
+		return nil, fmt.Errorf("failed to register extensions: %w", err)
+	}
 
 	// Output writer
 	agent.outputWriter, err = NewOutputWriter(config.Outputs, logger)
@@ -116,13 +126,14 @@ func (a *Agent) ExecuteWithContext(ctx context.Context, input string) error {
 	sessionID := generateSessionID()
 
 	execCtx := &ExecutionContext{
-		Context:     ctx,
-		SessionID:   sessionID,
-		StartTime:   startTime,
-		Data:        make(map[string]interface{}),
-		Variables:   make(map[string]string),
-		StepResults: make(map[string]*StepResult),
-		Metrics:     &ExecutionMetrics{},
+		Context:       ctx,
+		SessionID:     sessionID,
+		StartTime:     startTime,
+		Data:          make(map[string]interface{}),
+		Variables:     make(map[string]string),
+		StepResults:   make(map[string]*StepResult),
+		Metrics:       &ExecutionMetrics{},
+		Conversations: NewConversationStore(),
 	}
 
 	// Add environment variables to context
@@ -246,6 +257,12 @@ func (a *Agent) Stop() error {
 	return nil
 }
 
+// RegisterTemplateFunction adds a function that workflow templates can call,
+// such as a domain helper like jira_link(id), without changing the engine
+func (a *Agent) RegisterTemplateFunction(name string, fn TemplateFunction, signature FunctionSignature) error {
+	return a.workflow.RegisterTemplateFunction(name, fn, signature)
+}
+
 // GetConfig returns the agent configuration
 func (a *Agent) GetConfig() *AgentConfig {
 	return a.config
@@ -0,0 +1,435 @@
+package generic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// Code search
+//
+// search_code and find_files walk the workspace below a path, skipping .git,
+// everything the .gitignore files from the working directory down ignore
+// (unless include_ignored is set) and security.blocked_paths. File patterns
+// use .gitignore syntax: "*.go" matches at any depth, "pkg/**/*.go" is
+// anchored to the search path, and a leading "!" excludes.
+
+const (
+	defaultSearchMatches  = 100
+	defaultFindResults    = 500
+	maxSearchFileSize     = 1 << 20
+	maxSearchLineLength   = 500
+	binarySniffLength     = 8000
+	gitignoreFile         = ".gitignore"
+	searchContextLinesMax = 10
+)
+
+// ignoreRules is one directory's .gitignore
+type ignoreRules struct {
+	dir   string
+	rules *gitignore.GitIgnore
+}
+
+// workspaceWalker visits the files a search may read
+type workspaceWalker struct {
+	tr             *ToolRegistry
+	includeIgnored bool
+	ignores        []ignoreRules
+}
+
+// walk calls visit for each file and directory below root that is not
+// ignored or blocked, with its path relative to root
+func (w *workspaceWalker) walk(ctx context.Context, root string, visit func(path, rel string, entry fs.DirEntry) error) error {
+	if err := w.tr.validateFilePath(root); err != nil {
+		return fmt.Errorf("path validation failed: %w", err)
+	}
+	if !w.includeIgnored {
+		w.loadParentIgnores(root)
+	}
+
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			w.tr.logger.Debug("Skipping unreadable path", "path", path, "error", err)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if path == root {
+			if entry.IsDir() {
+				w.pushIgnores(absPath)
+			}
+			return nil
+		}
+
+		skip := func() error {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if w.tr.blockedPath(absPath) || (!w.includeIgnored && w.ignored(absPath, entry.IsDir())) {
+			return skip()
+		}
+		if entry.IsDir() {
+			w.pushIgnores(absPath)
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return visit(path, filepath.ToSlash(rel), entry)
+	})
+}
+
+// loadParentIgnores reads the .gitignore files of the directories from the
+// working directory down to root, which apply to root's contents too
+func (w *workspaceWalker) loadParentIgnores(root string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil || !pathWithin(absRoot, cwd) {
+		return
+	}
+	rel, err := filepath.Rel(cwd, absRoot)
+	if err != nil || rel == "." {
+		return
+	}
+
+	dir := cwd
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		w.addIgnoreFile(dir)
+		dir = filepath.Join(dir, part)
+	}
+}
+
+// pushIgnores adds the .gitignore of dir after dropping the rules of
+// directories the walk has left
+func (w *workspaceWalker) pushIgnores(dir string) {
+	kept := w.ignores[:0]
+	for _, ignore := range w.ignores {
+		if pathWithin(dir, ignore.dir) {
+			kept = append(kept, ignore)
+		}
+	}
+	w.ignores = kept
+	if !w.includeIgnored {
+		w.addIgnoreFile(dir)
+	}
+}
+
+func (w *workspaceWalker) addIgnoreFile(dir string) {
+	rules, err := gitignore.CompileIgnoreFile(filepath.Join(dir, gitignoreFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			w.tr.logger.Debug("Failed to read .gitignore", "dir", dir, "error", err)
+		}
+		return
+	}
+	w.ignores = append(w.ignores, ignoreRules{dir: dir, rules: rules})
+}
+
+// ignored reports whether the .gitignore of one of the directories above an
+// absolute path matches it
+func (w *workspaceWalker) ignored(absPath string, isDir bool) bool {
+	for _, ignore := range w.ignores {
+		rel, err := filepath.Rel(ignore.dir, absPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if isDir {
+			rel += "/"
+		}
+		if ignore.rules.MatchesPath(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedPath reports whether an absolute path is under a blocked path
+func (tr *ToolRegistry) blockedPath(absPath string) bool {
+	if tr.security == nil {
+		return false
+	}
+	for _, blocked := range tr.security.BlockedPaths {
+		if pathWithin(absPath, blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+// filePatternsParam compiles a pattern or list of patterns in .gitignore
+// syntax, or returns nil when the param is not set
+func filePatternsParam(params map[string]interface{}, name string) (*gitignore.GitIgnore, error) {
+	value, ok := params[name]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	if pattern, ok := value.(string); ok {
+		if strings.TrimSpace(pattern) == "" {
+			return nil, nil
+		}
+		return gitignore.CompileIgnoreLines(pattern), nil
+	}
+	patterns, err := stringListParam(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", name, err)
+	}
+	return gitignore.CompileIgnoreLines(patterns...), nil
+}
+
+func (tr *ToolRegistry) executeFindFiles(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	patterns, err := filePatternsParam(params, "pattern")
+	if err != nil {
+		return nil, err
+	}
+	if patterns == nil {
+		return nil, fmt.Errorf("pattern parameter is required")
+	}
+	root, _ := params["path"].(string)
+	if root == "" {
+		root = "."
+	}
+	kind, _ := params["type"].(string)
+	if kind == "" {
+		kind = "file"
+	}
+	if kind != "file" && kind != "dir" && kind != "any" {
+		return nil, fmt.Errorf("type must be file, dir or any, got %q", kind)
+	}
+	includeIgnored, err := boolParam(params, "include_ignored", false)
+	if err != nil {
+		return nil, err
+	}
+	maxResults, err := intParam(params, "max_results", defaultFindResults)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []interface{}{}
+	truncated := false
+	walker := &workspaceWalker{tr: tr, includeIgnored: includeIgnored}
+	err = walker.walk(ctx, root, func(path, rel string, entry fs.DirEntry) error {
+		if (kind == "file" && entry.IsDir()) || (kind == "dir" && !entry.IsDir()) {
+			return nil
+		}
+		match := rel
+		if entry.IsDir() {
+			match += "/"
+		}
+		if !patterns.MatchesPath(match) {
+			return nil
+		}
+		if maxResults > 0 && len(files) >= maxResults {
+			truncated = true
+			return fs.SkipAll
+		}
+		files = append(files, filepath.ToSlash(path))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files: %w", err)
+	}
+
+	return map[string]interface{}{
+		"path":      root,
+		"files":     files,
+		"count":     len(files),
+		"truncated": truncated,
+		"success":   true,
+	}, nil
+}
+
+func (tr *ToolRegistry) executeSearchCode(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	pattern, ok := params["pattern"].(string)
+	if !ok || pattern == "" {
+		return nil, fmt.Errorf("pattern parameter is required and must be a string")
+	}
+	literal, err := boolParam(params, "literal", false)
+	if err != nil {
+		return nil, err
+	}
+	ignoreCase, err := boolParam(params, "ignore_case", false)
+	if err != nil {
+		return nil, err
+	}
+	if literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	root, _ := params["path"].(string)
+	if root == "" {
+		root = "."
+	}
+	include, err := filePatternsParam(params, "include")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := filePatternsParam(params, "exclude")
+	if err != nil {
+		return nil, err
+	}
+	contextLines, err := intParam(params, "context_lines", 0)
+	if err != nil {
+		return nil, err
+	}
+	contextLines = min(contextLines, searchContextLinesMax)
+	maxMatches, err := intParam(params, "max_matches", defaultSearchMatches)
+	if err != nil {
+		return nil, err
+	}
+	includeIgnored, err := boolParam(params, "include_ignored", false)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []interface{}{}
+	filesSearched, filesMatched := 0, 0
+	truncated := false
+	walker := &workspaceWalker{tr: tr, includeIgnored: includeIgnored}
+	err = walker.walk(ctx, root, func(path, rel string, entry fs.DirEntry) error {
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			return nil
+		}
+		if (include != nil && !include.MatchesPath(rel)) || (exclude != nil && exclude.MatchesPath(rel)) {
+			return nil
+		}
+
+		fileMatches, err := searchFile(path, re, contextLines)
+		if err != nil {
+			tr.logger.Debug("Skipping file", "path", path, "error", err)
+			return nil
+		}
+		filesSearched++
+		if len(fileMatches) > 0 {
+			filesMatched++
+		}
+		for _, match := range fileMatches {
+			if maxMatches > 0 && len(matches) >= maxMatches {
+				truncated = true
+				return fs.SkipAll
+			}
+			matches = append(matches, match)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	return map[string]interface{}{
+		"pattern":        params["pattern"],
+		"matches":        matches,
+		"count":          len(matches),
+		"files_searched": filesSearched,
+		"files_matched":  filesMatched,
+		"truncated":      truncated,
+		"success":        true,
+	}, nil
+}
+
+// searchFile returns the matching lines of a text file as {path, line,
+// column, text} maps, with before and after context when contextLines is
+// set. Binary and very large files are skipped.
+func searchFile(path string, re *regexp.Regexp, contextLines int) ([]interface{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSearchFileSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxSearchFileSize)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(content[:min(len(content), binarySniffLength)], 0) >= 0 {
+		return nil, fmt.Errorf("binary file")
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSearchFileSize)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var matches []interface{}
+	for i, line := range lines {
+		location := re.FindStringIndex(line)
+		if location == nil {
+			continue
+		}
+		match := map[string]interface{}{
+			"path":   filepath.ToSlash(path),
+			"line":   i + 1,
+			"column": len([]rune(line[:location[0]])) + 1,
+			"text":   truncateSearchLine(line),
+		}
+		if contextLines > 0 {
+			match["before"] = searchContext(lines[max(i-contextLines, 0):i])
+			match["after"] = searchContext(lines[i+1 : min(i+1+contextLines, len(lines))])
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+func searchContext(lines []string) []interface{} {
+	result := make([]interface{}, len(lines))
+	for i, line := range lines {
+		result[i] = truncateSearchLine(line)
+	}
+	return result
+}
+
+// truncateSearchLine shortens minified or generated lines in results
+func truncateSearchLine(line string) string {
+	if len(line) <= maxSearchLineLength {
+		return line
+	}
+	cut := maxSearchLineLength
+	for cut > 0 && !utf8RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "..."
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
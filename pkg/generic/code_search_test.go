@@ -0,0 +1,214 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeCodeSearchTree lays out a small workspace with nested .gitignore
+// files, a blocked directory and a binary file
+func writeCodeSearchTree(t *testing.T) {
+	t.Helper()
+	writePatchTestFile(t, ".gitignore", "build/\n*.log\n")
+	writePatchTestFile(t, "main.go", "package main\n\n// TODO: flags\nfunc main() {\n\trun()\n}\n")
+	writePatchTestFile(t, "pkg/run.go", "package pkg\n\nfunc Run() {\n\t// todo: retries\n}\n")
+	writePatchTestFile(t, "pkg/.gitignore", "generated.go\n")
+	writePatchTestFile(t, "pkg/generated.go", "package pkg // TODO: generated\n")
+	writePatchTestFile(t, "pkg/run_test.go", "package pkg\n\n// TODO: more tests\n")
+	writePatchTestFile(t, "build/out.go", "package out // TODO: build\n")
+	writePatchTestFile(t, "debug.log", "TODO: log\n")
+	writePatchTestFile(t, "secrets/key.go", "package secrets // TODO: rotate\n")
+	writePatchTestFile(t, "image.bin", "TODO\x00\x01\x02")
+	writePatchTestFile(t, ".git/HEAD", "TODO: ref\n")
+}
+
+func TestSearchCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    map[string]interface{}
+		expected  []string
+		errorText string
+	}{
+		{
+			name:     "regular expression",
+			params:   map[string]interface{}{"pattern": `TODO:\s+\w+`},
+			expected: []string{"main.go:3", "pkg/run_test.go:3"},
+		},
+		{
+			name:     "ignore case",
+			params:   map[string]interface{}{"pattern": "todo:", "ignore_case": true},
+			expected: []string{"main.go:3", "pkg/run.go:4", "pkg/run_test.go:3"},
+		},
+		{
+			name:     "literal",
+			params:   map[string]interface{}{"pattern": "run()", "literal": true},
+			expected: []string{"main.go:5"},
+		},
+		{
+			name:     "include and exclude globs",
+			params:   map[string]interface{}{"pattern": "(?i)todo", "include": "pkg/", "exclude": []interface{}{"*_test.go"}},
+			expected: []string{"pkg/run.go:4"},
+		},
+		{
+			name:     "below a path",
+			params:   map[string]interface{}{"pattern": "TODO", "path": "pkg"},
+			expected: []string{"pkg/run_test.go:3"},
+		},
+		{
+			name:     "ignored files included on request",
+			params:   map[string]interface{}{"pattern": "TODO", "path": "pkg", "include_ignored": true},
+			expected: []string{"pkg/generated.go:1", "pkg/run_test.go:3"},
+		},
+		{
+			name:     "match limit",
+			params:   map[string]interface{}{"pattern": "package", "max_matches": 1.0},
+			expected: []string{"main.go:1"},
+		},
+		{
+			name:      "invalid expression",
+			params:    map[string]interface{}{"pattern": "func("},
+			errorText: "invalid pattern",
+		},
+		{
+			name:      "blocked search path",
+			params:    map[string]interface{}{"pattern": "TODO", "path": "secrets"},
+			errorText: "blocked",
+		},
+		{
+			name:      "path outside the workspace",
+			params:    map[string]interface{}{"pattern": "TODO", "path": "../"},
+			errorText: "path validation failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newPatchTestRegistry(t, &Security{BlockedPaths: []string{"secrets"}})
+			writeCodeSearchTree(t)
+
+			output, err := registry.executeSearchCode(context.Background(), tt.params)
+			if tt.errorText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorText) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("search_code failed: %v", err)
+			}
+
+			result := output.(map[string]interface{})
+			var got []string
+			for _, match := range result["matches"].([]interface{}) {
+				m := match.(map[string]interface{})
+				got = append(got, fmt.Sprintf("%s:%d", m["path"], m["line"]))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected matches %v, got %v", tt.expected, got)
+			}
+			if result["count"] != len(tt.expected) {
+				t.Errorf("Expected count %d, got %v", len(tt.expected), result["count"])
+			}
+		})
+	}
+}
+
+func TestSearchCodeResult(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{})
+	writeCodeSearchTree(t)
+
+	output, err := registry.executeSearchCode(context.Background(), map[string]interface{}{
+		"pattern": "run", "include": "main.go", "context_lines": 1.0,
+	})
+	if err != nil {
+		t.Fatalf("search_code failed: %v", err)
+	}
+	result := output.(map[string]interface{})
+	expected := map[string]interface{}{
+		"path":   "main.go",
+		"line":   5,
+		"column": 2,
+		"text":   "\trun()",
+		"before": []interface{}{"func main() {"},
+		"after":  []interface{}{"}"},
+	}
+	matches := result["matches"].([]interface{})
+	if len(matches) != 1 || !reflect.DeepEqual(matches[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, matches)
+	}
+	if result["files_searched"] != 1 || result["files_matched"] != 1 || result["truncated"] != false {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		params    map[string]interface{}
+		expected  []string
+		truncated bool
+	}{
+		{
+			name:     "glob at any depth",
+			params:   map[string]interface{}{"pattern": "*.go"},
+			expected: []string{"main.go", "pkg/run.go", "pkg/run_test.go"},
+		},
+		{
+			name:     "anchored glob",
+			params:   map[string]interface{}{"pattern": "pkg/*.go"},
+			expected: []string{"pkg/run.go", "pkg/run_test.go"},
+		},
+		{
+			name:     "negated glob",
+			params:   map[string]interface{}{"pattern": []interface{}{"*.go", "!*_test.go"}},
+			expected: []string{"main.go", "pkg/run.go"},
+		},
+		{
+			name:     "ignored files included on request",
+			params:   map[string]interface{}{"pattern": "*.go", "include_ignored": true},
+			expected: []string{"build/out.go", "main.go", "pkg/generated.go", "pkg/run.go", "pkg/run_test.go"},
+		},
+		{
+			name:     "directories",
+			params:   map[string]interface{}{"pattern": "*", "type": "dir", "include_ignored": true},
+			expected: []string{"build", "pkg"},
+		},
+		{
+			name:     "below a path",
+			params:   map[string]interface{}{"pattern": "*.go", "path": "pkg"},
+			expected: []string{"pkg/run.go", "pkg/run_test.go"},
+		},
+		{
+			name:      "result limit",
+			params:    map[string]interface{}{"pattern": "*.go", "max_results": 2.0},
+			expected:  []string{"main.go", "pkg/run.go"},
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newPatchTestRegistry(t, &Security{BlockedPaths: []string{"secrets"}})
+			writeCodeSearchTree(t)
+
+			output, err := registry.executeFindFiles(context.Background(), tt.params)
+			if err != nil {
+				t.Fatalf("find_files failed: %v", err)
+			}
+			result := output.(map[string]interface{})
+			var got []string
+			for _, file := range result["files"].([]interface{}) {
+				got = append(got, file.(string))
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected files %v, got %v", tt.expected, got)
+			}
+			if result["truncated"] != tt.truncated {
+				t.Errorf("Expected truncated %v, got %v", tt.truncated, result["truncated"])
+			}
+		})
+	}
+}
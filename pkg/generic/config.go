@@ -10,28 +10,32 @@ import (
 
 // AgentConfig represents the complete agent configuration
 type AgentConfig struct {
-	Agent       AgentInfo       `json:"agent" validate:"required"`
-	LLM         LLMConfig       `json:"llm" validate:"required"`
-	Embeddings  EmbeddingConfig `json:"embeddings,omitempty"`
-	DataSources []DataSource    `json:"data_sources,omitempty"`
-	Workflows   []Workflow      `json:"workflows,omitempty"`
-	Tools       map[string]Tool `json:"tools,omitempty"`
-	Outputs     []Output        `json:"outputs,omitempty"`
-	Environment Environment     `json:"environment,omitempty"`
-	Security    Security        `json:"security,omitempty"`
-	Validation  Validation      `json:"validation,omitempty"`
+	Agent             AgentInfo                `json:"agent" validate:"required"`
+	LLM               LLMConfig                `json:"llm" validate:"required"`
+	Embeddings        EmbeddingConfig          `json:"embeddings,omitempty"`
+	DataSources       []DataSource             `json:"data_sources,omitempty"`
+	Workflows         []Workflow               `json:"workflows,omitempty"`
+	Tools             map[string]Tool          `json:"tools,omitempty"`
+	Outputs           []Output                 `json:"outputs,omitempty"`
+	Environment       Environment              `json:"environment,omitempty"`
+	Security          Security                 `json:"security,omitempty"`
+	Validation        Validation               `json:"validation,omitempty"`
+	TemplateFunctions map[string]TemplateMacro `json:"template_functions,omitempty"`
+	Extensions        Extensions               `json:"extensions,omitempty"`
 }
 
 // AgentInfo contains basic agent metadata
 type AgentInfo struct {
-	Name          string   `json:"name" validate:"required"`
-	Description   string   `json:"description" validate:"required"`
-	Version       string   `json:"version"`
-	Goals         []string `json:"goals,omitempty"`
-	Capabilities  []string `json:"capabilities,omitempty"`
-	MaxIterations int      `json:"max_iterations"`
-	Timeout       string   `json:"timeout"`
-	Interactive   bool     `json:"interactive"`
+	Name            string   `json:"name" validate:"required"`
+	Description     string   `json:"description" validate:"required"`
+	Version         string   `json:"version"`
+	Goals           []string `json:"goals,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+	MaxIterations   int      `json:"max_iterations"`
+	Timeout         string   `json:"timeout"`
+	Interactive     bool     `json:"interactive"`
+	PromptsDir      string   `json:"prompts_dir,omitempty"`      // Managed prompts for prompt_ref, default "prompts"
+	StrictTemplates bool     `json:"strict_templates,omitempty"` // Fail steps whose templates have unresolved references
 }
 
 // LLMConfig contains LLM provider configuration
@@ -42,6 +46,7 @@ type LLMConfig struct {
 	MaxTokens         int                    `json:"max_tokens"`
 	SystemPrompt      string                 `json:"system_prompt,omitempty"`
 	SpecializedModels map[string]string      `json:"specialized_models,omitempty"`
+	ContextStrategy   string                 `json:"context_strategy,omitempty"` // truncate, summarize, drop_oldest or none
 	ProviderConfig    map[string]interface{} `json:"provider_config,omitempty"`
 	APIKey            string                 `json:"api_key,omitempty"` // Can be set directly or via environment variable
 }
@@ -128,6 +133,33 @@ type OutputSpec struct {
 	Template    string `json:"template,omitempty"`
 }
 
+// TemplateMacro is a reusable template snippet called like a function:
+// {jira_link("ABC-1")} renders Template with the parameter id set to "ABC-1"
+type TemplateMacro struct {
+	Params      []string `json:"params,omitempty"` // a trailing "?" marks a parameter optional
+	Template    string   `json:"template" validate:"required"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Extensions declares transformers and step types implemented by external
+// executables that speak the JSON protocol described in external.go
+type Extensions struct {
+	Transformers map[string]ExternalCommand `json:"transformers,omitempty"`
+	Steps        map[string]ExternalCommand `json:"steps,omitempty"`
+}
+
+// ExternalCommand is an executable run once per transform or step. Only the
+// variables named in Env are passed through from the agent's environment,
+// besides PATH.
+type ExternalCommand struct {
+	Command     string   `json:"command" validate:"required"`
+	Args        []string `json:"args,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"` // default 30s
+	Env         []string `json:"env,omitempty"`
+	WorkDir     string   `json:"work_dir,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
 // Tool defines a tool configuration
 type Tool struct {
 	Enabled     bool                   `json:"enabled"`
@@ -182,6 +214,7 @@ type Security struct {
 	AllowedPaths    []string `json:"allowed_paths,omitempty"`
 	BlockedPaths    []string `json:"blocked_paths,omitempty"`
 	AllowedCommands []string `json:"allowed_commands,omitempty"`
+	AllowedHosts    []string `json:"allowed_hosts,omitempty"`
 	RequireApproval bool     `json:"require_approval"`
 	MaxFileSize     string   `json:"max_file_size"`
 }
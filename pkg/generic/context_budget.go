@@ -0,0 +1,346 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Context strategies applied when a rendered prompt does not fit the model
+const (
+	ContextStrategyTruncate   = "truncate"    // shorten the largest template insertions
+	ContextStrategySummarize  = "summarize"   // map-reduce summarize the largest insertions
+	ContextStrategyDropOldest = "drop_oldest" // drop the oldest chat turns
+	ContextStrategyNone       = "none"        // fail before sending the request
+)
+
+const (
+	// charsPerToken matches the estimate used by LLMClient.EstimateTokens
+	charsPerToken = 4
+
+	// minShrinkableChars is the smallest insertion worth truncating or summarizing
+	minShrinkableChars = 256
+
+	// maxSummaryDepth bounds the reduce passes over chunk summaries
+	maxSummaryDepth = 3
+)
+
+// promptPart is one message being assembled for the LLM. Templated parts keep
+// their expanded template and insertions so the budgeter can shrink what was
+// inserted and render again; history parts are earlier chat turns that may be
+// dropped.
+type promptPart struct {
+	Role       string
+	Content    string
+	Template   string
+	Insertions []TemplateInsertion
+	History    bool
+}
+
+// render returns the part's message with its current insertions
+func (p *promptPart) render() Message {
+	if p.Template == "" {
+		return Message{Role: p.Role, Content: p.Content}
+	}
+	return Message{Role: p.Role, Content: SubstituteInsertions(p.Template, p.Insertions)}
+}
+
+// renderParts renders all parts into messages
+func renderParts(parts []*promptPart) []Message {
+	messages := make([]Message, len(parts))
+	for i, part := range parts {
+		messages[i] = part.render()
+	}
+	return messages
+}
+
+// templatedPart resolves a template into a part
+func (we *WorkflowEngine) templatedPart(step Step, role, template string, previousResults map[string]*StepResult, execCtx *ExecutionContext) (*promptPart, error) {
+	expanded, insertions, err := we.stepTemplates(step).ResolveInsertions(template, previousResults, execCtx)
+	if err != nil {
+		return nil, err
+	}
+	return &promptPart{Role: role, Template: expanded, Insertions: insertions}, nil
+}
+
+// contextBudgeter fits a step's prompt into its model's context window
+type contextBudgeter struct {
+	client   *LLMClient
+	step     string
+	strategy string
+	limit    int // tokens available for the prompt
+	execCtx  *ExecutionContext
+	logger   *slog.Logger
+}
+
+// newContextBudgeter reads the step's context_budget, which is either a
+// strategy name or an object with strategy, max_tokens (the context window)
+// and reserve_tokens (room kept for the reply, default the client's
+// max_tokens). It returns nil when the context window is unknown.
+func (we *WorkflowEngine) newContextBudgeter(step Step, client *LLMClient, execCtx *ExecutionContext, defaultStrategy string) (*contextBudgeter, error) {
+	strategy := client.config.ContextStrategy
+	if strategy == "" {
+		strategy = defaultStrategy
+	}
+	window := 0
+	reserve := client.config.MaxTokens
+
+	switch budget := step.Config["context_budget"].(type) {
+	case string:
+		strategy = budget
+	case map[string]interface{}:
+		if value, ok := budget["strategy"].(string); ok && value != "" {
+			strategy = value
+		}
+		if value, ok := budget["max_tokens"].(float64); ok {
+			window = int(value)
+		}
+		if value, ok := budget["reserve_tokens"].(float64); ok {
+			reserve = int(value)
+		}
+	}
+
+	switch strategy {
+	case ContextStrategyTruncate, ContextStrategySummarize, ContextStrategyDropOldest, ContextStrategyNone:
+	default:
+		return nil, fmt.Errorf("unknown context strategy %q", strategy)
+	}
+
+	if window == 0 {
+		window = client.ModelInfo().MaxTokens
+	}
+	if window <= 0 {
+		we.logger.Debug("Context window unknown, skipping context budget", "step", step.Name, "model", client.config.Model)
+		return nil, nil
+	}
+
+	limit := window - reserve
+	if limit <= 0 {
+		return nil, fmt.Errorf("step %s reserves %d tokens for the reply, leaving no room for the prompt in the %d-token context window",
+			step.Name, reserve, window)
+	}
+
+	return &contextBudgeter{
+		client:   client,
+		step:     step.Name,
+		strategy: strategy,
+		limit:    limit,
+		execCtx:  execCtx,
+		logger:   we.logger,
+	}, nil
+}
+
+// fit renders the parts, shrinking them with the configured strategy until
+// the estimated prompt fits. Strategies that run out of material to cut fall
+// back to truncation before giving up.
+func (cb *contextBudgeter) fit(ctx context.Context, parts []*promptPart) ([]Message, error) {
+	messages := renderParts(parts)
+	used := cb.client.EstimateTokens(messages)
+	if used <= cb.limit {
+		return messages, nil
+	}
+
+	cb.logger.Warn("Prompt exceeds the context budget",
+		"step", cb.step,
+		"estimated_tokens", used,
+		"budget_tokens", cb.limit,
+		"strategy", cb.strategy)
+
+	switch cb.strategy {
+	case ContextStrategyNone:
+		return nil, cb.overBudgetError(used)
+	case ContextStrategyDropOldest:
+		parts = cb.dropOldest(parts)
+	case ContextStrategySummarize:
+		if err := cb.summarize(ctx, parts); err != nil {
+			return nil, err
+		}
+	}
+
+	return cb.truncate(parts)
+}
+
+// dropOldest removes earlier chat turns, oldest first, until the prompt fits.
+// A system message that opened the thread is kept.
+func (cb *contextBudgeter) dropOldest(parts []*promptPart) []*promptPart {
+	dropped := 0
+	for cb.client.EstimateTokens(renderParts(parts)) > cb.limit {
+		index := -1
+		for i, part := range parts {
+			if part.History && part.Role != "system" {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			break
+		}
+		parts = append(parts[:index:index], parts[index+1:]...)
+		dropped++
+	}
+
+	if dropped > 0 {
+		cb.logger.Warn("Dropped oldest chat messages to fit the context window", "step", cb.step, "dropped_messages", dropped)
+	}
+	return parts
+}
+
+// summarize replaces the largest insertions with summaries, largest first,
+// until the prompt fits or nothing large is left
+func (cb *contextBudgeter) summarize(ctx context.Context, parts []*promptPart) error {
+	for _, target := range shrinkableInsertions(parts) {
+		if cb.client.EstimateTokens(renderParts(parts)) <= cb.limit {
+			return nil
+		}
+
+		original := target.Value
+		summary, err := cb.summarizeText(ctx, original, 0)
+		if err != nil {
+			return fmt.Errorf("failed to summarize {%s} to fit the context window: %w", target.Expression, err)
+		}
+		if len(summary) >= len(original) {
+			continue
+		}
+		target.Value = summary
+
+		cb.logger.Warn("Summarized template insertion to fit the context window",
+			"step", cb.step,
+			"expression", target.Expression,
+			"original_tokens", len(original)/charsPerToken,
+			"summary_tokens", len(summary)/charsPerToken)
+	}
+	return nil
+}
+
+// summarizeText summarizes text in chunks that fit the budget, then
+// summarizes the joined chunk summaries again while they are still too long
+func (cb *contextBudgeter) summarizeText(ctx context.Context, text string, depth int) (string, error) {
+	chunkChars := cb.limit * charsPerToken / 2
+	chunks := splitText(text, chunkChars)
+
+	summaries := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		prompt := fmt.Sprintf("Summarize part %d of %d of the following content. Keep names, numbers, file paths "+
+			"and other specifics that a later reader may need; drop repetition and boilerplate.\n\n%s", i+1, len(chunks), chunk)
+
+		response, err := cb.client.Complete(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		cb.execCtx.Metrics.LLMTokensUsed += response.TokensUsed
+		cb.execCtx.Metrics.LLMCost += response.Cost
+
+		summaries = append(summaries, strings.TrimSpace(response.Content))
+	}
+
+	summary := strings.Join(summaries, "\n\n")
+	if len(summary) > chunkChars && len(chunks) > 1 && depth < maxSummaryDepth {
+		return cb.summarizeText(ctx, summary, depth+1)
+	}
+	return summary, nil
+}
+
+// truncate shortens the largest insertion until the prompt fits, moving on to
+// the next largest when one has been cut as far as it can go
+func (cb *contextBudgeter) truncate(parts []*promptPart) ([]Message, error) {
+	for {
+		messages := renderParts(parts)
+		used := cb.client.EstimateTokens(messages)
+		if used <= cb.limit {
+			return messages, nil
+		}
+
+		candidates := shrinkableInsertions(parts)
+		if len(candidates) == 0 {
+			return nil, cb.overBudgetError(used)
+		}
+		target := candidates[0]
+
+		original := target.Value
+		excessChars := (used-cb.limit)*charsPerToken + charsPerToken
+		target.Value = truncateText(original, len(original)-excessChars)
+
+		cb.logger.Warn("Truncated template insertion to fit the context window",
+			"step", cb.step,
+			"expression", target.Expression,
+			"original_tokens", len(original)/charsPerToken,
+			"kept_tokens", len(target.Value)/charsPerToken)
+	}
+}
+
+func (cb *contextBudgeter) overBudgetError(used int) error {
+	return fmt.Errorf("prompt for step %s needs about %d tokens but only %d fit in the context window of %s",
+		cb.step, used, cb.limit, cb.client.config.Model)
+}
+
+// shrinkableInsertions returns the insertions of the current turn that are
+// large enough to shrink, largest first
+func shrinkableInsertions(parts []*promptPart) []*TemplateInsertion {
+	var insertions []*TemplateInsertion
+	for _, part := range parts {
+		if part.History {
+			continue
+		}
+		for i := range part.Insertions {
+			if len(part.Insertions[i].Value) >= minShrinkableChars {
+				insertions = append(insertions, &part.Insertions[i])
+			}
+		}
+	}
+
+	sort.SliceStable(insertions, func(i, j int) bool {
+		return len(insertions[i].Value) > len(insertions[j].Value)
+	})
+	return insertions
+}
+
+// truncateText keeps the first keep bytes of text, cut at a line or rune
+// boundary, and notes how much was removed
+func truncateText(text string, keep int) string {
+	marker := "\n... [%d characters truncated to fit the context window]"
+	keep -= len(marker) + 8
+	if keep < 0 {
+		keep = 0
+	}
+	if keep >= len(text) {
+		return text
+	}
+
+	cut := keep
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if newline := strings.LastIndex(text[:cut], "\n"); newline > cut/2 {
+		cut = newline
+	}
+
+	return text[:cut] + fmt.Sprintf(marker, len(text)-cut)
+}
+
+// splitText splits text into chunks of at most size bytes, preferring line
+// boundaries
+func splitText(text string, size int) []string {
+	if size <= 0 || len(text) <= size {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(text) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if newline := strings.LastIndex(text[:cut], "\n"); newline > cut/2 {
+			cut = newline + 1
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
@@ -0,0 +1,194 @@
+package generic
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBudgetTestEngine(t *testing.T, serverURL string) *WorkflowEngine {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	toolRegistry, _ := NewToolRegistry(map[string]Tool{}, &Security{Enabled: false}, logger)
+	validator, _ := NewValidator(Validation{Enabled: false}, logger)
+
+	engine, err := NewWorkflowEngine([]Workflow{}, toolRegistry, newTestLLMClient(t, serverURL), validator, logger)
+	if err != nil {
+		t.Fatalf("Failed to create workflow engine: %v", err)
+	}
+	return engine
+}
+
+func newBudgetTestContext(data map[string]interface{}) *ExecutionContext {
+	return &ExecutionContext{
+		Context:     context.Background(),
+		SessionID:   "test-session",
+		StartTime:   time.Now(),
+		Data:        data,
+		Variables:   make(map[string]string),
+		StepResults: make(map[string]*StepResult),
+		Metrics:     &ExecutionMetrics{},
+	}
+}
+
+func TestContextBudgetLLMStep(t *testing.T) {
+	diff := strings.Repeat("+ added a line to the diff\n", 400)
+	notes := strings.Repeat("note ", 100)
+
+	tests := []struct {
+		name             string
+		budget           map[string]interface{}
+		expectError      bool
+		expectedRequests int
+		expectInPrompt   string
+	}{
+		{
+			name:             "fits",
+			budget:           map[string]interface{}{"max_tokens": 100000.0, "reserve_tokens": 0.0},
+			expectedRequests: 1,
+			expectInPrompt:   diff,
+		},
+		{
+			name:             "truncate",
+			budget:           map[string]interface{}{"strategy": "truncate", "max_tokens": 600.0, "reserve_tokens": 100.0},
+			expectedRequests: 1,
+			expectInPrompt:   "characters truncated to fit the context window",
+		},
+		{
+			name:             "summarize",
+			budget:           map[string]interface{}{"strategy": "summarize", "max_tokens": 600.0, "reserve_tokens": 100.0},
+			expectedRequests: 12, // 11 chunk summaries and the step itself
+			expectInPrompt:   "Review:\nsummary\n\nsummary",
+		},
+		{
+			name:        "none",
+			budget:      map[string]interface{}{"strategy": "none", "max_tokens": 600.0, "reserve_tokens": 100.0},
+			expectError: true,
+		},
+		{
+			name:        "reserve exceeds window",
+			budget:      map[string]interface{}{"max_tokens": 600.0, "reserve_tokens": 600.0},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newChatTestServer(t, "summary", &requests)
+			defer server.Close()
+
+			engine := newBudgetTestEngine(t, server.URL)
+			execCtx := newBudgetTestContext(map[string]interface{}{"diff": diff, "notes": notes})
+
+			step := Step{Name: "review", Type: "llm", Config: map[string]interface{}{
+				"prompt":         "Review:\n{diff}\nNotes: {notes}",
+				"context_budget": tt.budget,
+			}}
+			_, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult))
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				if len(requests) != 0 {
+					t.Errorf("Expected no request to be sent, got %d", len(requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(requests) != tt.expectedRequests {
+				t.Fatalf("Expected %d requests, got %d", tt.expectedRequests, len(requests))
+			}
+			messages, _ := requests[len(requests)-1]["messages"].([]interface{})
+			user, _ := messages[len(messages)-1].(map[string]interface{})
+			content, _ := user["content"].(string)
+
+			if !strings.Contains(content, tt.expectInPrompt) {
+				t.Errorf("Expected prompt to contain %q, got %q", tt.expectInPrompt, content)
+			}
+			if !strings.Contains(content, notes) {
+				t.Error("Expected the smaller insertion to be kept intact")
+			}
+			if limit := 600 - 100; tt.name != "fits" && (len(content)+14)/4 > limit {
+				t.Errorf("Expected prompt within %d tokens, got about %d", limit, (len(content)+14)/4)
+			}
+		})
+	}
+}
+
+func TestContextBudgetChatDropsOldest(t *testing.T) {
+	var requests []map[string]interface{}
+	server := newChatTestServer(t, "ok", &requests)
+	defer server.Close()
+
+	engine := newBudgetTestEngine(t, server.URL)
+	execCtx := newBudgetTestContext(make(map[string]interface{}))
+
+	turn := strings.Repeat("word ", 200)
+	execCtx.conversations().Append("review",
+		Message{Role: "system", Content: "You review code."},
+		Message{Role: "user", Content: "first " + turn},
+		Message{Role: "assistant", Content: "second " + turn},
+		Message{Role: "user", Content: "third " + turn},
+		Message{Role: "assistant", Content: "fourth " + turn},
+	)
+
+	step := Step{Name: "review", Type: "chat", Config: map[string]interface{}{
+		"prompt":         "Anything else?",
+		"context_budget": map[string]interface{}{"max_tokens": 700.0, "reserve_tokens": 100.0},
+	}}
+	if _, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	messages, _ := requests[0]["messages"].([]interface{})
+	var sent []string
+	for _, raw := range messages {
+		message, _ := raw.(map[string]interface{})
+		content, _ := message["content"].(string)
+		sent = append(sent, strings.Fields(content)[0])
+	}
+
+	expected := []string{"You", "third", "fourth", "Anything"}
+	if strings.Join(sent, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected messages starting %v, got %v", expected, sent)
+	}
+
+	// The stored thread keeps the full history plus the new turn
+	if count := len(execCtx.conversations().Messages("review")); count != 7 {
+		t.Errorf("Expected 7 stored messages, got %d", count)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	text := strings.Repeat("line of text\n", 100)
+
+	truncated := truncateText(text, 500)
+	if len(truncated) > 500 {
+		t.Errorf("Expected at most 500 bytes, got %d", len(truncated))
+	}
+	if !strings.HasPrefix(text, strings.SplitN(truncated, "\n...", 2)[0]) {
+		t.Error("Expected truncation to keep the start of the text")
+	}
+	if truncateText("short", 500) != "short" {
+		t.Error("Expected text within the limit to be unchanged")
+	}
+
+	chunks := splitText(text, 200)
+	if strings.Join(chunks, "") != text {
+		t.Error("Expected chunks to reassemble into the original text")
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > 200 {
+			t.Errorf("Expected chunks of at most 200 bytes, got %d", len(chunk))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package generic
+
+import "sync"
+
+// ConversationStore holds named chat threads so chat steps can continue a
+// conversation across steps and loop iterations
+type ConversationStore struct {
+	threads map[string][]Message
+	mu      sync.RWMutex
+}
+
+// NewConversationStore creates an empty conversation store
+func NewConversationStore() *ConversationStore {
+	return &ConversationStore{
+		threads: make(map[string][]Message),
+	}
+}
+
+// Messages returns a copy of the messages in a thread
+func (cs *ConversationStore) Messages(thread string) []Message {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	messages := make([]Message, len(cs.threads[thread]))
+	copy(messages, cs.threads[thread])
+	return messages
+}
+
+// Append adds messages to the end of a thread, creating it if needed
+func (cs *ConversationStore) Append(thread string, messages ...Message) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.threads[thread] = append(cs.threads[thread], messages...)
+}
+
+// Reset clears a thread
+func (cs *ConversationStore) Reset(thread string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	delete(cs.threads, thread)
+}
+
+// Threads returns the names of all threads with messages
+func (cs *ConversationStore) Threads() []string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	names := make([]string, 0, len(cs.threads))
+	for name := range cs.threads {
+		names = append(names, name)
+	}
+	return names
+}
+
+// conversations returns the context's conversation store, creating it on
+// first use for contexts built without one
+func (ec *ExecutionContext) conversations() *ConversationStore {
+	if ec.Conversations == nil {
+		ec.Conversations = NewConversationStore()
+	}
+	return ec.Conversations
+}
@@ -429,7 +429,8 @@ func (di *DataIngestor) GetEmbeddingDataSources() map[string]*embedding.Embeddin
 
 // applyValidation validates data
 func (di *DataIngestor) applyValidation(data interface{}, config map[string]interface{}) (interface{}, error) {
-	// Simple validation - could check format, schema, etc.
+	// Simple validation - could check format, schema, etc. Structured formats
+	// are parsed, taking parser options such as delimiter from the same config
 	if format, ok := config["format"].(string); ok {
 		if dataStr, ok := data.(string); ok {
 			switch format {
@@ -439,6 +440,12 @@ func (di *DataIngestor) applyValidation(data interface{}, config map[string]inte
 					return nil, fmt.Errorf("invalid JSON: %w", err)
 				}
 				return temp, nil
+			case "csv", "yaml", "xml":
+				parser := map[string]Transformer{"csv": &CSVParser{}, "yaml": &YAMLParser{}, "xml": &XMLParser{}}[format]
+				if err := parser.ValidateParams(config); err != nil {
+					return nil, fmt.Errorf("invalid %s options: %w", format, err)
+				}
+				return parser.Transform(dataStr, config)
 			}
 		}
 	}
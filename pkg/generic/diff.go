@@ -0,0 +1,444 @@
+package generic
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Unified diffs
+//
+// parseUnifiedDiff reads git and plain unified diffs, including the loosely
+// formatted ones LLMs write: text around the diff, such as a Markdown fence
+// or an explanation, is ignored, hunk headers may leave out line numbers
+// ("@@ ... @@"), and the line counts in hunk headers are not trusted.
+
+// diffFile is the change to one file
+type diffFile struct {
+	OldPath string
+	NewPath string
+	Status  string // modified, added, deleted or renamed
+	Binary  bool
+	Hunks   []*diffHunk
+}
+
+// diffHunk is a run of changed lines with its context. OldStart and NewStart
+// are 0 when the header has no line numbers.
+type diffHunk struct {
+	OldStart int
+	NewStart int
+	Section  string
+	Lines    []diffLine
+	oldCount int // counts from the header, or -1
+	newCount int
+}
+
+// diffLine is a context (' '), added ('+') or deleted ('-') line
+type diffLine struct {
+	Kind      byte
+	Text      string
+	NoNewline bool // followed by "\ No newline at end of file"
+}
+
+var diffHunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// parseUnifiedDiff splits a unified diff into its files and hunks
+func parseUnifiedDiff(text string) ([]*diffFile, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var files []*diffFile
+	var file *diffFile
+	var hunk *diffHunk
+	fromGitHeader := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		next := ""
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+
+		if hunk != nil {
+			if hunk.accept(line, next) {
+				continue
+			}
+			hunk = nil
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath := splitGitDiffPaths(strings.TrimPrefix(line, "diff --git "))
+			file = &diffFile{OldPath: oldPath, NewPath: newPath, Status: "modified"}
+			if oldPath != newPath {
+				file.Status = "renamed"
+			}
+			files = append(files, file)
+			fromGitHeader = true
+
+		case strings.HasPrefix(line, "--- ") && strings.HasPrefix(next, "+++ "):
+			if file == nil || !fromGitHeader || len(file.Hunks) > 0 {
+				file = &diffFile{Status: "modified"}
+				files = append(files, file)
+			}
+			fromGitHeader = false
+			file.OldPath = diffHeaderPath(strings.TrimPrefix(line, "--- "))
+			file.NewPath = diffHeaderPath(strings.TrimPrefix(next, "+++ "))
+			// Different ---/+++ names alone are not a rename: plain diffs
+			// often compare a copy such as foo.go.orig with foo.go
+			switch {
+			case file.OldPath == "/dev/null":
+				file.Status = "added"
+			case file.NewPath == "/dev/null":
+				file.Status = "deleted"
+			}
+			i++
+
+		case file != nil && strings.HasPrefix(line, "new file mode"):
+			file.Status = "added"
+			file.OldPath = "/dev/null"
+		case file != nil && strings.HasPrefix(line, "deleted file mode"):
+			file.Status = "deleted"
+			file.NewPath = "/dev/null"
+		case file != nil && strings.HasPrefix(line, "rename from "):
+			file.Status = "renamed"
+			file.OldPath = diffHeaderPath(strings.TrimPrefix(line, "rename from "))
+		case file != nil && strings.HasPrefix(line, "rename to "):
+			file.Status = "renamed"
+			file.NewPath = diffHeaderPath(strings.TrimPrefix(line, "rename to "))
+		case file != nil && (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch"):
+			file.Binary = true
+
+		case strings.HasPrefix(line, "@@"):
+			if file == nil {
+				return nil, fmt.Errorf("line %d: hunk without a file header", i+1)
+			}
+			hunk = parseHunkHeader(line)
+			file.Hunks = append(file.Hunks, hunk)
+			fromGitHeader = false
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file changes found in diff")
+	}
+	return files, nil
+}
+
+// parseHunkHeader reads "@@ -1,3 +1,4 @@ func main() {", or a bare "@@ ... @@"
+func parseHunkHeader(line string) *diffHunk {
+	hunk := &diffHunk{oldCount: -1, newCount: -1}
+	match := diffHunkHeader.FindStringSubmatch(line)
+	if match == nil {
+		if end := strings.Index(line[2:], "@@"); end >= 0 {
+			hunk.Section = strings.TrimSpace(strings.TrimLeft(line[2+end:], "@"))
+		}
+		return hunk
+	}
+
+	hunk.OldStart, _ = strconv.Atoi(match[1])
+	hunk.NewStart, _ = strconv.Atoi(match[3])
+	hunk.oldCount, hunk.newCount = 1, 1
+	if match[2] != "" {
+		hunk.oldCount, _ = strconv.Atoi(match[2])
+	}
+	if match[4] != "" {
+		hunk.newCount, _ = strconv.Atoi(match[4])
+	}
+	hunk.Section = match[5]
+	return hunk
+}
+
+// accept adds line to the hunk if it belongs to it
+func (h *diffHunk) accept(line, next string) bool {
+	if strings.HasPrefix(line, `\`) {
+		if len(h.Lines) > 0 {
+			h.Lines[len(h.Lines)-1].NoNewline = true
+		}
+		return true
+	}
+	if strings.HasPrefix(line, "--- ") && strings.HasPrefix(next, "+++ ") {
+		return false
+	}
+
+	if line == "" {
+		// Editors and LLMs often drop the space of an empty context line
+		oldSeen, newSeen := h.counts()
+		if h.oldCount >= 0 {
+			if oldSeen >= h.oldCount && newSeen >= h.newCount {
+				return false
+			}
+		} else if next == "" || !strings.ContainsRune(" +-", rune(next[0])) {
+			return false
+		}
+		h.Lines = append(h.Lines, diffLine{Kind: ' '})
+		return true
+	}
+
+	switch line[0] {
+	case ' ', '+', '-':
+		h.Lines = append(h.Lines, diffLine{Kind: line[0], Text: line[1:]})
+		return true
+	}
+	return false
+}
+
+// counts returns the number of old and new lines in the hunk
+func (h *diffHunk) counts() (oldLines, newLines int) {
+	for _, line := range h.Lines {
+		if line.Kind != '+' {
+			oldLines++
+		}
+		if line.Kind != '-' {
+			newLines++
+		}
+	}
+	return oldLines, newLines
+}
+
+// splitGitDiffPaths splits the "a/old b/new" part of a diff --git line
+func splitGitDiffPaths(paths string) (string, string) {
+	if strings.HasPrefix(paths, `"`) {
+		if oldPath, rest, ok := cutQuotedPath(paths); ok {
+			return oldPath, diffHeaderPath(strings.TrimSpace(rest))
+		}
+	}
+	if i := strings.LastIndex(paths, " b/"); i >= 0 {
+		return diffHeaderPath(paths[:i]), diffHeaderPath(paths[i+1:])
+	}
+	if oldPath, newPath, ok := strings.Cut(paths, " "); ok {
+		return diffHeaderPath(oldPath), diffHeaderPath(newPath)
+	}
+	return diffHeaderPath(paths), diffHeaderPath(paths)
+}
+
+func cutQuotedPath(text string) (string, string, bool) {
+	for i := 1; i < len(text); i++ {
+		if text[i] == '\\' {
+			i++
+			continue
+		}
+		if text[i] == '"' {
+			return diffHeaderPath(text[:i+1]), text[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// diffHeaderPath cleans a path from a diff header: quotes, a trailing
+// timestamp and the a/ or b/ prefix are removed
+func diffHeaderPath(path string) string {
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, `"`) {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+	} else if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab]
+	}
+	if path == "/dev/null" {
+		return path
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// DiffParser turns a unified diff into a list of files with their hunks and
+// lines, for prompts or conditions that need to look at individual changes
+type DiffParser struct{}
+
+func (dp *DiffParser) Name() string { return "parse_diff" }
+func (dp *DiffParser) Description() string {
+	return "Parse a unified diff into files, hunks and lines"
+}
+
+func (dp *DiffParser) ValidateParams(params map[string]interface{}) error {
+	return nil
+}
+
+// Transform returns one map per file with old_path, new_path, path, status,
+// binary, additions, deletions and hunks; each hunk has old_start,
+// old_lines, new_start, new_lines, section and lines of type context, add
+// or delete with their old_line and new_line numbers
+func (dp *DiffParser) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := parseUnifiedDiff(inputStr)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, len(files))
+	for i, file := range files {
+		result[i] = file.toMap()
+	}
+	return result, nil
+}
+
+func (f *diffFile) toMap() map[string]interface{} {
+	path := f.NewPath
+	if f.Status == "deleted" {
+		path = f.OldPath
+	}
+
+	additions, deletions := 0, 0
+	hunks := make([]interface{}, len(f.Hunks))
+	for i, hunk := range f.Hunks {
+		oldLines, newLines := hunk.counts()
+		oldLine, newLine := hunk.OldStart, hunk.NewStart
+		lines := make([]interface{}, len(hunk.Lines))
+		for j, line := range hunk.Lines {
+			entry := map[string]interface{}{"content": line.Text}
+			switch line.Kind {
+			case '+':
+				additions++
+				entry["type"] = "add"
+				entry["new_line"] = newLine
+				newLine++
+			case '-':
+				deletions++
+				entry["type"] = "delete"
+				entry["old_line"] = oldLine
+				oldLine++
+			default:
+				entry["type"] = "context"
+				entry["old_line"] = oldLine
+				entry["new_line"] = newLine
+				oldLine++
+				newLine++
+			}
+			if hunk.OldStart == 0 && hunk.NewStart == 0 {
+				delete(entry, "old_line")
+				delete(entry, "new_line")
+			}
+			lines[j] = entry
+		}
+
+		hunks[i] = map[string]interface{}{
+			"old_start": hunk.OldStart,
+			"old_lines": oldLines,
+			"new_start": hunk.NewStart,
+			"new_lines": newLines,
+			"section":   hunk.Section,
+			"lines":     lines,
+		}
+	}
+
+	return map[string]interface{}{
+		"old_path":  f.OldPath,
+		"new_path":  f.NewPath,
+		"path":      path,
+		"status":    f.Status,
+		"binary":    f.Binary,
+		"additions": additions,
+		"deletions": deletions,
+		"hunks":     hunks,
+	}
+}
+
+// diffContextLines is the number of unchanged lines around each change in
+// the diffs unifiedDiff writes
+const diffContextLines = 3
+
+// lineEncoder returns a function mapping each distinct line to a rune, so
+// go-diff's rune diffs compare whole lines
+func lineEncoder() func(lines []string) []rune {
+	ids := make(map[string]rune)
+	return func(lines []string) []rune {
+		runes := make([]rune, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = rune(len(ids) + 1)
+				ids[line] = id
+			}
+			runes[i] = id
+		}
+		return runes
+	}
+}
+
+// unifiedDiff writes a unified diff of a file's lines, or "" when they are
+// the same, and counts the lines it adds and removes
+func unifiedDiff(path string, oldLines, newLines []string) (diff string, added, removed int) {
+	encode := lineEncoder()
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMainRunes(encode(oldLines), encode(newLines), false)
+
+	var ops []diffLine
+	oldIndex, newIndex := 0, 0
+	for _, d := range diffs {
+		for range []rune(d.Text) {
+			switch d.Type {
+			case diffmatchpatch.DiffInsert:
+				ops = append(ops, diffLine{Kind: '+', Text: newLines[newIndex]})
+				newIndex++
+			case diffmatchpatch.DiffDelete:
+				ops = append(ops, diffLine{Kind: '-', Text: oldLines[oldIndex]})
+				oldIndex++
+			default:
+				ops = append(ops, diffLine{Kind: ' ', Text: oldLines[oldIndex]})
+				oldIndex++
+				newIndex++
+			}
+		}
+	}
+
+	// Line numbers before each op
+	oldAt := make([]int, len(ops)+1)
+	newAt := make([]int, len(ops)+1)
+	var changes []int
+	for i, op := range ops {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		switch op.Kind {
+		case '+':
+			newAt[i+1]++
+			added++
+		case '-':
+			oldAt[i+1]++
+			removed++
+		default:
+			oldAt[i+1]++
+			newAt[i+1]++
+		}
+		if op.Kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return "", 0, 0
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+	for i := 0; i < len(changes); {
+		begin := max(changes[i]-diffContextLines, 0)
+		end := min(changes[i]+diffContextLines+1, len(ops))
+		for i++; i < len(changes) && changes[i]-diffContextLines <= end; i++ {
+			end = min(changes[i]+diffContextLines+1, len(ops))
+		}
+
+		oldCount, newCount := oldAt[end]-oldAt[begin], newAt[end]-newAt[begin]
+		oldStart, newStart := oldAt[begin], newAt[begin]
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, op := range ops[begin:end] {
+			b.WriteByte(op.Kind)
+			b.WriteString(op.Text)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), added, removed
+}
@@ -0,0 +1,171 @@
+package generic
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const gitDiffSample = `diff --git a/main.go b/main.go
+index 3b18e51..a9c2f4e 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,6 @@ package main
+ package main
+
+-import "fmt"
++import (
++	"fmt"
++)
+
+ func main() {
+diff --git a/old.txt b/new.txt
+similarity index 100%
+rename from old.txt
+rename to new.txt
+diff --git a/notes.md b/notes.md
+new file mode 100644
+--- /dev/null
++++ b/notes.md
+@@ -0,0 +1,2 @@
++# Notes
++Remember the milk
+\ No newline at end of file
+diff --git a/logo.png b/logo.png
+Binary files a/logo.png and b/logo.png differ
+`
+
+func TestParseDiff(t *testing.T) {
+	transformer := &DiffParser{}
+	output, err := transformer.Transform(gitDiffSample, nil)
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	files := output.([]interface{})
+	if len(files) != 4 {
+		t.Fatalf("Expected 4 files, got %d", len(files))
+	}
+
+	tests := []struct {
+		index     int
+		path      string
+		status    string
+		binary    bool
+		additions int
+		deletions int
+		hunks     int
+	}{
+		{0, "main.go", "modified", false, 3, 1, 1},
+		{1, "new.txt", "renamed", false, 0, 0, 0},
+		{2, "notes.md", "added", false, 2, 0, 1},
+		{3, "logo.png", "modified", true, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		file := files[tt.index].(map[string]interface{})
+		if file["path"] != tt.path || file["status"] != tt.status || file["binary"] != tt.binary {
+			t.Errorf("File %d: got path %v status %v binary %v", tt.index, file["path"], file["status"], file["binary"])
+		}
+		if file["additions"] != tt.additions || file["deletions"] != tt.deletions {
+			t.Errorf("File %d: got +%v -%v, expected +%d -%d", tt.index, file["additions"], file["deletions"], tt.additions, tt.deletions)
+		}
+		if hunks := file["hunks"].([]interface{}); len(hunks) != tt.hunks {
+			t.Errorf("File %d: expected %d hunks, got %d", tt.index, tt.hunks, len(hunks))
+		}
+	}
+
+	if renamed := files[1].(map[string]interface{}); renamed["old_path"] != "old.txt" {
+		t.Errorf("Expected rename from old.txt, got %v", renamed["old_path"])
+	}
+
+	hunk := files[0].(map[string]interface{})["hunks"].([]interface{})[0].(map[string]interface{})
+	if hunk["section"] != "package main" || hunk["old_lines"] != 5 || hunk["new_lines"] != 7 {
+		t.Errorf("Unexpected hunk header fields: %v", hunk)
+	}
+	lines, _ := json.Marshal(hunk["lines"].([]interface{})[2:4])
+	expected := `[{"content":"import \"fmt\"","old_line":3,"type":"delete"},{"content":"import (","new_line":3,"type":"add"}]`
+	if string(lines) != expected {
+		t.Errorf("Unexpected lines:\n got %s\nwant %s", lines, expected)
+	}
+}
+
+func TestParseDiffLooseInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		path     string
+		oldLines int
+		newLines int
+		wantErr  bool
+	}{
+		{
+			name:     "fenced LLM reply without line numbers",
+			input:    "Here is the fix:\n\n```diff\n--- a/app.py\n+++ b/app.py\n@@ ... @@\n def run():\n-    return 1\n+    return 2\n```\n\nThis changes the return value.",
+			path:     "app.py",
+			oldLines: 2,
+			newLines: 2,
+		},
+		{
+			name:     "wrong counts and a blank context line",
+			input:    "--- app.py\t2024-01-01\n+++ app.py\t2024-01-02\n@@ -1,2 +1,2 @@\n a = 1\n\n-b = 2\n+b = 3\n c = 4\n",
+			path:     "app.py",
+			oldLines: 4,
+			newLines: 4,
+		},
+		{
+			name:    "no diff",
+			input:   "nothing to see here",
+			wantErr: true,
+		},
+		{
+			name:    "hunk without file",
+			input:   "@@ -1 +1 @@\n-a\n+b\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parseUnifiedDiff(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %d files", len(files))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseUnifiedDiff failed: %v", err)
+			}
+			if len(files) != 1 || files[0].NewPath != tt.path || len(files[0].Hunks) != 1 {
+				t.Fatalf("Unexpected files: %+v", files)
+			}
+			oldLines, newLines := files[0].Hunks[0].counts()
+			if oldLines != tt.oldLines || newLines != tt.newLines {
+				t.Errorf("Expected %d/%d lines, got %d/%d", tt.oldLines, tt.newLines, oldLines, newLines)
+			}
+		})
+	}
+}
+
+func TestParseDiffRenames(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		status  string
+		oldPath string
+	}{
+		{"plain diff against a backup", "--- main.go.orig\n+++ main.go\n@@ -1 +1 @@\n-a\n+b\n", "modified", "main.go.orig"},
+		{"git header with different names", "diff --git a/old.go b/new.go\n--- a/old.go\n+++ b/new.go\n@@ -1 +1 @@\n-a\n+b\n", "renamed", "old.go"},
+		{"git rename headers", "diff --git a/old.go b/new.go\nsimilarity index 90%\nrename from old.go\nrename to new.go\n", "renamed", "old.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := parseUnifiedDiff(tt.input)
+			if err != nil {
+				t.Fatalf("parseUnifiedDiff failed: %v", err)
+			}
+			if files[0].Status != tt.status || files[0].OldPath != tt.oldPath {
+				t.Errorf("Expected status %s from %s, got %s from %s", tt.status, tt.oldPath, files[0].Status, files[0].OldPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// edit_file changes parts of one file. Each edit is one of:
+//
+//	{"old_text": "...", "new_text": "..."}            replace text that occurs exactly once,
+//	                                                  or everywhere with "replace_all": true
+//	{"start_line": 10, "end_line": 12, "new_text": ...} replace lines 10-12; without
+//	                                                  new_text the lines are deleted
+//	{"insert_line": 5, "new_text": "..."}             insert before line 5; one past the
+//	                                                  last line appends
+//
+// Line numbers and search text refer to the file as it was before the call,
+// so several edits can be computed from one read of it. Edits may not
+// overlap. Either every edit applies or the file is left alone; the old
+// content is copied to <path>.backup unless "backup": false, and the new
+// content replaces the file in one rename. The result includes a unified
+// diff of the change.
+
+// fileEdit is an edit resolved to a span of the original text
+type fileEdit struct {
+	index      int
+	start, end int
+	text       string
+}
+
+func (tr *ToolRegistry) executeEditFile(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	path, ok := params["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("path parameter is required and must be a string")
+	}
+	if err := tr.validateFilePath(path); err != nil {
+		return nil, fmt.Errorf("path validation failed: %w", err)
+	}
+	dryRun, err := boolParam(params, "dry_run", false)
+	if err != nil {
+		return nil, err
+	}
+	backup, err := boolParam(params, "backup", true)
+	if err != nil {
+		return nil, err
+	}
+
+	edits, err := editsParam(params)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s (use write_file to create files): %w", path, err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	crlf := strings.Contains(string(content), "\r\n")
+	original := strings.ReplaceAll(string(content), "\r\n", "\n")
+
+	var spans []fileEdit
+	for i, edit := range edits {
+		resolved, err := resolveFileEdit(original, i+1, edit)
+		if err != nil {
+			return nil, fmt.Errorf("edit %d: %w", i+1, err)
+		}
+		spans = append(spans, resolved...)
+	}
+	// Inserts go before a replacement starting at the same offset, so an
+	// insert_line and a start_line naming the same line work in either order
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].start == spans[i].end && spans[j].start != spans[j].end
+	})
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			return nil, fmt.Errorf("edits %d and %d overlap", spans[i-1].index, spans[i].index)
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(original[last:span.start])
+		b.WriteString(span.text)
+		last = span.end
+	}
+	b.WriteString(original[last:])
+	updated := b.String()
+
+	diff, added, removed := unifiedDiff(path, splitEditLines(original), splitEditLines(updated))
+
+	result := map[string]interface{}{
+		"path":          path,
+		"edits":         len(spans),
+		"diff":          diff,
+		"lines_added":   added,
+		"lines_removed": removed,
+		"dry_run":       dryRun,
+		"applied":       false,
+		"success":       true,
+	}
+	if dryRun || updated == original {
+		return result, nil
+	}
+
+	if backup {
+		backupPath := path + ".backup"
+		if err := tr.copyFile(path, backupPath); err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+		result["backup"] = backupPath
+	}
+	if crlf {
+		updated = strings.ReplaceAll(updated, "\n", "\r\n")
+	}
+	if err := writeFileAtomic(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	result["applied"] = true
+
+	tr.logger.Debug("File edited", "path", path, "edits", len(spans), "lines_added", added, "lines_removed", removed)
+	return result, nil
+}
+
+// editsParam reads the edits list, or a single edit given at the top level
+func editsParam(params map[string]interface{}) ([]map[string]interface{}, error) {
+	raw, ok := params["edits"]
+	if !ok {
+		for _, key := range []string{"old_text", "start_line", "insert_line"} {
+			if _, ok := params[key]; ok {
+				return []map[string]interface{}{params}, nil
+			}
+		}
+		return nil, fmt.Errorf("edits parameter is required")
+	}
+
+	items, ok := raw.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("edits must be a non-empty array")
+	}
+	edits := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		if edits[i], ok = item.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("edit %d must be an object, got %T", i+1, item)
+		}
+	}
+	return edits, nil
+}
+
+// resolveFileEdit finds the spans of the original text an edit replaces
+func resolveFileEdit(original string, index int, edit map[string]interface{}) ([]fileEdit, error) {
+	newText, _ := edit["new_text"].(string)
+	newText = strings.ReplaceAll(newText, "\r\n", "\n")
+
+	if oldText, ok := edit["old_text"].(string); ok {
+		oldText = strings.ReplaceAll(oldText, "\r\n", "\n")
+		if oldText == "" {
+			return nil, fmt.Errorf("old_text cannot be empty")
+		}
+		replaceAll, err := boolParam(edit, "replace_all", false)
+		if err != nil {
+			return nil, err
+		}
+
+		var spans []fileEdit
+		for from := 0; ; {
+			at := strings.Index(original[from:], oldText)
+			if at < 0 {
+				break
+			}
+			start := from + at
+			spans = append(spans, fileEdit{index: index, start: start, end: start + len(oldText), text: newText})
+			from = start + len(oldText)
+		}
+
+		switch {
+		case len(spans) == 0:
+			return nil, oldTextNotFound(original, oldText)
+		case len(spans) > 1 && !replaceAll:
+			lines := make([]string, len(spans))
+			for i, span := range spans {
+				lines[i] = fmt.Sprint(strings.Count(original[:span.start], "\n") + 1)
+			}
+			return nil, fmt.Errorf("old_text matches %d times (lines %s); include more surrounding text or set replace_all", len(spans), strings.Join(lines, ", "))
+		}
+		return spans, nil
+	}
+
+	starts := lineStarts(original)
+	lineCount := len(starts) - 1
+	if newText != "" && !strings.HasSuffix(newText, "\n") {
+		newText += "\n"
+	}
+
+	if _, ok := edit["insert_line"]; ok {
+		line, err := intParam(edit, "insert_line", 0)
+		if err != nil {
+			return nil, err
+		}
+		if line < 1 || line > lineCount+1 {
+			return nil, fmt.Errorf("insert_line %d is outside the file's %d lines", line, lineCount)
+		}
+		if newText == "" {
+			return nil, fmt.Errorf("new_text is required to insert lines")
+		}
+		at := starts[line-1]
+		if line == lineCount+1 && original != "" && !strings.HasSuffix(original, "\n") {
+			newText = "\n" + strings.TrimSuffix(newText, "\n")
+		}
+		return []fileEdit{{index: index, start: at, end: at, text: newText}}, nil
+	}
+
+	if _, ok := edit["start_line"]; ok {
+		startLine, err := intParam(edit, "start_line", 0)
+		if err != nil {
+			return nil, err
+		}
+		endLine, err := intParam(edit, "end_line", startLine)
+		if err != nil {
+			return nil, err
+		}
+		if startLine < 1 || endLine < startLine || endLine > lineCount {
+			return nil, fmt.Errorf("lines %d-%d are outside the file's %d lines", startLine, endLine, lineCount)
+		}
+		end := starts[endLine]
+		if endLine == lineCount && !strings.HasSuffix(original, "\n") {
+			newText = strings.TrimSuffix(newText, "\n")
+		}
+		return []fileEdit{{index: index, start: starts[startLine-1], end: end, text: newText}}, nil
+	}
+
+	return nil, fmt.Errorf("needs old_text, start_line or insert_line")
+}
+
+// oldTextNotFound explains a failed search, pointing at a match that only
+// differs in whitespace when there is one
+func oldTextNotFound(original, oldText string) error {
+	want := strings.Split(strings.TrimSuffix(oldText, "\n"), "\n")
+	if at, ok := findLines(splitEditLines(original), 0, want, 0, true); ok {
+		return fmt.Errorf("old_text not found; text differing only in whitespace starts at line %d", at+1)
+	}
+	return fmt.Errorf("old_text not found")
+}
+
+// lineStarts returns the offset of each line of text, followed by the length
+// of the text
+func lineStarts(text string) []int {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' && i+1 < len(text) {
+			starts = append(starts, i+1)
+		}
+	}
+	if text == "" {
+		return starts
+	}
+	return append(starts, len(text))
+}
+
+// splitEditLines splits text into lines without a trailing empty line
+func splitEditLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// writeFileAtomic replaces path with data by renaming a temporary file over
+// it, so readers never see a partly written file
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to set mode of %s: %w", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package generic
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+const editTestSource = "package main\n\nfunc a() int {\n\treturn 1\n}\n\nfunc b() int {\n\treturn 1\n}\n"
+
+func TestEditFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		params    map[string]interface{}
+		expected  string
+		errorText string
+	}{
+		{
+			name:     "unique search and replace",
+			source:   editTestSource,
+			params:   map[string]interface{}{"old_text": "func a() int {\n\treturn 1", "new_text": "func a() int {\n\treturn 2"},
+			expected: strings.Replace(editTestSource, "func a() int {\n\treturn 1", "func a() int {\n\treturn 2", 1),
+		},
+		{
+			name:      "ambiguous search",
+			source:    editTestSource,
+			params:    map[string]interface{}{"old_text": "return 1", "new_text": "return 2"},
+			errorText: "matches 2 times (lines 4, 8)",
+		},
+		{
+			name:     "replace all",
+			source:   editTestSource,
+			params:   map[string]interface{}{"old_text": "return 1", "new_text": "return 2", "replace_all": true},
+			expected: strings.ReplaceAll(editTestSource, "return 1", "return 2"),
+		},
+		{
+			name:      "search with different indentation",
+			source:    editTestSource,
+			params:    map[string]interface{}{"old_text": "func b() int {\n    return 1", "new_text": "x"},
+			errorText: "differing only in whitespace starts at line 7",
+		},
+		{
+			name:   "several edits against the original line numbers",
+			source: editTestSource,
+			params: map[string]interface{}{"edits": []interface{}{
+				map[string]interface{}{"insert_line": 3.0, "new_text": "// a returns one"},
+				map[string]interface{}{"start_line": 7.0, "end_line": 9.0},
+				map[string]interface{}{"old_text": "package main", "new_text": "package tools"},
+				map[string]interface{}{"insert_line": 10.0, "new_text": "var c = 3\n"},
+			}},
+			expected: "package tools\n\n// a returns one\nfunc a() int {\n\treturn 1\n}\n\nvar c = 3\n",
+		},
+		{
+			name:   "replace a line after inserting before it",
+			source: editTestSource,
+			params: map[string]interface{}{"edits": []interface{}{
+				map[string]interface{}{"start_line": 3.0, "new_text": "func a() int64 {"},
+				map[string]interface{}{"insert_line": 3.0, "new_text": "// a returns one"},
+			}},
+			expected: strings.Replace(editTestSource, "func a() int {", "// a returns one\nfunc a() int64 {", 1),
+		},
+		{
+			name:   "insert before a line that is replaced",
+			source: editTestSource,
+			params: map[string]interface{}{"edits": []interface{}{
+				map[string]interface{}{"insert_line": 3.0, "new_text": "// a returns one"},
+				map[string]interface{}{"start_line": 3.0, "new_text": "func a() int64 {"},
+			}},
+			expected: strings.Replace(editTestSource, "func a() int {", "// a returns one\nfunc a() int64 {", 1),
+		},
+		{
+			name:      "overlapping edits",
+			source:    editTestSource,
+			params:    map[string]interface{}{"edits": []interface{}{map[string]interface{}{"start_line": 3.0, "end_line": 5.0}, map[string]interface{}{"old_text": "return 1\n}\n\nfunc b", "new_text": ""}}},
+			errorText: "edits 1 and 2 overlap",
+		},
+		{
+			name:      "line out of range",
+			source:    editTestSource,
+			params:    map[string]interface{}{"start_line": 8.0, "end_line": 12.0},
+			errorText: "outside the file's 9 lines",
+		},
+		{
+			name:     "append to a file without a final newline",
+			source:   "one\ntwo",
+			params:   map[string]interface{}{"insert_line": 3.0, "new_text": "three"},
+			expected: "one\ntwo\nthree",
+		},
+		{
+			name:     "CRLF file",
+			source:   "one\r\ntwo\r\n",
+			params:   map[string]interface{}{"old_text": "one\ntwo", "new_text": "uno\ndos"},
+			expected: "uno\r\ndos\r\n",
+		},
+		{
+			name:      "no edit",
+			source:    editTestSource,
+			params:    map[string]interface{}{"new_text": "x"},
+			errorText: "edits parameter is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newPatchTestRegistry(t, &Security{})
+			writePatchTestFile(t, "main.go", tt.source)
+
+			params := map[string]interface{}{"path": "main.go"}
+			for key, value := range tt.params {
+				params[key] = value
+			}
+			output, err := registry.executeEditFile(context.Background(), params)
+			if tt.errorText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorText) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorText, err)
+				}
+				if got := readPatchTestFile(t, "main.go"); got != tt.source {
+					t.Errorf("A failed edit changed the file to %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("edit_file failed: %v", err)
+			}
+
+			if got := readPatchTestFile(t, "main.go"); got != tt.expected {
+				t.Errorf("Unexpected content:\n got %q\nwant %q", got, tt.expected)
+			}
+			result := output.(map[string]interface{})
+			if result["applied"] != true || result["backup"] != "main.go.backup" {
+				t.Errorf("Unexpected result %v", result)
+			}
+			if got := readPatchTestFile(t, "main.go.backup"); got != tt.source {
+				t.Errorf("Expected the backup to hold the original, got %q", got)
+			}
+
+			// The reported diff applies to the original and gives the new content
+			writePatchTestFile(t, "main.go", tt.source)
+			if _, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": result["diff"], "fuzz": 0.0}); err != nil {
+				t.Fatalf("Reported diff does not apply: %v", err)
+			}
+			if got := readPatchTestFile(t, "main.go"); got != tt.expected {
+				t.Errorf("Reported diff gives %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEditFileDryRun(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{BlockedPaths: []string{"secrets"}})
+	writePatchTestFile(t, "main.go", editTestSource)
+
+	output, err := registry.executeEditFile(context.Background(), map[string]interface{}{
+		"path": "main.go", "old_text": "func a", "new_text": "func first", "dry_run": true, "backup": false,
+	})
+	if err != nil {
+		t.Fatalf("edit_file failed: %v", err)
+	}
+	result := output.(map[string]interface{})
+	expectedDiff := "--- a/main.go\n+++ b/main.go\n@@ -1,6 +1,6 @@\n package main\n \n-func a() int {\n+func first() int {\n \treturn 1\n }\n \n"
+	if result["diff"] != expectedDiff || result["lines_added"] != 1 || result["lines_removed"] != 1 || result["applied"] != false {
+		t.Errorf("Unexpected dry run result %v", result)
+	}
+	if got := readPatchTestFile(t, "main.go"); got != editTestSource {
+		t.Errorf("Dry run changed the file")
+	}
+	if _, err := os.Stat("main.go.backup"); !os.IsNotExist(err) {
+		t.Errorf("Dry run wrote a backup")
+	}
+
+	writePatchTestFile(t, "secrets/key.txt", "a\n")
+	if _, err := registry.executeEditFile(context.Background(), map[string]interface{}{"path": "secrets/key.txt", "old_text": "a", "new_text": "b"}); err == nil {
+		t.Errorf("Expected blocked paths to be rejected")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldLines := strings.Split("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16", "\n")
+	newLines := append([]string{}, oldLines...)
+	newLines[1] = "two"
+	newLines[14] = "fifteen"
+
+	expected := "--- a/n.txt\n+++ b/n.txt\n" +
+		"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+		"@@ -12,5 +12,5 @@\n 12\n 13\n 14\n-15\n+fifteen\n 16\n"
+	if got, added, removed := unifiedDiff("n.txt", oldLines, newLines); got != expected || added != 2 || removed != 2 {
+		t.Errorf("Unexpected diff (+%d -%d):\n got %q\nwant %q", added, removed, got, expected)
+	}
+	if got, added, removed := unifiedDiff("n.txt", oldLines, oldLines); got != "" || added != 0 || removed != 0 {
+		t.Errorf("Expected no diff for equal lines, got %q", got)
+	}
+	if got, added, _ := unifiedDiff("n.txt", nil, []string{"a"}); got != "--- a/n.txt\n+++ b/n.txt\n@@ -0,0 +1,1 @@\n+a\n" || added != 1 {
+		t.Errorf("Unexpected diff for a new file: %q", got)
+	}
+
+	// Lines that look like diff headers once prefixed are still counted
+	_, added, removed := unifiedDiff("q.sql", []string{"-- comment", "---", "i++"}, []string{"++i", "+++", "-- note"})
+	if added != 3 || removed != 3 {
+		t.Errorf("Expected +3 -3, got +%d -%d", added, removed)
+	}
+}
@@ -0,0 +1,335 @@
+package generic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// External transformers and step types
+//
+// The extensions section of the config declares transformers and step types
+// implemented by executables, so they can be written in any language. Each
+// use starts the command once, writes a single JSON request to its stdin and
+// reads a single JSON response from its stdout:
+//
+//	request:  {"kind": "transform" | "step", "name": "...", "input": ..., "params": {...},
+//	           "context": {"session_id": "...", "data": {...}, "variables": {...},
+//	                       "steps": {"<step name>": <output>, ...}}}
+//	response: {"output": ..., "error": "...", "logs": [{"level": "info", "message": "..."}]}
+//
+// For a transform, input is the value being transformed and params are the
+// transform's params. For a step, input and params come from the step config
+// after template rendering. A non-empty error, a non-zero exit status or a
+// stdout that is not a JSON object fails the transform or step; stderr is
+// included in the error. Logs are forwarded to the agent's logger and may
+// also be plain strings, which are logged at info level.
+//
+// Commands run in work_dir with only PATH and the variables listed in env
+// passed through, and are killed after timeout (default 30s). Like script
+// steps, the command line is checked by the validator when it is registered.
+
+const defaultExternalTimeout = 30 * time.Second
+
+type externalRequest struct {
+	Kind    string                 `json:"kind"`
+	Name    string                 `json:"name"`
+	Input   interface{}            `json:"input"`
+	Params  map[string]interface{} `json:"params"`
+	Context externalContext        `json:"context"`
+}
+
+type externalContext struct {
+	SessionID string                 `json:"session_id,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+	Variables map[string]string      `json:"variables"`
+	Steps     map[string]interface{} `json:"steps"`
+}
+
+type externalResponse struct {
+	Output interface{}       `json:"output"`
+	Error  string            `json:"error,omitempty"`
+	Logs   []json.RawMessage `json:"logs,omitempty"`
+}
+
+// RegisterExtensions registers the external transformers and step types
+// declared in the config
+func (we *WorkflowEngine) RegisterExtensions(extensions Extensions) error {
+	for _, name := range sortedCommandNames(extensions.Transformers) {
+		if _, ok := we.transformPipeline.registry.GetTransformer(name); ok {
+			return fmt.Errorf("external transformer %s: conflicts with an existing transformer", name)
+		}
+		runner, err := we.newExternalRunner(name, extensions.Transformers[name])
+		if err != nil {
+			return fmt.Errorf("external transformer %s: %w", name, err)
+		}
+		we.transformPipeline.registry.RegisterTransformer(&ExternalTransformer{runner: runner})
+		we.logger.Debug("Registered external transformer", "name", name, "command", runner.command.Command)
+	}
+
+	for _, name := range sortedCommandNames(extensions.Steps) {
+		if _, ok := we.builtinSteps[name]; ok {
+			return fmt.Errorf("external step %s: conflicts with a built-in step type", name)
+		}
+		runner, err := we.newExternalRunner(name, extensions.Steps[name])
+		if err != nil {
+			return fmt.Errorf("external step %s: %w", name, err)
+		}
+		if we.externalSteps == nil {
+			we.externalSteps = make(map[string]*externalRunner)
+		}
+		we.externalSteps[name] = runner
+		we.logger.Debug("Registered external step type", "name", name, "command", runner.command.Command)
+	}
+	return nil
+}
+
+func sortedCommandNames(commands map[string]ExternalCommand) []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// externalRunner runs an external command with the JSON protocol
+type externalRunner struct {
+	name    string
+	command ExternalCommand
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+// newExternalRunner checks the command the same way as a config-defined
+// script step
+func (we *WorkflowEngine) newExternalRunner(name string, command ExternalCommand) (*externalRunner, error) {
+	if command.Command == "" {
+		return nil, fmt.Errorf("command is required")
+	}
+
+	timeout := defaultExternalTimeout
+	if command.Timeout != "" {
+		parsed, err := time.ParseDuration(command.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		if parsed <= 0 {
+			return nil, fmt.Errorf("timeout must be positive")
+		}
+		timeout = parsed
+	}
+
+	commandLine := strings.Join(append([]string{command.Command}, command.Args...), " ")
+	validationResult, err := we.validator.ValidateScript(commandLine, SecurityContext{
+		IsTrustedSource: true,
+		MaxFileSize:     10 * 1024,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("command validation failed: %w", err)
+	}
+	if !validationResult.IsSecure {
+		return nil, fmt.Errorf("command security validation failed: %v", validationResult.Violations)
+	}
+	if len(validationResult.Warnings) > 0 {
+		we.logger.Warn("External command validation warnings",
+			"name", name,
+			"warnings", validationResult.Warnings)
+	}
+
+	return &externalRunner{name: name, command: command, timeout: timeout, logger: we.logger}, nil
+}
+
+// run sends request to the command and returns the output of its response
+func (r *externalRunner) run(ctx context.Context, request externalRequest) (interface{}, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode request for %s: %w", r.name, err)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctxWithTimeout, r.command.Command, r.command.Args...)
+	cmd.Dir = r.command.WorkDir
+	cmd.Env = externalEnv(r.command.Env)
+	cmd.Stdin = bytes.NewReader(body)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children of a killed command can hold its pipes open; stop waiting for them
+	cmd.WaitDelay = time.Second
+
+	r.logger.Debug("Running external command", "name", r.name, "kind", request.Kind, "command", r.command.Command)
+	runErr := cmd.Run()
+	if errors.Is(ctxWithTimeout.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%s timed out after %s", r.name, r.timeout)
+	}
+
+	var response externalResponse
+	decodeErr := json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &response)
+	if decodeErr == nil {
+		r.forwardLogs(response.Logs)
+	}
+
+	switch {
+	case runErr != nil:
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s failed: %w: %s", r.name, runErr, message)
+		}
+		return nil, fmt.Errorf("%s failed: %w", r.name, runErr)
+	case decodeErr != nil:
+		return nil, fmt.Errorf("%s returned an invalid response: %w", r.name, decodeErr)
+	case response.Error != "":
+		return nil, fmt.Errorf("%s: %s", r.name, response.Error)
+	}
+	return response.Output, nil
+}
+
+// forwardLogs logs the messages a command returned, each either a string or
+// an object with level and message
+func (r *externalRunner) forwardLogs(logs []json.RawMessage) {
+	for _, raw := range logs {
+		var entry struct {
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(raw, &entry.Message); err != nil {
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				entry.Message = string(raw)
+			}
+		}
+
+		level := slog.LevelInfo
+		switch strings.ToLower(entry.Level) {
+		case "debug":
+			level = slog.LevelDebug
+		case "warn", "warning":
+			level = slog.LevelWarn
+		case "error":
+			level = slog.LevelError
+		}
+		r.logger.Log(context.Background(), level, entry.Message, "external", r.name)
+	}
+}
+
+// externalEnv returns PATH and the allowed variables from the agent's
+// environment
+func externalEnv(allowed []string) []string {
+	env := []string{}
+	for _, name := range append([]string{"PATH"}, allowed...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// newExternalContext describes the running workflow for a request
+func newExternalContext(execCtx *ExecutionContext) externalContext {
+	result := externalContext{
+		Data:      map[string]interface{}{},
+		Variables: map[string]string{},
+		Steps:     map[string]interface{}{},
+	}
+	if execCtx == nil {
+		return result
+	}
+
+	result.SessionID = execCtx.SessionID
+	if execCtx.Data != nil {
+		result.Data = execCtx.Data
+	}
+	if execCtx.Variables != nil {
+		result.Variables = execCtx.Variables
+	}
+	for name, stepResult := range execCtx.StepResults {
+		if stepResult != nil && stepResult.Success {
+			result.Steps[name] = stepResult.Output
+		}
+	}
+	return result
+}
+
+// ExternalTransformer is a transformer implemented by an external command
+type ExternalTransformer struct {
+	runner *externalRunner
+}
+
+func (et *ExternalTransformer) Name() string { return et.runner.name }
+func (et *ExternalTransformer) Description() string {
+	if et.runner.command.Description != "" {
+		return et.runner.command.Description
+	}
+	return "External transformer: " + et.runner.command.Command
+}
+
+// ValidateParams accepts any params; the command validates them when it runs
+func (et *ExternalTransformer) ValidateParams(params map[string]interface{}) error {
+	return nil
+}
+
+func (et *ExternalTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return et.TransformInContext(nil, input, params)
+}
+
+func (et *ExternalTransformer) TransformInContext(execCtx *ExecutionContext, input interface{}, params map[string]interface{}) (interface{}, error) {
+	var ctx context.Context
+	if execCtx != nil {
+		ctx = execCtx.Context
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	return et.runner.run(ctx, externalRequest{
+		Kind:    "transform",
+		Name:    et.runner.name,
+		Input:   input,
+		Params:  params,
+		Context: newExternalContext(execCtx),
+	})
+}
+
+// executeExternalStep runs a step whose type is an external command. The
+// step's input and params config values are rendered as templates first.
+func (we *WorkflowEngine) executeExternalStep(ctx context.Context, runner *externalRunner, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult) (interface{}, error) {
+	input, err := we.renderConfigValue(step, step.Config["input"], previousResults, execCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render input: %w", err)
+	}
+
+	params := map[string]interface{}{}
+	if stepParams, ok := step.Config["params"].(map[string]interface{}); ok {
+		for k, v := range stepParams {
+			if params[k], err = we.renderConfigValue(step, v, previousResults, execCtx); err != nil {
+				return nil, fmt.Errorf("failed to render parameter %s: %w", k, err)
+			}
+		}
+	}
+
+	output, err := runner.run(ctx, externalRequest{
+		Kind:    "step",
+		Name:    step.Name,
+		Input:   input,
+		Params:  params,
+		Context: newExternalContext(execCtx),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	we.logger.Info("External step completed", "step", step.Name, "type", step.Type)
+	return output, nil
+}
@@ -0,0 +1,211 @@
+package generic
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeExternalCommand writes an executable bash script and returns its path
+func writeExternalCommand(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "command.sh")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env bash\n"+body+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write command: %v", err)
+	}
+	return path
+}
+
+// echoRequestScript replies with the request it received as the output
+const echoRequestScript = `request=$(cat)
+printf '{"output": %s, "logs": ["received", {"level": "debug", "message": "done"}]}' "$request"`
+
+func TestExternalTransformer(t *testing.T) {
+	engine := newBudgetTestEngine(t, "http://localhost")
+	err := engine.RegisterExtensions(Extensions{Transformers: map[string]ExternalCommand{
+		"echo_request": {Command: writeExternalCommand(t, echoRequestScript), Description: "Echo the request"},
+		"fail":         {Command: writeExternalCommand(t, `cat >/dev/null; printf '{"error": "bad input", "logs": ["rejected"]}'`)},
+		"crash":        {Command: writeExternalCommand(t, `echo "traceback here" >&2; exit 3`)},
+		"garbage":      {Command: writeExternalCommand(t, `echo "not json"`)},
+		"slow":         {Command: writeExternalCommand(t, `sleep 5`), Timeout: "200ms"},
+	}})
+	if err != nil {
+		t.Fatalf("RegisterExtensions failed: %v", err)
+	}
+
+	registry := engine.transformPipeline.registry
+	transformer, ok := registry.GetTransformer("echo_request")
+	if !ok {
+		t.Fatal("echo_request transformer not registered")
+	}
+	if transformer.Description() != "Echo the request" {
+		t.Errorf("Unexpected description %q", transformer.Description())
+	}
+
+	execCtx := newBudgetTestContext(map[string]interface{}{"repo": "agent"})
+	execCtx.StepResults["previous"] = &StepResult{StepName: "previous", Success: true, Output: "earlier output"}
+
+	output, err := transformer.(ExecutionTransformer).TransformInContext(execCtx, []interface{}{"a", "b"}, map[string]interface{}{"limit": float64(2)})
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	request, ok := output.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected the echoed request, got %T", output)
+	}
+	if request["kind"] != "transform" || request["name"] != "echo_request" {
+		t.Errorf("Unexpected kind or name: %v", request)
+	}
+	if input, _ := request["input"].([]interface{}); len(input) != 2 || input[0] != "a" {
+		t.Errorf("Unexpected input %v", request["input"])
+	}
+	if params, _ := request["params"].(map[string]interface{}); params["limit"] != float64(2) {
+		t.Errorf("Unexpected params %v", request["params"])
+	}
+	context, _ := request["context"].(map[string]interface{})
+	if context["session_id"] != "test-session" {
+		t.Errorf("Unexpected session_id %v", context["session_id"])
+	}
+	if data, _ := context["data"].(map[string]interface{}); data["repo"] != "agent" {
+		t.Errorf("Unexpected context data %v", context["data"])
+	}
+	if steps, _ := context["steps"].(map[string]interface{}); steps["previous"] != "earlier output" {
+		t.Errorf("Unexpected context steps %v", context["steps"])
+	}
+
+	errorTests := []struct {
+		name     string
+		contains string
+	}{
+		{"fail", "fail: bad input"},
+		{"crash", "traceback here"},
+		{"garbage", "invalid response"},
+		{"slow", "timed out after 200ms"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformer, _ := registry.GetTransformer(tt.name)
+			start := time.Now()
+			_, err := transformer.Transform("input", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %v", tt.contains, err)
+			}
+			if time.Since(start) > 3*time.Second {
+				t.Errorf("Command was not stopped at its timeout")
+			}
+		})
+	}
+}
+
+func TestExternalCommandEnvironment(t *testing.T) {
+	t.Setenv("EXTERNAL_ALLOWED", "visible")
+	t.Setenv("EXTERNAL_SECRET", "hidden")
+	workDir := t.TempDir()
+
+	engine := newBudgetTestEngine(t, "http://localhost")
+	err := engine.RegisterExtensions(Extensions{Transformers: map[string]ExternalCommand{
+		"env": {
+			Command: writeExternalCommand(t, `cat >/dev/null; printf '{"output": "%s|%s|%s"}' "$EXTERNAL_ALLOWED" "$EXTERNAL_SECRET" "$(pwd)"`),
+			Env:     []string{"EXTERNAL_ALLOWED"},
+			WorkDir: workDir,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("RegisterExtensions failed: %v", err)
+	}
+
+	transformer, _ := engine.transformPipeline.registry.GetTransformer("env")
+	output, err := transformer.Transform("input", nil)
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+	resolvedDir, _ := filepath.EvalSymlinks(workDir)
+	if output != "visible||"+resolvedDir && output != "visible||"+workDir {
+		t.Errorf("Unexpected environment output %q", output)
+	}
+}
+
+func TestExternalStep(t *testing.T) {
+	engine := newBudgetTestEngine(t, "http://localhost")
+	err := engine.RegisterExtensions(Extensions{Steps: map[string]ExternalCommand{
+		"lint": {Command: writeExternalCommand(t, echoRequestScript)},
+	}})
+	if err != nil {
+		t.Fatalf("RegisterExtensions failed: %v", err)
+	}
+
+	execCtx := newBudgetTestContext(map[string]interface{}{"file": "main.go"})
+	step := Step{
+		Name: "lint_file",
+		Type: "lint",
+		Config: map[string]interface{}{
+			"input":  "{file}",
+			"params": map[string]interface{}{"rules": []interface{}{"{file}-rules"}, "strict": true},
+		},
+	}
+
+	result, err := engine.executeStep(execCtx.Context, step, execCtx, execCtx.StepResults)
+	if err != nil {
+		t.Fatalf("executeStep failed: %v", err)
+	}
+	request, _ := result.Output.(map[string]interface{})
+	if request["kind"] != "step" || request["name"] != "lint_file" {
+		t.Errorf("Unexpected kind or name: %v", request)
+	}
+	if request["input"] != "main.go" {
+		t.Errorf("Expected rendered input, got %v", request["input"])
+	}
+	params, _ := request["params"].(map[string]interface{})
+	if rules, _ := params["rules"].([]interface{}); len(rules) != 1 || rules[0] != "main.go-rules" || params["strict"] != true {
+		t.Errorf("Unexpected params %v", params)
+	}
+	if execCtx.StepResults["lint_file"] != result {
+		t.Errorf("Step result was not stored in the execution context")
+	}
+}
+
+func TestRegisterExtensionsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions Extensions
+		contains   string
+	}{
+		{
+			name:       "missing command",
+			extensions: Extensions{Transformers: map[string]ExternalCommand{"empty": {}}},
+			contains:   "command is required",
+		},
+		{
+			name:       "invalid timeout",
+			extensions: Extensions{Transformers: map[string]ExternalCommand{"bad": {Command: "true", Timeout: "soon"}}},
+			contains:   "invalid timeout",
+		},
+		{
+			name:       "dangerous command",
+			extensions: Extensions{Steps: map[string]ExternalCommand{"wipe": {Command: "rm", Args: []string{"-rf", "/"}}}},
+			contains:   "security validation failed",
+		},
+		{
+			name:       "built-in step type",
+			extensions: Extensions{Steps: map[string]ExternalCommand{"script": {Command: "true"}}},
+			contains:   "conflicts with a built-in step type",
+		},
+		{
+			name:       "built-in transformer",
+			extensions: Extensions{Transformers: map[string]ExternalCommand{"to_yaml": {Command: "true"}}},
+			contains:   "conflicts with an existing transformer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := newBudgetTestEngine(t, "http://localhost")
+			err := engine.RegisterExtensions(tt.extensions)
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,713 @@
+package generic
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Structured format transformers
+//
+// parse_csv, parse_yaml and parse_xml turn text into lists and maps that the
+// other transformers, templates and queries can work with; to_csv, to_yaml
+// and to_xml turn them back into text.
+
+// registerFormatTransformers registers the parsers and encoders
+func (tr *TransformRegistry) registerFormatTransformers() {
+	tr.RegisterTransformer(&CSVParser{})
+	tr.RegisterTransformer(&CSVEncoder{})
+	tr.RegisterTransformer(&YAMLParser{})
+	tr.RegisterTransformer(&YAMLEncoder{})
+	tr.RegisterTransformer(&XMLParser{})
+	tr.RegisterTransformer(&XMLEncoder{})
+}
+
+// boolParam reads an optional boolean parameter
+func boolParam(params map[string]interface{}, name string, fallback bool) (bool, error) {
+	value, ok := params[name]
+	if !ok || value == nil {
+		return fallback, nil
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be true or false, got %T", name, value)
+	}
+	return b, nil
+}
+
+// intParam reads an optional non-negative integer parameter
+func intParam(params map[string]interface{}, name string, fallback int) (int, error) {
+	value, ok := params[name]
+	if !ok || value == nil {
+		return fallback, nil
+	}
+	var n int
+	switch v := value.(type) {
+	case int:
+		n = v
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("%s must be a whole number, got %v", name, v)
+		}
+		n = int(v)
+	default:
+		return 0, fmt.Errorf("%s must be a number, got %T", name, value)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s cannot be negative", name)
+	}
+	return n, nil
+}
+
+// delimiterParam reads an optional single-character delimiter
+func delimiterParam(params map[string]interface{}) (rune, error) {
+	value, ok := params["delimiter"]
+	if !ok {
+		return ',', nil
+	}
+	delimiter, _ := value.(string)
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+	if utf8.RuneCountInString(delimiter) != 1 {
+		return 0, fmt.Errorf("delimiter must be a single character, got %q", value)
+	}
+	r, _ := utf8.DecodeRuneInString(delimiter)
+	return r, nil
+}
+
+// CSVParser parses delimited text into rows. validatePath checks the files
+// from_file reads; without it from_file is refused.
+type CSVParser struct {
+	validatePath func(path string) error
+}
+
+func (cp *CSVParser) Name() string { return "parse_csv" }
+func (cp *CSVParser) Description() string {
+	return "Parse CSV into a list of row maps (header) or lists, inferring numbers and booleans"
+}
+
+func (cp *CSVParser) ValidateParams(params map[string]interface{}) error {
+	if _, err := delimiterParam(params); err != nil {
+		return err
+	}
+	for _, name := range []string{"header", "infer_types", "from_file"} {
+		if _, err := boolParam(params, name, false); err != nil {
+			return err
+		}
+	}
+	if _, err := intParam(params, "limit", 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Transform reads the input, or the file it names when from_file is set,
+// one record at a time so that a limit stops early on large inputs
+func (cp *CSVParser) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	delimiter, _ := delimiterParam(params)
+	header, _ := boolParam(params, "header", true)
+	inferTypes, _ := boolParam(params, "infer_types", true)
+	fromFile, _ := boolParam(params, "from_file", false)
+	limit, _ := intParam(params, "limit", 0)
+
+	var source io.Reader = strings.NewReader(inputStr)
+	if fromFile {
+		if cp.validatePath == nil {
+			return nil, fmt.Errorf("from_file is not available here; read the file with a tool step")
+		}
+		if err := cp.validatePath(inputStr); err != nil {
+			return nil, fmt.Errorf("path validation failed: %w", err)
+		}
+		file, err := os.Open(inputStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open CSV file: %w", err)
+		}
+		defer file.Close()
+		source = file
+	}
+
+	reader := csv.NewReader(source)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	var columns []string
+	rows := []interface{}{}
+	for limit == 0 || len(rows) < limit {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		if header && columns == nil {
+			columns = append([]string{}, record...)
+			continue
+		}
+
+		values := make([]interface{}, len(record))
+		for i, field := range record {
+			values[i] = field
+			if inferTypes {
+				values[i] = inferScalar(field)
+			}
+		}
+
+		if !header {
+			rows = append(rows, values)
+			continue
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = nil
+			if i < len(values) {
+				row[column] = values[i]
+			}
+		}
+		for i := len(columns); i < len(values); i++ {
+			row[fmt.Sprintf("column_%d", i+1)] = values[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// inferScalar converts CSV fields that look like integers, decimals or
+// booleans; empty fields become null. Numbers with leading zeros, such as ZIP
+// codes and IDs, and numbers that would not be written back the same way stay
+// strings.
+func inferScalar(field string) interface{} {
+	trimmed := strings.TrimSpace(field)
+	switch strings.ToLower(trimmed) {
+	case "":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	digits := strings.TrimLeft(trimmed, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return field
+	}
+	if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(trimmed, 64); err == nil && exactDecimal(trimmed) {
+		return f
+	}
+	return field
+}
+
+// plainDecimal matches decimals without exponents, which a float64 holds
+// exactly enough to write back when they have at most 15 significant digits
+var plainDecimal = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)$`)
+
+// exactDecimal reports whether a float64 can stand in for the decimal text
+// without losing digits, so long account numbers and "NaN" or "1e3" stay
+// strings
+func exactDecimal(text string) bool {
+	if !plainDecimal.MatchString(text) {
+		return false
+	}
+	digits := strings.TrimLeft(strings.Replace(strings.TrimLeft(text, "+-"), ".", "", 1), "0")
+	if strings.Contains(text, ".") {
+		digits = strings.TrimRight(digits, "0")
+	}
+	return len(digits) <= 15
+}
+
+// CSVEncoder writes rows as CSV
+type CSVEncoder struct{}
+
+func (ce *CSVEncoder) Name() string { return "to_csv" }
+func (ce *CSVEncoder) Description() string {
+	return "Write a list of maps or lists as CSV"
+}
+
+func (ce *CSVEncoder) ValidateParams(params map[string]interface{}) error {
+	if _, err := delimiterParam(params); err != nil {
+		return err
+	}
+	if _, err := boolParam(params, "header", true); err != nil {
+		return err
+	}
+	if columns, ok := params["columns"]; ok {
+		if _, err := stringListParam(columns); err != nil {
+			return fmt.Errorf("columns %w", err)
+		}
+	}
+	return nil
+}
+
+// Transform writes map rows under the given columns, or the sorted union of
+// their keys; nested values are written as JSON
+func (ce *CSVEncoder) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	rows, ok := toInterfaceSlice(input)
+	if !ok {
+		return nil, fmt.Errorf("input must be a list, got %T", input)
+	}
+
+	delimiter, _ := delimiterParam(params)
+	header, _ := boolParam(params, "header", true)
+	columns, _ := stringListParam(params["columns"])
+
+	if columns == nil {
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			if m, ok := row.(map[string]interface{}); ok {
+				for key := range m {
+					if !seen[key] {
+						seen[key] = true
+						columns = append(columns, key)
+					}
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = delimiter
+
+	if header && len(columns) > 0 {
+		if err := writer.Write(columns); err != nil {
+			return nil, fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	for i, row := range rows {
+		var values []interface{}
+		switch r := row.(type) {
+		case map[string]interface{}:
+			for _, column := range columns {
+				values = append(values, r[column])
+			}
+		default:
+			list, ok := toInterfaceSlice(row)
+			if !ok {
+				return nil, fmt.Errorf("row %d must be a map or list, got %T", i, row)
+			}
+			values = list
+		}
+
+		record := make([]string, len(values))
+		for j, value := range values {
+			field, err := csvField(value)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i, err)
+			}
+			record[j] = field
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func csvField(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("cannot encode value: %w", err)
+		}
+		return string(encoded), nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// stringListParam reads a list of strings, or nil when absent
+func stringListParam(value interface{}) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if list, ok := value.([]string); ok {
+		return list, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("must be a list of strings, got %T", value)
+	}
+	result := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a list of strings, item %d is %T", i, item)
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// toInterfaceSlice converts any slice to []interface{}
+func toInterfaceSlice(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case []map[string]interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = item
+		}
+		return result, true
+	case []string:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = item
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// YAMLParser parses YAML documents
+type YAMLParser struct{}
+
+func (yp *YAMLParser) Name() string { return "parse_yaml" }
+func (yp *YAMLParser) Description() string {
+	return "Parse YAML; several documents become a list"
+}
+
+func (yp *YAMLParser) ValidateParams(params map[string]interface{}) error {
+	return nil
+}
+
+func (yp *YAMLParser) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(inputStr))
+	var documents []interface{}
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		documents = append(documents, normalizeYAML(document))
+	}
+
+	switch len(documents) {
+	case 0:
+		return nil, nil
+	case 1:
+		return documents[0], nil
+	}
+	return documents, nil
+}
+
+// normalizeYAML converts maps with non-string keys so the result matches
+// what parse_json produces
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = normalizeYAML(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	}
+	return value
+}
+
+// YAMLEncoder writes data as YAML
+type YAMLEncoder struct{}
+
+func (ye *YAMLEncoder) Name() string        { return "to_yaml" }
+func (ye *YAMLEncoder) Description() string { return "Write data as YAML" }
+
+func (ye *YAMLEncoder) ValidateParams(params map[string]interface{}) error {
+	return nil
+}
+
+func (ye *YAMLEncoder) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return encodeYAML(input)
+}
+
+// encodeYAML writes value as block-style YAML indented by two spaces. The
+// yaml() template function and yaml outputs use it too, so all YAML the
+// agent writes looks the same.
+func encodeYAML(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return "", fmt.Errorf("failed to write YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to write YAML: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// XMLParser parses XML into maps. Each element becomes a map with its
+// attributes under "@name", its text under "#text" and its children by tag
+// name, with repeated tags collected into a list. An element holding only
+// text becomes that string. The result is keyed by the root element:
+//
+//	<issues><issue id="1">nil check</issue></issues>
+//	=> {"issues": {"issue": {"@id": "1", "#text": "nil check"}}}
+type XMLParser struct{}
+
+func (xp *XMLParser) Name() string        { return "parse_xml" }
+func (xp *XMLParser) Description() string { return "Parse XML into nested maps" }
+
+func (xp *XMLParser) ValidateParams(params map[string]interface{}) error {
+	return nil
+}
+
+func (xp *XMLParser) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(inputStr))
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid XML: no root element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			value, err := parseXMLElement(decoder, start)
+			if err != nil {
+				return nil, fmt.Errorf("invalid XML: %w", err)
+			}
+			return map[string]interface{}{start.Name.Local: value}, nil
+		}
+	}
+}
+
+func parseXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	element := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		element["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := parseXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			switch existing := element[name].(type) {
+			case nil:
+				element[name] = child
+			case []interface{}:
+				element[name] = append(existing, child)
+			default:
+				element[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(element) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				element["#text"] = content
+			}
+			return element, nil
+		}
+	}
+}
+
+// XMLEncoder writes maps as XML, the reverse of parse_xml
+type XMLEncoder struct{}
+
+func (xe *XMLEncoder) Name() string { return "to_xml" }
+func (xe *XMLEncoder) Description() string {
+	return "Write maps as XML (\"@name\" keys are attributes, \"#text\" is text)"
+}
+
+func (xe *XMLEncoder) ValidateParams(params map[string]interface{}) error {
+	for _, name := range []string{"root", "item"} {
+		if value, ok := params[name]; ok {
+			if s, ok := value.(string); !ok || s == "" {
+				return fmt.Errorf("%s must be a non-empty string", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Transform writes the input under the root element; a map with a single
+// key is used as its own root, as parse_xml produces. List items are
+// written as repeated elements, or as "item" elements at the top level.
+func (xe *XMLEncoder) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	root, _ := params["root"].(string)
+	item, _ := params["item"].(string)
+	if item == "" {
+		item = "item"
+	}
+
+	if root == "" {
+		root = "root"
+		if m, ok := input.(map[string]interface{}); ok && len(m) == 1 {
+			for key, value := range m {
+				root, input = key, value
+			}
+		}
+	}
+
+	if list, ok := toInterfaceSlice(input); ok {
+		input = map[string]interface{}{item: list}
+	}
+
+	var sb strings.Builder
+	if err := writeXMLElement(&sb, root, input, 0); err != nil {
+		return nil, fmt.Errorf("failed to write XML: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func writeXMLElement(sb *strings.Builder, name string, value interface{}, depth int) error {
+	if list, ok := toInterfaceSlice(value); ok {
+		for _, item := range list {
+			if err := writeXMLElement(sb, name, item, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := checkXMLName(name); err != nil {
+		return err
+	}
+	indent := strings.Repeat("  ", depth)
+	sb.WriteString(indent + "<" + name)
+
+	m, isMap := value.(map[string]interface{})
+	if !isMap {
+		sb.WriteString(">")
+		escapeXMLText(sb, xmlText(value))
+		sb.WriteString("</" + name + ">\n")
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var children []string
+	for _, key := range keys {
+		if attr, ok := strings.CutPrefix(key, "@"); ok {
+			if err := checkXMLName(attr); err != nil {
+				return err
+			}
+			sb.WriteString(" " + attr + `="`)
+			escapeXMLText(sb, xmlText(m[key]))
+			sb.WriteString(`"`)
+		} else if key != "#text" {
+			children = append(children, key)
+		}
+	}
+
+	text, hasText := m["#text"]
+	if len(children) == 0 && !hasText {
+		sb.WriteString("/>\n")
+		return nil
+	}
+	sb.WriteString(">")
+	if hasText {
+		escapeXMLText(sb, xmlText(text))
+	}
+	if len(children) > 0 {
+		sb.WriteString("\n")
+		for _, child := range children {
+			if err := writeXMLElement(sb, child, m[child], depth+1); err != nil {
+				return err
+			}
+		}
+		sb.WriteString(indent)
+	}
+	sb.WriteString("</" + name + ">\n")
+	return nil
+}
+
+func checkXMLName(name string) error {
+	if name == "" || strings.ContainsAny(name, " <>&\"'/=") || strings.ContainsAny(name[:1], "0123456789-.") {
+		return fmt.Errorf("%q is not a valid XML name", name)
+	}
+	return nil
+}
+
+func xmlText(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func escapeXMLText(sb *strings.Builder, text string) {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(text))
+	sb.Write(buf.Bytes())
+}
@@ -0,0 +1,188 @@
+package generic
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatTransformers(t *testing.T) {
+	registry := NewTransformRegistry(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	csvFile := filepath.Join(t.TempDir(), "sales.csv")
+	if err := os.WriteFile(csvFile, []byte("region,total\nnorth,10\nsouth,20\neast,30\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		transform     string
+		input         interface{}
+		params        map[string]interface{}
+		expected      string // JSON for parsers, text for encoders
+		expectedInErr string
+	}{
+		// parse_csv
+		{
+			name:      "csv with header and types",
+			transform: "parse_csv",
+			input:     "name,count,ratio,active,note\nalpha,3,0.5,true,\nbeta,x1,2,FALSE,\"a, b\"\n",
+			expected:  `[{"active":true,"count":3,"name":"alpha","note":null,"ratio":0.5},{"active":false,"count":"x1","name":"beta","note":"a, b","ratio":2}]`,
+		},
+		{
+			name:      "csv without header or inference",
+			transform: "parse_csv",
+			input:     "a;1\nb;2",
+			params:    map[string]interface{}{"header": false, "infer_types": false, "delimiter": ";"},
+			expected:  `[["a","1"],["b","2"]]`,
+		},
+		{
+			name:      "csv ragged rows",
+			transform: "parse_csv",
+			input:     "a,b\n1\n2,3,4",
+			expected:  `[{"a":1,"b":null},{"a":2,"b":3,"column_3":4}]`,
+		},
+		{
+			name:          "csv from_file without a path check",
+			transform:     "parse_csv",
+			input:         csvFile,
+			params:        map[string]interface{}{"from_file": true},
+			expectedInErr: "from_file is not available",
+		},
+		{
+			name:      "csv keeps numbers that would change as strings",
+			transform: "parse_csv",
+			input:     "zip,id,zero,ratio,small,account,long_decimal,nan,exp\n02134,007,0,0.25,-0.5,12345678901234567890,3.14159265358979323,NaN,1e3\n",
+			expected:  `[{"account":"12345678901234567890","exp":"1e3","id":"007","long_decimal":"3.14159265358979323","nan":"NaN","ratio":0.25,"small":-0.5,"zero":0,"zip":"02134"}]`,
+		},
+		{name: "csv tab delimiter", transform: "parse_csv", input: "a\tb\n1\t2", params: map[string]interface{}{"delimiter": `\t`}, expected: `[{"a":1,"b":2}]`},
+		{name: "csv bad quote", transform: "parse_csv", input: "a\n\"oops", expectedInErr: "invalid CSV"},
+		{name: "csv bad delimiter", transform: "parse_csv", input: "a", params: map[string]interface{}{"delimiter": "::"}, expectedInErr: "single character"},
+		{name: "csv bad limit", transform: "parse_csv", input: "a", params: map[string]interface{}{"limit": "ten"}, expectedInErr: "limit must be a number"},
+
+		// to_csv
+		{
+			name:      "csv from maps",
+			transform: "to_csv",
+			input:     []interface{}{map[string]interface{}{"b": 1, "a": "x, y"}, map[string]interface{}{"a": "z", "c": []interface{}{1, 2}}},
+			expected:  "a,b,c\n\"x, y\",1,\nz,,\"[1,2]\"\n",
+		},
+		{
+			name:      "csv with chosen columns",
+			transform: "to_csv",
+			input:     []map[string]interface{}{{"a": 1, "b": 2}},
+			params:    map[string]interface{}{"columns": []interface{}{"b"}, "delimiter": "|"},
+			expected:  "b\n2\n",
+		},
+		{name: "csv from lists", transform: "to_csv", input: []interface{}{[]interface{}{"a", 1}}, params: map[string]interface{}{"header": false}, expected: "a,1\n"},
+		{name: "csv from non-list", transform: "to_csv", input: "text", expectedInErr: "input must be a list"},
+
+		// parse_yaml and to_yaml
+		{
+			name:      "yaml",
+			transform: "parse_yaml",
+			input:     "name: agent\nsteps:\n  - id: 1\n    run: true\nmeta:\n  2: two\n",
+			expected:  `{"meta":{"2":"two"},"name":"agent","steps":[{"id":1,"run":true}]}`,
+		},
+		{name: "yaml documents", transform: "parse_yaml", input: "a: 1\n---\nb: 2\n", expected: `[{"a":1},{"b":2}]`},
+		{name: "invalid yaml", transform: "parse_yaml", input: "a: [1", expectedInErr: "invalid YAML"},
+		{
+			name:      "to yaml",
+			transform: "to_yaml",
+			input:     map[string]interface{}{"name": "agent", "tags": []interface{}{"a", "yes"}},
+			expected:  "name: agent\ntags:\n  - a\n  - \"yes\"\n",
+		},
+
+		// parse_xml and to_xml
+		{
+			name:      "xml",
+			transform: "parse_xml",
+			input:     `<?xml version="1.0"?><report version="2"><issue id="1">nil check</issue><issue id="2"><file>a.go</file></issue><summary>ok</summary></report>`,
+			expected:  `{"report":{"@version":"2","issue":[{"#text":"nil check","@id":"1"},{"@id":"2","file":"a.go"}],"summary":"ok"}}`,
+		},
+		{name: "invalid xml", transform: "parse_xml", input: "<a><b></a>", expectedInErr: "invalid XML"},
+		{name: "empty xml", transform: "parse_xml", input: "  ", expectedInErr: "no root element"},
+		{
+			name:      "to xml from parsed shape",
+			transform: "to_xml",
+			input: map[string]interface{}{"report": map[string]interface{}{
+				"@version": "2",
+				"issue":    []interface{}{map[string]interface{}{"@id": "1", "#text": "a < b"}, "plain"},
+				"empty":    map[string]interface{}{},
+			}},
+			expected: "<report version=\"2\">\n  <empty/>\n  <issue id=\"1\">a &lt; b</issue>\n  <issue>plain</issue>\n</report>\n",
+		},
+		{
+			name:      "to xml list with root",
+			transform: "to_xml",
+			input:     []interface{}{"a", "b"},
+			params:    map[string]interface{}{"root": "files", "item": "file"},
+			expected:  "<files>\n  <file>a</file>\n  <file>b</file>\n</files>\n",
+		},
+		{name: "to xml invalid name", transform: "to_xml", input: map[string]interface{}{"1bad": "x", "ok": "y"}, expectedInErr: "not a valid XML name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformer, ok := registry.GetTransformer(tt.transform)
+			if !ok {
+				t.Fatalf("Transformer %s is not registered", tt.transform)
+			}
+
+			params := tt.params
+			if params == nil {
+				params = map[string]interface{}{}
+			}
+			err := transformer.ValidateParams(params)
+			var result interface{}
+			if err == nil {
+				result, err = transformer.Transform(tt.input, params)
+			}
+
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actual, isText := result.(string)
+			if !isText {
+				encoded, _ := json.Marshal(result)
+				actual = string(encoded)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestCSVFromFile(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{Enabled: true, AllowedPaths: []string{"./data"}, BlockedPaths: []string{"data/private"}})
+	writePatchTestFile(t, "data/sales.csv", "region,total\nnorth,10\nsouth,20\neast,30\n")
+	writePatchTestFile(t, "data/private/keys.csv", "name,key\nprod,secret\n")
+	writePatchTestFile(t, "notes.csv", "a\n1\n")
+	parser := &CSVParser{validatePath: registry.validateFilePath}
+
+	rows, err := parser.Transform("data/sales.csv", map[string]interface{}{"from_file": true, "limit": float64(2)})
+	if err != nil {
+		t.Fatalf("parse_csv from_file failed: %v", err)
+	}
+	encoded, _ := json.Marshal(rows)
+	if expected := `[{"region":"north","total":10},{"region":"south","total":20}]`; string(encoded) != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+
+	for _, path := range []string{"/etc/passwd", "notes.csv", "data/private/keys.csv", "data/../notes.csv"} {
+		if _, err := parser.Transform(path, map[string]interface{}{"from_file": true}); err == nil || !strings.Contains(err.Error(), "path validation failed") {
+			t.Errorf("Expected %s to be rejected, got %v", path, err)
+		}
+	}
+}
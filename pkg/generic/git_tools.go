@@ -0,0 +1,237 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alantheprice/agent/pkg/interfaces"
+	"github.com/alantheprice/agent/pkg/providers/git"
+)
+
+// Git tools
+//
+// git_status, git_log, git_branch, git_checkout, git_show and git_blame run
+// against the repository in the working directory through git.Provider and
+// return structured results: commits, statuses and blamed lines are maps
+// with snake_case keys, and dates are RFC 3339 strings.
+
+// gitProvider returns a provider for the working directory bound to ctx
+func (tr *ToolRegistry) gitProvider(ctx context.Context) *git.Provider {
+	return git.NewProvider("").WithContext(ctx)
+}
+
+func (tr *ToolRegistry) executeGitStatus(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	status, err := tr.gitProvider(ctx).GetStatus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git status: %w", err)
+	}
+
+	return map[string]interface{}{
+		"branch":     status.Branch,
+		"ahead":      status.Ahead,
+		"behind":     status.Behind,
+		"staged":     stringsToInterfaces(status.Staged),
+		"unstaged":   stringsToInterfaces(status.Unstaged),
+		"untracked":  stringsToInterfaces(status.Untracked),
+		"conflicted": stringsToInterfaces(status.Conflicted),
+		"clean":      status.Clean,
+		"output":     formatGitStatus(status),
+		"success":    true,
+	}, nil
+}
+
+// formatGitStatus summarizes a status as text for prompts
+func formatGitStatus(status *interfaces.GitStatus) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "On branch %s", status.Branch)
+	if status.Ahead > 0 || status.Behind > 0 {
+		fmt.Fprintf(&b, " (ahead %d, behind %d)", status.Ahead, status.Behind)
+	}
+	b.WriteString("\n")
+	if status.Clean {
+		b.WriteString("nothing to commit, working tree clean\n")
+	}
+	for _, group := range []struct {
+		name  string
+		paths []string
+	}{
+		{"conflicted", status.Conflicted},
+		{"staged", status.Staged},
+		{"unstaged", status.Unstaged},
+		{"untracked", status.Untracked},
+	} {
+		for _, path := range group.paths {
+			fmt.Fprintf(&b, "%s: %s\n", group.name, path)
+		}
+	}
+	return b.String()
+}
+
+func (tr *ToolRegistry) executeGitLog(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	limit, err := intParam(params, "limit", 20)
+	if err != nil {
+		return nil, err
+	}
+	opts := git.LogOptions{Limit: limit}
+	opts.Ref, _ = params["ref"].(string)
+	opts.Author, _ = params["author"].(string)
+	opts.Since, _ = params["since"].(string)
+	if opts.Path, _ = params["path"].(string); opts.Path != "" {
+		if err := tr.validateFilePath(opts.Path); err != nil {
+			return nil, fmt.Errorf("path validation failed: %w", err)
+		}
+	}
+
+	commits, err := tr.gitProvider(ctx).Log(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git log: %w", err)
+	}
+	result := make([]interface{}, len(commits))
+	for i, commit := range commits {
+		result[i] = gitCommitToMap(commit)
+	}
+	return map[string]interface{}{"commits": result, "count": len(result), "success": true}, nil
+}
+
+func (tr *ToolRegistry) executeGitBranch(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	provider := tr.gitProvider(ctx)
+
+	created := ""
+	if name, _ := params["name"].(string); name != "" {
+		if err := provider.CreateBranch(name); err != nil {
+			return nil, fmt.Errorf("failed to create branch: %w", err)
+		}
+		created = name
+	}
+
+	branches, err := provider.GetBranches()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	current, err := provider.GetCurrentBranch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current branch: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"current":  current,
+		"branches": stringsToInterfaces(branches),
+		"success":  true,
+	}
+	if created != "" {
+		result["created"] = created
+	}
+	return result, nil
+}
+
+func (tr *ToolRegistry) executeGitCheckout(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	branch, ok := params["branch"].(string)
+	if !ok || branch == "" {
+		return nil, fmt.Errorf("branch parameter is required and must be a string")
+	}
+	create, err := boolParam(params, "create", false)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := tr.gitProvider(ctx)
+	if create {
+		if err := provider.CreateBranch(branch); err != nil {
+			return nil, fmt.Errorf("failed to create branch: %w", err)
+		}
+	}
+	if err := provider.CheckoutBranch(branch); err != nil {
+		return nil, fmt.Errorf("failed to check out branch: %w", err)
+	}
+	return map[string]interface{}{"branch": branch, "created": create, "success": true}, nil
+}
+
+func (tr *ToolRegistry) executeGitShow(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	rev, _ := params["rev"].(string)
+	includeDiff, err := boolParam(params, "diff", true)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := tr.gitProvider(ctx).Show(rev, includeDiff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show commit: %w", err)
+	}
+
+	files := make([]interface{}, len(details.Files))
+	for i, file := range details.Files {
+		entry := map[string]interface{}{"path": file.Path, "status": file.Status}
+		if file.OldPath != "" {
+			entry["old_path"] = file.OldPath
+		}
+		files[i] = entry
+	}
+	result := gitCommitToMap(details.GitCommit)
+	result["parents"] = stringsToInterfaces(details.Parents)
+	result["files"] = files
+	if includeDiff {
+		result["diff"] = details.Diff
+	}
+	result["success"] = true
+	return result, nil
+}
+
+func (tr *ToolRegistry) executeGitBlame(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	path, ok := params["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("path parameter is required and must be a string")
+	}
+	if err := tr.validateFilePath(path); err != nil {
+		return nil, fmt.Errorf("path validation failed: %w", err)
+	}
+	startLine, err := intParam(params, "start_line", 0)
+	if err != nil {
+		return nil, err
+	}
+	endLine, err := intParam(params, "end_line", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := tr.gitProvider(ctx).Blame(path, startLine, endLine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to blame %s: %w", path, err)
+	}
+	result := make([]interface{}, len(lines))
+	for i, line := range lines {
+		result[i] = map[string]interface{}{
+			"line":    line.Line,
+			"hash":    line.Hash,
+			"author":  line.Author,
+			"email":   line.Email,
+			"date":    line.Date.Format(time.RFC3339),
+			"summary": line.Summary,
+			"content": line.Content,
+		}
+	}
+	return map[string]interface{}{"path": path, "lines": result, "success": true}, nil
+}
+
+// gitCommitToMap converts a commit to a tool result map
+func gitCommitToMap(commit interfaces.GitCommit) map[string]interface{} {
+	subject, _, _ := strings.Cut(commit.Message, "\n")
+	return map[string]interface{}{
+		"hash":       commit.Hash,
+		"short_hash": commit.ShortHash,
+		"author":     commit.Author,
+		"email":      commit.Email,
+		"date":       commit.Date.Format(time.RFC3339),
+		"subject":    subject,
+		"message":    commit.Message,
+	}
+}
+
+func stringsToInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
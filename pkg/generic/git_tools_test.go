@@ -0,0 +1,102 @@
+package generic
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alantheprice/agent/pkg/providers/git"
+)
+
+func TestGitTools(t *testing.T) {
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Ana Tester")
+	t.Setenv("GIT_AUTHOR_EMAIL", "ana@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Ana Tester")
+	t.Setenv("GIT_COMMITTER_EMAIL", "ana@example.com")
+
+	registry := newPatchTestRegistry(t, &Security{BlockedPaths: []string{"secrets"}})
+	provider := git.NewProvider("")
+	if err := provider.InitRepository("."); err != nil {
+		t.Fatalf("InitRepository failed: %v", err)
+	}
+	writePatchTestFile(t, "main.go", "package main\n")
+	if err := provider.AddFiles(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CommitChanges("Initial commit\n\nSets up the module."); err != nil {
+		t.Fatal(err)
+	}
+
+	execute := func(name string, params map[string]interface{}) map[string]interface{} {
+		t.Helper()
+		tool, ok := registry.GetTool(name)
+		if !ok {
+			t.Fatalf("Tool %s not registered", name)
+		}
+		output, err := tool.Execute(context.Background(), params)
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		return output.(map[string]interface{})
+	}
+
+	execute("git_checkout", map[string]interface{}{"branch": "feature", "create": true})
+	writePatchTestFile(t, "main.go", "package main\n\nfunc main() {}\n")
+	writePatchTestFile(t, "notes.txt", "todo\n")
+
+	status := execute("git_status", nil)
+	if status["branch"] != "feature" || status["clean"] != false {
+		t.Errorf("Unexpected status %v", status)
+	}
+	if unstaged := status["unstaged"].([]interface{}); len(unstaged) != 1 || unstaged[0] != "main.go" {
+		t.Errorf("Expected main.go to be unstaged, got %v", unstaged)
+	}
+	if !strings.Contains(status["output"].(string), "untracked: notes.txt") {
+		t.Errorf("Expected the untracked file in the summary, got %q", status["output"])
+	}
+
+	if err := provider.AddFiles([]string{"main.go"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CommitChanges("Add main"); err != nil {
+		t.Fatal(err)
+	}
+
+	log := execute("git_log", map[string]interface{}{"limit": 1.0})
+	commits := log["commits"].([]interface{})
+	if len(commits) != 1 || commits[0].(map[string]interface{})["subject"] != "Add main" {
+		t.Errorf("Unexpected log %v", log)
+	}
+	log = execute("git_log", map[string]interface{}{"ref": "master"})
+	if first := log["commits"].([]interface{})[0].(map[string]interface{}); first["subject"] != "Initial commit" || first["message"] != "Initial commit\n\nSets up the module." {
+		t.Errorf("Unexpected commit %v", first)
+	}
+
+	branches := execute("git_branch", map[string]interface{}{"name": "release"})
+	if branches["current"] != "feature" || branches["created"] != "release" || len(branches["branches"].([]interface{})) != 3 {
+		t.Errorf("Unexpected branches %v", branches)
+	}
+
+	show := execute("git_show", map[string]interface{}{})
+	files := show["files"].([]interface{})
+	if show["subject"] != "Add main" || len(files) != 1 || files[0].(map[string]interface{})["status"] != "modified" {
+		t.Errorf("Unexpected show result %v", show)
+	}
+	if !strings.Contains(show["diff"].(string), "+func main() {}") {
+		t.Errorf("Expected the patch, got %q", show["diff"])
+	}
+
+	blame := execute("git_blame", map[string]interface{}{"path": "main.go", "start_line": 3.0})
+	lines := blame["lines"].([]interface{})
+	if len(lines) != 1 || lines[0].(map[string]interface{})["content"] != "func main() {}" || lines[0].(map[string]interface{})["summary"] != "Add main" {
+		t.Errorf("Unexpected blame %v", blame)
+	}
+
+	tool, _ := registry.GetTool("git_blame")
+	if _, err := tool.Execute(context.Background(), map[string]interface{}{"path": "secrets/key.txt"}); err == nil {
+		t.Errorf("Expected blocked paths to be rejected")
+	}
+}
@@ -0,0 +1,437 @@
+package generic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP requests
+//
+// The http_request tool and the http step type call APIs mid-run. Requests
+// may only go to hosts listed in security.allowed_hosts, as "api.github.com",
+// "localhost:8080" (that port only), "*.example.com" (subdomains) or "*";
+// redirects are checked against the same list. Responses with status 429 or
+// 5xx are retried with exponential backoff, honouring Retry-After. Failed
+// connections and timeouts are only retried for idempotent methods, since
+// the server may already have handled the request, unless
+// retry_non_idempotent is set. The body is read up to max_response_bytes and JSON responses
+// are parsed into "json".
+
+const (
+	defaultHTTPTimeout       = 30 * time.Second
+	defaultHTTPRetries       = 2
+	defaultHTTPRetryDelay    = 500 * time.Millisecond
+	maxHTTPRetryDelay        = 30 * time.Second
+	defaultHTTPResponseBytes = 5 << 20
+	maxHTTPRedirects         = 10
+	httpErrorBodyExcerpt     = 200
+)
+
+// errHostNotAllowed is returned for hosts missing from security.allowed_hosts
+var errHostNotAllowed = errors.New("host not allowed")
+
+// httpRequestSpec is a request read from tool params or step config
+type httpRequestSpec struct {
+	method             string
+	url                *url.URL
+	headers            map[string]string
+	body               []byte
+	contentType        string
+	timeout            time.Duration
+	retries            int
+	retryDelay         time.Duration
+	maxBytes           int
+	failOnStatus       bool
+	retryNonIdempotent bool
+}
+
+func (tr *ToolRegistry) executeHTTPRequest(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	spec, err := tr.httpRequestSpec(params)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Timeout: spec.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxHTTPRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxHTTPRedirects)
+			}
+			return tr.checkHost(req.URL)
+		},
+	}
+
+	start := time.Now()
+	var resp *http.Response
+	var body []byte
+	var truncated bool
+	attempt := 0
+	for {
+		attempt++
+		resp, body, truncated, err = doHTTPRequest(ctx, client, spec)
+		if !spec.retryable(resp, err) || attempt > spec.retries {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		delay := spec.retryDelay * time.Duration(math.Pow(2, float64(attempt-1)))
+		if resp != nil {
+			if after := retryAfter(resp.Header.Get("Retry-After")); after > delay {
+				delay = after
+			}
+		}
+		if delay > maxHTTPRetryDelay {
+			delay = maxHTTPRetryDelay
+		}
+		tr.logger.Debug("Retrying HTTP request", "method", spec.method, "host", spec.url.Host, "attempt", attempt, "delay", delay, "status", httpStatus(resp), "error", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("HTTP request cancelled during backoff: %w", ctx.Err())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed after %d attempts: %w", spec.method, redactURL(spec.url), attempt, err)
+	}
+
+	result := map[string]interface{}{
+		"url":         redactURL(resp.Request.URL),
+		"method":      spec.method,
+		"status":      resp.StatusCode,
+		"status_text": http.StatusText(resp.StatusCode),
+		"headers":     responseHeaders(resp.Header),
+		"body":        string(body),
+		"truncated":   truncated,
+		"attempts":    attempt,
+		"duration_ms": time.Since(start).Milliseconds(),
+		"success":     resp.StatusCode < 400,
+	}
+	if !truncated && len(bytes.TrimSpace(body)) > 0 && strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		var parsed interface{}
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			tr.logger.Debug("Failed to parse JSON response", "url", redactURL(spec.url), "error", err)
+		} else {
+			result["json"] = parsed
+		}
+	}
+
+	tr.logger.Debug("HTTP request completed", "method", spec.method, "host", resp.Request.URL.Host, "status", resp.StatusCode, "attempts", attempt, "bytes", len(body))
+
+	if spec.failOnStatus && resp.StatusCode >= 400 {
+		excerpt := strings.TrimSpace(string(body))
+		if len(excerpt) > httpErrorBodyExcerpt {
+			excerpt = excerpt[:httpErrorBodyExcerpt] + "..."
+		}
+		return nil, fmt.Errorf("%s %s returned %d %s: %s", spec.method, redactURL(spec.url), resp.StatusCode, http.StatusText(resp.StatusCode), excerpt)
+	}
+	return result, nil
+}
+
+// httpRequestSpec validates the request params
+func (tr *ToolRegistry) httpRequestSpec(params map[string]interface{}) (*httpRequestSpec, error) {
+	rawURL, ok := params["url"].(string)
+	if !ok || rawURL == "" {
+		return nil, fmt.Errorf("url parameter is required and must be a string")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("url must use http or https, got %q", u.Scheme)
+	}
+	if err := tr.checkHost(u); err != nil {
+		return nil, err
+	}
+
+	spec := &httpRequestSpec{url: u, headers: map[string]string{}}
+	spec.method, _ = params["method"].(string)
+	spec.method = strings.ToUpper(spec.method)
+
+	if query, ok := params["query"]; ok && query != nil {
+		values, ok := query.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("query must be an object, got %T", query)
+		}
+		q := u.Query()
+		if err := addFormValues(q, values); err != nil {
+			return nil, fmt.Errorf("query %w", err)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	if headers, ok := params["headers"]; ok && headers != nil {
+		values, ok := headers.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("headers must be an object, got %T", headers)
+		}
+		for name, value := range values {
+			spec.headers[name] = fmt.Sprint(value)
+		}
+	}
+
+	if err := spec.encodeBody(params); err != nil {
+		return nil, err
+	}
+	if spec.method == "" {
+		spec.method = http.MethodGet
+		if spec.body != nil {
+			spec.method = http.MethodPost
+		}
+	}
+
+	timeout, err := intParam(params, "timeout", int(defaultHTTPTimeout/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	spec.timeout = time.Duration(timeout) * time.Second
+	if spec.retries, err = intParam(params, "retries", defaultHTTPRetries); err != nil {
+		return nil, err
+	}
+	retryDelay, err := intParam(params, "retry_delay_ms", int(defaultHTTPRetryDelay/time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	spec.retryDelay = time.Duration(retryDelay) * time.Millisecond
+	if spec.maxBytes, err = intParam(params, "max_response_bytes", defaultHTTPResponseBytes); err != nil {
+		return nil, err
+	}
+	if spec.failOnStatus, err = boolParam(params, "fail_on_error_status", true); err != nil {
+		return nil, err
+	}
+	if spec.retryNonIdempotent, err = boolParam(params, "retry_non_idempotent", false); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// encodeBody encodes the body param: strings are sent as they are, other
+// values as JSON, or as a URL-encoded form with "body_type": "form"
+func (spec *httpRequestSpec) encodeBody(params map[string]interface{}) error {
+	body, ok := params["body"]
+	if !ok || body == nil {
+		return nil
+	}
+	bodyType, _ := params["body_type"].(string)
+
+	switch bodyType {
+	case "form":
+		values, ok := body.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("a form body must be an object, got %T", body)
+		}
+		form := url.Values{}
+		if err := addFormValues(form, values); err != nil {
+			return fmt.Errorf("body %w", err)
+		}
+		spec.body = []byte(form.Encode())
+		spec.contentType = "application/x-www-form-urlencoded"
+	case "", "json":
+		if text, ok := body.(string); ok && bodyType == "" {
+			spec.body = []byte(text)
+			spec.contentType = "text/plain; charset=utf-8"
+			break
+		}
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode body as JSON: %w", err)
+		}
+		spec.body = encoded
+		spec.contentType = "application/json"
+	case "text":
+		text, ok := body.(string)
+		if !ok {
+			return fmt.Errorf("a text body must be a string, got %T", body)
+		}
+		spec.body = []byte(text)
+		spec.contentType = "text/plain; charset=utf-8"
+	default:
+		return fmt.Errorf("body_type must be json, form or text, got %q", bodyType)
+	}
+	return nil
+}
+
+// addFormValues adds scalars and lists of scalars to form values
+func addFormValues(form url.Values, values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch v := values[key].(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				form.Add(key, formatFormValue(item))
+			}
+		case map[string]interface{}:
+			return fmt.Errorf("value %s cannot be an object", key)
+		default:
+			form.Add(key, formatFormValue(v))
+		}
+	}
+	return nil
+}
+
+func formatFormValue(value interface{}) string {
+	if f, ok := value.(float64); ok && f == math.Trunc(f) {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return fmt.Sprint(value)
+}
+
+// checkHost rejects URLs whose host is not in security.allowed_hosts
+func (tr *ToolRegistry) checkHost(u *url.URL) error {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+
+	if tr.security != nil {
+		for _, allowed := range tr.security.AllowedHosts {
+			allowed = strings.ToLower(strings.TrimSpace(allowed))
+			allowedHost, allowedPort := allowed, ""
+			if h, p, err := net.SplitHostPort(allowed); err == nil {
+				allowedHost, allowedPort = h, p
+			}
+			if allowedPort != "" && allowedPort != port {
+				continue
+			}
+			switch {
+			case allowedHost == "*", allowedHost == host:
+				return nil
+			case strings.HasPrefix(allowedHost, "*.") && strings.HasSuffix(host, allowedHost[1:]):
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %s is not in security.allowed_hosts", errHostNotAllowed, u.Host)
+}
+
+// doHTTPRequest sends one attempt and reads up to maxBytes of the body
+func doHTTPRequest(ctx context.Context, client *http.Client, spec *httpRequestSpec) (*http.Response, []byte, bool, error) {
+	var body io.Reader
+	if spec.body != nil {
+		body = bytes.NewReader(spec.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, spec.method, spec.url.String(), body)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	if spec.contentType != "" {
+		req.Header.Set("Content-Type", spec.contentType)
+	}
+	for name, value := range spec.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(spec.maxBytes)+1))
+	if err != nil {
+		return resp, nil, false, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > spec.maxBytes {
+		return resp, data[:spec.maxBytes], true, nil
+	}
+	return resp, data, false, nil
+}
+
+// retryable reports whether an attempt failed in a way worth retrying
+func (spec *httpRequestSpec) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// A redirect to a host that is not allowed fails every time
+		if errors.Is(err, errHostNotAllowed) || errors.Is(err, context.Canceled) {
+			return false
+		}
+		return spec.retryNonIdempotent || idempotentMethod(spec.method)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// idempotentMethod reports whether sending a request twice has the same
+// effect as sending it once
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func httpStatus(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// responseHeaders flattens response headers, joining repeated values
+func responseHeaders(header http.Header) map[string]interface{} {
+	result := make(map[string]interface{}, len(header))
+	for name, values := range header {
+		result[name] = strings.Join(values, ", ")
+	}
+	return result
+}
+
+// redactURL drops credentials and the query, which often carries tokens,
+// from URLs in results, logs and errors
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	if redacted.RawQuery != "" {
+		redacted.RawQuery = "..."
+	}
+	return redacted.String()
+}
+
+// executeHTTPStep runs an http step. Its config holds the http_request
+// params, with strings rendered as templates.
+func (we *WorkflowEngine) executeHTTPStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult) (interface{}, error) {
+	rendered, err := we.renderConfigValue(step, step.Config, previousResults, execCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render http config: %w", err)
+	}
+	params, _ := rendered.(map[string]interface{})
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return we.toolRegistry.executeHTTPRequest(ctx, params)
+}
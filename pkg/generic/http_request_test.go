@@ -0,0 +1,313 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newHTTPTestServer serves a few endpoints for the http_request tests and
+// counts the requests to /flaky
+func newHTTPTestServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var flaky atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"method":       r.Method,
+			"query":        r.URL.RawQuery,
+			"content_type": r.Header.Get("Content-Type"),
+			"token":        r.Header.Get("Authorization"),
+			"body":         string(body),
+		})
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if flaky.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/limited", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such thing", http.StatusNotFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": ["` + strings.Repeat("x", 100) + `"]}`))
+	})
+	mux.HandleFunc("/elsewhere", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace("http://"+r.Host, "127.0.0.1", "localhost", 1)+"/echo", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &flaky
+}
+
+func newHTTPTestRegistry(t *testing.T, allowedHosts ...string) *ToolRegistry {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry, err := NewToolRegistry(map[string]Tool{}, &Security{AllowedHosts: allowedHosts}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create tool registry: %v", err)
+	}
+	return registry
+}
+
+func TestHTTPRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		params    map[string]interface{}
+		check     func(t *testing.T, result map[string]interface{})
+		errorText string
+	}{
+		{
+			name:   "GET with query and headers",
+			path:   "/echo?page=1",
+			params: map[string]interface{}{"query": map[string]interface{}{"label": []interface{}{"bug", "ui"}, "per_page": 50.0}, "headers": map[string]interface{}{"Authorization": "token abc"}},
+			check: func(t *testing.T, result map[string]interface{}) {
+				echo := result["json"].(map[string]interface{})
+				if echo["method"] != "GET" || echo["query"] != "label=bug&label=ui&page=1&per_page=50" || echo["token"] != "token abc" {
+					t.Errorf("Unexpected request %v", echo)
+				}
+				if result["status"] != 200 || result["success"] != true || result["attempts"] != 1 {
+					t.Errorf("Unexpected result %v", result)
+				}
+			},
+		},
+		{
+			name:   "JSON body defaults to POST",
+			path:   "/echo",
+			params: map[string]interface{}{"body": map[string]interface{}{"body": "Looks good"}},
+			check: func(t *testing.T, result map[string]interface{}) {
+				echo := result["json"].(map[string]interface{})
+				if echo["method"] != "POST" || echo["content_type"] != "application/json" || echo["body"] != `{"body":"Looks good"}` {
+					t.Errorf("Unexpected request %v", echo)
+				}
+			},
+		},
+		{
+			name:   "form body",
+			path:   "/echo",
+			params: map[string]interface{}{"method": "put", "body": map[string]interface{}{"name": "a b", "n": 2.0}, "body_type": "form"},
+			check: func(t *testing.T, result map[string]interface{}) {
+				echo := result["json"].(map[string]interface{})
+				if echo["method"] != "PUT" || echo["content_type"] != "application/x-www-form-urlencoded" || echo["body"] != "n=2&name=a+b" {
+					t.Errorf("Unexpected request %v", echo)
+				}
+			},
+		},
+		{
+			name:   "retries server errors",
+			path:   "/flaky",
+			params: map[string]interface{}{"retry_delay_ms": 1.0},
+			check: func(t *testing.T, result map[string]interface{}) {
+				if result["body"] != "ok" || result["attempts"] != 3 {
+					t.Errorf("Unexpected result %v", result)
+				}
+				if _, ok := result["json"]; ok {
+					t.Errorf("Expected no json for a text response")
+				}
+			},
+		},
+		{
+			name:      "gives up after the retries",
+			path:      "/limited",
+			params:    map[string]interface{}{"retries": 1.0, "retry_delay_ms": 1.0},
+			errorText: "returned 429 Too Many Requests: slow down",
+		},
+		{
+			name:   "error status without failing",
+			path:   "/missing",
+			params: map[string]interface{}{"fail_on_error_status": false},
+			check: func(t *testing.T, result map[string]interface{}) {
+				if result["status"] != 404 || result["success"] != false || result["attempts"] != 1 {
+					t.Errorf("Unexpected result %v", result)
+				}
+			},
+		},
+		{
+			name:   "response size cap",
+			path:   "/large",
+			params: map[string]interface{}{"max_response_bytes": 20.0},
+			check: func(t *testing.T, result map[string]interface{}) {
+				if result["body"] != `{"items": ["xxxxxxxx` || result["truncated"] != true {
+					t.Errorf("Unexpected result %v", result)
+				}
+				if _, ok := result["json"]; ok {
+					t.Errorf("Expected a truncated body not to be parsed")
+				}
+			},
+		},
+		{
+			name:      "redirect to a host that is not allowed",
+			path:      "/elsewhere",
+			errorText: "localhost:",
+		},
+		{
+			name:      "invalid body type",
+			path:      "/echo",
+			params:    map[string]interface{}{"body": "x", "body_type": "xml"},
+			errorText: "body_type must be json, form or text",
+		},
+	}
+
+	server, _ := newHTTPTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newHTTPTestRegistry(t, "127.0.0.1")
+			params := map[string]interface{}{"url": server.URL + tt.path}
+			for key, value := range tt.params {
+				params[key] = value
+			}
+
+			output, err := registry.executeHTTPRequest(context.Background(), params)
+			if tt.errorText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorText) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("http_request failed: %v", err)
+			}
+			tt.check(t, output.(map[string]interface{}))
+		})
+	}
+}
+
+func TestHTTPRequestAllowedHosts(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed []string
+		ok      bool
+	}{
+		{"https://api.github.com/repos", []string{"api.github.com"}, true},
+		{"https://API.GitHub.com/repos", []string{"api.github.com"}, true},
+		{"https://uploads.github.com/x", []string{"*.github.com"}, true},
+		{"https://github.com/x", []string{"*.github.com"}, false},
+		{"https://evilgithub.com/x", []string{"*.github.com"}, false},
+		{"http://localhost:8080/x", []string{"localhost:8080"}, true},
+		{"http://localhost:9090/x", []string{"localhost:8080"}, false},
+		{"https://example.com/x", []string{"example.com:443"}, true},
+		{"https://example.com/x", []string{"*"}, true},
+		{"https://example.com/x", nil, false},
+	}
+
+	for _, tt := range tests {
+		registry := newHTTPTestRegistry(t, tt.allowed...)
+		_, err := registry.httpRequestSpec(map[string]interface{}{"url": tt.url})
+		if tt.ok && err != nil {
+			t.Errorf("Expected %s to be allowed by %v, got %v", tt.url, tt.allowed, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "not in security.allowed_hosts")) {
+			t.Errorf("Expected %s to be rejected by %v, got %v", tt.url, tt.allowed, err)
+		}
+	}
+
+	registry := newHTTPTestRegistry(t, "*")
+	if _, err := registry.httpRequestSpec(map[string]interface{}{"url": "file:///etc/passwd"}); err == nil {
+		t.Errorf("Expected non-HTTP URLs to be rejected")
+	}
+}
+
+func TestHTTPStep(t *testing.T) {
+	server, _ := newHTTPTestServer(t)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry := newHTTPTestRegistry(t, "127.0.0.1")
+	validator, _ := NewValidator(Validation{Enabled: false}, logger)
+	engine, err := NewWorkflowEngine([]Workflow{}, registry, newTestLLMClient(t, server.URL), validator, logger)
+	if err != nil {
+		t.Fatalf("Failed to create workflow engine: %v", err)
+	}
+
+	execCtx := &ExecutionContext{
+		Context:     context.Background(),
+		StartTime:   time.Now(),
+		Data:        map[string]interface{}{},
+		Variables:   map[string]string{},
+		StepResults: map[string]*StepResult{},
+		Metrics:     &ExecutionMetrics{},
+	}
+	execCtx.StepResults["review"] = &StepResult{StepName: "review", Success: true, Output: map[string]interface{}{"summary": "Looks good", "pr": 42.0}}
+
+	step := Step{Name: "comment", Type: "http", Config: map[string]interface{}{
+		"url":    server.URL + "/echo",
+		"query":  map[string]interface{}{"pr": "{review.pr}"},
+		"body":   map[string]interface{}{"body": "Review: {review.summary}"},
+		"method": "POST",
+	}}
+	result, err := engine.executeStep(context.Background(), step, execCtx, execCtx.StepResults)
+	if err != nil {
+		t.Fatalf("http step failed: %v", err)
+	}
+	echo := result.Output.(map[string]interface{})["json"].(map[string]interface{})
+	expected := map[string]interface{}{
+		"method":       "POST",
+		"query":        "pr=42",
+		"content_type": "application/json",
+		"token":        "",
+		"body":         `{"body":"Review: Looks good"}`,
+	}
+	if !reflect.DeepEqual(echo, expected) {
+		t.Errorf("Expected request %v, got %v", expected, echo)
+	}
+}
+
+func TestHTTPRequestRetriesAfterTransportErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		params   map[string]interface{}
+		attempts int32
+	}{
+		{name: "GET is retried", method: "GET", attempts: 3},
+		{name: "PUT is retried", method: "PUT", attempts: 3},
+		{name: "POST is sent once", method: "POST", attempts: 1},
+		{name: "PATCH is sent once", method: "PATCH", attempts: 1},
+		{name: "POST retried on request", method: "POST", params: map[string]interface{}{"retry_non_idempotent": true}, attempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The server reads each request and drops the connection, as when
+			// a request times out after the server has handled it
+			var received atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received.Add(1)
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+			}))
+			defer server.Close()
+
+			registry := newHTTPTestRegistry(t, "127.0.0.1")
+			params := map[string]interface{}{"url": server.URL, "method": tt.method, "body": map[string]interface{}{"body": "Looks good"}, "retry_delay_ms": 1.0}
+			for key, value := range tt.params {
+				params[key] = value
+			}
+			if _, err := registry.executeHTTPRequest(context.Background(), params); err == nil {
+				t.Fatalf("Expected the dropped connection to fail the request")
+			}
+			if got := received.Load(); got != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, got)
+			}
+		})
+	}
+}
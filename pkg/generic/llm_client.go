@@ -14,13 +14,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/alantheprice/agent/pkg/interfaces/types"
 	providerConfig "github.com/alantheprice/agent/pkg/providers/config"
 )
 
 // LLMClient handles interactions with LLM providers
 type LLMClient struct {
-	config LLMConfig
-	logger *slog.Logger
+	config         LLMConfig
+	logger         *slog.Logger
+	responseFormat *types.ResponseFormat
 }
 
 // LLMResponse represents a response from the LLM
@@ -29,20 +31,52 @@ type LLMResponse struct {
 	TokensUsed int                    `json:"tokens_used"`
 	Cost       float64                `json:"cost"`
 	Model      string                 `json:"model"`
+	ToolCalls  []types.ToolCall       `json:"tool_calls,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata"`
 }
 
+// ToolDefinition describes a tool offered to the LLM through function calling
+type ToolDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
 // GetConfig returns the LLM configuration
 func (llm *LLMClient) GetConfig() LLMConfig {
 	return llm.config
 }
 
+// WithParameters returns a copy of the client that uses the given sampling
+// parameters. The copy shares the resolved API key, so it is cheap to make
+// per step.
+func (llm *LLMClient) WithParameters(temperature float64, maxTokens int) *LLMClient {
+	client := *llm
+	client.config.Temperature = temperature
+	client.config.MaxTokens = maxTokens
+	return &client
+}
+
+// WithResponseFormat returns a copy of the client that asks the provider for
+// the given response format through its native JSON mode
+func (llm *LLMClient) WithResponseFormat(format *types.ResponseFormat) *LLMClient {
+	client := *llm
+	client.responseFormat = format
+	return &client
+}
+
 // NewLLMClient creates a new LLM client
 func NewLLMClient(config LLMConfig, logger *slog.Logger) (*LLMClient, error) {
+	return newLLMClient(config, logger, true)
+}
+
+// newLLMClient creates a client, asking for a missing API key on stdin only
+// when allowPrompt is set
+func newLLMClient(config LLMConfig, logger *slog.Logger, allowPrompt bool) (*LLMClient, error) {
 	// Resolve API key using the new configuration system with automatic prompting
 	if config.APIKey == "" {
 		// Use the new prompting-enabled function for interactive key management
-		apiKey := providerConfig.GetAPIKeyForProviderWithPrompt(config.Provider, true)
+		apiKey := providerConfig.GetAPIKeyForProviderWithPrompt(config.Provider, allowPrompt)
 		config.APIKey = apiKey
 		logger.Debug("API key from config system", "provider", config.Provider, "found", config.APIKey != "")
 	}
@@ -300,6 +334,98 @@ func (llm *LLMClient) Chat(ctx context.Context, messages []Message) (*LLMRespons
 	}
 }
 
+// ChatStream sends a chat message to the LLM and writes response tokens to
+// writer as they arrive. The complete response is still returned so callers
+// can record content, usage and cost once the stream finishes.
+func (llm *LLMClient) ChatStream(ctx context.Context, messages []Message, writer io.Writer) (*LLMResponse, error) {
+	llm.logger.Info("Sending streaming chat request to LLM",
+		"provider", llm.config.Provider,
+		"model", llm.config.Model,
+		"message_count", len(messages))
+
+	switch llm.config.Provider {
+	case "deepinfra":
+		return llm.streamOpenAICompatibleAPI(ctx, messages, llm.baseURL("https://api.deepinfra.com/v1/openai"), "deepinfra", writer)
+	default:
+		// Providers without a streaming integration fall back to a blocking
+		// request and emit the whole answer at once
+		response, err := llm.Chat(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(writer, response.Content); err != nil {
+			return nil, fmt.Errorf("failed to write response: %w", err)
+		}
+		return response, nil
+	}
+}
+
+// ChatWithTools sends a chat request that offers tools to the LLM. When the
+// model decides to call tools, the calls are returned in LLMResponse.ToolCalls
+// and the caller is expected to answer each with a "tool" message.
+func (llm *LLMClient) ChatWithTools(ctx context.Context, messages []Message, tools []ToolDefinition) (*LLMResponse, error) {
+	llm.logger.Info("Sending chat request with tools to LLM",
+		"provider", llm.config.Provider,
+		"model", llm.config.Model,
+		"message_count", len(messages),
+		"tool_count", len(tools))
+
+	switch llm.config.Provider {
+	case "deepinfra":
+		return llm.callOpenAICompatibleAPI(ctx, messages, tools, llm.baseURL("https://api.deepinfra.com/v1/openai"), "deepinfra")
+	default:
+		return nil, fmt.Errorf("tool calling not implemented for LLM provider: %s", llm.config.Provider)
+	}
+}
+
+// ModelInfo describes the configured model using the provider capabilities
+// in configs/providers.json. "supports_tools", "supports_json_mode" and
+// "context_window" entries in provider_config override the provider defaults
+// for models that differ.
+func (llm *LLMClient) ModelInfo() types.ModelInfo {
+	info := types.ModelInfo{
+		Name:     llm.config.Model,
+		Provider: llm.config.Provider,
+		// Without providers.json, assume native tools and JSON mode wherever
+		// the client has an integration
+		SupportsTools:    llm.config.Provider == "deepinfra",
+		SupportsJSONMode: llm.config.Provider == "deepinfra",
+	}
+
+	if providers, err := providerConfig.LoadProvidersConfig(); err == nil {
+		if definition, exists := providers.Providers[llm.config.Provider]; exists {
+			info.MaxTokens = definition.Capabilities.MaxTokens
+			info.SupportsTools = definition.Capabilities.SupportsTools
+			info.SupportsImages = definition.Capabilities.SupportsImages
+			info.SupportsJSONMode = definition.Capabilities.SupportsJSONMode
+		}
+	} else {
+		llm.logger.Debug("Provider capabilities unavailable", "provider", llm.config.Provider, "error", err)
+	}
+
+	if supportsTools, ok := llm.config.ProviderConfig["supports_tools"].(bool); ok {
+		info.SupportsTools = supportsTools
+	}
+	if supportsJSONMode, ok := llm.config.ProviderConfig["supports_json_mode"].(bool); ok {
+		info.SupportsJSONMode = supportsJSONMode
+	}
+	if contextWindow, ok := llm.config.ProviderConfig["context_window"].(float64); ok && contextWindow > 0 {
+		info.MaxTokens = int(contextWindow)
+	}
+
+	return info
+}
+
+// EstimateTokens gives a rough token count for messages, using the same
+// four-characters-per-token estimate as the providers
+func (llm *LLMClient) EstimateTokens(messages []Message) int {
+	totalChars := 0
+	for _, msg := range messages {
+		totalChars += len(msg.Content) + len(msg.Role) + 10 // Add some overhead
+	}
+	return totalChars / 4
+}
+
 // Complete generates a completion from a prompt
 func (llm *LLMClient) Complete(ctx context.Context, prompt string) (*LLMResponse, error) {
 	messages := []Message{
@@ -317,10 +443,13 @@ func (llm *LLMClient) CompleteWithSystem(ctx context.Context, systemPrompt, user
 	return llm.Chat(ctx, messages)
 }
 
-// Message represents a chat message
+// Message represents a chat message. Assistant messages may carry tool calls,
+// and "tool" messages answer one of them by ToolCallID.
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []types.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
 }
 
 // Provider-specific implementations (placeholders for now)
@@ -341,7 +470,7 @@ func (llm *LLMClient) chatOllama(ctx context.Context, messages []Message) (*LLMR
 }
 
 func (llm *LLMClient) chatDeepInfra(ctx context.Context, messages []Message) (*LLMResponse, error) {
-	return llm.callOpenAICompatibleAPI(ctx, messages, "https://api.deepinfra.com/v1/openai", "deepinfra")
+	return llm.callOpenAICompatibleAPI(ctx, messages, nil, llm.baseURL("https://api.deepinfra.com/v1/openai"), "deepinfra")
 }
 
 func (llm *LLMClient) chatGroq(ctx context.Context, messages []Message) (*LLMResponse, error) {
@@ -349,21 +478,19 @@ func (llm *LLMClient) chatGroq(ctx context.Context, messages []Message) (*LLMRes
 }
 
 // callOpenAICompatibleAPI makes a call to an OpenAI-compatible API
-func (llm *LLMClient) callOpenAICompatibleAPI(ctx context.Context, messages []Message, baseURL, providerName string) (*LLMResponse, error) {
+func (llm *LLMClient) callOpenAICompatibleAPI(ctx context.Context, messages []Message, tools []ToolDefinition, baseURL, providerName string) (*LLMResponse, error) {
 	// Log the API key status (without revealing the key)
 	llm.logger.Debug("Making API call", "provider", providerName, "baseURL", baseURL, "has_api_key", llm.config.APIKey != "", "api_key_length", len(llm.config.APIKey))
-	// Convert messages to OpenAI format
-	openaiMessages := make([]OpenAIMessage, len(messages))
-	for i, msg := range messages {
-		openaiMessages[i] = OpenAIMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		}
-	}
-
-	request := OpenAIRequest{
-		Model:    llm.config.Model,
-		Messages: openaiMessages,
+	request := llm.newOpenAIRequest(messages)
+	for _, tool := range tools {
+		request.Tools = append(request.Tools, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
 	}
 
 	requestBody, err := json.Marshal(request)
@@ -405,27 +532,196 @@ func (llm *LLMClient) callOpenAICompatibleAPI(ctx context.Context, messages []Me
 		return nil, fmt.Errorf("no choices in response")
 	}
 
-	// Calculate simple cost estimate (this would be provider-specific in reality)
-	cost := float64(apiResponse.Usage.TotalTokens) * 0.002 / 1000 // rough estimate
-
 	return &LLMResponse{
 		Content:    apiResponse.Choices[0].Message.Content,
 		TokensUsed: apiResponse.Usage.TotalTokens,
-		Cost:       cost,
+		Cost:       estimateCost(apiResponse.Usage.TotalTokens),
 		Model:      llm.config.Model,
+		ToolCalls:  apiResponse.Choices[0].Message.ToolCalls,
 		Metadata:   map[string]interface{}{"provider": providerName},
 	}, nil
 }
 
+// streamOpenAICompatibleAPI makes a streaming call to an OpenAI-compatible API,
+// forwarding content deltas to writer as server-sent events arrive
+func (llm *LLMClient) streamOpenAICompatibleAPI(ctx context.Context, messages []Message, baseURL, providerName string, writer io.Writer) (*LLMResponse, error) {
+	llm.logger.Debug("Making streaming API call", "provider", providerName, "baseURL", baseURL, "has_api_key", llm.config.APIKey != "")
+
+	request := llm.newOpenAIRequest(messages)
+	request.Stream = true
+	request.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+llm.config.APIKey)
+
+	// No overall client timeout: long answers are expected to stream for a
+	// while, and cancellation is handled through ctx
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request to %s: %w", providerName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		responseBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(responseBody))
+	}
+
+	var content strings.Builder
+	var usage *OpenAIUsage
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			llm.logger.Debug("Skipping malformed stream chunk", "provider", providerName, "error", err)
+			continue
+		}
+
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			delta := chunk.Choices[0].Delta.Content
+			content.WriteString(delta)
+			if _, err := io.WriteString(writer, delta); err != nil {
+				return nil, fmt.Errorf("failed to write stream content: %w", err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream from %s: %w", providerName, err)
+	}
+
+	metadata := map[string]interface{}{"provider": providerName, "streamed": true}
+
+	// Not every OpenAI-compatible endpoint honours include_usage, so fall back
+	// to a rough estimate (~4 characters per token) when usage is missing
+	tokensUsed := 0
+	if usage != nil {
+		tokensUsed = usage.TotalTokens
+	} else {
+		promptChars := 0
+		for _, msg := range messages {
+			promptChars += len(msg.Content)
+		}
+		tokensUsed = (promptChars + content.Len()) / 4
+		metadata["estimated_usage"] = true
+	}
+
+	return &LLMResponse{
+		Content:    content.String(),
+		TokensUsed: tokensUsed,
+		Cost:       estimateCost(tokensUsed),
+		Model:      llm.config.Model,
+		Metadata:   metadata,
+	}, nil
+}
+
+// newOpenAIRequest converts messages to OpenAI format and applies the
+// client's sampling parameters
+func (llm *LLMClient) newOpenAIRequest(messages []Message) OpenAIRequest {
+	openaiMessages := make([]OpenAIMessage, len(messages))
+	for i, msg := range messages {
+		openaiMessages[i] = OpenAIMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+	}
+
+	return OpenAIRequest{
+		Model:          llm.config.Model,
+		Messages:       openaiMessages,
+		Temperature:    llm.config.Temperature,
+		MaxTokens:      llm.config.MaxTokens,
+		ResponseFormat: toOpenAIResponseFormat(llm.responseFormat),
+	}
+}
+
+// baseURL returns the provider base URL, preferring a base_url override from
+// the provider config
+func (llm *LLMClient) baseURL(defaultURL string) string {
+	if baseURL, ok := llm.config.ProviderConfig["base_url"].(string); ok && baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
+	}
+	return defaultURL
+}
+
+// estimateCost calculates a simple cost estimate (this would be provider-specific in reality)
+func estimateCost(totalTokens int) float64 {
+	return float64(totalTokens) * 0.002 / 1000 // rough estimate
+}
+
 // OpenAI API types for compatibility
 type OpenAIRequest struct {
-	Model    string          `json:"model"`
-	Messages []OpenAIMessage `json:"messages"`
+	Model          string                `json:"model"`
+	Messages       []OpenAIMessage       `json:"messages"`
+	Temperature    float64               `json:"temperature"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Tools          []OpenAITool          `json:"tools,omitempty"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type OpenAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []types.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
+}
+
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+type OpenAIFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
 }
 
 type OpenAIResponse struct {
@@ -438,5 +734,16 @@ type OpenAIChoice struct {
 }
 
 type OpenAIUsage struct {
-	TotalTokens int `json:"total_tokens"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type OpenAIStreamChunk struct {
+	Choices []OpenAIStreamChoice `json:"choices"`
+	Usage   *OpenAIUsage         `json:"usage,omitempty"`
+}
+
+type OpenAIStreamChoice struct {
+	Delta OpenAIMessage `json:"delta"`
 }
@@ -0,0 +1,149 @@
+package generic
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// knownLLMProviders lists the providers LLMClient can dispatch to
+var knownLLMProviders = map[string]bool{
+	"openai":    true,
+	"anthropic": true,
+	"gemini":    true,
+	"ollama":    true,
+	"deepinfra": true,
+	"groq":      true,
+}
+
+// LLMClientPool hands out LLM clients keyed by provider and model, so steps
+// that override the model share one client and one resolved API key
+type LLMClientPool struct {
+	defaultClient *LLMClient
+	clients       map[string]*pooledClient
+	mu            sync.Mutex
+	logger        *slog.Logger
+}
+
+// pooledClient is created once, outside the pool's lock, so creating one
+// client does not hold up steps that use others
+type pooledClient struct {
+	once   sync.Once
+	client *LLMClient
+	err    error
+}
+
+// NewLLMClientPool creates a pool seeded with the agent's default client
+func NewLLMClientPool(defaultClient *LLMClient, logger *slog.Logger) *LLMClientPool {
+	pool := &LLMClientPool{
+		defaultClient: defaultClient,
+		clients:       make(map[string]*pooledClient),
+		logger:        logger,
+	}
+
+	if defaultClient != nil {
+		entry := &pooledClient{client: defaultClient}
+		entry.once.Do(func() {})
+		pool.clients[poolKey(defaultClient.config.Provider, defaultClient.config.Model)] = entry
+	}
+
+	return pool
+}
+
+// Default returns the agent's default client
+func (p *LLMClientPool) Default() *LLMClient {
+	return p.defaultClient
+}
+
+// Get returns the client for provider and model, creating it on first use.
+// Empty values fall back to the default client's provider and model. The
+// pool never prompts for API keys: a provider without one is an error, and
+// a later Get tries again.
+func (p *LLMClientPool) Get(provider, model string) (*LLMClient, error) {
+	var base LLMConfig
+	if p.defaultClient != nil {
+		base = p.defaultClient.config
+	}
+
+	if provider == "" {
+		provider = base.Provider
+	}
+	if model == "" {
+		model = base.Model
+	}
+	if provider == "" || model == "" {
+		return nil, fmt.Errorf("no default LLM client configured and step does not specify provider and model")
+	}
+
+	key := poolKey(provider, model)
+
+	p.mu.Lock()
+	entry, exists := p.clients[key]
+	if !exists {
+		entry = &pooledClient{}
+		p.clients[key] = entry
+	}
+	p.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.client, entry.err = p.newClient(base, provider, model)
+		if entry.err != nil {
+			p.mu.Lock()
+			if p.clients[key] == entry {
+				delete(p.clients, key)
+			}
+			p.mu.Unlock()
+		}
+	})
+	return entry.client, entry.err
+}
+
+// newClient creates the client for provider and model from the default
+// client's settings
+func (p *LLMClientPool) newClient(base LLMConfig, provider, model string) (*LLMClient, error) {
+	key := poolKey(provider, model)
+	config := base
+	config.Model = model
+	if provider != base.Provider {
+		// API keys and provider settings such as base_url belong to the
+		// default provider, so resolve them afresh for a different one
+		config.Provider = provider
+		config.APIKey = ""
+		config.ProviderConfig = nil
+	}
+
+	client, err := newLLMClient(config, p.logger, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM client for %s: %w", key, err)
+	}
+
+	p.logger.Debug("Added LLM client to pool", "provider", provider, "model", model)
+
+	return client, nil
+}
+
+// ResolveModelRole looks up a role in LLMConfig.SpecializedModels. Values may
+// name just a model ("gpt-4o-mini") or a provider and model
+// ("groq:llama-3.1-8b-instant"); the provider prefix is only recognised when it
+// names a known provider, since model names may contain colons themselves.
+func (p *LLMClientPool) ResolveModelRole(role string) (provider, model string, err error) {
+	if p.defaultClient == nil {
+		return "", "", fmt.Errorf("model role %q requested but no default LLM client is configured", role)
+	}
+
+	value, exists := p.defaultClient.config.SpecializedModels[role]
+	if !exists || value == "" {
+		return "", "", fmt.Errorf("model role %q not found in llm.specialized_models", role)
+	}
+
+	if prefix, rest, found := strings.Cut(value, ":"); found && knownLLMProviders[prefix] {
+		return prefix, rest, nil
+	}
+
+	return "", value, nil
+}
+
+func poolKey(provider, model string) string {
+	return provider + "/" + model
+}
@@ -0,0 +1,264 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newChatTestServer returns an OpenAI-compatible server that answers every
+// request with content and records each decoded request body
+func newChatTestServer(t *testing.T, content string, requests *[]map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if requests != nil {
+			*requests = append(*requests, body)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenAIResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: content}}},
+			Usage:   OpenAIUsage{TotalTokens: 5},
+		})
+	}))
+}
+
+func TestLLMClientPoolGet(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	defaultClient := newTestLLMClient(t, "http://localhost")
+	pool := NewLLMClientPool(defaultClient, logger)
+
+	client, err := pool.Get("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client != defaultClient {
+		t.Error("Expected empty provider and model to return the default client")
+	}
+
+	first, err := pool.Get("deepinfra", "small-model")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, _ := pool.Get("", "small-model")
+	if first != second {
+		t.Error("Expected clients to be pooled per provider and model")
+	}
+	if first.config.Model != "small-model" || first.config.APIKey != "test-key" {
+		t.Errorf("Expected pooled client to inherit the default provider settings, got %+v", first.config)
+	}
+
+	if _, err := NewLLMClientPool(nil, logger).Get("", ""); err == nil {
+		t.Error("Expected error when no default client and no provider or model")
+	}
+}
+
+func TestLLMClientPoolConcurrentGet(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	pool := NewLLMClientPool(newTestLLMClient(t, "http://localhost"), logger)
+
+	clients := make([]*LLMClient, 8)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i], _ = pool.Get("", "shared-model")
+		}(i)
+	}
+	wg.Wait()
+	for _, client := range clients {
+		if client == nil || client != clients[0] {
+			t.Fatalf("Expected every caller to get one shared client, got %v", clients)
+		}
+	}
+}
+
+func TestLLMClientPoolDoesNotPrompt(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GROQ_API_KEY", "")
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	pool := NewLLMClientPool(newTestLLMClient(t, "http://localhost"), logger)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := pool.Get("groq", "llama-3.1-8b-instant")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "no API key available for provider groq") {
+			t.Errorf("Expected a missing API key error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get blocked instead of reporting the missing API key")
+	}
+
+	// The failure is not cached, and other clients are unaffected
+	if _, err := pool.Get("groq", "llama-3.1-8b-instant"); err == nil {
+		t.Error("Expected the missing API key to be reported again")
+	}
+	if _, err := pool.Get("", ""); err != nil {
+		t.Errorf("Expected the default client, got %v", err)
+	}
+}
+
+func TestLLMClientPoolResolveModelRole(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	defaultClient := newTestLLMClient(t, "http://localhost")
+	defaultClient.config.SpecializedModels = map[string]string{
+		"fast":      "groq:llama-3.1-8b-instant",
+		"reasoning": "deepseek-ai/DeepSeek-R1",
+		"local":     "llama3:8b",
+	}
+	pool := NewLLMClientPool(defaultClient, logger)
+
+	tests := []struct {
+		role             string
+		expectedProvider string
+		expectedModel    string
+		expectError      bool
+	}{
+		{role: "fast", expectedProvider: "groq", expectedModel: "llama-3.1-8b-instant"},
+		{role: "reasoning", expectedModel: "deepseek-ai/DeepSeek-R1"},
+		{role: "local", expectedModel: "llama3:8b"},
+		{role: "missing", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			provider, model, err := pool.ResolveModelRole(tt.role)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if provider != tt.expectedProvider || model != tt.expectedModel {
+				t.Errorf("Expected %q/%q, got %q/%q", tt.expectedProvider, tt.expectedModel, provider, model)
+			}
+		})
+	}
+}
+
+func TestLLMStepOverrides(t *testing.T) {
+	var requests []map[string]interface{}
+	server := newChatTestServer(t, "positive", &requests)
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	toolRegistry, _ := NewToolRegistry(map[string]Tool{}, &Security{Enabled: false}, logger)
+	validator, _ := NewValidator(Validation{Enabled: false}, logger)
+
+	llmClient := newTestLLMClient(t, server.URL)
+	llmClient.config.Temperature = 0.7
+	llmClient.config.MaxTokens = 4096
+	llmClient.config.SystemPrompt = "You are a helpful assistant."
+	llmClient.config.SpecializedModels = map[string]string{"fast": "tiny-model"}
+
+	engine, _ := NewWorkflowEngine([]Workflow{}, toolRegistry, llmClient, validator, logger)
+
+	tests := []struct {
+		name                string
+		config              map[string]interface{}
+		expectedModel       string
+		expectedTemperature float64
+		expectedMaxTokens   float64
+		expectedSystem      string
+	}{
+		{
+			name:                "defaults",
+			config:              map[string]interface{}{},
+			expectedModel:       "test-model",
+			expectedTemperature: 0.7,
+			expectedMaxTokens:   4096,
+			expectedSystem:      "You are a helpful assistant.",
+		},
+		{
+			name: "model role with parameter overrides",
+			config: map[string]interface{}{
+				"model_role":    "fast",
+				"temperature":   0.0,
+				"max_tokens":    16.0,
+				"system_prompt": "Classify the sentiment.",
+			},
+			expectedModel:       "tiny-model",
+			expectedTemperature: 0,
+			expectedMaxTokens:   16,
+			expectedSystem:      "Classify the sentiment.",
+		},
+		{
+			name:                "explicit model",
+			config:              map[string]interface{}{"model": "big-model"},
+			expectedModel:       "big-model",
+			expectedTemperature: 0.7,
+			expectedMaxTokens:   4096,
+			expectedSystem:      "You are a helpful assistant.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			tt.config["prompt"] = "How does this read?"
+
+			execCtx := &ExecutionContext{
+				Context:     context.Background(),
+				SessionID:   "test-session",
+				StartTime:   time.Now(),
+				Data:        make(map[string]interface{}),
+				Variables:   make(map[string]string),
+				StepResults: make(map[string]*StepResult),
+				Metrics:     &ExecutionMetrics{},
+			}
+
+			step := Step{Name: "classify", Type: "llm", Config: tt.config}
+			result, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Metadata["model"] != tt.expectedModel {
+				t.Errorf("Expected model metadata %q, got %v", tt.expectedModel, result.Metadata["model"])
+			}
+
+			if len(requests) != 1 {
+				t.Fatalf("Expected 1 request, got %d", len(requests))
+			}
+			request := requests[0]
+			if request["model"] != tt.expectedModel {
+				t.Errorf("Expected model %q, got %v", tt.expectedModel, request["model"])
+			}
+			if request["temperature"] != tt.expectedTemperature {
+				t.Errorf("Expected temperature %v, got %v", tt.expectedTemperature, request["temperature"])
+			}
+			if request["max_tokens"] != tt.expectedMaxTokens {
+				t.Errorf("Expected max_tokens %v, got %v", tt.expectedMaxTokens, request["max_tokens"])
+			}
+
+			messages, _ := request["messages"].([]interface{})
+			if len(messages) != 2 {
+				t.Fatalf("Expected system and user messages, got %v", messages)
+			}
+			system, _ := messages[0].(map[string]interface{})
+			if system["content"] != tt.expectedSystem {
+				t.Errorf("Expected system prompt %q, got %v", tt.expectedSystem, system["content"])
+			}
+		})
+	}
+}
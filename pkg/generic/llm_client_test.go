@@ -0,0 +1,122 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newStreamingTestServer returns an OpenAI-compatible server that streams the
+// given chunks as server-sent events and records each decoded request body
+func newStreamingTestServer(t *testing.T, chunks []string, usage *OpenAIUsage, requests *[]map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		if requests != nil {
+			*requests = append(*requests, body)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			event := OpenAIStreamChunk{Choices: []OpenAIStreamChoice{{Delta: OpenAIMessage{Content: chunk}}}}
+			payload, _ := json.Marshal(event)
+			fmt.Fprintf(w, "data: %s\n\n", payload)
+		}
+		if usage != nil {
+			payload, _ := json.Marshal(OpenAIStreamChunk{Usage: usage})
+			fmt.Fprintf(w, "data: %s\n\n", payload)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func newTestLLMClient(t *testing.T, baseURL string) *LLMClient {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	client, err := NewLLMClient(LLMConfig{
+		Provider:       "deepinfra",
+		Model:          "test-model",
+		APIKey:         "test-key",
+		ProviderConfig: map[string]interface{}{"base_url": baseURL},
+	}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create LLM client: %v", err)
+	}
+	return client
+}
+
+func TestChatStream(t *testing.T) {
+	tests := []struct {
+		name           string
+		chunks         []string
+		usage          *OpenAIUsage
+		expectedTokens int
+		expectEstimate bool
+	}{
+		{
+			name:           "usage reported by provider",
+			chunks:         []string{"Hello", ", ", "world"},
+			usage:          &OpenAIUsage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10},
+			expectedTokens: 10,
+		},
+		{
+			name:           "usage missing from stream",
+			chunks:         []string{"Hello", ", ", "world"},
+			expectedTokens: (len("Say hello") + len("Hello, world")) / 4,
+			expectEstimate: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newStreamingTestServer(t, tt.chunks, tt.usage, &requests)
+			defer server.Close()
+
+			client := newTestLLMClient(t, server.URL)
+
+			var streamed strings.Builder
+			response, err := client.ChatStream(context.Background(), []Message{{Role: "user", Content: "Say hello"}}, &streamed)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expected := strings.Join(tt.chunks, "")
+			if streamed.String() != expected {
+				t.Errorf("Expected streamed output %q, got %q", expected, streamed.String())
+			}
+			if response.Content != expected {
+				t.Errorf("Expected response content %q, got %q", expected, response.Content)
+			}
+			if response.TokensUsed != tt.expectedTokens {
+				t.Errorf("Expected %d tokens, got %d", tt.expectedTokens, response.TokensUsed)
+			}
+			if response.Cost <= 0 {
+				t.Error("Expected a positive cost estimate")
+			}
+			if _, estimated := response.Metadata["estimated_usage"]; estimated != tt.expectEstimate {
+				t.Errorf("Expected estimated_usage=%v, got metadata %v", tt.expectEstimate, response.Metadata)
+			}
+
+			if len(requests) != 1 {
+				t.Fatalf("Expected 1 request, got %d", len(requests))
+			}
+			if stream, _ := requests[0]["stream"].(bool); !stream {
+				t.Error("Expected request to ask for a stream")
+			}
+		})
+	}
+}
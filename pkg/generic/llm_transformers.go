@@ -0,0 +1,330 @@
+package generic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alantheprice/agent/pkg/interfaces/types"
+)
+
+// ExecutionTransformer is implemented by transformers that need the running
+// workflow, such as the LLM-backed ones. The pipeline calls TransformInContext
+// for them, passing the execution context whose metrics they update.
+type ExecutionTransformer interface {
+	Transformer
+	TransformInContext(execCtx *ExecutionContext, input interface{}, params map[string]interface{}) (interface{}, error)
+}
+
+// LLM-backed transformers
+//
+// llm_summarize, llm_classify and llm_extract send their input to the agent's
+// LLM. Like llm steps they accept provider, model, model_role, temperature,
+// max_tokens and context_budget params; inputs too large for the model are
+// summarized (llm_summarize) or truncated (the others) to fit. Identical
+// requests are answered from a cache for the life of the workflow engine
+// unless "cache": false, and token usage and cost are added to the
+// execution metrics.
+
+// registerLLMTransformers registers the LLM-backed transformers, which run
+// through the engine's LLM clients
+func (tr *TransformRegistry) registerLLMTransformers(engine *WorkflowEngine) {
+	runner := &llmTransformRunner{engine: engine, cache: make(map[string]interface{})}
+	tr.RegisterTransformer(&LLMSummarizer{runner: runner})
+	tr.RegisterTransformer(&LLMClassifier{runner: runner})
+	tr.RegisterTransformer(&LLMExtractor{runner: runner})
+}
+
+// llmTransformRunner sends transformer prompts to the LLM and caches replies
+type llmTransformRunner struct {
+	engine *WorkflowEngine
+	cache  map[string]interface{}
+	mu     sync.Mutex
+}
+
+// llmTransformInputPlaceholder marks the input in a transformer prompt so the
+// context budget can shrink it
+const llmTransformInputPlaceholder = "\x00input\x00"
+
+// run sends instruction followed by the input text and returns the reply,
+// decoded when format is set
+func (r *llmTransformRunner) run(execCtx *ExecutionContext, name string, params map[string]interface{}, instruction string, input interface{}, format *types.ResponseFormat, defaultStrategy string) (interface{}, error) {
+	if execCtx == nil {
+		execCtx = &ExecutionContext{Data: map[string]interface{}{}}
+	}
+	if execCtx.Metrics == nil {
+		execCtx.Metrics = &ExecutionMetrics{}
+	}
+	ctx := execCtx.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	step := Step{Name: name, Config: params}
+	client, err := r.engine.llmClientForStep(step)
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := transformInputText(input)
+	if err != nil {
+		return nil, err
+	}
+	parts := []*promptPart{{
+		Role:       "user",
+		Template:   instruction + "\n\n" + llmTransformInputPlaceholder,
+		Insertions: []TemplateInsertion{{Placeholder: llmTransformInputPlaceholder, Expression: "input", Value: text}},
+	}}
+
+	useCache, err := boolParam(params, "cache", true)
+	if err != nil {
+		return nil, err
+	}
+	key := llmTransformCacheKey(client.config, renderParts(parts), format)
+	if useCache {
+		r.mu.Lock()
+		cached, found := r.cache[key]
+		r.mu.Unlock()
+		if found {
+			r.engine.logger.Debug("Using cached transformer result", "transform", name)
+			return cached, nil
+		}
+	}
+
+	messages := renderParts(parts)
+	budgeter, err := r.engine.newContextBudgeter(step, client, execCtx, defaultStrategy)
+	if err != nil {
+		return nil, err
+	}
+	if budgeter != nil {
+		if messages, err = budgeter.fit(ctx, parts); err != nil {
+			return nil, err
+		}
+	}
+
+	var result interface{}
+	var response *LLMResponse
+	if format != nil {
+		maxRepairs, err := intParam(params, "max_repairs", defaultStructuredRepairs)
+		if err != nil {
+			return nil, err
+		}
+		result, response, err = client.ChatStructured(ctx, messages, *format, maxRepairs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		response, err = client.Chat(ctx, messages)
+		if err != nil {
+			return nil, err
+		}
+		result = strings.TrimSpace(response.Content)
+	}
+
+	execCtx.Metrics.LLMTokensUsed += response.TokensUsed
+	execCtx.Metrics.LLMCost += response.Cost
+	r.engine.logger.Debug("Transformer LLM call completed",
+		"transform", name,
+		"model", response.Model,
+		"tokens_used", response.TokensUsed,
+		"cost", response.Cost)
+
+	if useCache {
+		r.mu.Lock()
+		r.cache[key] = result
+		r.mu.Unlock()
+	}
+	return result, nil
+}
+
+// transformInputText returns string input as is and encodes anything else as
+// indented JSON
+func transformInputText(input interface{}) (string, error) {
+	if text, ok := input.(string); ok {
+		return text, nil
+	}
+	encoded, err := json.MarshalIndent(input, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("cannot encode input of type %T: %w", input, err)
+	}
+	return string(encoded), nil
+}
+
+// llmTransformCacheKey identifies a request by everything that shapes the reply
+func llmTransformCacheKey(config LLMConfig, messages []Message, format *types.ResponseFormat) string {
+	encoded, _ := json.Marshal(struct {
+		Provider    string
+		Model       string
+		Temperature float64
+		MaxTokens   int
+		Messages    []Message
+		Format      *types.ResponseFormat
+	}{config.Provider, config.Model, config.Temperature, config.MaxTokens, messages, format})
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// LLMSummarizer condenses its input, typically a large step output, so it
+// can be passed to later prompts inline
+type LLMSummarizer struct {
+	runner *llmTransformRunner
+}
+
+func (ls *LLMSummarizer) Name() string        { return "llm_summarize" }
+func (ls *LLMSummarizer) Description() string { return "Summarize the input with the LLM" }
+
+func (ls *LLMSummarizer) ValidateParams(params map[string]interface{}) error {
+	if _, err := intParam(params, "max_words", 0); err != nil {
+		return err
+	}
+	if focus, ok := params["focus"]; ok {
+		if _, ok := focus.(string); !ok {
+			return fmt.Errorf("focus must be a string, got %T", focus)
+		}
+	}
+	return nil
+}
+
+func (ls *LLMSummarizer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return ls.TransformInContext(nil, input, params)
+}
+
+// TransformInContext summarizes in at most max_words words (default 200),
+// concentrating on focus when it is given
+func (ls *LLMSummarizer) TransformInContext(execCtx *ExecutionContext, input interface{}, params map[string]interface{}) (interface{}, error) {
+	maxWords, _ := intParam(params, "max_words", 200)
+	instruction := fmt.Sprintf("Summarize the following content in at most %d words. Keep names, numbers, file paths "+
+		"and other specifics that a later reader may need; drop repetition and boilerplate. Reply with only the summary.", maxWords)
+	if focus, _ := params["focus"].(string); focus != "" {
+		instruction += "\nFocus on: " + focus
+	}
+
+	return ls.runner.run(execCtx, ls.Name(), params, instruction, input, nil, ContextStrategySummarize)
+}
+
+// LLMClassifier assigns the input one of the given labels, or with
+// "multiple": true any number of them
+type LLMClassifier struct {
+	runner *llmTransformRunner
+}
+
+func (lc *LLMClassifier) Name() string { return "llm_classify" }
+func (lc *LLMClassifier) Description() string {
+	return "Classify the input into one of the given labels with the LLM"
+}
+
+func (lc *LLMClassifier) ValidateParams(params map[string]interface{}) error {
+	labels, err := stringListParam(params["labels"])
+	if err != nil {
+		return fmt.Errorf("labels %w", err)
+	}
+	if len(labels) < 2 {
+		return fmt.Errorf("labels parameter needs at least two labels")
+	}
+	if _, err := boolParam(params, "multiple", false); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (lc *LLMClassifier) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return lc.TransformInContext(nil, input, params)
+}
+
+// TransformInContext returns the chosen label, or a list of labels when
+// multiple is set
+func (lc *LLMClassifier) TransformInContext(execCtx *ExecutionContext, input interface{}, params map[string]interface{}) (interface{}, error) {
+	labels, _ := stringListParam(params["labels"])
+	multiple, _ := boolParam(params, "multiple", false)
+
+	enum := make([]interface{}, len(labels))
+	for i, label := range labels {
+		enum[i] = label
+	}
+	labelSchema := map[string]interface{}{"type": "string", "enum": enum}
+
+	field := "label"
+	instruction := "Classify the following content with exactly one of these labels: " + strings.Join(labels, ", ") + "."
+	if multiple {
+		field = "labels"
+		labelSchema = map[string]interface{}{"type": "array", "items": labelSchema}
+		instruction = "Classify the following content with every label that applies, from: " + strings.Join(labels, ", ") + "."
+	}
+	if guidance, _ := params["instructions"].(string); guidance != "" {
+		instruction += "\n" + guidance
+	}
+
+	format := &types.ResponseFormat{
+		Type: types.ResponseFormatJSONSchema,
+		Name: "classification",
+		Schema: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{field: labelSchema},
+			"required":   []interface{}{field},
+		},
+	}
+
+	value, err := lc.runner.run(execCtx, lc.Name(), params, instruction, input, format, ContextStrategyTruncate)
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]interface{})[field], nil
+}
+
+// LLMExtractor pulls data matching a JSON schema out of free text
+type LLMExtractor struct {
+	runner *llmTransformRunner
+}
+
+func (le *LLMExtractor) Name() string { return "llm_extract" }
+func (le *LLMExtractor) Description() string {
+	return "Extract data matching a JSON schema from the input with the LLM"
+}
+
+func (le *LLMExtractor) ValidateParams(params map[string]interface{}) error {
+	_, err := le.responseFormat(params)
+	return err
+}
+
+// responseFormat reads the schema or schema_file param
+func (le *LLMExtractor) responseFormat(params map[string]interface{}) (*types.ResponseFormat, error) {
+	_, hasSchema := params["schema"]
+	_, hasSchemaFile := params["schema_file"]
+	if !hasSchema && !hasSchemaFile {
+		return nil, fmt.Errorf("schema or schema_file parameter is required")
+	}
+
+	format, err := parseResponseFormat(map[string]interface{}{
+		"type":        types.ResponseFormatJSONSchema,
+		"name":        "extraction",
+		"schema":      params["schema"],
+		"schema_file": params["schema_file"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format, nil
+}
+
+func (le *LLMExtractor) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return le.TransformInContext(nil, input, params)
+}
+
+func (le *LLMExtractor) TransformInContext(execCtx *ExecutionContext, input interface{}, params map[string]interface{}) (interface{}, error) {
+	format, err := le.responseFormat(params)
+	if err != nil {
+		return nil, err
+	}
+
+	instruction := "Extract the requested data from the following content. Use null for anything the content does not state."
+	if guidance, _ := params["instructions"].(string); guidance != "" {
+		instruction += "\n" + guidance
+	}
+
+	return le.runner.run(execCtx, le.Name(), params, instruction, input, format, ContextStrategyTruncate)
+}
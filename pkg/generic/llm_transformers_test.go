@@ -0,0 +1,180 @@
+package generic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLLMTransformers(t *testing.T) {
+	tests := []struct {
+		name             string
+		transform        string
+		reply            string
+		input            interface{}
+		params           map[string]interface{}
+		expected         string
+		expectedInErr    string
+		expectInPrompt   string
+		expectedModel    string
+		expectedRequests int
+	}{
+		{
+			name:             "summarize",
+			transform:        "llm_summarize",
+			reply:            "  Two files changed.  ",
+			input:            "diff --git a/a.go b/a.go\n+added",
+			params:           map[string]interface{}{"max_words": 50.0, "focus": "risky changes"},
+			expected:         "Two files changed.",
+			expectInPrompt:   "at most 50 words",
+			expectedModel:    "test-model",
+			expectedRequests: 1,
+		},
+		{
+			name:             "summarize structured input with model override",
+			transform:        "llm_summarize",
+			reply:            "summary",
+			input:            map[string]interface{}{"files": []interface{}{"a.go"}},
+			params:           map[string]interface{}{"model": "small-model"},
+			expected:         "summary",
+			expectInPrompt:   `"files": [`,
+			expectedModel:    "small-model",
+			expectedRequests: 1,
+		},
+		{
+			name:             "classify",
+			transform:        "llm_classify",
+			reply:            `{"label": "bug"}`,
+			input:            "It crashes on start",
+			params:           map[string]interface{}{"labels": []interface{}{"bug", "feature"}},
+			expected:         "bug",
+			expectInPrompt:   "exactly one of these labels: bug, feature",
+			expectedRequests: 1,
+		},
+		{
+			name:             "classify multiple",
+			transform:        "llm_classify",
+			reply:            `{"labels": ["docs", "bug"]}`,
+			input:            "Fix the crash and update the README",
+			params:           map[string]interface{}{"labels": []interface{}{"bug", "docs", "feature"}, "multiple": true},
+			expected:         `[docs bug]`,
+			expectedRequests: 1,
+		},
+		{
+			name:             "classify rejects unknown label",
+			transform:        "llm_classify",
+			reply:            `{"label": "question"}`,
+			input:            "How do I run it?",
+			params:           map[string]interface{}{"labels": []interface{}{"bug", "feature"}, "max_repairs": 1.0},
+			expectedInErr:    "must be one of",
+			expectedRequests: 2,
+		},
+		{
+			name:      "extract",
+			transform: "llm_extract",
+			reply:     "```json\n{\"title\": \"Fix parser\", \"issue\": 42}\n```",
+			input:     "Title: Fix parser (closes #42)",
+			params: map[string]interface{}{"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"title": map[string]interface{}{"type": "string"}, "issue": map[string]interface{}{"type": "number"}},
+				"required":   []interface{}{"title"},
+			}},
+			expected:         `map[issue:42 title:Fix parser]`,
+			expectInPrompt:   "Extract the requested data",
+			expectedRequests: 1,
+		},
+		{name: "extract needs schema", transform: "llm_extract", params: map[string]interface{}{}, expectedInErr: "schema or schema_file parameter is required"},
+		{name: "classify needs labels", transform: "llm_classify", params: map[string]interface{}{"labels": []interface{}{"only"}}, expectedInErr: "at least two labels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newChatTestServer(t, tt.reply, &requests)
+			defer server.Close()
+
+			engine := newBudgetTestEngine(t, server.URL)
+			transformer, ok := engine.transformPipeline.registry.GetTransformer(tt.transform)
+			if !ok {
+				t.Fatalf("Transformer %s is not registered", tt.transform)
+			}
+			contextual := transformer.(ExecutionTransformer)
+
+			execCtx := newBudgetTestContext(map[string]interface{}{})
+			err := transformer.ValidateParams(tt.params)
+			var result interface{}
+			if err == nil {
+				result, err = contextual.TransformInContext(execCtx, tt.input, tt.params)
+			}
+
+			if len(requests) != tt.expectedRequests {
+				t.Errorf("Expected %d requests, got %d", tt.expectedRequests, len(requests))
+			}
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if actual := fmt.Sprint(result); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+			if execCtx.Metrics.LLMTokensUsed != 5*tt.expectedRequests {
+				t.Errorf("Expected %d tokens in metrics, got %d", 5*tt.expectedRequests, execCtx.Metrics.LLMTokensUsed)
+			}
+
+			var prompt string
+			for _, message := range requests[0]["messages"].([]interface{}) {
+				prompt += message.(map[string]interface{})["content"].(string) + "\n"
+			}
+			if tt.expectInPrompt != "" && !strings.Contains(prompt, tt.expectInPrompt) {
+				t.Errorf("Expected prompt to contain %q, got %q", tt.expectInPrompt, prompt)
+			}
+			if tt.expectedModel != "" && requests[0]["model"] != tt.expectedModel {
+				t.Errorf("Expected model %q, got %v", tt.expectedModel, requests[0]["model"])
+			}
+		})
+	}
+}
+
+func TestLLMTransformersInPipeline(t *testing.T) {
+	var requests []map[string]interface{}
+	server := newChatTestServer(t, "short version", &requests)
+	defer server.Close()
+
+	engine := newBudgetTestEngine(t, server.URL)
+	execCtx := newBudgetTestContext(map[string]interface{}{})
+	result := &StepResult{StepName: "review", Success: true, Output: strings.Repeat("long review text ", 50)}
+
+	run := func(params map[string]interface{}) {
+		t.Helper()
+		step := Step{Name: "review", PostTransforms: []Transform{
+			{Source: "review", Transform: "llm_summarize", Params: params, StoreAs: "review_summary"},
+		}}
+		if err := engine.transformPipeline.ExecutePostTransforms(step, result, map[string]*StepResult{}, execCtx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	run(map[string]interface{}{})
+	run(map[string]interface{}{})
+	if len(requests) != 1 {
+		t.Errorf("Expected the repeated summary to come from the cache, got %d requests", len(requests))
+	}
+
+	run(map[string]interface{}{"cache": false})
+	if len(requests) != 2 {
+		t.Errorf("Expected cache: false to send a new request, got %d requests", len(requests))
+	}
+
+	if execCtx.Data["review_summary"] != "short version" {
+		t.Errorf("Expected stored summary, got %v", execCtx.Data["review_summary"])
+	}
+	if execCtx.Metrics.LLMTokensUsed != 10 {
+		t.Errorf("Expected 10 tokens in metrics, got %d", execCtx.Metrics.LLMTokensUsed)
+	}
+}
@@ -0,0 +1,362 @@
+package generic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MarkdownExtractor pulls structured pieces out of Markdown, typically an
+// LLM reply. The mode parameter selects what to extract:
+//
+//	code     fenced code blocks, optionally only those tagged with language
+//	section  the body of the section at heading, a "/" separated path
+//	sections every section as {heading, level, path, content}
+//	list     bullet or numbered list items as an array of strings
+//	table    table rows as records keyed by the header cells
+//
+// code, list and table return the first match unless all is true, in which
+// case they return every match (for code, as {language, code} maps). A
+// heading parameter limits any mode to that section.
+type MarkdownExtractor struct{}
+
+var (
+	markdownHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	markdownFence     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	markdownListItem  = regexp.MustCompile(`^(\s*)(?:[-*+]|\d{1,9}[.)])(?:[ \t]+(.*))?$`)
+	markdownTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+func (me *MarkdownExtractor) Name() string { return "extract_markdown" }
+func (me *MarkdownExtractor) Description() string {
+	return "Extract code blocks, sections, lists or tables from Markdown"
+}
+
+func (me *MarkdownExtractor) ValidateParams(params map[string]interface{}) error {
+	mode, _ := params["mode"].(string)
+	switch mode {
+	case "", "code", "sections", "list", "table":
+	case "section":
+		if heading, _ := params["heading"].(string); heading == "" {
+			return fmt.Errorf("heading parameter is required for section mode")
+		}
+	default:
+		return fmt.Errorf("unsupported mode: %s", mode)
+	}
+	if _, err := boolParam(params, "all", false); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (me *MarkdownExtractor) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, _ := params["mode"].(string)
+	heading, _ := params["heading"].(string)
+	language, _ := params["language"].(string)
+	all, _ := boolParam(params, "all", false)
+
+	doc := parseMarkdown(inputStr)
+	if heading != "" {
+		section, found := doc.section(heading)
+		if !found {
+			return nil, fmt.Errorf("section %q not found", heading)
+		}
+		if mode == "section" {
+			return section.content(), nil
+		}
+		doc = section
+	}
+
+	switch mode {
+	case "sections":
+		return doc.sections(), nil
+	case "list":
+		return firstOrAll(doc.lists(), all, "list")
+	case "table":
+		return firstOrAll(doc.tables(), all, "table")
+	}
+
+	blocks := doc.codeBlocks(language)
+	if all {
+		result := make([]interface{}, len(blocks))
+		for i, block := range blocks {
+			result[i] = block
+		}
+		return result, nil
+	}
+	if len(blocks) == 0 {
+		if language != "" {
+			return nil, fmt.Errorf("no %s code block found", language)
+		}
+		return nil, fmt.Errorf("no code block found")
+	}
+	return blocks[0]["code"], nil
+}
+
+func firstOrAll(matches []interface{}, all bool, kind string) (interface{}, error) {
+	if all {
+		return matches, nil
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no %s found", kind)
+	}
+	return matches[0], nil
+}
+
+// markdownLine is a line of a Markdown document; fenced lines are inside a
+// code block, including its fences
+type markdownLine struct {
+	text    string
+	fenced  bool
+	heading int // heading level, or 0
+	title   string
+}
+
+type markdownDoc struct {
+	lines []markdownLine
+}
+
+func parseMarkdown(text string) *markdownDoc {
+	doc := &markdownDoc{}
+	var fence string
+	for _, text := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := markdownLine{text: text}
+
+		if fence != "" {
+			line.fenced = true
+			if isClosingFence(text, fence) {
+				fence = ""
+			}
+		} else if match := markdownFence.FindStringSubmatch(text); match != nil {
+			line.fenced = true
+			fence = match[2]
+		} else if match := markdownHeading.FindStringSubmatch(text); match != nil {
+			line.heading = len(match[1])
+			line.title = strings.TrimSpace(match[2])
+		}
+
+		doc.lines = append(doc.lines, line)
+	}
+	return doc
+}
+
+// content returns the document text without a leading heading line
+func (doc *markdownDoc) content() string {
+	lines := doc.lines
+	if len(lines) > 0 && lines[0].heading > 0 {
+		lines = lines[1:]
+	}
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.text
+	}
+	return strings.TrimSpace(strings.Join(texts, "\n"))
+}
+
+// sectionEnd returns the index after the section whose heading is at start
+func (doc *markdownDoc) sectionEnd(start int) int {
+	for i := start + 1; i < len(doc.lines); i++ {
+		if level := doc.lines[i].heading; level > 0 && level <= doc.lines[start].heading {
+			return i
+		}
+	}
+	return len(doc.lines)
+}
+
+// section finds a section by its heading path, such as "Review/Risks",
+// where each part is matched case-insensitively against a heading nested
+// within the previous one
+func (doc *markdownDoc) section(path string) (*markdownDoc, bool) {
+	start, end := 0, len(doc.lines)
+	for i, part := range strings.Split(path, "/") {
+		part = strings.TrimSpace(part)
+		searchFrom := start
+		if i > 0 {
+			searchFrom = start + 1
+		}
+
+		found := -1
+		for j := searchFrom; j < end; j++ {
+			if doc.lines[j].heading > 0 && strings.EqualFold(doc.lines[j].title, part) {
+				found = j
+				break
+			}
+		}
+		if found < 0 {
+			return nil, false
+		}
+		start, end = found, min(end, doc.sectionEnd(found))
+	}
+	return &markdownDoc{lines: doc.lines[start:end]}, true
+}
+
+func (doc *markdownDoc) sections() []interface{} {
+	result := []interface{}{}
+	var path []string
+	var levels []int
+
+	for i, line := range doc.lines {
+		if line.heading == 0 {
+			continue
+		}
+		for len(levels) > 0 && levels[len(levels)-1] >= line.heading {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		levels = append(levels, line.heading)
+		path = append(path, line.title)
+
+		section := &markdownDoc{lines: doc.lines[i:doc.sectionEnd(i)]}
+		result = append(result, map[string]interface{}{
+			"heading": line.title,
+			"level":   line.heading,
+			"path":    strings.Join(path, "/"),
+			"content": section.content(),
+		})
+	}
+	return result
+}
+
+// codeBlocks returns the fenced blocks, only those tagged with language
+// when it is given
+func (doc *markdownDoc) codeBlocks(language string) []map[string]interface{} {
+	var blocks []map[string]interface{}
+	for i := 0; i < len(doc.lines); i++ {
+		match := markdownFence.FindStringSubmatch(doc.lines[i].text)
+		if !doc.lines[i].fenced || match == nil {
+			continue
+		}
+
+		indent := len(match[1])
+		var code []string
+		j := i + 1
+		for ; j < len(doc.lines) && doc.lines[j].fenced; j++ {
+			if isClosingFence(doc.lines[j].text, match[2]) {
+				break
+			}
+			text := doc.lines[j].text
+			for k := 0; k < indent && strings.HasPrefix(text, " "); k++ {
+				text = text[1:]
+			}
+			code = append(code, text)
+		}
+		i = j
+
+		if language == "" || strings.EqualFold(match[3], language) {
+			blocks = append(blocks, map[string]interface{}{
+				"language": match[3],
+				"code":     strings.Join(code, "\n"),
+			})
+		}
+	}
+	return blocks
+}
+
+func isClosingFence(text, fence string) bool {
+	trimmed := strings.TrimSpace(text)
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// lists returns each run of list items as an array of item texts; lines
+// indented under an item continue it, and nested items are included in order
+func (doc *markdownDoc) lists() []interface{} {
+	result := []interface{}{}
+	var items []interface{}
+	blank := false
+
+	flush := func() {
+		if len(items) > 0 {
+			result = append(result, items)
+		}
+		items = nil
+	}
+
+	for _, line := range doc.lines {
+		if line.fenced || line.heading > 0 {
+			flush()
+			continue
+		}
+
+		if match := markdownListItem.FindStringSubmatch(line.text); match != nil && !markdownTableRule.MatchString(line.text) {
+			items = append(items, strings.TrimSpace(match[2]))
+			blank = false
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line.text)
+		switch {
+		case trimmed == "":
+			blank = true
+		case len(items) > 0 && (!blank || strings.HasPrefix(line.text, "  ") || strings.HasPrefix(line.text, "\t")):
+			last := len(items) - 1
+			items[last] = strings.TrimSpace(items[last].(string) + " " + trimmed)
+			blank = false
+		default:
+			flush()
+			blank = false
+		}
+	}
+	flush()
+	return result
+}
+
+// tables returns each table as an array of records keyed by its header
+func (doc *markdownDoc) tables() []interface{} {
+	result := []interface{}{}
+	for i := 0; i+1 < len(doc.lines); i++ {
+		header, rule := doc.lines[i], doc.lines[i+1]
+		if header.fenced || rule.fenced || !strings.Contains(header.text, "|") ||
+			!strings.Contains(rule.text, "-") || !markdownTableRule.MatchString(rule.text) {
+			continue
+		}
+
+		columns := splitTableRow(header.text)
+		records := []interface{}{}
+		j := i + 2
+		for ; j < len(doc.lines) && !doc.lines[j].fenced && strings.Contains(doc.lines[j].text, "|"); j++ {
+			cells := splitTableRow(doc.lines[j].text)
+			record := make(map[string]interface{}, len(columns))
+			for k, column := range columns {
+				record[column] = ""
+				if k < len(cells) {
+					record[column] = cells[k]
+				}
+			}
+			records = append(records, record)
+		}
+
+		result = append(result, records)
+		i = j - 1
+	}
+	return result
+}
+
+// splitTableRow splits a table row into trimmed cells, honouring \|
+func splitTableRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case row[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(row[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
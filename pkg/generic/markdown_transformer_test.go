@@ -0,0 +1,142 @@
+package generic
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownExtractor(t *testing.T) {
+	reply := strings.Join([]string{
+		"Here is the fix.",
+		"",
+		"```go",
+		"package main",
+		"",
+		"func main() {}",
+		"```",
+		"",
+		"# Review",
+		"",
+		"## Risks",
+		"- nil map write in",
+		"  handler.go",
+		"- missing test",
+		"",
+		"## Files",
+		"| File | Lines |",
+		"|------|------:|",
+		"| a.go | 12 |",
+		"| b\\|c.go | 3 |",
+		"",
+		"```sh",
+		"# not a heading",
+		"go test ./...",
+		"```",
+		"",
+		"# Notes ##",
+		"1. first",
+		"2) second",
+		"",
+		"Trailing paragraph.",
+	}, "\n")
+
+	tests := []struct {
+		name          string
+		params        map[string]interface{}
+		input         string
+		expected      string // JSON unless the result is a string
+		expectedInErr string
+	}{
+		{name: "first code block", params: map[string]interface{}{}, expected: "package main\n\nfunc main() {}"},
+		{name: "code block by language", params: map[string]interface{}{"mode": "code", "language": "SH"}, expected: "# not a heading\ngo test ./..."},
+		{
+			name:     "all code blocks",
+			params:   map[string]interface{}{"all": true},
+			expected: `[{"code":"package main\n\nfunc main() {}","language":"go"},{"code":"# not a heading\ngo test ./...","language":"sh"}]`,
+		},
+		{name: "missing language", params: map[string]interface{}{"language": "python"}, expectedInErr: "no python code block found"},
+		{name: "tilde fence with indent", params: map[string]interface{}{}, input: "  ~~~~\n  a\n    b\n  ~~~~", expected: "a\n  b"},
+		{name: "unclosed fence", params: map[string]interface{}{}, input: "```\nx\ny", expected: "x\ny"},
+
+		{name: "section by path", params: map[string]interface{}{"mode": "section", "heading": "review / files"}, expected: "| File | Lines |\n|------|------:|\n| a.go | 12 |\n| b\\|c.go | 3 |\n\n```sh\n# not a heading\ngo test ./...\n```"},
+		{name: "section with closing hashes", params: map[string]interface{}{"mode": "section", "heading": "Notes"}, expected: "1. first\n2) second\n\nTrailing paragraph."},
+		{name: "section path must nest", params: map[string]interface{}{"mode": "section", "heading": "Notes/Risks"}, expectedInErr: `section "Notes/Risks" not found`},
+		{
+			name:     "sections",
+			params:   map[string]interface{}{"mode": "sections"},
+			input:    "# A\nintro\n## B\nbody\n# C",
+			expected: `[{"content":"intro\n## B\nbody","heading":"A","level":1,"path":"A"},{"content":"body","heading":"B","level":2,"path":"A/B"},{"content":"","heading":"C","level":1,"path":"C"}]`,
+		},
+
+		{name: "list with continuation", params: map[string]interface{}{"mode": "list"}, expected: `["nil map write in handler.go","missing test"]`},
+		{name: "numbered list in section", params: map[string]interface{}{"mode": "list", "heading": "Notes"}, expected: `["first","second"]`},
+		{name: "all lists", params: map[string]interface{}{"mode": "list", "all": true}, input: "- a\n\ntext\n\n* b\n  * c", expected: `[["a"],["b","c"]]`},
+		{name: "no list", params: map[string]interface{}{"mode": "list"}, input: "just text", expectedInErr: "no list found"},
+
+		{name: "table", params: map[string]interface{}{"mode": "table"}, expected: `[{"File":"a.go","Lines":"12"},{"File":"b|c.go","Lines":"3"}]`},
+		{name: "table without outer pipes", params: map[string]interface{}{"mode": "table"}, input: "a | b\n--|--\n1 | 2\n3", expected: `[{"a":"1","b":"2"}]`},
+
+		{name: "unsupported mode", params: map[string]interface{}{"mode": "images"}, expectedInErr: "unsupported mode"},
+		{name: "section needs heading", params: map[string]interface{}{"mode": "section"}, expectedInErr: "heading parameter is required"},
+	}
+
+	extractor := &MarkdownExtractor{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			if input == "" {
+				input = reply
+			}
+
+			err := extractor.ValidateParams(tt.params)
+			var result interface{}
+			if err == nil {
+				result, err = extractor.Transform(input, tt.params)
+			}
+
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actual, isText := result.(string)
+			if !isText {
+				encoded, _ := json.Marshal(result)
+				actual = string(encoded)
+			}
+			if actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMarkdownExtractorPostTransform(t *testing.T) {
+	te := newTestTemplateEngine()
+	pipeline := NewTransformPipeline(NewTransformRegistry(te.logger), te, te.logger)
+
+	step := Step{
+		Name: "generate",
+		PostTransforms: []Transform{{
+			Source:    "generate",
+			Transform: "extract_markdown",
+			Params:    map[string]interface{}{"language": "go"},
+			StoreAs:   "generated_code",
+		}},
+	}
+	result := &StepResult{StepName: "generate", Success: true, Output: "Sure:\n```go\npackage main\n```\nDone."}
+	execCtx := &ExecutionContext{Data: map[string]interface{}{}}
+
+	if err := pipeline.ExecutePostTransforms(step, result, map[string]*StepResult{}, execCtx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code := execCtx.Data["generated_code"]; code != "package main" {
+		t.Errorf("Expected %q, got %q", "package main", code)
+	}
+}
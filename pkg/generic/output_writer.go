@@ -88,8 +88,7 @@ func (ow *OutputWriter) formatData(data interface{}, output Output) ([]byte, err
 	case "json":
 		return json.MarshalIndent(data, "", "  ")
 	case "yaml":
-		// Simple YAML formatting by converting structured data
-		yamlStr, err := ow.convertToYAML(data, 0)
+		yamlStr, err := ow.convertToYAML(data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to format as YAML: %w", err)
 		}
@@ -192,63 +191,18 @@ func (ow *OutputWriter) writeToWebhook(data []byte, output Output, execCtx *Exec
 	return nil
 }
 
-// convertToYAML converts data to YAML format (simple implementation)
-func (ow *OutputWriter) convertToYAML(data interface{}, indent int) (string, error) {
-	indentStr := strings.Repeat("  ", indent)
-
-	switch v := data.(type) {
-	case nil:
-		return "null", nil
-	case bool:
-		return fmt.Sprintf("%v", v), nil
-	case int, int64, float64:
-		return fmt.Sprintf("%v", v), nil
-	case string:
-		// Escape special characters and quote if necessary
-		if strings.Contains(v, "\n") || strings.Contains(v, ":") || strings.Contains(v, "#") {
-			escaped := strings.ReplaceAll(v, "\"", "\\\"")
-			escaped = strings.ReplaceAll(escaped, "\n", "\\n")
-			return fmt.Sprintf("\"%s\"", escaped), nil
-		}
-		return v, nil
-	case []interface{}:
-		var result strings.Builder
-		for i, item := range v {
-			if i > 0 {
-				result.WriteString("\n")
-			}
-			result.WriteString(indentStr + "- ")
-			itemYAML, err := ow.convertToYAML(item, indent+1)
-			if err != nil {
-				return "", err
-			}
-			result.WriteString(itemYAML)
-		}
-		return result.String(), nil
-	case map[string]interface{}:
-		var result strings.Builder
-		i := 0
-		for key, value := range v {
-			if i > 0 {
-				result.WriteString("\n")
-			}
-			result.WriteString(indentStr + key + ": ")
-			valueYAML, err := ow.convertToYAML(value, indent+1)
-			if err != nil {
-				return "", err
-			}
-			// Handle multiline values
-			if strings.Contains(valueYAML, "\n") {
-				result.WriteString("\n" + strings.ReplaceAll(valueYAML, "\n", "\n"+indentStr+"  "))
-			} else {
-				result.WriteString(valueYAML)
-			}
-			i++
-		}
-		return result.String(), nil
-	default:
-		return fmt.Sprintf("%v", v), nil
+// convertToYAML converts data to YAML format, going through JSON first so
+// fields are named as in the json format
+func (ow *OutputWriter) convertToYAML(data interface{}) (string, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	var value interface{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return "", err
 	}
+	return encodeYAML(value)
 }
 
 // convertToCSV converts data to CSV format
@@ -0,0 +1,45 @@
+package generic
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLWritersAgree(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	data := map[string]interface{}{
+		"title":   "fix: handle #12",
+		"notes":   "line one\nline two",
+		"enabled": "no",
+		"tags":    []interface{}{"a: b", 3.0, map[string]interface{}{"nested": []interface{}{}}},
+	}
+
+	writer, _ := NewOutputWriter(nil, logger)
+	formatted, err := writer.formatData(data, Output{Config: map[string]interface{}{"format": "yaml"}})
+	if err != nil {
+		t.Fatalf("formatData failed: %v", err)
+	}
+	transformed, err := (&YAMLEncoder{}).Transform(data, nil)
+	if err != nil {
+		t.Fatalf("to_yaml failed: %v", err)
+	}
+	templated, err := newTestTemplateEngine().yamlFunction([]interface{}{data})
+	if err != nil {
+		t.Fatalf("yaml() failed: %v", err)
+	}
+
+	if string(formatted) != transformed || templated.(string)+"\n" != transformed {
+		t.Errorf("YAML writers differ:\noutput: %q\nto_yaml: %q\nyaml(): %q", formatted, transformed, templated)
+	}
+
+	var decoded map[string]interface{}
+	if err := yaml.Unmarshal(formatted, &decoded); err != nil {
+		t.Fatalf("Output is not valid YAML: %v\n%s", err, formatted)
+	}
+	if decoded["title"] != data["title"] || decoded["notes"] != data["notes"] || decoded["enabled"] != "no" {
+		t.Errorf("Output did not round-trip: %v", decoded)
+	}
+}
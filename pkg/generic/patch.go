@@ -0,0 +1,496 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// apply_patch applies a unified diff to files on disk. Each hunk is placed
+// where its context lines match, trying the line numbers from the header
+// first and then the nearest match elsewhere in the file; when the context
+// does not match exactly, whitespace differences are ignored and then up to
+// fuzz (default 2) context lines are dropped from either end of the hunk.
+// Hunks that cannot be placed are reported as conflicts with the closest
+// region of the file, and nothing is written unless every hunk applies.
+
+const defaultPatchFuzz = 2
+
+// patchedFile is the planned content of a file, or its removal when deleted
+type patchedFile struct {
+	path    string
+	lines   []string
+	newline bool
+	crlf    bool
+	mode    fs.FileMode
+	deleted bool
+}
+
+// patchPlan holds the files a patch changes, so several diffs of the same
+// file in one patch apply on top of each other
+type patchPlan struct {
+	files map[string]*patchedFile
+	order []string
+}
+
+func (tr *ToolRegistry) executeApplyPatch(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	patch, ok := params["patch"].(string)
+	if !ok {
+		return nil, fmt.Errorf("patch parameter is required and must be a string")
+	}
+	dryRun, err := boolParam(params, "dry_run", false)
+	if err != nil {
+		return nil, err
+	}
+	fuzz, err := intParam(params, "fuzz", defaultPatchFuzz)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	plan := &patchPlan{files: make(map[string]*patchedFile)}
+	reports := []interface{}{}
+	conflicts := []interface{}{}
+	for _, file := range files {
+		report, fileConflicts, err := tr.planPatchedFile(plan, file, fuzz)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+		conflicts = append(conflicts, fileConflicts...)
+	}
+
+	result := map[string]interface{}{
+		"files":     reports,
+		"conflicts": conflicts,
+		"dry_run":   dryRun,
+		"applied":   false,
+		"success":   len(conflicts) == 0,
+	}
+	if len(conflicts) > 0 {
+		tr.logger.Warn("Patch did not apply cleanly", "conflicts", len(conflicts))
+		return result, nil
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for _, path := range plan.order {
+		if err := plan.files[path].write(); err != nil {
+			return nil, err
+		}
+	}
+	result["applied"] = true
+	tr.logger.Debug("Patch applied", "files", len(plan.order))
+	return result, nil
+}
+
+// planPatchedFile applies one file's hunks to the plan and describes the
+// result
+func (tr *ToolRegistry) planPatchedFile(plan *patchPlan, file *diffFile, fuzz int) (map[string]interface{}, []interface{}, error) {
+	for _, p := range []string{file.OldPath, file.NewPath} {
+		if p == "/dev/null" {
+			continue
+		}
+		if err := tr.validateFilePath(p); err != nil {
+			return nil, nil, fmt.Errorf("path validation failed: %w", err)
+		}
+	}
+
+	path := file.NewPath
+	switch {
+	case file.Status == "deleted":
+		path = file.OldPath
+	case file.Status == "modified" && file.OldPath != file.NewPath:
+		target, err := plan.patchTarget(file.OldPath, file.NewPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		path = target
+	}
+	report := map[string]interface{}{"path": path, "status": file.Status, "hunks": len(file.Hunks)}
+	if file.Status == "renamed" {
+		report["old_path"] = file.OldPath
+	}
+	conflict := func(hunk int, message string) []interface{} {
+		entry := map[string]interface{}{"path": path, "message": message}
+		if hunk > 0 {
+			entry["hunk"] = hunk
+		}
+		return []interface{}{entry}
+	}
+
+	if file.Binary {
+		return report, conflict(0, "binary patches are not supported"), nil
+	}
+
+	source := file.OldPath
+	if file.Status == "added" || file.Status == "modified" {
+		source = path
+	}
+	current, err := plan.load(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case file.Status == "added" && !current.deleted && (len(current.lines) > 0 || current.newline):
+		return report, conflict(0, "file already exists"), nil
+	case file.Status != "added" && current.deleted:
+		return report, conflict(0, "file does not exist"), nil
+	}
+
+	lines, warnings, conflicts := applyHunks(current.lines, file.Hunks, fuzz)
+	for _, entry := range conflicts {
+		entry.(map[string]interface{})["path"] = path
+	}
+	if len(warnings) > 0 {
+		report["warnings"] = warnings
+	}
+	if len(conflicts) > 0 {
+		return report, conflicts, nil
+	}
+
+	if file.Status == "deleted" {
+		if len(lines) > 0 {
+			return report, conflict(0, "file has lines the patch does not delete"), nil
+		}
+		plan.set(&patchedFile{path: source, deleted: true})
+		return report, nil, nil
+	}
+
+	updated := &patchedFile{
+		path:    path,
+		lines:   lines,
+		newline: patchedNewline(current, file.Hunks),
+		crlf:    current.crlf,
+		mode:    current.mode,
+	}
+	if file.Status == "renamed" {
+		plan.set(&patchedFile{path: source, deleted: true})
+	}
+	plan.set(updated)
+	return report, nil, nil
+}
+
+// patchTarget picks the file a plain diff with different old and new names
+// applies to. Like patch(1), it takes the name that exists, preferring the
+// one with the fewest path components, then the shortest base name, then the
+// shortest name, so "diff -u foo.go.orig foo.go" patches foo.go.
+func (p *patchPlan) patchTarget(oldPath, newPath string) (string, error) {
+	var existing []string
+	for _, candidate := range []string{oldPath, newPath} {
+		file, err := p.load(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !file.deleted {
+			existing = append(existing, candidate)
+		}
+	}
+	switch len(existing) {
+	case 0:
+		return oldPath, nil
+	case 1:
+		return existing[0], nil
+	}
+
+	rank := func(path string) [3]int {
+		return [3]int{strings.Count(filepath.ToSlash(path), "/"), len(filepath.Base(path)), len(path)}
+	}
+	oldRank, newRank := rank(oldPath), rank(newPath)
+	for i := range oldRank {
+		if newRank[i] != oldRank[i] {
+			if newRank[i] < oldRank[i] {
+				return newPath, nil
+			}
+			return oldPath, nil
+		}
+	}
+	return oldPath, nil
+}
+
+// load returns the planned or on-disk content of path
+func (p *patchPlan) load(path string) (*patchedFile, error) {
+	if planned, ok := p.files[path]; ok {
+		return planned, nil
+	}
+
+	file := &patchedFile{path: path, mode: 0644}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		file.deleted = true
+		return file, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	text := string(content)
+	file.mode = info.Mode().Perm()
+	file.crlf = strings.Contains(text, "\r\n")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text != "" {
+		file.newline = strings.HasSuffix(text, "\n")
+		file.lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+	return file, nil
+}
+
+func (p *patchPlan) set(file *patchedFile) {
+	if _, ok := p.files[file.path]; !ok {
+		p.order = append(p.order, file.path)
+	}
+	p.files[file.path] = file
+}
+
+func (f *patchedFile) write() error {
+	if f.deleted {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %w", f.path, err)
+		}
+		return nil
+	}
+
+	text := strings.Join(f.lines, "\n")
+	if f.newline && len(f.lines) > 0 {
+		text += "\n"
+	}
+	if f.crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(f.path, []byte(text), f.mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// patchedNewline works out whether the patched file ends with a newline from
+// the "\ No newline at end of file" markers in the hunks
+func patchedNewline(current *patchedFile, hunks []*diffHunk) bool {
+	newline := current.newline || current.deleted || len(current.lines) == 0
+	for _, hunk := range hunks {
+		for i := len(hunk.Lines) - 1; i >= 0; i-- {
+			if hunk.Lines[i].Kind != '-' {
+				if hunk.Lines[i].NoNewline {
+					return false
+				}
+				break
+			}
+		}
+		for i := len(hunk.Lines) - 1; i >= 0; i-- {
+			if hunk.Lines[i].Kind != '+' {
+				if hunk.Lines[i].NoNewline {
+					newline = true
+				}
+				break
+			}
+		}
+	}
+	return newline
+}
+
+// applyHunks applies the hunks in order, returning the new lines, notes on
+// hunks placed with an offset or fuzz, and conflicts for those not placed
+func applyHunks(lines []string, hunks []*diffHunk, fuzz int) ([]string, []interface{}, []interface{}) {
+	var out []string
+	warnings := []interface{}{}
+	conflicts := []interface{}{}
+	pos := 0
+
+	for i, hunk := range hunks {
+		var oldLines, newLines []string
+		for _, line := range hunk.Lines {
+			if line.Kind != '+' {
+				oldLines = append(oldLines, line.Text)
+			}
+			if line.Kind != '-' {
+				newLines = append(newLines, line.Text)
+			}
+		}
+
+		expected := -1
+		if hunk.OldStart > 0 || hunk.NewStart > 0 {
+			expected = hunk.OldStart - 1
+			if len(oldLines) == 0 {
+				expected = hunk.OldStart // insertion after line OldStart
+			}
+		}
+
+		at, lead, trail, loose, ok := locateHunk(lines, pos, oldLines, expected, hunk, fuzz)
+		if !ok {
+			conflicts = append(conflicts, hunkConflict(lines, i+1, oldLines, expected))
+			continue
+		}
+
+		switch {
+		case lead > 0 || trail > 0:
+			warnings = append(warnings, fmt.Sprintf("hunk %d applied at line %d with fuzz %d", i+1, at+1, max(lead, trail)))
+		case loose:
+			warnings = append(warnings, fmt.Sprintf("hunk %d applied at line %d ignoring whitespace", i+1, at+1))
+		case expected >= 0 && at != expected:
+			warnings = append(warnings, fmt.Sprintf("hunk %d applied at line %d (offset %d)", i+1, at+1, at-expected))
+		}
+
+		matched := len(oldLines) - lead - trail
+		out = append(out, lines[pos:at]...)
+		out = append(out, newLines[lead:len(newLines)-trail]...)
+		pos = at + matched
+	}
+
+	out = append(out, lines[pos:]...)
+	return out, warnings, conflicts
+}
+
+// locateHunk finds where the old side of a hunk starts at or after from. It
+// returns the position and how many leading and trailing context lines had
+// to be dropped to match.
+func locateHunk(lines []string, from int, oldLines []string, expected int, hunk *diffHunk, fuzz int) (at, lead, trail int, loose, ok bool) {
+	if len(oldLines) == 0 {
+		switch {
+		case expected >= from && expected <= len(lines):
+			return expected, 0, 0, false, true
+		case expected < 0 && len(lines) == 0:
+			return 0, 0, 0, false, true
+		}
+		return 0, 0, 0, false, false
+	}
+
+	leadingContext, trailingContext := 0, 0
+	for _, line := range hunk.Lines {
+		if line.Kind != ' ' {
+			break
+		}
+		leadingContext++
+	}
+	for i := len(hunk.Lines) - 1; i >= 0 && hunk.Lines[i].Kind == ' '; i-- {
+		trailingContext++
+	}
+
+	for f := 0; f <= fuzz; f++ {
+		lead, trail = min(f, leadingContext), min(f, trailingContext)
+		if f > 0 && lead < f && trail < f {
+			break // no more context to drop
+		}
+		if lead+trail >= len(oldLines) {
+			break
+		}
+		window := oldLines[lead : len(oldLines)-trail]
+		start := expected
+		if start >= 0 {
+			start += lead
+		}
+		for _, loose := range []bool{false, true} {
+			if at, ok := findLines(lines, from, window, start, loose); ok {
+				return at, lead, trail, loose, true
+			}
+		}
+	}
+	return 0, 0, 0, false, false
+}
+
+// findLines finds want in lines at or after from, nearest to near when it
+// is not negative
+func findLines(lines []string, from int, want []string, near int, loose bool) (int, bool) {
+	last := len(lines) - len(want)
+	if last < from {
+		return 0, false
+	}
+	if near < from {
+		near = from
+	}
+	if near > last {
+		near = last
+	}
+
+	matches := func(at int) bool {
+		for i, line := range want {
+			if line != lines[at+i] && (!loose || strings.Join(strings.Fields(line), " ") != strings.Join(strings.Fields(lines[at+i]), " ")) {
+				return false
+			}
+		}
+		return true
+	}
+	for distance := 0; near-distance >= from || near+distance <= last; distance++ {
+		if near+distance <= last && matches(near+distance) {
+			return near + distance, true
+		}
+		if distance > 0 && near-distance >= from && matches(near-distance) {
+			return near - distance, true
+		}
+	}
+	return 0, false
+}
+
+// hunkConflict describes a hunk that could not be placed, with the region
+// of the file closest to what the hunk expected
+func hunkConflict(lines []string, hunk int, oldLines []string, expected int) map[string]interface{} {
+	conflict := map[string]interface{}{
+		"hunk":     hunk,
+		"message":  "context lines not found",
+		"expected": strings.Join(oldLines, "\n"),
+	}
+	if expected >= 0 {
+		conflict["line"] = expected + 1
+	}
+	if len(oldLines) == 0 {
+		conflict["message"] = "insertion point not found"
+		return conflict
+	}
+
+	if at, ok := closestLines(lines, oldLines, expected); ok {
+		conflict["closest_line"] = at + 1
+		conflict["found"] = strings.Join(lines[at:min(at+len(oldLines), len(lines))], "\n")
+	}
+	return conflict
+}
+
+// closestLines finds the window of lines with the smallest line-level edit
+// distance to want, preferring the one nearest to near on a tie
+func closestLines(lines, want []string, near int) (int, bool) {
+	if len(lines) == 0 || len(lines) > 20000 {
+		return 0, false
+	}
+
+	encode := lineEncoder()
+	wantRunes := encode(want)
+	fileRunes := encode(lines)
+
+	dmp := diffmatchpatch.New()
+	best, bestDistance := 0, -1
+	for at := 0; at < len(lines); at++ {
+		window := fileRunes[at:min(at+len(want), len(lines))]
+		distance := dmp.DiffLevenshtein(dmp.DiffMainRunes(wantRunes, window, false))
+		if bestDistance < 0 || distance < bestDistance ||
+			(distance == bestDistance && near >= 0 && lineGap(at, near) < lineGap(best, near)) {
+			best, bestDistance = at, distance
+		}
+	}
+	if bestDistance >= len(want) {
+		return 0, false
+	}
+	return best, true
+}
+
+func lineGap(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,279 @@
+package generic
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newPatchTestRegistry(t *testing.T, security *Security) *ToolRegistry {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	registry, err := NewToolRegistry(map[string]Tool{}, security, logger)
+	if err != nil {
+		t.Fatalf("Failed to create tool registry: %v", err)
+	}
+	return registry
+}
+
+func writePatchTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readPatchTestFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(content)
+}
+
+const patchTestSource = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n\nfunc helper() int {\n\treturn 1\n}\n"
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		patch    string
+		expected string
+		warning  string
+	}{
+		{
+			name:   "exact",
+			source: patchTestSource,
+			patch: "--- a/main.go\n+++ b/main.go\n@@ -5,3 +5,3 @@\n func main() {\n-\tfmt.Println(\"hello\")\n+\tfmt.Println(\"goodbye\")\n }\n" +
+				"@@ -9,3 +9,3 @@\n func helper() int {\n-\treturn 1\n+\treturn 2\n }\n",
+			expected: strings.NewReplacer(`"hello"`, `"goodbye"`, "return 1", "return 2").Replace(patchTestSource),
+		},
+		{
+			name:     "offset after concurrent edit",
+			source:   "// Copyright header\n// added by someone else\n" + patchTestSource,
+			patch:    "--- a/main.go\n+++ b/main.go\n@@ -9,3 +9,3 @@\n func helper() int {\n-\treturn 1\n+\treturn 2\n }\n",
+			expected: "// Copyright header\n// added by someone else\n" + strings.Replace(patchTestSource, "return 1", "return 2", 1),
+			warning:  "offset 2",
+		},
+		{
+			name:     "no line numbers and different indentation",
+			source:   patchTestSource,
+			patch:    "```diff\n--- main.go\n+++ main.go\n@@ ... @@\n func main() {\n-    fmt.Println(\"hello\")\n+\tfmt.Println(\"hi\")\n }\n```",
+			expected: strings.Replace(patchTestSource, `"hello"`, `"hi"`, 1),
+			warning:  "ignoring whitespace",
+		},
+		{
+			name:     "fuzz drops stale context",
+			source:   patchTestSource,
+			patch:    "--- a/main.go\n+++ b/main.go\n@@ -9,3 +9,4 @@\n func helper() int {\n-\treturn 1\n+\tx := 2\n+\treturn x\n } // stale comment\n",
+			expected: strings.Replace(patchTestSource, "\treturn 1\n", "\tx := 2\n\treturn x\n", 1),
+			warning:  "fuzz 1",
+		},
+		{
+			name:     "no newline at end of file",
+			source:   "one\ntwo",
+			patch:    "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n one\n-two\n\\ No newline at end of file\n+three\n",
+			expected: "one\nthree\n",
+		},
+		{
+			name:     "CRLF file",
+			source:   "one\r\ntwo\r\n",
+			patch:    "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n",
+			expected: "one\r\nthree\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newPatchTestRegistry(t, &Security{})
+			writePatchTestFile(t, "main.go", tt.source)
+
+			output, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": tt.patch})
+			if err != nil {
+				t.Fatalf("apply_patch failed: %v", err)
+			}
+			result := output.(map[string]interface{})
+			if result["success"] != true || result["applied"] != true {
+				t.Fatalf("Patch did not apply: %v", result["conflicts"])
+			}
+			if got := readPatchTestFile(t, "main.go"); got != tt.expected {
+				t.Errorf("Unexpected content:\n got %q\nwant %q", got, tt.expected)
+			}
+
+			file := result["files"].([]interface{})[0].(map[string]interface{})
+			warnings, _ := file["warnings"].([]interface{})
+			if tt.warning == "" && len(warnings) > 0 {
+				t.Errorf("Unexpected warnings %v", warnings)
+			}
+			if tt.warning != "" && (len(warnings) != 1 || !strings.Contains(warnings[0].(string), tt.warning)) {
+				t.Errorf("Expected a warning containing %q, got %v", tt.warning, warnings)
+			}
+		})
+	}
+}
+
+func TestApplyPatchFiles(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{})
+	writePatchTestFile(t, "old.txt", "keep\n")
+	writePatchTestFile(t, "gone.txt", "bye\n")
+
+	patch := "diff --git a/docs/new.md b/docs/new.md\nnew file mode 100644\n--- /dev/null\n+++ b/docs/new.md\n@@ -0,0 +1,2 @@\n+# New\n+text\n" +
+		"diff --git a/gone.txt b/gone.txt\ndeleted file mode 100644\n--- a/gone.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-bye\n" +
+		"diff --git a/old.txt b/renamed.txt\n--- a/old.txt\n+++ b/renamed.txt\n@@ -1 +1,2 @@\n keep\n+more\n"
+
+	dryRun, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": patch, "dry_run": true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if result := dryRun.(map[string]interface{}); result["success"] != true || result["applied"] != false {
+		t.Fatalf("Unexpected dry run result: %v", result)
+	}
+	if _, err := os.Stat("docs/new.md"); !os.IsNotExist(err) {
+		t.Fatalf("Dry run changed files")
+	}
+
+	if _, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": patch}); err != nil {
+		t.Fatalf("apply_patch failed: %v", err)
+	}
+	if got := readPatchTestFile(t, "docs/new.md"); got != "# New\ntext\n" {
+		t.Errorf("Unexpected new file %q", got)
+	}
+	if got := readPatchTestFile(t, "renamed.txt"); got != "keep\nmore\n" {
+		t.Errorf("Unexpected renamed file %q", got)
+	}
+	for _, path := range []string{"gone.txt", "old.txt"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+}
+
+func TestApplyPatchPlainDiffNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		patch   string
+		patched string
+		absent  string
+	}{
+		{
+			name:    "diff against a backup copy",
+			files:   []string{"main.go.orig", "main.go"},
+			patch:   "--- main.go.orig\t2024-05-01 10:00:00.000000000 +0200\n+++ main.go\t2024-05-01 10:05:00.000000000 +0200\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n",
+			patched: "main.go",
+		},
+		{
+			name:    "only the old name exists",
+			files:   []string{"src/app.txt"},
+			patch:   "--- a/src/app.txt\n+++ b/app.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n",
+			patched: "src/app.txt",
+			absent:  "app.txt",
+		},
+		{
+			name:    "only the new name exists",
+			files:   []string{"app.txt"},
+			patch:   "--- a/app.txt.old\n+++ b/app.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+three\n",
+			patched: "app.txt",
+			absent:  "app.txt.old",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newPatchTestRegistry(t, &Security{})
+			for _, path := range tt.files {
+				writePatchTestFile(t, path, "one\ntwo\n")
+			}
+
+			output, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": tt.patch})
+			if err != nil {
+				t.Fatalf("apply_patch failed: %v", err)
+			}
+			file := output.(map[string]interface{})["files"].([]interface{})[0].(map[string]interface{})
+			if file["path"] != tt.patched || file["status"] != "modified" {
+				t.Errorf("Unexpected file report %v", file)
+			}
+			if got := readPatchTestFile(t, tt.patched); got != "one\nthree\n" {
+				t.Errorf("Unexpected content of %s: %q", tt.patched, got)
+			}
+			for _, path := range tt.files {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("Expected %s to be kept: %v", path, err)
+				} else if path != tt.patched && readPatchTestFile(t, path) != "one\ntwo\n" {
+					t.Errorf("Expected %s to be left alone", path)
+				}
+			}
+			if tt.absent != "" {
+				if _, err := os.Stat(tt.absent); !os.IsNotExist(err) {
+					t.Errorf("Expected %s not to be created", tt.absent)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyPatchConflicts(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{})
+	writePatchTestFile(t, "main.go", patchTestSource)
+	writePatchTestFile(t, "other.go", "package other\n")
+
+	patch := "--- a/other.go\n+++ b/other.go\n@@ -1 +1 @@\n-package other\n+package another\n" +
+		"--- a/main.go\n+++ b/main.go\n@@ -9,3 +9,3 @@\n func helper() string {\n-\treturn \"1\"\n+\treturn \"2\"\n }\n"
+
+	output, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": patch, "fuzz": float64(0)})
+	if err != nil {
+		t.Fatalf("apply_patch failed: %v", err)
+	}
+	result := output.(map[string]interface{})
+	if result["success"] != false || result["applied"] != false {
+		t.Fatalf("Expected a conflict, got %v", result)
+	}
+	conflicts := result["conflicts"].([]interface{})
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %v", conflicts)
+	}
+	conflict := conflicts[0].(map[string]interface{})
+	if conflict["path"] != "main.go" || conflict["hunk"] != 1 || conflict["line"] != 9 || conflict["closest_line"] != 9 {
+		t.Errorf("Unexpected conflict %v", conflict)
+	}
+	if !strings.Contains(conflict["found"].(string), "func helper() int {") {
+		t.Errorf("Expected the closest region in the conflict, got %q", conflict["found"])
+	}
+	if got := readPatchTestFile(t, "other.go"); got != "package other\n" {
+		t.Errorf("A conflicting patch should not change any file, got %q", got)
+	}
+}
+
+func TestApplyPatchAllowedPaths(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{Enabled: true, AllowedPaths: []string{"src"}, BlockedPaths: []string{"src/secrets"}})
+	writePatchTestFile(t, "src/app.txt", "a\n")
+	writePatchTestFile(t, "src/secrets/key.txt", "a\n")
+	writePatchTestFile(t, "docs/readme.txt", "a\n")
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"src/app.txt", false},
+		{"src/secrets/key.txt", true},
+		{"docs/readme.txt", true},
+		{"../outside.txt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			patch := "--- a/" + tt.path + "\n+++ b/" + tt.path + "\n@@ -1 +1 @@\n-a\n+b\n"
+			_, err := registry.executeApplyPatch(context.Background(), map[string]interface{}{"patch": patch})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package generic
+
+import (
+	"fmt"
+
+	"github.com/alantheprice/agent/pkg/providers/prompts"
+)
+
+// defaultPromptsDir is where agents keep managed prompt files unless
+// agent.prompts_dir says otherwise
+const defaultPromptsDir = "prompts"
+
+// promptRefKeys maps each step config key that references a managed prompt
+// to the inline key it fills in
+var promptRefKeys = map[string]string{
+	"prompt_ref":         "prompt",
+	"system_prompt_ref":  "system_prompt",
+	"opening_prompt_ref": "opening_prompt",
+}
+
+// SetPromptsDir points prompt references at a different prompts directory
+func (we *WorkflowEngine) SetPromptsDir(dir string) {
+	if dir == "" {
+		dir = defaultPromptsDir
+	}
+	we.prompts = prompts.NewManager(dir)
+}
+
+// resolvePromptRefs returns a copy of the step whose "*_ref" keys are replaced
+// by the managed prompts they name ("review" or "review@2"). The prompt text
+// is then rendered by the template engine like any inline prompt, and the
+// resolved references are recorded in metadata.
+func (we *WorkflowEngine) resolvePromptRefs(step Step, metadata map[string]interface{}) (Step, error) {
+	var config map[string]interface{}
+
+	for refKey, promptKey := range promptRefKeys {
+		ref, ok := step.Config[refKey].(string)
+		if !ok || ref == "" {
+			continue
+		}
+		if _, inline := step.Config[promptKey]; inline {
+			return step, fmt.Errorf("step %s sets both %s and %s", step.Name, refKey, promptKey)
+		}
+
+		content, resolved, err := we.prompts.LoadRef(ref)
+		if err != nil {
+			return step, fmt.Errorf("failed to resolve %s %q: %w", refKey, ref, err)
+		}
+
+		if config == nil {
+			config = make(map[string]interface{}, len(step.Config))
+			for key, value := range step.Config {
+				config[key] = value
+			}
+		}
+		config[promptKey] = content
+		metadata[refKey] = resolved
+
+		we.logger.Debug("Resolved prompt reference", "step", step.Name, "ref", ref, "resolved", resolved)
+	}
+
+	if config != nil {
+		step.Config = config
+	}
+	return step, nil
+}
@@ -0,0 +1,104 @@
+package generic
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPromptRef(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"review@1.txt":  "Review {diff}",
+		"review@2.txt":  "Review carefully: {diff}",
+		"review@10.txt": "Review line by line: {diff}",
+		"persona.txt":   "You are a strict reviewer.",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write prompt: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name             string
+		config           map[string]interface{}
+		expectError      bool
+		expectedPrompt   string
+		expectedSystem   string
+		expectedResolved string
+	}{
+		{
+			name:             "latest version",
+			config:           map[string]interface{}{"prompt_ref": "review"},
+			expectedPrompt:   "Review line by line: +added",
+			expectedResolved: "review@10",
+		},
+		{
+			name:             "pinned version with system prompt",
+			config:           map[string]interface{}{"prompt_ref": "review@2", "system_prompt_ref": "persona"},
+			expectedPrompt:   "Review carefully: +added",
+			expectedSystem:   "You are a strict reviewer.",
+			expectedResolved: "review@2",
+		},
+		{
+			name:        "missing version",
+			config:      map[string]interface{}{"prompt_ref": "review@3"},
+			expectError: true,
+		},
+		{
+			name:        "inline prompt and reference",
+			config:      map[string]interface{}{"prompt_ref": "review", "prompt": "Review {diff}"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newChatTestServer(t, "looks good", &requests)
+			defer server.Close()
+
+			engine := newBudgetTestEngine(t, server.URL)
+			engine.SetPromptsDir(dir)
+			execCtx := newBudgetTestContext(map[string]interface{}{"diff": "+added"})
+
+			step := Step{Name: "review", Type: "llm", Config: tt.config}
+			result, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult))
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.Metadata["prompt_ref"] != tt.expectedResolved {
+				t.Errorf("Expected prompt_ref metadata %q, got %v", tt.expectedResolved, result.Metadata["prompt_ref"])
+			}
+			if _, inline := tt.config["prompt"]; inline {
+				t.Error("Expected the step config to be left unchanged")
+			}
+
+			messages, _ := requests[0]["messages"].([]interface{})
+			var contents []string
+			for _, raw := range messages {
+				message, _ := raw.(map[string]interface{})
+				content, _ := message["content"].(string)
+				contents = append(contents, content)
+			}
+
+			expected := []string{tt.expectedPrompt}
+			if tt.expectedSystem != "" {
+				expected = []string{tt.expectedSystem, tt.expectedPrompt}
+			}
+			if strings.Join(contents, "|") != strings.Join(expected, "|") {
+				t.Errorf("Expected messages %q, got %q", expected, contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package generic
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// Queries over structured step outputs
+//
+// evaluateQuery runs a JMESPath expression (https://jmespath.org), using
+// go-jmespath, such as
+//
+//	items[?severity == 'high'].file
+//	sort_by(files, &lines)[-1].path
+//	{total: length(items), files: items[].file}
+//
+// Expressions that start with "$" are JSONPath instead, which adds recursive
+// descent:
+//
+//	$..file
+//	$.items[?(@.severity == 'high')].file
+//
+// Object projections, keys() and values() follow Go's map order, so sort
+// them where order matters. JSONPath results are always a list of the
+// matched values. Data given as a string is decoded as JSON first,
+// tolerating code fences around it.
+
+// evaluateQuery evaluates a JMESPath or JSONPath expression against data
+func evaluateQuery(expression string, data interface{}) (interface{}, error) {
+	data, err := normalizeQueryData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "$") {
+		return evaluateJSONPath(expression, data)
+	}
+
+	query, err := jmespath.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %w", expression, err)
+	}
+	result, err := query.Search(data)
+	if err != nil {
+		return nil, fmt.Errorf("query %q failed: %w", expression, err)
+	}
+	return result, nil
+}
+
+// normalizeQueryData turns data into plain JSON values: strings are decoded
+// as JSON and structs or typed slices are round-tripped through JSON
+func normalizeQueryData(data interface{}) (interface{}, error) {
+	if text, ok := data.(string); ok {
+		value, err := extractJSONValue(text)
+		if err != nil {
+			return nil, fmt.Errorf("query data is not JSON: %w", err)
+		}
+		return value, nil
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("query data cannot be encoded as JSON: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return nil, fmt.Errorf("query data cannot be encoded as JSON: %w", err)
+	}
+	return value, nil
+}
+
+// sliceQueryList applies Python-style slice semantics
+func sliceQueryList(list []interface{}, parts [3]*int) (interface{}, error) {
+	step := 1
+	if parts[2] != nil {
+		step = *parts[2]
+		if step == 0 {
+			return nil, fmt.Errorf("slice step cannot be 0")
+		}
+	}
+
+	length := len(list)
+	bound := func(value *int, fallback int) int {
+		if value == nil {
+			return fallback
+		}
+		n := *value
+		if n < 0 {
+			n += length
+			if n < 0 {
+				if step < 0 {
+					return -1
+				}
+				return 0
+			}
+		} else if n >= length {
+			if step < 0 {
+				return length - 1
+			}
+			return length
+		}
+		return n
+	}
+
+	result := []interface{}{}
+	if step > 0 {
+		for i := bound(parts[0], 0); i < bound(parts[1], length); i += step {
+			result = append(result, list[i])
+		}
+	} else {
+		for i := bound(parts[0], length-1); i > bound(parts[1], -1); i += step {
+			result = append(result, list[i])
+		}
+	}
+	return result, nil
+}
+
+// queryTruthy follows JMESPath: false, null and empty strings, lists and
+// objects are false; everything else, including 0, is true
+func queryTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// JSONPath
+
+// evaluateJSONPath evaluates a JSONPath expression, returning every match
+func evaluateJSONPath(expression string, data interface{}) (interface{}, error) {
+	nodes := []interface{}{data}
+	rest := strings.TrimPrefix(expression, "$")
+
+	for rest != "" {
+		var err error
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			rest = rest[2:]
+			var descendants []interface{}
+			for _, node := range nodes {
+				descendants = appendDescendants(descendants, node)
+			}
+			nodes = descendants
+			if strings.HasPrefix(rest, "[") {
+				continue
+			}
+			var name string
+			name, rest = splitJSONPathName(rest)
+			nodes = selectJSONPathName(nodes, name)
+
+		case strings.HasPrefix(rest, "."):
+			var name string
+			name, rest = splitJSONPathName(rest[1:])
+			if name == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: missing name after '.'", expression)
+			}
+			nodes = selectJSONPathName(nodes, name)
+
+		case strings.HasPrefix(rest, "["):
+			end := matchingBracket(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q: unclosed '['", expression)
+			}
+			selector := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if nodes, err = selectJSONPathBracket(nodes, selector); err != nil {
+				return nil, fmt.Errorf("invalid JSONPath %q: %w", expression, err)
+			}
+
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", expression, rest)
+		}
+	}
+
+	if nodes == nil {
+		nodes = []interface{}{}
+	}
+	return nodes, nil
+}
+
+// appendDescendants appends node and everything nested in it, in document
+// order with object keys sorted
+func appendDescendants(result []interface{}, node interface{}) []interface{} {
+	result = append(result, node)
+	switch v := node.(type) {
+	case []interface{}:
+		for _, item := range v {
+			result = appendDescendants(result, item)
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			result = appendDescendants(result, v[key])
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// splitJSONPathName splits a dot-notation name or "*" off the path
+func splitJSONPathName(path string) (string, string) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		return path, ""
+	}
+	return path[:end], path[end:]
+}
+
+// jsonPathChildren returns the members of a list or object
+func jsonPathChildren(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		children := make([]interface{}, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			children = append(children, v[key])
+		}
+		return children
+	}
+	return nil
+}
+
+func selectJSONPathName(nodes []interface{}, name string) []interface{} {
+	var result []interface{}
+	for _, node := range nodes {
+		if name == "*" {
+			result = append(result, jsonPathChildren(node)...)
+			continue
+		}
+		if m, ok := node.(map[string]interface{}); ok {
+			if value, exists := m[name]; exists {
+				result = append(result, value)
+			}
+		}
+	}
+	return result
+}
+
+func selectJSONPathBracket(nodes []interface{}, selector string) ([]interface{}, error) {
+	if selector == "*" {
+		return selectJSONPathName(nodes, "*"), nil
+	}
+
+	if strings.HasPrefix(selector, "?") {
+		condition := strings.TrimSpace(selector[1:])
+		if strings.HasPrefix(condition, "(") && strings.HasSuffix(condition, ")") {
+			condition = condition[1 : len(condition)-1]
+		}
+		query, err := jmespath.Compile(translateJSONPathFilter(condition))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", condition, err)
+		}
+
+		var result []interface{}
+		for _, parent := range nodes {
+			for _, child := range jsonPathChildren(parent) {
+				matched, err := query.Search(child)
+				if err != nil {
+					return nil, err
+				}
+				if queryTruthy(matched) {
+					result = append(result, child)
+				}
+			}
+		}
+		return result, nil
+	}
+
+	if strings.Contains(selector, ":") {
+		var parts [3]*int
+		for i, part := range strings.SplitN(selector, ":", 3) {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slice %q", selector)
+			}
+			parts[i] = &n
+		}
+		var result []interface{}
+		for _, node := range nodes {
+			if list, ok := node.([]interface{}); ok {
+				sliced, err := sliceQueryList(list, parts)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, sliced.([]interface{})...)
+			}
+		}
+		return result, nil
+	}
+
+	var result []interface{}
+	for _, part := range splitOutsideQuotes(selector, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '\'' || part[0] == '"') && part[len(part)-1] == part[0] {
+			result = append(result, selectJSONPathName(nodes, part[1:len(part)-1])...)
+			continue
+		}
+
+		index, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q", part)
+		}
+		for _, node := range nodes {
+			list, ok := node.([]interface{})
+			if !ok {
+				continue
+			}
+			i := index
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				result = append(result, list[i])
+			}
+		}
+	}
+	return result, nil
+}
+
+// matchingBracket returns the index of the "]" closing the "[" at path[0]
+func matchingBracket(path string) int {
+	depth := 0
+	var quoteChar byte
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case quoteChar != 0:
+			if c == '\\' {
+				i++
+			} else if c == quoteChar {
+				quoteChar = 0
+			}
+		case c == '\'' || c == '"':
+			quoteChar = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// translateJSONPathFilter rewrites a JSONPath filter such as
+// @.lines > 10 && @.status == "added" as the equivalent JMESPath condition:
+// double-quoted strings become raw strings, and bare numbers, true, false
+// and null become JSON literals.
+func translateJSONPathFilter(condition string) string {
+	var sb strings.Builder
+	previous := byte('(')
+
+	for i := 0; i < len(condition); {
+		c := condition[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(condition) && condition[end] != c {
+				if condition[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			body := condition[i+1 : min(end, len(condition))]
+			if c == '"' {
+				body = strings.ReplaceAll(body, `'`, `\'`)
+			}
+			sb.WriteString("'" + body + "'")
+			i = end + 1
+			previous = '\''
+			continue
+
+		case strings.ContainsRune("=!<>(&|,", rune(previous)) && (c == '-' || (c >= '0' && c <= '9') || unicode.IsLetter(rune(c))):
+			end := i + 1
+			for end < len(condition) && (condition[end] == '.' || condition[end] == '_' ||
+				unicode.IsLetter(rune(condition[end])) || unicode.IsDigit(rune(condition[end]))) {
+				end++
+			}
+			word := condition[i:end]
+			if _, err := strconv.ParseFloat(word, 64); err == nil || word == "true" || word == "false" || word == "null" {
+				word = "`" + word + "`"
+			}
+			sb.WriteString(word)
+			i = end
+			previous = 'a'
+			continue
+		}
+
+		sb.WriteByte(c)
+		if c != ' ' {
+			previous = c
+		}
+		i++
+	}
+	return sb.String()
+}
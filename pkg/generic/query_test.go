@@ -0,0 +1,205 @@
+package generic
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateQuery(t *testing.T) {
+	review := `{
+		"items": [
+			{"file": "a.go", "severity": "high", "lines": 12, "tags": ["bug"]},
+			{"file": "b.go", "severity": "low", "lines": 3, "tags": ["style", "nit"]},
+			{"file": "c.go", "severity": "high", "lines": 40, "tags": []}
+		],
+		"meta": {"author": "sam", "reviewed": true}
+	}`
+
+	tests := []struct {
+		name          string
+		expression    string
+		data          interface{}
+		expected      string
+		expectedInErr string
+	}{
+		// JMESPath
+		{name: "field", expression: "meta.author", data: review, expected: `"sam"`},
+		{name: "missing field", expression: "meta.missing", data: review, expected: "null"},
+		{name: "filter projection", expression: "items[?severity=='high'].file", data: review, expected: `["a.go","c.go"]`},
+		{name: "numeric comparison", expression: "items[?lines > `10`].file", data: review, expected: `["a.go","c.go"]`},
+		{name: "and with not", expression: "items[?severity=='high' && !contains(tags, 'bug')].file", data: review, expected: `["c.go"]`},
+		{name: "index and negative index", expression: "[items[0].file, items[-1].file]", data: review, expected: `["a.go","c.go"]`},
+		{name: "slice", expression: "items[::-1].file", data: review, expected: `["c.go","b.go","a.go"]`},
+		{name: "flatten", expression: "items[].tags[]", data: review, expected: `["bug","style","nit"]`},
+		{name: "object projection", expression: "items[0].* | [?type(@) == 'string'] | sort(@)", data: review, expected: `["a.go","high"]`},
+		{name: "multi-select hash", expression: "{count: length(items), files: items[].file}", data: review, expected: `{"count":3,"files":["a.go","b.go","c.go"]}`},
+		{name: "pipe stops projection", expression: "items[*].file | [0]", data: review, expected: `"a.go"`},
+		{name: "sort_by and max_by", expression: "[sort_by(items, &lines)[0].file, max_by(items, &lines).file]", data: review, expected: `["b.go","c.go"]`},
+		{name: "sum and join", expression: "[sum(items[].lines), join(', ', items[].severity)]", data: review, expected: `[55,"high, low, high"]`},
+		{name: "or falls back", expression: "meta.missing || 'none'", data: review, expected: `"none"`},
+		{name: "raw and json literals", expression: "[`{\"a\": 1}`, 'it\\'s']", data: review, expected: `[{"a":1},"it's"]`},
+		{name: "quoted identifier", expression: `"odd key"`, data: map[string]interface{}{"odd key": 1}, expected: "1"},
+		{name: "structured data", expression: "[?ok].name", data: []map[string]interface{}{{"name": "x", "ok": true}, {"name": "y", "ok": false}}, expected: `["x"]`},
+		{name: "syntax error", expression: "items[?severity==", data: review, expectedInErr: "invalid query"},
+		{name: "unknown function", expression: "nope(items)", data: review, expectedInErr: "unknown function: nope"},
+		{name: "wrong argument type", expression: "length(`1`)", data: review, expectedInErr: "Invalid type for: 1"},
+		{name: "not JSON", expression: "a", data: "not json", expectedInErr: "query data is not JSON"},
+
+		// JSONPath
+		{name: "jsonpath field", expression: "$.meta.author", data: review, expected: `["sam"]`},
+		{name: "jsonpath wildcard", expression: "$.items[*].file", data: review, expected: `["a.go","b.go","c.go"]`},
+		{name: "jsonpath recursive", expression: "$..author", data: review, expected: `["sam"]`},
+		{name: "jsonpath filter", expression: `$.items[?(@.severity == "high" && @.lines < 20)].file`, data: review, expected: `["a.go"]`},
+		{name: "jsonpath union and slice", expression: "$.items[0,2].file", data: review, expected: `["a.go","c.go"]`},
+		{name: "jsonpath slice", expression: "$.items[1:].lines", data: review, expected: `[3,40]`},
+		{name: "jsonpath bracket name", expression: "$['meta']['reviewed']", data: review, expected: `[true]`},
+		{name: "jsonpath no match", expression: "$.nothing", data: review, expected: `[]`},
+		{name: "jsonpath unclosed bracket", expression: "$.items[0", data: review, expectedInErr: "unclosed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := evaluateQuery(tt.expression, tt.data)
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v (value %v)", tt.expectedInErr, err, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			encoded, _ := json.Marshal(value)
+			if actual := string(encoded); actual != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestQueryInTemplatesAndTransforms(t *testing.T) {
+	te := newTestTemplateEngine()
+	results := map[string]*StepResult{
+		"review": {StepName: "review", Success: true, Output: map[string]interface{}{
+			"output": "```json\n" + `{"items": [{"file": "a.go", "severity": "high"}, {"file": "b.go", "severity": "low"}]}` + "\n```",
+		}},
+	}
+	execCtx := &ExecutionContext{Data: map[string]interface{}{}}
+
+	rendered, err := te.RenderTemplate(`{query("items[?severity=='high'].file", review.output) | join(",")}`, results, execCtx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rendered != "a.go" {
+		t.Errorf("Expected %q, got %q", "a.go", rendered)
+	}
+
+	transformer, ok := NewTransformRegistry(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))).GetTransformer("query")
+	if !ok {
+		t.Fatal("Expected query transformer to be registered")
+	}
+	if err := transformer.ValidateParams(map[string]interface{}{}); err == nil {
+		t.Error("Expected missing expression to be rejected")
+	}
+	value, err := transformer.Transform(results["review"].Output.(map[string]interface{})["output"], map[string]interface{}{"expression": "$..file"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if encoded, _ := json.Marshal(value); string(encoded) != `["a.go","b.go"]` {
+		t.Errorf("Expected %s, got %s", `["a.go","b.go"]`, encoded)
+	}
+}
+
+// Cases from the JMESPath specification and its compliance suite
+func TestEvaluateQueryJMESPathCompliance(t *testing.T) {
+	people := `{
+		"people": [
+			{"name": "a", "age": 30, "tags": ["x"]},
+			{"name": "b", "age": 25, "tags": ["y", "z"]},
+			{"name": "c", "age": 40},
+			{"first": "d"}
+		],
+		"ops": {"functionA": {"numArgs": 2}, "functionB": {"numArgs": 3}},
+		"nested": [[1, 2], [3, [4, 5]]],
+		"numbers": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9]
+	}`
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		// identifiers and subexpressions
+		{"people[0].name", `"a"`},
+		{"people[5].name", "null"},
+		{"@.ops.functionA.numArgs", "2"},
+
+		// filters
+		{"people[?age > `28`].name", `["a","c"]`},
+		{"people[?name == 'b'].age", `[25]`},
+		{"people[?age].name", `["a","b","c"]`},
+		{"people[?!age].first", `["d"]`},
+		{"people[?age >= `30` || name == 'b'].name", `["a","b","c"]`},
+		{"people[?tags && contains(tags, 'z')].name", `["b"]`},
+		{"numbers[?@ > `7`]", `[8,9]`},
+
+		// projections
+		{"people[*].age", `[30,25,40]`},
+		{"sort(ops.*.numArgs)", `[2,3]`},
+		{"nested[]", `[1,2,3,[4,5]]`},
+		{"nested[][]", `[1,2,3,4,5]`},
+		{"people[*].tags[0]", `["x","y"]`},
+
+		// multi-select
+		{"people[0].[name, age]", `["a",30]`},
+		{"people[?age].{n: name, older: age > `28`}", `[{"n":"a","older":true},{"n":"b","older":false},{"n":"c","older":true}]`},
+		{"[people[0].name, missing]", `["a",null]`},
+
+		// pipes
+		{"people[*].name | [1]", `"b"`},
+		{"people[?age] | length(@)", "3"},
+		{"people[*].age | max(@)", "40"},
+
+		// slices
+		{"numbers[0:3]", `[0,1,2]`},
+		{"numbers[5:]", `[5,6,7,8,9]`},
+		{"numbers[::3]", `[0,3,6,9]`},
+		{"numbers[-2:]", `[8,9]`},
+		{"numbers[8:2:-3]", `[8,5]`},
+
+		// functions
+		{"abs(`-3`)", "3"},
+		{"avg(people[*].age)", "31.666666666666668"},
+		{"ceil(`1.2`)", "2"},
+		{"floor(`1.8`)", "1"},
+		{"starts_with(people[0].name, 'a')", "true"},
+		{"ends_with('report.md', '.md')", "true"},
+		{"sort(keys(ops))", `["functionA","functionB"]`},
+		{"sort(values(ops)[*].numArgs)", `[2,3]`},
+		{"map(&age, people[?age])", `[30,25,40]`},
+		{"merge(`{\"a\": 1}`, `{\"a\": 2, \"b\": 3}`)", `{"a":2,"b":3}`},
+		{"min_by(people[?age], &age).name", `"b"`},
+		{"not_null(people[3].name, people[3].first)", `"d"`},
+		{"reverse('abc')", `"cba"`},
+		{"to_number('12.5')", "12.5"},
+		{"to_string(`[1]`)", `"[1]"`},
+		{"type(people)", `"array"`},
+		{"length('hello')", "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			value, err := evaluateQuery(tt.expression, people)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			encoded, _ := json.Marshal(value)
+			if actual := string(encoded); actual != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,859 @@
+package generic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Relational transformers
+//
+// group_by, join, pivot, top_n and window work on arrays of records (maps),
+// such as parsed CSV rows or JSON from an LLM; JSON text is parsed first.
+// Field names may be dotted paths into nested records. Keys are compared by
+// their text, so the number 7 from a CSV file matches "7" from an LLM.
+
+// registerRelationalTransformers registers the record array transformers
+func (tr *TransformRegistry) registerRelationalTransformers() {
+	tr.RegisterTransformer(&GroupByTransformer{})
+	tr.RegisterTransformer(&JoinTransformer{})
+	tr.RegisterTransformer(&PivotTransformer{})
+	tr.RegisterTransformer(&TopNTransformer{})
+	tr.RegisterTransformer(&WindowTransformer{})
+}
+
+// aggregationOps are the operations group_by and pivot accept
+var aggregationOps = map[string]bool{
+	"count": true, "sum": true, "avg": true, "average": true, "min": true, "max": true,
+	"first": true, "last": true, "list": true, "distinct": true, "count_distinct": true,
+}
+
+// toRecords reads an array of records, parsing JSON text first
+func toRecords(input interface{}) ([]map[string]interface{}, error) {
+	if text, ok := input.(string); ok {
+		value, err := extractJSONValue(text)
+		if err != nil {
+			return nil, fmt.Errorf("input is not a JSON array: %w", err)
+		}
+		input = value
+	}
+	if records, ok := input.([]map[string]interface{}); ok {
+		return records, nil
+	}
+
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("input must be an array of records, got %T", input)
+	}
+	records := make([]map[string]interface{}, v.Len())
+	for i := range records {
+		record, ok := v.Index(i).Interface().(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("item %d is not a record, got %T", i, v.Index(i).Interface())
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+func recordsToInterfaces(records []map[string]interface{}) []interface{} {
+	result := make([]interface{}, len(records))
+	for i, record := range records {
+		result[i] = record
+	}
+	return result
+}
+
+// recordField returns the value at a dotted path, or nil
+func recordField(record map[string]interface{}, path string) interface{} {
+	if value, ok := record[path]; ok {
+		return value
+	}
+	var current interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+// fieldsParam reads a field name or a list of field names
+func fieldsParam(params map[string]interface{}, name string, required bool) ([]string, error) {
+	value, ok := params[name]
+	if !ok || value == nil {
+		if required {
+			return nil, fmt.Errorf("%s parameter is required", name)
+		}
+		return nil, nil
+	}
+	if field, ok := value.(string); ok {
+		if field == "" {
+			return nil, fmt.Errorf("%s cannot be empty", name)
+		}
+		return []string{field}, nil
+	}
+	fields, err := stringListParam(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", name, err)
+	}
+	if len(fields) == 0 && required {
+		return nil, fmt.Errorf("%s parameter needs at least one field", name)
+	}
+	return fields, nil
+}
+
+// recordKey identifies the values of fields in a record
+func recordKey(record map[string]interface{}, fields []string) (string, bool) {
+	parts := make([]string, len(fields))
+	complete := true
+	for i, field := range fields {
+		value := recordField(record, field)
+		if value == nil {
+			complete = false
+		}
+		parts[i] = keyText(value)
+	}
+	return strings.Join(parts, "\x00"), complete
+}
+
+func keyText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// recordNumber converts numbers and numeric text to float64
+func recordNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareRecordValues orders values numerically when both are numbers and
+// as text otherwise; nil sorts after everything else
+func compareRecordValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if aNum, ok := recordNumber(a); ok {
+		if bNum, ok := recordNumber(b); ok {
+			switch {
+			case aNum < bNum:
+				return -1
+			case aNum > bNum:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(keyText(a), keyText(b))
+}
+
+// recordAggregation is one named aggregation of a field
+type recordAggregation struct {
+	name  string
+	op    string
+	field string
+}
+
+// parseAggregations reads {"name": "op:field"} or {"name": {"op": ..., "field": ...}}
+func parseAggregations(value interface{}) ([]recordAggregation, error) {
+	specs, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("aggregations must be an object, got %T", value)
+	}
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	aggregations := make([]recordAggregation, 0, len(names))
+	for _, name := range names {
+		aggregation := recordAggregation{name: name}
+		switch spec := specs[name].(type) {
+		case string:
+			aggregation.op, aggregation.field, _ = strings.Cut(spec, ":")
+		case map[string]interface{}:
+			aggregation.op, _ = spec["op"].(string)
+			aggregation.field, _ = spec["field"].(string)
+		default:
+			return nil, fmt.Errorf("aggregation %s must be a string or an object, got %T", name, spec)
+		}
+		if !aggregationOps[aggregation.op] {
+			return nil, fmt.Errorf("aggregation %s: unsupported operation %q", name, aggregation.op)
+		}
+		if aggregation.field == "" && aggregation.op != "count" {
+			return nil, fmt.Errorf("aggregation %s: %s needs a field", name, aggregation.op)
+		}
+		aggregations = append(aggregations, aggregation)
+	}
+	return aggregations, nil
+}
+
+// aggregateRecords applies op to field over records. count without a field
+// counts records; the other operations skip missing values.
+func aggregateRecords(records []map[string]interface{}, op, field string) interface{} {
+	if op == "count" && field == "" {
+		return len(records)
+	}
+
+	var values []interface{}
+	for _, record := range records {
+		if value := recordField(record, field); value != nil {
+			values = append(values, value)
+		}
+	}
+
+	switch op {
+	case "count":
+		return len(values)
+	case "sum", "avg", "average":
+		sum, count := 0.0, 0
+		for _, value := range values {
+			if n, ok := recordNumber(value); ok {
+				sum += n
+				count++
+			}
+		}
+		if op == "sum" {
+			return sum
+		}
+		if count == 0 {
+			return nil
+		}
+		return sum / float64(count)
+	case "min", "max":
+		var best interface{}
+		for _, value := range values {
+			c := compareRecordValues(value, best)
+			if best == nil || (op == "min" && c < 0) || (op == "max" && c > 0) {
+				best = value
+			}
+		}
+		return best
+	case "first", "last":
+		if len(values) == 0 {
+			return nil
+		}
+		if op == "first" {
+			return values[0]
+		}
+		return values[len(values)-1]
+	case "list":
+		if values == nil {
+			return []interface{}{}
+		}
+		return values
+	case "distinct", "count_distinct":
+		seen := make(map[string]bool)
+		distinct := []interface{}{}
+		for _, value := range values {
+			if key := keyText(value); !seen[key] {
+				seen[key] = true
+				distinct = append(distinct, value)
+			}
+		}
+		if op == "count_distinct" {
+			return len(distinct)
+		}
+		return distinct
+	}
+	return nil
+}
+
+// recordGroup is the records sharing a key, in input order
+type recordGroup struct {
+	first   map[string]interface{}
+	records []map[string]interface{}
+}
+
+// groupRecords groups records by fields, keeping the order in which keys
+// first appear
+func groupRecords(records []map[string]interface{}, fields []string) []*recordGroup {
+	var groups []*recordGroup
+	index := make(map[string]*recordGroup)
+	for _, record := range records {
+		key, _ := recordKey(record, fields)
+		group, ok := index[key]
+		if !ok {
+			group = &recordGroup{first: record}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.records = append(group.records, record)
+	}
+	return groups
+}
+
+// GroupByTransformer groups records by one or more fields and aggregates
+// each group. aggregations maps output names to "op:field" specs, such as
+// {"total": "sum:amount", "rows": "count"}; the default is a count. With
+// items set, each group also lists its records under that name.
+type GroupByTransformer struct{}
+
+func (gb *GroupByTransformer) Name() string { return "group_by" }
+func (gb *GroupByTransformer) Description() string {
+	return "Group records by fields with per-group aggregations"
+}
+
+func (gb *GroupByTransformer) ValidateParams(params map[string]interface{}) error {
+	if _, err := fieldsParam(params, "by", true); err != nil {
+		return err
+	}
+	if aggregations, ok := params["aggregations"]; ok {
+		if _, err := parseAggregations(aggregations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gb *GroupByTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	records, err := toRecords(input)
+	if err != nil {
+		return nil, err
+	}
+	by, err := fieldsParam(params, "by", true)
+	if err != nil {
+		return nil, err
+	}
+	aggregations := []recordAggregation{{name: "count", op: "count"}}
+	if spec, ok := params["aggregations"]; ok {
+		if aggregations, err = parseAggregations(spec); err != nil {
+			return nil, err
+		}
+	}
+	items, _ := params["items"].(string)
+
+	result := []interface{}{}
+	for _, group := range groupRecords(records, by) {
+		row := make(map[string]interface{}, len(by)+len(aggregations)+1)
+		for _, field := range by {
+			row[field] = recordField(group.first, field)
+		}
+		for _, aggregation := range aggregations {
+			row[aggregation.name] = aggregateRecords(group.records, aggregation.op, aggregation.field)
+		}
+		if items != "" {
+			row[items] = recordsToInterfaces(group.records)
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// JoinTransformer joins the input records with the records in with, which
+// in a pipeline names another source. Records match when the on fields (or
+// left_on and right_on) are equal; type is inner (default) or left. Fields
+// from the right record are added to the left one, prefixed with
+// right_prefix when it is set; without a prefix, a right field whose name
+// is already taken gets a "_right" suffix.
+type JoinTransformer struct{}
+
+func (jt *JoinTransformer) Name() string { return "join" }
+func (jt *JoinTransformer) Description() string {
+	return "Join two record arrays on key fields (inner or left)"
+}
+
+// SourceParams lets the pipeline resolve with like a source
+func (jt *JoinTransformer) SourceParams() []string { return []string{"with"} }
+
+func (jt *JoinTransformer) ValidateParams(params map[string]interface{}) error {
+	if _, ok := params["with"]; !ok {
+		return fmt.Errorf("with parameter is required")
+	}
+	if _, _, err := jt.keys(params); err != nil {
+		return err
+	}
+	switch joinType, _ := params["type"].(string); joinType {
+	case "", "inner", "left":
+	default:
+		return fmt.Errorf("unsupported join type: %s", joinType)
+	}
+	return nil
+}
+
+// keys returns the left and right key fields
+func (jt *JoinTransformer) keys(params map[string]interface{}) ([]string, []string, error) {
+	on, err := fieldsParam(params, "on", false)
+	if err != nil {
+		return nil, nil, err
+	}
+	leftOn, err := fieldsParam(params, "left_on", false)
+	if err != nil {
+		return nil, nil, err
+	}
+	rightOn, err := fieldsParam(params, "right_on", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if leftOn == nil {
+		leftOn = on
+	}
+	if rightOn == nil {
+		rightOn = on
+	}
+	if len(leftOn) == 0 || len(rightOn) == 0 {
+		return nil, nil, fmt.Errorf("on, or left_on and right_on, parameters are required")
+	}
+	if len(leftOn) != len(rightOn) {
+		return nil, nil, fmt.Errorf("left_on and right_on must have the same number of fields")
+	}
+	return leftOn, rightOn, nil
+}
+
+func (jt *JoinTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	left, err := toRecords(input)
+	if err != nil {
+		return nil, err
+	}
+	right, err := toRecords(params["with"])
+	if err != nil {
+		return nil, fmt.Errorf("with: %w", err)
+	}
+	leftOn, rightOn, err := jt.keys(params)
+	if err != nil {
+		return nil, err
+	}
+	joinType, _ := params["type"].(string)
+	prefix, _ := params["right_prefix"].(string)
+
+	index := make(map[string][]map[string]interface{})
+	for _, record := range right {
+		if key, complete := recordKey(record, rightOn); complete {
+			index[key] = append(index[key], record)
+		}
+	}
+
+	sameKey := make(map[string]bool)
+	for i := range leftOn {
+		if leftOn[i] == rightOn[i] {
+			sameKey[rightOn[i]] = true
+		}
+	}
+
+	result := []interface{}{}
+	for _, record := range left {
+		key, complete := recordKey(record, leftOn)
+		matches := index[key]
+		if !complete {
+			matches = nil
+		}
+		if len(matches) == 0 {
+			if joinType == "left" {
+				result = append(result, copyRecord(record))
+			}
+			continue
+		}
+
+		for _, match := range matches {
+			joined := copyRecord(record)
+			for field, value := range match {
+				if prefix == "" && sameKey[field] {
+					continue
+				}
+				name := prefix + field
+				if _, taken := joined[name]; taken && prefix == "" {
+					name = field + "_right"
+				}
+				joined[name] = value
+			}
+			result = append(result, joined)
+		}
+	}
+	return result, nil
+}
+
+func copyRecord(record map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		copied[k] = v
+	}
+	return copied
+}
+
+// PivotTransformer turns the values of the columns field into columns: one
+// row per distinct index key, with each cell aggregating the values field
+// of the matching records (aggregate defaults to sum, or count without
+// values). Missing cells are set to fill, null by default.
+type PivotTransformer struct{}
+
+func (pt *PivotTransformer) Name() string { return "pivot" }
+func (pt *PivotTransformer) Description() string {
+	return "Pivot record values into columns"
+}
+
+func (pt *PivotTransformer) ValidateParams(params map[string]interface{}) error {
+	if _, err := fieldsParam(params, "index", true); err != nil {
+		return err
+	}
+	if columns, _ := params["columns"].(string); columns == "" {
+		return fmt.Errorf("columns parameter is required")
+	}
+	_, err := pt.aggregate(params)
+	return err
+}
+
+func (pt *PivotTransformer) aggregate(params map[string]interface{}) (string, error) {
+	op, _ := params["aggregate"].(string)
+	values, _ := params["values"].(string)
+	if op == "" {
+		op = "sum"
+		if values == "" {
+			op = "count"
+		}
+	}
+	if !aggregationOps[op] {
+		return "", fmt.Errorf("unsupported aggregate: %s", op)
+	}
+	if values == "" && op != "count" {
+		return "", fmt.Errorf("values parameter is required for %s", op)
+	}
+	return op, nil
+}
+
+func (pt *PivotTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	records, err := toRecords(input)
+	if err != nil {
+		return nil, err
+	}
+	index, err := fieldsParam(params, "index", true)
+	if err != nil {
+		return nil, err
+	}
+	op, err := pt.aggregate(params)
+	if err != nil {
+		return nil, err
+	}
+	columnField, _ := params["columns"].(string)
+	valueField, _ := params["values"].(string)
+	fill := params["fill"]
+
+	var columns []string
+	seenColumns := make(map[string]bool)
+	for _, record := range records {
+		column := keyText(recordField(record, columnField))
+		if !seenColumns[column] {
+			seenColumns[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	result := []interface{}{}
+	for _, group := range groupRecords(records, index) {
+		row := make(map[string]interface{}, len(index)+len(columns))
+		for _, field := range index {
+			row[field] = recordField(group.first, field)
+		}
+
+		cells := make(map[string][]map[string]interface{})
+		for _, record := range group.records {
+			column := keyText(recordField(record, columnField))
+			cells[column] = append(cells[column], record)
+		}
+		for _, column := range columns {
+			if cellRecords, ok := cells[column]; ok {
+				row[column] = aggregateRecords(cellRecords, op, valueField)
+			} else {
+				row[column] = fill
+			}
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// TopNTransformer returns the n records with the highest by values, or the
+// lowest with "order": "asc"; with group_by it returns the top n of each
+// group, groups in order of first appearance
+type TopNTransformer struct{}
+
+func (tn *TopNTransformer) Name() string { return "top_n" }
+func (tn *TopNTransformer) Description() string {
+	return "Keep the top n records by a field, optionally per group"
+}
+
+func (tn *TopNTransformer) ValidateParams(params map[string]interface{}) error {
+	if _, ok := params["n"]; !ok {
+		return fmt.Errorf("n parameter is required")
+	}
+	if _, err := intParam(params, "n", 0); err != nil {
+		return err
+	}
+	if by, _ := params["by"].(string); by == "" {
+		return fmt.Errorf("by parameter is required")
+	}
+	if _, err := fieldsParam(params, "group_by", false); err != nil {
+		return err
+	}
+	return validateOrder(params)
+}
+
+func validateOrder(params map[string]interface{}) error {
+	switch order, _ := params["order"].(string); order {
+	case "", "asc", "desc":
+		return nil
+	default:
+		return fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+}
+
+func (tn *TopNTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	records, err := toRecords(input)
+	if err != nil {
+		return nil, err
+	}
+	n, err := intParam(params, "n", 0)
+	if err != nil {
+		return nil, err
+	}
+	by, _ := params["by"].(string)
+	groupBy, err := fieldsParam(params, "group_by", false)
+	if err != nil {
+		return nil, err
+	}
+	order, _ := params["order"].(string)
+	if order == "" {
+		order = "desc"
+	}
+
+	groups := []*recordGroup{{records: records}}
+	if len(groupBy) > 0 {
+		groups = groupRecords(records, groupBy)
+	}
+
+	result := []interface{}{}
+	for _, group := range groups {
+		sorted := sortRecords(group.records, by, order)
+		for _, record := range sorted[:min(n, len(sorted))] {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// sortRecords returns a stably sorted copy of records; records missing the
+// field come last in either order
+func sortRecords(records []map[string]interface{}, field, order string) []map[string]interface{} {
+	sorted := make([]map[string]interface{}, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return recordLess(sorted[i], sorted[j], field, order)
+	})
+	return sorted
+}
+
+// recordLess orders two records by field; missing values come last
+func recordLess(a, b map[string]interface{}, field, order string) bool {
+	aValue, bValue := recordField(a, field), recordField(b, field)
+	if aValue == nil || bValue == nil {
+		return aValue != nil
+	}
+	if order == "desc" {
+		return compareRecordValues(aValue, bValue) > 0
+	}
+	return compareRecordValues(aValue, bValue) < 0
+}
+
+// WindowTransformer adds a field computed over a window of related records
+// to each record, keeping the input order. Records are partitioned by
+// partition_by and ordered by order_by (ascending unless order is desc).
+// The op is one of:
+//
+//	row_number   position in the partition, from 1
+//	rank         position with ties sharing a rank, from 1
+//	lag, lead    field of the record offset (default 1) before or after
+//	running_sum  sum of field up to and including the record
+//	running_avg  average of field up to and including the record
+//	moving_avg   average of field over the last size (default 3) records
+//
+// The result is stored under as, which defaults to the op name.
+type WindowTransformer struct{}
+
+var windowOps = map[string]bool{
+	"row_number": true, "rank": true, "lag": true, "lead": true,
+	"running_sum": true, "running_avg": true, "moving_avg": true,
+}
+
+func (wt *WindowTransformer) Name() string { return "window" }
+func (wt *WindowTransformer) Description() string {
+	return "Add row numbers, ranks, lag/lead or running values over record partitions"
+}
+
+func (wt *WindowTransformer) ValidateParams(params map[string]interface{}) error {
+	op, _ := params["op"].(string)
+	if !windowOps[op] {
+		return fmt.Errorf("unsupported window op: %q", op)
+	}
+	field, _ := params["field"].(string)
+	orderBy, _ := params["order_by"].(string)
+	switch op {
+	case "row_number":
+	case "rank":
+		if orderBy == "" {
+			return fmt.Errorf("rank needs an order_by field")
+		}
+	default:
+		if field == "" {
+			return fmt.Errorf("%s needs a field", op)
+		}
+	}
+	if _, err := fieldsParam(params, "partition_by", false); err != nil {
+		return err
+	}
+	if _, err := intParam(params, "offset", 1); err != nil {
+		return err
+	}
+	if size, err := intParam(params, "size", 3); err != nil {
+		return err
+	} else if size == 0 {
+		return fmt.Errorf("size must be at least 1")
+	}
+	return validateOrder(params)
+}
+
+func (wt *WindowTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	records, err := toRecords(input)
+	if err != nil {
+		return nil, err
+	}
+	op, _ := params["op"].(string)
+	field, _ := params["field"].(string)
+	orderBy, _ := params["order_by"].(string)
+	order, _ := params["order"].(string)
+	partitionBy, err := fieldsParam(params, "partition_by", false)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := intParam(params, "offset", 1)
+	if err != nil {
+		return nil, err
+	}
+	size, err := intParam(params, "size", 3)
+	if err != nil {
+		return nil, err
+	}
+	as, _ := params["as"].(string)
+	if as == "" {
+		as = op
+	}
+
+	// Partition record indexes, keeping the input order for the output
+	var partitions [][]int
+	partitionIndex := make(map[string]int)
+	for i, record := range records {
+		key := ""
+		if len(partitionBy) > 0 {
+			key, _ = recordKey(record, partitionBy)
+		}
+		p, ok := partitionIndex[key]
+		if !ok {
+			p = len(partitions)
+			partitionIndex[key] = p
+			partitions = append(partitions, nil)
+		}
+		partitions[p] = append(partitions[p], i)
+	}
+
+	outputs := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		outputs[i] = copyRecord(record)
+	}
+
+	for _, partition := range partitions {
+		if orderBy != "" {
+			sort.SliceStable(partition, func(i, j int) bool {
+				return recordLess(records[partition[i]], records[partition[j]], orderBy, order)
+			})
+		}
+
+		sum := 0.0
+		count := 0
+		rank := 0
+		for i, index := range partition {
+			record, out := records[index], outputs[index]
+			switch op {
+			case "row_number":
+				out[as] = i + 1
+			case "rank":
+				if i == 0 || compareRecordValues(recordField(record, orderBy), recordField(records[partition[i-1]], orderBy)) != 0 {
+					rank = i + 1
+				}
+				out[as] = rank
+			case "lag", "lead":
+				j := i - offset
+				if op == "lead" {
+					j = i + offset
+				}
+				out[as] = nil
+				if j >= 0 && j < len(partition) {
+					out[as] = recordField(records[partition[j]], field)
+				}
+			case "running_sum", "running_avg":
+				if n, ok := recordNumber(recordField(record, field)); ok {
+					sum += n
+					count++
+				}
+				if op == "running_sum" {
+					out[as] = sum
+				} else if count > 0 {
+					out[as] = sum / float64(count)
+				} else {
+					out[as] = nil
+				}
+			case "moving_avg":
+				windowSum, windowCount := 0.0, 0
+				for _, previous := range partition[max(0, i-size+1) : i+1] {
+					if n, ok := recordNumber(recordField(records[previous], field)); ok {
+						windowSum += n
+						windowCount++
+					}
+				}
+				out[as] = nil
+				if windowCount > 0 {
+					out[as] = windowSum / float64(windowCount)
+				}
+			}
+		}
+	}
+
+	return recordsToInterfaces(outputs), nil
+}
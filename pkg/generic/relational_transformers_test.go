@@ -0,0 +1,294 @@
+package generic
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const relationalTestRows = `[
+	{"region": "north", "product": "apple", "month": 1, "sales": 10},
+	{"region": "south", "product": "apple", "month": 1, "sales": 4},
+	{"region": "north", "product": "pear", "month": 2, "sales": 7},
+	{"region": "north", "product": "apple", "month": 3, "sales": "5"},
+	{"region": "south", "product": "plum", "month": 2, "sales": null}
+]`
+
+func TestRelationalTransformers(t *testing.T) {
+	registry := NewTransformRegistry(newTestTemplateEngine().logger)
+
+	tests := []struct {
+		name      string
+		transform string
+		input     interface{}
+		params    map[string]interface{}
+		expected  string
+		errorText string
+	}{
+		{
+			name:      "group_by default count",
+			transform: "group_by",
+			params:    map[string]interface{}{"by": "region"},
+			expected:  `[{"count":3,"region":"north"},{"count":2,"region":"south"}]`,
+		},
+		{
+			name:      "group_by aggregations",
+			transform: "group_by",
+			params: map[string]interface{}{"by": "region", "aggregations": map[string]interface{}{
+				"total":    "sum:sales",
+				"average":  "avg:sales",
+				"best":     "max:sales",
+				"products": "distinct:product",
+				"rows":     map[string]interface{}{"op": "count"},
+			}},
+			expected: `[{"average":7.333333333333333,"best":10,"products":["apple","pear"],"region":"north","rows":3,"total":22},` +
+				`{"average":4,"best":4,"products":["apple","plum"],"region":"south","rows":2,"total":4}]`,
+		},
+		{
+			name:      "group_by several fields with items",
+			transform: "group_by",
+			input:     `[{"a": 1, "b": "x"}, {"a": 1, "b": "x"}, {"a": 1, "b": "y"}]`,
+			params:    map[string]interface{}{"by": []interface{}{"a", "b"}, "items": "rows", "aggregations": map[string]interface{}{}},
+			expected:  `[{"a":1,"b":"x","rows":[{"a":1,"b":"x"},{"a":1,"b":"x"}]},{"a":1,"b":"y","rows":[{"a":1,"b":"y"}]}]`,
+		},
+		{
+			name:      "group_by bad aggregation",
+			transform: "group_by",
+			params:    map[string]interface{}{"by": "region", "aggregations": map[string]interface{}{"x": "median:sales"}},
+			errorText: `unsupported operation "median"`,
+		},
+		{
+			name:      "inner join",
+			transform: "join",
+			input:     `[{"id": 1, "title": "Crash on start"}, {"id": 2, "title": "Typo"}, {"id": 3, "title": "Slow"}]`,
+			params: map[string]interface{}{"on": "id", "with": []interface{}{
+				map[string]interface{}{"id": "1", "label": "bug", "title": "crash"},
+				map[string]interface{}{"id": "3", "label": "performance"},
+			}},
+			expected: `[{"id":1,"label":"bug","title":"Crash on start","title_right":"crash"},{"id":3,"label":"performance","title":"Slow"}]`,
+		},
+		{
+			name:      "left join with prefix and different keys",
+			transform: "join",
+			input:     `[{"id": 1}, {"id": 2}]`,
+			params: map[string]interface{}{"left_on": "id", "right_on": "issue", "type": "left", "right_prefix": "label_", "with": `[
+				{"issue": 1, "name": "bug"}, {"issue": 1, "name": "ui"}
+			]`},
+			expected: `[{"id":1,"label_issue":1,"label_name":"bug"},{"id":1,"label_issue":1,"label_name":"ui"},{"id":2}]`,
+		},
+		{
+			name:      "join without keys",
+			transform: "join",
+			input:     `[]`,
+			params:    map[string]interface{}{"with": `[]`},
+			errorText: "parameters are required",
+		},
+		{
+			name:      "pivot sums",
+			transform: "pivot",
+			params:    map[string]interface{}{"index": "region", "columns": "product", "values": "sales", "fill": 0.0},
+			expected:  `[{"apple":15,"pear":7,"plum":0,"region":"north"},{"apple":4,"pear":0,"plum":0,"region":"south"}]`,
+		},
+		{
+			name:      "pivot counts",
+			transform: "pivot",
+			params:    map[string]interface{}{"index": "product", "columns": "region"},
+			expected:  `[{"north":2,"product":"apple","south":1},{"north":1,"product":"pear","south":null},{"north":null,"product":"plum","south":1}]`,
+		},
+		{
+			name:      "top_n",
+			transform: "top_n",
+			params:    map[string]interface{}{"n": 2.0, "by": "sales"},
+			expected:  `[{"month":1,"product":"apple","region":"north","sales":10},{"month":2,"product":"pear","region":"north","sales":7}]`,
+		},
+		{
+			name:      "top_n per group ascending",
+			transform: "top_n",
+			params:    map[string]interface{}{"n": 1.0, "by": "sales", "group_by": "region", "order": "asc"},
+			expected:  `[{"month":3,"product":"apple","region":"north","sales":"5"},{"month":1,"product":"apple","region":"south","sales":4}]`,
+		},
+		{
+			name:      "window row_number by partition",
+			transform: "window",
+			input:     `[{"g": "a", "v": 3}, {"g": "b", "v": 1}, {"g": "a", "v": 1}]`,
+			params:    map[string]interface{}{"op": "row_number", "partition_by": "g", "order_by": "v"},
+			expected:  `[{"g":"a","row_number":2,"v":3},{"g":"b","row_number":1,"v":1},{"g":"a","row_number":1,"v":1}]`,
+		},
+		{
+			name:      "window rank with ties",
+			transform: "window",
+			input:     `[{"v": 5}, {"v": 9}, {"v": 5}, {"v": 1}]`,
+			params:    map[string]interface{}{"op": "rank", "order_by": "v", "order": "desc", "as": "place"},
+			expected:  `[{"place":2,"v":5},{"place":1,"v":9},{"place":2,"v":5},{"place":4,"v":1}]`,
+		},
+		{
+			name:      "window lag",
+			transform: "window",
+			input:     `[{"m": 2, "v": 20}, {"m": 1, "v": 10}, {"m": 3, "v": 30}]`,
+			params:    map[string]interface{}{"op": "lag", "field": "v", "order_by": "m", "as": "previous"},
+			expected:  `[{"m":2,"previous":10,"v":20},{"m":1,"previous":null,"v":10},{"m":3,"previous":20,"v":30}]`,
+		},
+		{
+			name:      "window moving average",
+			transform: "window",
+			input:     `[{"v": 1}, {"v": 2}, {"v": 3}, {"v": 4}]`,
+			params:    map[string]interface{}{"op": "moving_avg", "field": "v", "size": 2.0},
+			expected:  `[{"moving_avg":1,"v":1},{"moving_avg":1.5,"v":2},{"moving_avg":2.5,"v":3},{"moving_avg":3.5,"v":4}]`,
+		},
+		{
+			name:      "window running_sum",
+			transform: "window",
+			input:     `[{"v": 1}, {"v": 2}, {"v": 3}]`,
+			params:    map[string]interface{}{"op": "running_sum", "field": "v"},
+			expected:  `[{"running_sum":1,"v":1},{"running_sum":3,"v":2},{"running_sum":6,"v":3}]`,
+		},
+		{
+			name:      "window unknown op",
+			transform: "window",
+			params:    map[string]interface{}{"op": "ntile"},
+			errorText: "unsupported window op",
+		},
+		{
+			name:      "input not records",
+			transform: "group_by",
+			input:     []interface{}{"a", "b"},
+			params:    map[string]interface{}{"by": "x"},
+			errorText: "item 0 is not a record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformer, ok := registry.GetTransformer(tt.transform)
+			if !ok {
+				t.Fatalf("Transformer %s not registered", tt.transform)
+			}
+			input := tt.input
+			if input == nil {
+				input = relationalTestRows
+			}
+
+			err := transformer.ValidateParams(tt.params)
+			var result interface{}
+			if err == nil {
+				result, err = transformer.Transform(input, tt.params)
+			}
+			if tt.errorText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorText) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			encoded, _ := json.Marshal(result)
+			if string(encoded) != tt.expected {
+				t.Errorf("Unexpected result:\n got %s\nwant %s", encoded, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJoinInPipeline(t *testing.T) {
+	te := newTestTemplateEngine()
+	pipeline := NewTransformPipeline(NewTransformRegistry(te.logger), te, te.logger)
+
+	rows := []interface{}{
+		map[string]interface{}{"id": 1.0, "text": "App crashes"},
+		map[string]interface{}{"id": 2.0, "text": "Add dark mode"},
+	}
+	stepResults := map[string]*StepResult{
+		"classify": {StepName: "classify", Success: true, Output: `[{"id": "1", "label": "bug"}, {"id": "2", "label": "feature"}]`},
+	}
+	execCtx := &ExecutionContext{Data: map[string]interface{}{"rows": rows}}
+
+	step := Step{
+		Name: "report",
+		ContextTransforms: []Transform{
+			{Source: "rows", Transform: "join", Params: map[string]interface{}{"with": "classify", "on": "id"}, StoreAs: "labeled"},
+			{Source: "labeled", Transform: "group_by", Params: map[string]interface{}{"by": "label"}, StoreAs: "by_label"},
+		},
+	}
+	if err := pipeline.ExecutePreTransforms(step, stepResults, execCtx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	encoded, _ := json.Marshal(execCtx.Data["by_label"])
+	if expected := `[{"count":1,"label":"bug"},{"count":1,"label":"feature"}]`; string(encoded) != expected {
+		t.Errorf("Expected %s, got %s", expected, encoded)
+	}
+	if step.ContextTransforms[0].Params["with"] != "classify" {
+		t.Errorf("Resolving the with source changed the configured params")
+	}
+}
+
+func TestTextTransformersOnStructuredSources(t *testing.T) {
+	te := newTestTemplateEngine()
+	pipeline := NewTransformPipeline(NewTransformRegistry(te.logger), te, te.logger)
+
+	execCtx := &ExecutionContext{Data: map[string]interface{}{
+		"files": []interface{}{"main.go", "README.md", "main_test.go"},
+		"issue": map[string]interface{}{"id": 42.0, "title": "Fix #12 and #15"},
+	}}
+	step := Step{
+		Name: "report",
+		ContextTransforms: []Transform{
+			{Source: "files", Transform: "extract_lines", Params: map[string]interface{}{"pattern": `\.go$`}, StoreAs: "go_files"},
+			{Source: "issue", Transform: "regex_extract", Params: map[string]interface{}{"pattern": `#(\d+)`}, StoreAs: "refs"},
+			{Source: "issue", Transform: "string_process", Params: map[string]interface{}{"operation": "upper"}, StoreAs: "shout"},
+		},
+	}
+	if err := pipeline.ExecutePreTransforms(step, map[string]*StepResult{}, execCtx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"go_files": []string{"main.go", "main_test.go"},
+		"refs":     []interface{}{"12", "15"},
+		"shout":    `{"ID":42,"TITLE":"FIX #12 AND #15"}`,
+	}
+	for key, want := range expected {
+		if got := execCtx.Data[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s to be %#v, got %#v", key, want, got)
+		}
+	}
+}
+
+func TestParsersOnListSources(t *testing.T) {
+	te := newTestTemplateEngine()
+	pipeline := NewTransformPipeline(NewTransformRegistry(te.logger), te, te.logger)
+
+	stepResults := map[string]*StepResult{
+		"log":  {StepName: "log", Success: true, Output: "# export\nregion,total\nnorth,10\n# done\nsouth,20"},
+		"show": {StepName: "show", Success: true, Output: "commit abc\nAuthor: a\n--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,1 @@\n-old\n+new"},
+	}
+	execCtx := &ExecutionContext{Data: map[string]interface{}{}}
+	step := Step{
+		Name: "report",
+		ContextTransforms: []Transform{
+			{Source: "log", Transform: "extract_lines", Params: map[string]interface{}{"pattern": "^[^#]"}, StoreAs: "csv_lines"},
+			{Source: "csv_lines", Transform: "parse_csv", StoreAs: "rows"},
+			{Source: "show", Transform: "extract_lines", Params: map[string]interface{}{"pattern": "^(---|\\+\\+\\+|@@|[-+ ])"}, StoreAs: "diff_lines"},
+			{Source: "diff_lines", Transform: "parse_diff", StoreAs: "files"},
+		},
+	}
+	if err := pipeline.ExecutePreTransforms(step, stepResults, execCtx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	encoded, _ := json.Marshal(execCtx.Data["rows"])
+	if expected := `[{"region":"north","total":10},{"region":"south","total":20}]`; string(encoded) != expected {
+		t.Errorf("Expected rows %s, got %s", expected, encoded)
+	}
+	files, ok := execCtx.Data["files"].([]interface{})
+	if !ok || len(files) != 1 {
+		t.Fatalf("Expected one diff file, got %#v", execCtx.Data["files"])
+	}
+	file := files[0].(map[string]interface{})
+	if file["path"] != "main.go" || file["additions"] != 1 || file["deletions"] != 1 {
+		t.Errorf("Unexpected diff file %v", file)
+	}
+}
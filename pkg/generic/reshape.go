@@ -0,0 +1,310 @@
+package generic
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Reshaper builds a new structure from its input following a declarative
+// spec, so one step's output can be adapted to the shape another step
+// expects without round trips through text. Each key of the spec is an
+// output field and its value says how to fill it:
+//
+//	"title"                      copy the value at a dotted path (null if missing)
+//	"{upper(title)}"             evaluate a template expression, keeping its type
+//	"#{number}: {title}"         render a template to text
+//	{"name": ..., ...}           build a nested object from a spec
+//	[spec, ...]                  build an array, one spec per element
+//	{"$each": "files", "$map": spec, "$filter": "lines > 0"}
+//	                             map the elements of an array, optionally
+//	                             keeping only those matching a condition
+//	{"$literal": value}          use value as is
+//	numbers, booleans and null   used as is
+//
+// Templates see the current item's fields by name, the item itself as item,
+// the whole input as root, and inside $each the element's position as index,
+// along with the workflow's step results and context data. When the input is
+// an array the spec is applied to each element, unless "each" is false.
+type Reshaper struct {
+	templates *TemplateEngine
+}
+
+func (r *Reshaper) Name() string { return "reshape" }
+func (r *Reshaper) Description() string {
+	return "Build a new structure from the input with a mapping spec"
+}
+
+func (r *Reshaper) ValidateParams(params map[string]interface{}) error {
+	spec, ok := params["spec"]
+	if !ok || spec == nil {
+		return fmt.Errorf("spec parameter is required")
+	}
+	if _, err := boolParam(params, "each", true); err != nil {
+		return err
+	}
+	return validateReshapeSpec(spec, "spec")
+}
+
+// validateReshapeSpec checks the $ directives of a spec up front, so a typo
+// fails the transform before it runs
+func validateReshapeSpec(spec interface{}, path string) error {
+	switch s := spec.(type) {
+	case map[string]interface{}:
+		if _, ok := s["$literal"]; ok {
+			if len(s) != 1 {
+				return fmt.Errorf("%s: $literal cannot be combined with other fields", path)
+			}
+			return nil
+		}
+		if each, ok := s["$each"]; ok {
+			if text, ok := each.(string); !ok || strings.TrimSpace(text) == "" {
+				return fmt.Errorf("%s: $each must be a path or expression", path)
+			}
+			if filter, ok := s["$filter"]; ok {
+				if _, ok := filter.(string); !ok {
+					return fmt.Errorf("%s: $filter must be a condition", path)
+				}
+			}
+			for key := range s {
+				if key != "$each" && key != "$map" && key != "$filter" {
+					return fmt.Errorf("%s: unexpected field %q with $each", path, key)
+				}
+			}
+			if mapping, ok := s["$map"]; ok {
+				return validateReshapeSpec(mapping, path+".$map")
+			}
+			return nil
+		}
+		for key, value := range s {
+			if strings.HasPrefix(key, "$") {
+				return fmt.Errorf("%s: unknown directive %q", path, key)
+			}
+			if err := validateReshapeSpec(value, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, value := range s {
+			if err := validateReshapeSpec(value, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case string, bool, float64, int, nil:
+	default:
+		return fmt.Errorf("%s: unsupported spec value %T", path, spec)
+	}
+	return nil
+}
+
+func (r *Reshaper) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return r.TransformInContext(nil, input, params)
+}
+
+func (r *Reshaper) TransformInContext(execCtx *ExecutionContext, input interface{}, params map[string]interface{}) (interface{}, error) {
+	if text, ok := input.(string); ok {
+		if value, err := extractJSONValue(text); err == nil {
+			input = value
+		}
+	}
+	each, err := boolParam(params, "each", true)
+	if err != nil {
+		return nil, err
+	}
+
+	shaper := &reshapeRun{templates: r.templates.WithStrict(true), root: input}
+	if execCtx != nil {
+		shaper.stepResults = execCtx.StepResults
+		shaper.data = execCtx.Data
+	}
+
+	if items, ok := reshapeList(input); ok && each {
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			if result[i], err = shaper.build(params["spec"], item, i, "spec"); err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+		return result, nil
+	}
+	return shaper.build(params["spec"], input, -1, "spec")
+}
+
+// reshapeRun holds what a spec's templates can refer to besides the item
+type reshapeRun struct {
+	templates   *TemplateEngine
+	root        interface{}
+	stepResults map[string]*StepResult
+	data        map[string]interface{}
+}
+
+// build evaluates spec against item; index is the item's position in an
+// array, or -1
+func (rr *reshapeRun) build(spec interface{}, item interface{}, index int, path string) (interface{}, error) {
+	switch s := spec.(type) {
+	case string:
+		return rr.evaluate(s, item, index, path)
+	case []interface{}:
+		result := make([]interface{}, len(s))
+		for i, element := range s {
+			value, err := rr.build(element, item, index, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	case map[string]interface{}:
+		if literal, ok := s["$literal"]; ok {
+			return literal, nil
+		}
+		if _, ok := s["$each"]; ok {
+			return rr.mapEach(s, item, index, path)
+		}
+		keys := make([]string, 0, len(s))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result := make(map[string]interface{}, len(s))
+		for _, key := range keys {
+			value, err := rr.build(s[key], item, index, path+"."+key)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = value
+		}
+		return result, nil
+	}
+	return spec, nil
+}
+
+// mapEach builds one value per element of the $each array
+func (rr *reshapeRun) mapEach(spec map[string]interface{}, item interface{}, index int, path string) (interface{}, error) {
+	source, err := rr.evaluate(spec["$each"].(string), item, index, path+".$each")
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return []interface{}{}, nil
+	}
+	elements, ok := reshapeList(source)
+	if !ok {
+		return nil, fmt.Errorf("%s: $each must select an array, got %T", path, source)
+	}
+
+	mapping, hasMapping := spec["$map"]
+	filter, _ := spec["$filter"].(string)
+	result := make([]interface{}, 0, len(elements))
+	for i, element := range elements {
+		if filter != "" {
+			stepResults, execCtx := rr.scope(element, i)
+			keep, err := rr.templates.evaluateTemplateCondition(filter, stepResults, execCtx)
+			if err != nil {
+				return nil, fmt.Errorf("%s.$filter: %w", path, err)
+			}
+			if !keep {
+				continue
+			}
+		}
+		if !hasMapping {
+			result = append(result, element)
+			continue
+		}
+		value, err := rr.build(mapping, element, i, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// evaluate fills a string spec: a whole {expression} keeps the value's type,
+// text with expressions is rendered, and anything else is a path into item
+func (rr *reshapeRun) evaluate(spec string, item interface{}, index int, path string) (interface{}, error) {
+	trimmed := strings.TrimSpace(spec)
+	if expression, ok := wholeReshapeExpression(trimmed); ok {
+		stepResults, execCtx := rr.scope(item, index)
+		value, err := rr.templates.resolveExpression(expression, stepResults, execCtx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return value, nil
+	}
+	if strings.Contains(spec, "{") {
+		stepResults, execCtx := rr.scope(item, index)
+		text, err := rr.templates.RenderTemplate(spec, stepResults, execCtx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return text, nil
+	}
+
+	value, err := rr.templates.fieldValue(item, trimmed)
+	if err != nil {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// wholeReshapeExpression returns the expression when text is exactly one
+// {expression}
+func wholeReshapeExpression(text string) (string, bool) {
+	if len(text) < 3 || text[0] != '{' || text[len(text)-1] != '}' {
+		return "", false
+	}
+	inner := text[1 : len(text)-1]
+	if strings.ContainsAny(inner, "{}") || strings.HasPrefix(inner, "%") {
+		return "", false
+	}
+	return strings.TrimSpace(inner), true
+}
+
+// scope binds the item's fields, item, root and index over the workflow's
+// step results and data
+func (rr *reshapeRun) scope(item interface{}, index int) (map[string]*StepResult, *ExecutionContext) {
+	bindings := map[string]interface{}{}
+	if record, ok := item.(map[string]interface{}); ok {
+		for key, value := range record {
+			bindings[key] = value
+		}
+	}
+	bindings["item"] = item
+	bindings["root"] = rr.root
+	if index >= 0 {
+		bindings["index"] = index
+	}
+
+	stepResults := make(map[string]*StepResult, len(rr.stepResults))
+	for name, result := range rr.stepResults {
+		if _, shadowed := bindings[name]; !shadowed {
+			stepResults[name] = result
+		}
+	}
+	data := make(map[string]interface{}, len(rr.data)+len(bindings))
+	for key, value := range rr.data {
+		data[key] = value
+	}
+	for key, value := range bindings {
+		data[key] = value
+	}
+	return stepResults, &ExecutionContext{Data: data}
+}
+
+// reshapeList returns the elements of a slice or array
+func reshapeList(value interface{}) ([]interface{}, bool) {
+	if items, ok := value.([]interface{}); ok {
+		return items, true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, true
+}
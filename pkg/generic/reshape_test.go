@@ -0,0 +1,159 @@
+package generic
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const reshapeTestIssue = `{
+	"number": 42,
+	"title": "Crash on start",
+	"user": {"login": "ana", "id": 7},
+	"labels": [{"name": "bug", "color": "red"}, {"name": "p1", "color": ""}],
+	"files": [{"path": "main.go", "lines": 12}, {"path": "README.md", "lines": 0}]
+}`
+
+func TestReshape(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     interface{}
+		params    map[string]interface{}
+		expected  string
+		errorText string
+	}{
+		{
+			name:  "renames and nested paths",
+			input: reshapeTestIssue,
+			params: map[string]interface{}{"spec": map[string]interface{}{
+				"id":      "number",
+				"author":  "user.login",
+				"missing": "user.email",
+			}},
+			expected: `{"author":"ana","id":42,"missing":null}`,
+		},
+		{
+			name:  "computed fields keep their type",
+			input: reshapeTestIssue,
+			params: map[string]interface{}{"spec": map[string]interface{}{
+				"heading":     "#{number}: {title | upper}",
+				"label_names": "{map(labels, \"name\")}",
+				"total_lines": "{sum(files, \"lines\")}",
+				"kind":        map[string]interface{}{"$literal": "issue"},
+				"open":        true,
+			}},
+			expected: `{"heading":"#42: CRASH ON START","kind":"issue","label_names":["bug","p1"],"open":true,"total_lines":12}`,
+		},
+		{
+			name:  "nested objects and arrays",
+			input: reshapeTestIssue,
+			params: map[string]interface{}{"spec": map[string]interface{}{
+				"meta": map[string]interface{}{"author": map[string]interface{}{"name": "user.login", "id": "user.id"}},
+				"pair": []interface{}{"number", "title"},
+			}},
+			expected: `{"meta":{"author":{"id":7,"name":"ana"}},"pair":[42,"Crash on start"]}`,
+		},
+		{
+			name:  "array element mapping with filter",
+			input: reshapeTestIssue,
+			params: map[string]interface{}{"spec": map[string]interface{}{
+				"changed": map[string]interface{}{
+					"$each":   "files",
+					"$filter": "lines > 0",
+					"$map":    map[string]interface{}{"file": "path", "position": "{index}", "issue": "{root.number}"},
+				},
+				"labels": map[string]interface{}{"$each": "labels", "$map": "name"},
+			}},
+			expected: `{"changed":[{"file":"main.go","issue":42,"position":0}],"labels":["bug","p1"]}`,
+		},
+		{
+			name:     "array input is reshaped per item",
+			input:    []interface{}{map[string]interface{}{"n": 1.0}, map[string]interface{}{"n": 2.0}},
+			params:   map[string]interface{}{"spec": map[string]interface{}{"value": "n", "position": "{index}"}},
+			expected: `[{"position":0,"value":1},{"position":1,"value":2}]`,
+		},
+		{
+			name:     "array input as a whole",
+			input:    `[1, 2, 3]`,
+			params:   map[string]interface{}{"each": false, "spec": map[string]interface{}{"count": "{len(item)}", "first": "{first(item)}"}},
+			expected: `{"count":3,"first":1}`,
+		},
+		{
+			name:      "unresolved expression",
+			input:     reshapeTestIssue,
+			params:    map[string]interface{}{"spec": map[string]interface{}{"x": "{nope}"}},
+			errorText: "spec.x",
+		},
+		{
+			name:      "$each over a scalar",
+			input:     reshapeTestIssue,
+			params:    map[string]interface{}{"spec": map[string]interface{}{"x": map[string]interface{}{"$each": "title"}}},
+			errorText: "$each must select an array",
+		},
+		{
+			name:      "unknown directive",
+			params:    map[string]interface{}{"spec": map[string]interface{}{"x": map[string]interface{}{"$eachh": "files"}}},
+			errorText: `unknown directive "$eachh"`,
+		},
+		{
+			name:      "missing spec",
+			params:    map[string]interface{}{},
+			errorText: "spec parameter is required",
+		},
+	}
+
+	transformer := &Reshaper{templates: newTestTemplateEngine()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := transformer.ValidateParams(tt.params)
+			var result interface{}
+			if err == nil {
+				result, err = transformer.Transform(tt.input, tt.params)
+			}
+			if tt.errorText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorText) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errorText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			encoded, _ := json.Marshal(result)
+			if string(encoded) != tt.expected {
+				t.Errorf("Unexpected result:\n got %s\nwant %s", encoded, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReshapeInPipeline(t *testing.T) {
+	te := newTestTemplateEngine()
+	registry := NewTransformRegistry(te.logger)
+	registry.RegisterTransformer(&Reshaper{templates: te})
+	pipeline := NewTransformPipeline(registry, te, te.logger)
+
+	stepResults := map[string]*StepResult{
+		"fetch": {StepName: "fetch", Success: true, Output: reshapeTestIssue},
+	}
+	execCtx := &ExecutionContext{Data: map[string]interface{}{"repo": "acme/app"}, StepResults: stepResults}
+
+	step := Step{
+		Name: "report",
+		ContextTransforms: []Transform{{
+			Source:    "fetch",
+			Transform: "reshape",
+			Params:    map[string]interface{}{"spec": map[string]interface{}{"url": "https://github.com/{repo}/issues/{number}"}},
+			StoreAs:   "issue",
+		}},
+	}
+	if err := pipeline.ExecutePreTransforms(step, stepResults, execCtx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	issue := execCtx.Data["issue"].(map[string]interface{})
+	if expected := "https://github.com/acme/app/issues/42"; issue["url"] != expected {
+		t.Errorf("Expected %s, got %v", expected, issue["url"])
+	}
+}
@@ -0,0 +1,333 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alantheprice/agent/pkg/interfaces/types"
+)
+
+// defaultStructuredRepairs is how many times an llm step with a
+// response_format asks the model to fix output that fails to parse or validate
+const defaultStructuredRepairs = 2
+
+// parseResponseFormat reads a step's response_format setting. It accepts the
+// shorthands "text", "json" and "json_object", or an object with type, name,
+// strict and either an inline schema or a schema_file. A nil result means free
+// text.
+func parseResponseFormat(raw interface{}) (*types.ResponseFormat, error) {
+	switch value := raw.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch value {
+		case "", types.ResponseFormatText:
+			return nil, nil
+		case "json", types.ResponseFormatJSONObject:
+			return &types.ResponseFormat{Type: types.ResponseFormatJSONObject}, nil
+		default:
+			return nil, fmt.Errorf("unknown response_format %q", value)
+		}
+	case map[string]interface{}:
+		format := &types.ResponseFormat{Type: types.ResponseFormatJSONObject}
+		if formatType, ok := value["type"].(string); ok && formatType != "" {
+			format.Type = formatType
+		}
+		if name, ok := value["name"].(string); ok {
+			format.Name = name
+		}
+		if strict, ok := value["strict"].(bool); ok {
+			format.Strict = strict
+		}
+
+		if schema, ok := value["schema"].(map[string]interface{}); ok {
+			format.Schema = schema
+		} else if schemaFile, ok := value["schema_file"].(string); ok && schemaFile != "" {
+			data, err := os.ReadFile(schemaFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read response schema: %w", err)
+			}
+			if err := json.Unmarshal(data, &format.Schema); err != nil {
+				return nil, fmt.Errorf("failed to parse response schema %s: %w", schemaFile, err)
+			}
+		}
+
+		switch format.Type {
+		case types.ResponseFormatText:
+			return nil, nil
+		case types.ResponseFormatJSONObject:
+		case types.ResponseFormatJSONSchema:
+			if format.Schema == nil {
+				return nil, fmt.Errorf("response_format json_schema requires schema or schema_file")
+			}
+		default:
+			return nil, fmt.Errorf("unknown response_format type %q", format.Type)
+		}
+		return format, nil
+	default:
+		return nil, fmt.Errorf("response_format must be a string or an object")
+	}
+}
+
+// ChatStructured asks for JSON output matching format and returns the decoded
+// value. Providers with native JSON mode get the format in the request;
+// every reply is still parsed and checked against the schema locally, and
+// invalid replies are sent back with the problems for up to maxRepairs
+// attempts. The returned response carries the usage of all attempts.
+func (llm *LLMClient) ChatStructured(ctx context.Context, messages []Message, format types.ResponseFormat, maxRepairs int) (interface{}, *LLMResponse, error) {
+	client := llm
+	if llm.ModelInfo().SupportsJSONMode {
+		client = llm.WithResponseFormat(&format)
+	}
+
+	messages = withJSONInstruction(messages, format)
+
+	totalTokens := 0
+	totalCost := 0.0
+	for attempt := 0; ; attempt++ {
+		response, err := client.Chat(ctx, messages)
+		if err != nil {
+			return nil, nil, err
+		}
+		totalTokens += response.TokensUsed
+		totalCost += response.Cost
+
+		value, problems := decodeStructuredReply(response.Content, format.Schema)
+		if len(problems) == 0 {
+			response.TokensUsed = totalTokens
+			response.Cost = totalCost
+			if response.Metadata == nil {
+				response.Metadata = make(map[string]interface{})
+			}
+			response.Metadata["repairs"] = attempt
+			return value, response, nil
+		}
+
+		if attempt >= maxRepairs {
+			return nil, nil, fmt.Errorf("LLM output did not match the response format after %d repair attempts: %s",
+				attempt, strings.Join(problems, "; "))
+		}
+
+		llm.logger.Debug("Requesting structured output repair", "attempt", attempt+1, "problems", problems)
+		messages = append(messages,
+			Message{Role: "assistant", Content: response.Content},
+			Message{Role: "user", Content: "Your previous reply was not valid:\n- " + strings.Join(problems, "\n- ") +
+				"\n\nReply again with only the corrected JSON."},
+		)
+	}
+}
+
+// withJSONInstruction tells the model to answer in JSON, appending to the
+// system prompt when there is one. Providers in native JSON mode also expect
+// the prompt itself to mention JSON.
+func withJSONInstruction(messages []Message, format types.ResponseFormat) []Message {
+	instruction := "Respond with a single valid JSON value and nothing else."
+	if format.Schema != nil {
+		if schema, err := json.Marshal(format.Schema); err == nil {
+			instruction = "Respond with a single JSON value that matches this JSON Schema, and nothing else:\n" + string(schema)
+		}
+	}
+
+	result := make([]Message, len(messages))
+	copy(result, messages)
+	if len(result) > 0 && result[0].Role == "system" {
+		result[0].Content += "\n\n" + instruction
+		return result
+	}
+	return append([]Message{{Role: "system", Content: instruction}}, result...)
+}
+
+// decodeStructuredReply parses a reply and validates it against schema,
+// returning the problems found
+func decodeStructuredReply(content string, schema map[string]interface{}) (interface{}, []string) {
+	value, err := extractJSONValue(content)
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	if schema == nil {
+		return value, nil
+	}
+	return value, validateJSONSchema(value, schema, "$")
+}
+
+// extractJSONValue decodes the JSON in a reply, tolerating code fences and
+// prose around the outermost object or array
+func extractJSONValue(content string) (interface{}, error) {
+	text := stripCodeFence(strings.TrimSpace(content))
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		return value, nil
+	}
+
+	for _, pair := range [][2]string{{"{", "}"}, {"[", "]"}} {
+		start := strings.Index(text, pair[0])
+		end := strings.LastIndex(text, pair[1])
+		if start >= 0 && end > start {
+			if err := json.Unmarshal([]byte(text[start:end+1]), &value); err == nil {
+				return value, nil
+			}
+		}
+	}
+
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return nil, fmt.Errorf("reply is not valid JSON: %s", text)
+}
+
+// validateJSONSchema checks value against the commonly used subset of JSON
+// Schema: type, enum, properties, required, additionalProperties, items,
+// minLength/maxLength, minimum/maximum and minItems/maxItems
+func validateJSONSchema(value interface{}, schema map[string]interface{}, path string) []string {
+	var problems []string
+
+	if expected, ok := schema["type"]; ok && !matchesSchemaType(value, expected) {
+		return []string{fmt.Sprintf("%s: expected %v, got %s", path, expected, jsonTypeName(value))}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range enum {
+			if fmt.Sprint(option) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s: must be one of %v", path, enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				key, _ := name.(string)
+				if _, exists := v[key]; !exists {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %q", path, key))
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			propertySchema, defined := properties[key].(map[string]interface{})
+			if !defined {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					problems = append(problems, fmt.Sprintf("%s: unexpected property %q", path, key))
+				}
+				continue
+			}
+			problems = append(problems, validateJSONSchema(v[key], propertySchema, path+"."+key)...)
+		}
+
+	case []interface{}:
+		if minItems, ok := schema["minItems"].(float64); ok && float64(len(v)) < minItems {
+			problems = append(problems, fmt.Sprintf("%s: must have at least %v items", path, minItems))
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && float64(len(v)) > maxItems {
+			problems = append(problems, fmt.Sprintf("%s: must have at most %v items", path, maxItems))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateJSONSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+
+	case string:
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len([]rune(v))) < minLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %v characters", path, minLength))
+		}
+		if maxLength, ok := schema["maxLength"].(float64); ok && float64(len([]rune(v))) > maxLength {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %v characters", path, maxLength))
+		}
+
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && v < minimum {
+			problems = append(problems, fmt.Sprintf("%s: must be >= %v", path, minimum))
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && v > maximum {
+			problems = append(problems, fmt.Sprintf("%s: must be <= %v", path, maximum))
+		}
+	}
+
+	return problems
+}
+
+// matchesSchemaType reports whether value has the schema type, which may be a
+// single name or a list of names
+func matchesSchemaType(value interface{}, expected interface{}) bool {
+	switch t := expected.(type) {
+	case string:
+		actual := jsonTypeName(value)
+		if actual == t {
+			return true
+		}
+		if number, ok := value.(float64); ok {
+			return t == "number" || (t == "integer" && number == float64(int64(number)))
+		}
+		return false
+	case []interface{}:
+		for _, option := range t {
+			if matchesSchemaType(value, option) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// jsonTypeName returns the JSON Schema type name of a decoded JSON value
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// toOpenAIResponseFormat maps a response format onto the OpenAI-compatible
+// response_format field
+func toOpenAIResponseFormat(format *types.ResponseFormat) *OpenAIResponseFormat {
+	if format == nil || format.Type == "" || format.Type == types.ResponseFormatText {
+		return nil
+	}
+
+	if format.Type == types.ResponseFormatJSONSchema && format.Schema != nil {
+		name := format.Name
+		if name == "" {
+			name = "response"
+		}
+		return &OpenAIResponseFormat{
+			Type:       types.ResponseFormatJSONSchema,
+			JSONSchema: &OpenAIJSONSchema{Name: name, Schema: format.Schema, Strict: format.Strict},
+		}
+	}
+
+	return &OpenAIResponseFormat{Type: types.ResponseFormatJSONObject}
+}
@@ -0,0 +1,220 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alantheprice/agent/pkg/interfaces/types"
+)
+
+// newSequenceTestServer returns an OpenAI-compatible server that answers with
+// each reply in turn, repeating the last one, and records each request body
+func newSequenceTestServer(t *testing.T, replies []string, requests *[]map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request body: %v", err)
+		}
+		*requests = append(*requests, body)
+
+		reply := replies[len(replies)-1]
+		if len(*requests) <= len(replies) {
+			reply = replies[len(*requests)-1]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(OpenAIResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: reply}}},
+			Usage:   OpenAIUsage{TotalTokens: 5},
+		})
+	}))
+}
+
+var articleSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []interface{}{"title", "word_count"},
+	"properties": map[string]interface{}{
+		"title":      map[string]interface{}{"type": "string", "minLength": 1.0},
+		"word_count": map[string]interface{}{"type": "integer", "minimum": 0.0},
+		"tags":       map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"status":     map[string]interface{}{"enum": []interface{}{"draft", "published"}},
+	},
+	"additionalProperties": false,
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	tests := []struct {
+		name             string
+		value            string
+		expectedProblems int
+	}{
+		{name: "valid", value: `{"title": "Go 1.24", "word_count": 120, "tags": ["go"], "status": "draft"}`},
+		{name: "missing required", value: `{"title": "Go 1.24"}`, expectedProblems: 1},
+		{name: "wrong type", value: `{"title": "Go 1.24", "word_count": "many"}`, expectedProblems: 1},
+		{name: "not an integer", value: `{"title": "Go 1.24", "word_count": 1.5}`, expectedProblems: 1},
+		{name: "below minimum", value: `{"title": "Go 1.24", "word_count": -1}`, expectedProblems: 1},
+		{name: "empty string", value: `{"title": "", "word_count": 1}`, expectedProblems: 1},
+		{name: "bad item", value: `{"title": "Go", "word_count": 1, "tags": ["go", 2]}`, expectedProblems: 1},
+		{name: "enum", value: `{"title": "Go", "word_count": 1, "status": "archived"}`, expectedProblems: 1},
+		{name: "extra property", value: `{"title": "Go", "word_count": 1, "author": "x"}`, expectedProblems: 1},
+		{name: "not an object", value: `["Go"]`, expectedProblems: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("Invalid test value: %v", err)
+			}
+
+			problems := validateJSONSchema(value, articleSchema, "$")
+			if len(problems) != tt.expectedProblems {
+				t.Errorf("Expected %d problems, got %v", tt.expectedProblems, problems)
+			}
+		})
+	}
+}
+
+func TestExtractJSONValue(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expectError bool
+	}{
+		{name: "plain", content: `{"title": "Go"}`},
+		{name: "code fence", content: "```json\n{\"title\": \"Go\"}\n```"},
+		{name: "prose", content: `Here is the data: {"title": "Go"} Hope that helps.`},
+		{name: "array", content: `The tags are ["go", "json"].`},
+		{name: "not json", content: "I could not find an article.", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractJSONValue(tt.content)
+			if tt.expectError != (err != nil) {
+				t.Errorf("Expected error=%v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestParseResponseFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          interface{}
+		expectedType string
+		expectError  bool
+	}{
+		{name: "unset"},
+		{name: "text", raw: "text"},
+		{name: "json shorthand", raw: "json", expectedType: types.ResponseFormatJSONObject},
+		{name: "schema", raw: map[string]interface{}{"type": "json_schema", "schema": articleSchema}, expectedType: types.ResponseFormatJSONSchema},
+		{name: "schema file", raw: map[string]interface{}{"type": "json_schema", "schema_file": "../../samples/schemas/news_article_schema.json"}, expectedType: types.ResponseFormatJSONSchema},
+		{name: "schema missing", raw: map[string]interface{}{"type": "json_schema"}, expectError: true},
+		{name: "unknown", raw: "yaml", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := parseResponseFormat(tt.raw)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			actualType := ""
+			if format != nil {
+				actualType = format.Type
+			}
+			if actualType != tt.expectedType {
+				t.Errorf("Expected type %q, got %q", tt.expectedType, actualType)
+			}
+		})
+	}
+}
+
+func TestChatStructured(t *testing.T) {
+	tests := []struct {
+		name            string
+		replies         []string
+		supportsJSON    bool
+		maxRepairs      int
+		expectedCalls   int
+		expectError     bool
+		expectNativeFmt bool
+	}{
+		{
+			name:            "native json mode",
+			replies:         []string{`{"title": "Go", "word_count": 3}`},
+			supportsJSON:    true,
+			expectedCalls:   1,
+			expectNativeFmt: true,
+		},
+		{
+			name:          "repairs invalid output",
+			replies:       []string{"Sure! The title is Go.", `{"title": "Go"}`, "```json\n{\"title\": \"Go\", \"word_count\": 3}\n```"},
+			maxRepairs:    2,
+			expectedCalls: 3,
+		},
+		{
+			name:          "gives up after repairs",
+			replies:       []string{`{"title": "Go"}`},
+			maxRepairs:    1,
+			expectedCalls: 2,
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newSequenceTestServer(t, tt.replies, &requests)
+			defer server.Close()
+
+			client := newTestLLMClient(t, server.URL)
+			client.config.ProviderConfig["supports_json_mode"] = tt.supportsJSON
+
+			format := types.ResponseFormat{Type: types.ResponseFormatJSONSchema, Name: "article", Schema: articleSchema}
+			value, response, err := client.ChatStructured(context.Background(), []Message{{Role: "user", Content: "Extract the article"}}, format, tt.maxRepairs)
+
+			if len(requests) != tt.expectedCalls {
+				t.Fatalf("Expected %d requests, got %d", tt.expectedCalls, len(requests))
+			}
+			_, hasFormat := requests[0]["response_format"]
+			if hasFormat != tt.expectNativeFmt {
+				t.Errorf("Expected response_format in request=%v, got %v", tt.expectNativeFmt, requests[0]["response_format"])
+			}
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			article, _ := value.(map[string]interface{})
+			if article["title"] != "Go" || article["word_count"] != 3.0 {
+				t.Errorf("Unexpected value %v", value)
+			}
+			if response.TokensUsed != 5*tt.expectedCalls {
+				t.Errorf("Expected usage of all attempts, got %d tokens", response.TokensUsed)
+			}
+			if response.Metadata["repairs"] != tt.expectedCalls-1 {
+				t.Errorf("Expected %d repairs, got %v", tt.expectedCalls-1, response.Metadata["repairs"])
+			}
+		})
+	}
+}
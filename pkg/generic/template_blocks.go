@@ -0,0 +1,575 @@
+package generic
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Template blocks
+//
+// Besides {expr} placeholders, templates support conditional and repeated
+// sections:
+//
+//	{% if feedback %}Previous feedback: {feedback}{% elif attempt > 1 %}Retry {attempt}{% else %}First try{% endif %}
+//	{% for file in files %}{loop.index}. {file.path}{% if not loop.last %}, {% endif %}{% endfor %}
+//
+// Conditions support and, or, not and the comparisons == != > < >= <=;
+// references that do not resolve are treated as empty. Loops bind the item
+// and loop.index (from 1), loop.index0, loop.first, loop.last and
+// loop.length. A "-" inside a tag ("{%-" or "-%}") trims the whitespace
+// before or after it.
+//
+// Literal braces are written as \{ and \}, and everything between
+// {% raw %} and {% endraw %} is copied as-is, which suits JSON examples and
+// code in prompts.
+
+// templateTag matches a block tag, capturing the whitespace-control markers
+var templateTag = regexp.MustCompile(`\{%(-?)\s*(.*?)\s*(-?)%\}`)
+
+// forTag parses "for item in source"
+var forTag = regexp.MustCompile(`^for\s+(\w+)\s+in\s+(.+)$`)
+
+type templateNode interface{}
+
+type textNode string
+
+type rawNode string
+
+type ifBranch struct {
+	condition string
+	body      []templateNode
+}
+
+type ifNode struct {
+	branches []ifBranch
+	elseBody []templateNode
+}
+
+type forNode struct {
+	variable string
+	source   string
+	body     []templateNode
+}
+
+type templateToken struct {
+	text  string // literal text, or the tag body for tags
+	isTag bool
+	isRaw bool
+}
+
+// tokenizeTemplate splits a template into text and tag tokens, applying the
+// whitespace-control markers. Escaped tags (\{%) stay in the text and raw
+// sections become a single raw token.
+func tokenizeTemplate(template string) []templateToken {
+	var tokens []templateToken
+	trimNext := false
+	last := 0
+
+	matches := templateTag.FindAllStringSubmatchIndex(template, -1)
+	for i := 0; i < len(matches); i++ {
+		match := matches[i]
+		if match[0] > 0 && template[match[0]-1] == '\\' {
+			continue
+		}
+
+		text := template[last:match[0]]
+		if trimNext {
+			text = strings.TrimLeft(text, " \t\r\n")
+		}
+		if match[3] > match[2] {
+			text = strings.TrimRight(text, " \t\r\n")
+		}
+		if text != "" {
+			tokens = append(tokens, templateToken{text: text})
+		}
+
+		body := template[match[4]:match[5]]
+		trimNext = match[7] > match[6]
+		last = match[1]
+		if body != "raw" {
+			tokens = append(tokens, templateToken{text: body, isTag: true})
+			continue
+		}
+
+		// Copy everything up to the matching endraw without parsing it
+		end := i + 1
+		for end < len(matches) && template[matches[end][4]:matches[end][5]] != "endraw" {
+			end++
+		}
+		if end == len(matches) {
+			tokens = append(tokens, templateToken{text: body, isTag: true})
+			continue
+		}
+
+		raw := template[last:matches[end][0]]
+		if trimNext {
+			raw = strings.TrimLeft(raw, " \t\r\n")
+		}
+		if matches[end][3] > matches[end][2] {
+			raw = strings.TrimRight(raw, " \t\r\n")
+		}
+		if raw != "" {
+			tokens = append(tokens, templateToken{text: raw, isRaw: true})
+		}
+
+		trimNext = matches[end][7] > matches[end][6]
+		last = matches[end][1]
+		i = end
+	}
+
+	text := template[last:]
+	if trimNext {
+		text = strings.TrimLeft(text, " \t\r\n")
+	}
+	if text != "" {
+		tokens = append(tokens, templateToken{text: text})
+	}
+	return tokens
+}
+
+// parseTemplateNodes builds the block tree until one of the terminator tags,
+// returning the nodes, the terminator found and the next token position
+func parseTemplateNodes(tokens []templateToken, pos int, terminators ...string) ([]templateNode, string, int, error) {
+	var nodes []templateNode
+
+	for pos < len(tokens) {
+		token := tokens[pos]
+		pos++
+
+		if token.isRaw {
+			nodes = append(nodes, rawNode(token.text))
+			continue
+		}
+		if !token.isTag {
+			nodes = append(nodes, textNode(token.text))
+			continue
+		}
+
+		keyword, _, _ := strings.Cut(token.text, " ")
+		for _, terminator := range terminators {
+			if keyword == terminator {
+				return nodes, token.text, pos, nil
+			}
+		}
+
+		switch keyword {
+		case "if":
+			node := &ifNode{}
+			condition := strings.TrimSpace(strings.TrimPrefix(token.text, "if"))
+			opening := condition
+			for {
+				if condition == "" {
+					return nil, "", pos, fmt.Errorf("{%% %s %%} is missing a condition", token.text)
+				}
+
+				body, end, next, err := parseTemplateNodes(tokens, pos, "elif", "else", "endif")
+				if err != nil {
+					return nil, "", next, err
+				}
+				if end == "" {
+					return nil, "", next, fmt.Errorf("{%% if %s %%} is missing {%% endif %%}", opening)
+				}
+				node.branches = append(node.branches, ifBranch{condition: condition, body: body})
+				pos = next
+
+				if strings.HasPrefix(end, "elif") {
+					condition = strings.TrimSpace(strings.TrimPrefix(end, "elif"))
+					continue
+				}
+				if end == "else" {
+					elseBody, end, next, err := parseTemplateNodes(tokens, pos, "endif")
+					if err != nil {
+						return nil, "", next, err
+					}
+					if end == "" {
+						return nil, "", next, fmt.Errorf("{%% if %s %%} is missing {%% endif %%}", opening)
+					}
+					node.elseBody = elseBody
+					pos = next
+				}
+				break
+			}
+			nodes = append(nodes, node)
+
+		case "for":
+			matches := forTag.FindStringSubmatch(token.text)
+			if matches == nil {
+				return nil, "", pos, fmt.Errorf("invalid loop {%% %s %%}, expected {%% for item in list %%}", token.text)
+			}
+
+			body, end, next, err := parseTemplateNodes(tokens, pos, "endfor")
+			if err != nil {
+				return nil, "", next, err
+			}
+			if end == "" {
+				return nil, "", next, fmt.Errorf("{%% %s %%} is missing {%% endfor %%}", token.text)
+			}
+			nodes = append(nodes, &forNode{variable: matches[1], source: strings.TrimSpace(matches[2]), body: body})
+			pos = next
+
+		case "raw":
+			return nil, "", pos, fmt.Errorf("{%% raw %%} is missing {%% endraw %%}")
+
+		default:
+			return nil, "", pos, fmt.Errorf("unexpected {%% %s %%}", token.text)
+		}
+	}
+
+	return nodes, "", pos, nil
+}
+
+// templateRenderer expands blocks and collects the insertions for one template
+type templateRenderer struct {
+	te         *TemplateEngine
+	execCtx    *ExecutionContext
+	out        strings.Builder
+	insertions []TemplateInsertion
+	unresolved []UnresolvedReference
+}
+
+// renderNodes writes the nodes using the step results in scope
+func (r *templateRenderer) renderNodes(nodes []templateNode, scope map[string]*StepResult) error {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case textNode:
+			r.renderText(string(n), scope)
+
+		case rawNode:
+			r.out.WriteString(string(n))
+
+		case *ifNode:
+			body := n.elseBody
+			for _, branch := range n.branches {
+				matched, err := r.te.evaluateTemplateCondition(branch.condition, scope, r.execCtx)
+				if err != nil {
+					return fmt.Errorf("in {%% if %s %%}: %w", branch.condition, err)
+				}
+				if matched {
+					body = branch.body
+					break
+				}
+			}
+			if err := r.renderNodes(body, scope); err != nil {
+				return err
+			}
+
+		case *forNode:
+			items, err := r.loopItems(n.source, scope)
+			if err != nil {
+				return fmt.Errorf("in {%% for %s in %s %%}: %w", n.variable, n.source, err)
+			}
+
+			for i, item := range items {
+				loopScope := make(map[string]*StepResult, len(scope)+2)
+				for name, result := range scope {
+					loopScope[name] = result
+				}
+				loopScope[n.variable] = &StepResult{StepName: n.variable, Success: true, Output: item}
+				loopScope["loop"] = &StepResult{StepName: "loop", Success: true, Output: map[string]interface{}{
+					"index":  i + 1,
+					"index0": i,
+					"first":  i == 0,
+					"last":   i == len(items)-1,
+					"length": len(items),
+				}}
+
+				if err := r.renderNodes(n.body, loopScope); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// renderText resolves the {expr} placeholders in a text section and unescapes
+// \{ and \}. Each resolved value gets its own placeholder, so values
+// inserted by different loop iterations stay separate and are never parsed as
+// templates again.
+func (r *templateRenderer) renderText(text string, scope map[string]*StepResult) {
+	for text != "" {
+		i := strings.IndexAny(text, "\\{")
+		if i < 0 {
+			r.out.WriteString(text)
+			return
+		}
+		r.out.WriteString(text[:i])
+		text = text[i:]
+
+		if text[0] == '\\' {
+			if len(text) > 1 && (text[1] == '{' || text[1] == '}') {
+				r.out.WriteByte(text[1])
+				text = text[2:]
+			} else {
+				r.out.WriteByte('\\')
+				text = text[1:]
+			}
+			continue
+		}
+
+		end := expressionEnd(text)
+		if end < 2 {
+			r.out.WriteByte('{')
+			text = text[1:]
+			continue
+		}
+		r.renderExpression(text[:end+1], strings.TrimSpace(text[1:end]), scope)
+		text = text[end+1:]
+	}
+}
+
+// expressionEnd returns the index of the "}" closing the placeholder that
+// text starts with, or -1. Braces inside quoted strings and balanced inner
+// braces, as in {query("{id: id}", issues)}, do not close it.
+func expressionEnd(text string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// renderExpression writes the placeholder for one expression. Expressions
+// that do not resolve are written back unchanged and null values become
+// empty; both are recorded as unresolved.
+func (r *templateRenderer) renderExpression(fullMatch, expression string, scope map[string]*StepResult) {
+	value, err := r.te.resolveExpression(expression, scope, r.execCtx)
+	if err != nil {
+		r.te.logger.Debug("Failed to resolve template expression", "expression", expression, "error", err)
+		r.unresolved = append(r.unresolved, UnresolvedReference{Expression: expression, Reason: err.Error()})
+		r.out.WriteString(fullMatch)
+		return
+	}
+	if value == nil {
+		r.unresolved = append(r.unresolved, UnresolvedReference{Expression: expression, Reason: "value is null"})
+	}
+
+	valueStr := r.te.formatValue(value)
+	r.te.logger.Debug("Template substitution successful",
+		"expression", expression,
+		"value_type", fmt.Sprintf("%T", value),
+		"value_length", len(valueStr))
+
+	placeholder := fmt.Sprintf("\x00%d\x00", len(r.insertions))
+	r.insertions = append(r.insertions, TemplateInsertion{
+		Placeholder: placeholder,
+		Expression:  expression,
+		Value:       valueStr,
+	})
+	r.out.WriteString(placeholder)
+}
+
+// loopItems resolves a loop source into items. Maps iterate in key order as
+// {"key": ..., "value": ...} items; a source that does not resolve is empty
+// and recorded as unresolved.
+func (r *templateRenderer) loopItems(source string, scope map[string]*StepResult) ([]interface{}, error) {
+	value, err := r.te.resolveExpression(source, scope, r.execCtx)
+	if err != nil {
+		r.unresolved = append(r.unresolved, UnresolvedReference{Expression: source, Reason: err.Error()})
+		return nil, nil
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	if m, ok := value.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		items := make([]interface{}, len(keys))
+		for i, key := range keys {
+			items[i] = map[string]interface{}{"key": key, "value": m[key]}
+		}
+		return items, nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot loop over %T", value)
+	}
+
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// evaluateTemplateCondition evaluates an if condition
+func (te *TemplateEngine) evaluateTemplateCondition(condition string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (bool, error) {
+	condition = strings.TrimSpace(condition)
+
+	if parts := splitOutsideQuotes(condition, " or "); len(parts) > 1 {
+		for _, part := range parts {
+			matched, err := te.evaluateTemplateCondition(part, stepResults, execCtx)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+
+	if parts := splitOutsideQuotes(condition, " and "); len(parts) > 1 {
+		for _, part := range parts {
+			matched, err := te.evaluateTemplateCondition(part, stepResults, execCtx)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	if strings.HasPrefix(condition, "not ") {
+		matched, err := te.evaluateTemplateCondition(strings.TrimPrefix(condition, "not "), stepResults, execCtx)
+		return !matched, err
+	}
+
+	for _, operator := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		parts := splitOutsideQuotes(condition, operator)
+		if len(parts) != 2 {
+			continue
+		}
+
+		left := te.conditionOperand(parts[0], stepResults, execCtx)
+		right := te.conditionOperand(parts[1], stepResults, execCtx)
+
+		switch operator {
+		case "==":
+			return te.valuesEqual(left, right), nil
+		case "!=":
+			return !te.valuesEqual(left, right), nil
+		}
+
+		a, errA := te.toFloat64(left)
+		b, errB := te.toFloat64(right)
+		if errA != nil || errB != nil {
+			return false, fmt.Errorf("%q needs numbers on both sides", operator)
+		}
+		switch operator {
+		case ">=":
+			return a >= b, nil
+		case "<=":
+			return a <= b, nil
+		case ">":
+			return a > b, nil
+		default:
+			return a < b, nil
+		}
+	}
+
+	return isTruthy(te.conditionOperand(condition, stepResults, execCtx)), nil
+}
+
+// conditionOperand resolves a literal or reference; references that do not
+// resolve are nil so optional values can be tested with a plain if
+func (te *TemplateEngine) conditionOperand(operand string, stepResults map[string]*StepResult, execCtx *ExecutionContext) interface{} {
+	operand = strings.TrimSpace(operand)
+	if operand == "none" || operand == "null" {
+		return nil
+	}
+	if literal := te.parseLiteral(operand); literal != operand {
+		return literal
+	}
+
+	value, err := te.resolveExpression(operand, stepResults, execCtx)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// valuesEqual compares numbers numerically and everything else as text
+func (te *TemplateEngine) valuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if !aIsString && !bIsString {
+		numA, errA := te.toFloat64(a)
+		numB, errB := te.toFloat64(b)
+		if errA == nil && errB == nil {
+			return numA == numB
+		}
+	}
+	return te.formatValue(a) == te.formatValue(b)
+}
+
+// isTruthy reports whether a value counts as true in a condition: empty
+// strings, zero, false, nil and empty collections are false
+func isTruthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.TrimSpace(v) != ""
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() != 0
+	case reflect.Ptr, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return true
+}
+
+// splitOutsideQuotes splits s on sep wherever sep is not inside quotes
+func splitOutsideQuotes(s, sep string) []string {
+	var parts []string
+	var quoteChar byte
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoteChar != 0:
+			if s[i] == quoteChar {
+				quoteChar = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quoteChar = s[i]
+		case strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[start:i])
+			i += len(sep) - 1
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
@@ -17,6 +17,7 @@ type TemplateFunction func(args []interface{}) (interface{}, error)
 type TemplateEngine struct {
 	logger    *slog.Logger
 	functions map[string]TemplateFunction
+	strict    bool
 }
 
 // NewTemplateEngine creates a new template engine with built-in functions
@@ -32,52 +33,154 @@ func NewTemplateEngine(logger *slog.Logger) *TemplateEngine {
 	return te
 }
 
-// RenderTemplate renders a template with enhanced context access
-func (te *TemplateEngine) RenderTemplate(template string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (string, error) {
-	rendered := template
-
-	// Find all template expressions: {expression}
-	re := regexp.MustCompile(`\{([^}]+)\}`)
-	matches := re.FindAllStringSubmatch(template, -1)
+// FunctionSignature describes a registered function's parameters. Calls
+// with too few or too many arguments fail before the function runs.
+type FunctionSignature struct {
+	Params      []string // parameter names; a trailing "?" marks one optional
+	Variadic    bool     // the last parameter accepts any number of arguments
+	Description string
+}
 
-	for _, match := range matches {
-		if len(match) < 2 {
-			continue
+// arity returns the argument count bounds; maxArgs is -1 when unbounded
+func (s FunctionSignature) arity() (minArgs, maxArgs int) {
+	for _, param := range s.Params {
+		if !strings.HasSuffix(param, "?") {
+			minArgs++
 		}
+	}
+	if s.Variadic {
+		return minArgs, -1
+	}
+	return minArgs, len(s.Params)
+}
 
-		fullMatch := match[0]                     // {expression}
-		expression := strings.TrimSpace(match[1]) // expression
+// functionName matches valid template function names
+var functionName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
 
-		// Resolve the expression
-		value, err := te.resolveExpression(expression, stepResults, execCtx)
-		if err != nil {
-			te.logger.Error("Failed to resolve template expression", "expression", expression, "error", err)
-			continue // Leave unresolved expressions as-is
+// RegisterFunction adds a template function, callable as {name(args)} or as
+// a filter. It fails if the name is invalid or already registered, built-ins
+// included.
+func (te *TemplateEngine) RegisterFunction(name string, fn TemplateFunction, signature FunctionSignature) error {
+	if !functionName.MatchString(name) {
+		return fmt.Errorf("invalid template function name %q", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("template function %s is nil", name)
+	}
+	if _, exists := te.functions[name]; exists {
+		return fmt.Errorf("template function %s is already registered", name)
+	}
+
+	minArgs, maxArgs := signature.arity()
+	te.functions[name] = func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(name, args, minArgs, maxArgs); err != nil {
+			return nil, err
 		}
+		return fn(args)
+	}
 
-		// Convert to string
-		valueStr := te.formatValue(value)
+	te.logger.Debug("Registered template function", "name", name, "params", signature.Params)
+	return nil
+}
 
-		te.logger.Debug("Template substitution successful",
-			"expression", expression,
-			"value_type", fmt.Sprintf("%T", value),
-			"value_length", len(valueStr),
-			"sample_value", func() string {
-				if len(valueStr) > 100 {
-					return valueStr[:100] + "..."
-				}
-				return valueStr
-			}())
+// WithStrict returns an engine sharing te's functions that, when strict,
+// fails renders with unresolved references instead of warning about them
+func (te *TemplateEngine) WithStrict(strict bool) *TemplateEngine {
+	if te.strict == strict {
+		return te
+	}
+	return &TemplateEngine{logger: te.logger, functions: te.functions, strict: strict}
+}
+
+// UnresolvedReference is a template expression that could not be filled in
+type UnresolvedReference struct {
+	Expression string
+	Reason     string
+}
 
-		// Replace in template
-		rendered = strings.ReplaceAll(rendered, fullMatch, valueStr)
+// UnresolvedReferencesError lists every reference a strict render could not
+// resolve
+type UnresolvedReferencesError struct {
+	References []UnresolvedReference
+}
+
+func (e *UnresolvedReferencesError) Error() string {
+	descriptions := make([]string, len(e.References))
+	for i, ref := range e.References {
+		descriptions[i] = fmt.Sprintf("{%s} (%s)", ref.Expression, ref.Reason)
 	}
+	return fmt.Sprintf("unresolved template references: %s", strings.Join(descriptions, ", "))
+}
+
+// TemplateInsertion is one expression substituted into a template
+type TemplateInsertion struct {
+	Placeholder string // marks the insertion in the expanded template
+	Expression  string
+	Value       string
+}
 
-	return rendered, nil
+// RenderTemplate renders a template with enhanced context access
+func (te *TemplateEngine) RenderTemplate(template string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (string, error) {
+	expanded, insertions, err := te.ResolveInsertions(template, stepResults, execCtx)
+	if err != nil {
+		return "", err
+	}
+	return SubstituteInsertions(expanded, insertions), nil
+}
+
+// ResolveInsertions expands the template's blocks and resolves its
+// expressions without substituting them, so callers can inspect or shrink the
+// values first. It returns the expanded template, in which each insertion's
+// placeholder marks where its value goes.
+//
+// References that do not resolve are left in place and references that
+// resolve to null become empty; both are logged as a warning, or returned as
+// an *UnresolvedReferencesError when the engine is strict.
+func (te *TemplateEngine) ResolveInsertions(template string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (string, []TemplateInsertion, error) {
+	nodes, end, _, err := parseTemplateNodes(tokenizeTemplate(template), 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid template: %w", err)
+	}
+	if end != "" {
+		return "", nil, fmt.Errorf("invalid template: unexpected {%% %s %%}", end)
+	}
+
+	renderer := &templateRenderer{te: te, execCtx: execCtx}
+	if err := renderer.renderNodes(nodes, stepResults); err != nil {
+		return "", nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if len(renderer.unresolved) > 0 {
+		unresolvedErr := &UnresolvedReferencesError{References: renderer.unresolved}
+		if te.strict {
+			return "", nil, unresolvedErr
+		}
+		te.logger.Warn("Template has unresolved references", "references", unresolvedErr.Error())
+	}
+
+	return renderer.out.String(), renderer.insertions, nil
+}
+
+// SubstituteInsertions replaces each insertion's placeholder in template
+func SubstituteInsertions(template string, insertions []TemplateInsertion) string {
+	if len(insertions) == 0 {
+		return template
+	}
+
+	pairs := make([]string, 0, len(insertions)*2)
+	for _, insertion := range insertions {
+		pairs = append(pairs, insertion.Placeholder, insertion.Value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
 }
 
 // resolveExpression resolves a template expression to a value
 func (te *TemplateEngine) resolveExpression(expression string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (interface{}, error) {
+	// Check if it's a filter pipeline: value | filter(args) | filter
+	if stages := te.splitPipeline(expression); len(stages) > 1 {
+		return te.resolvePipeline(expression, stages, stepResults, execCtx)
+	}
+
 	// Check if it's a function call: function(args...)
 	if strings.Contains(expression, "(") && strings.HasSuffix(expression, ")") {
 		return te.resolveFunction(expression, stepResults, execCtx)
@@ -97,6 +200,101 @@ func (te *TemplateEngine) resolveExpression(expression string, stepResults map[s
 	return te.resolveSimpleReference(expression, stepResults, execCtx)
 }
 
+// resolveOptionalArgument resolves an argument like resolveArgument, but a
+// reference that does not resolve is nil
+func (te *TemplateEngine) resolveOptionalArgument(argStr string, stepResults map[string]*StepResult, execCtx *ExecutionContext) interface{} {
+	argStr = strings.TrimSpace(argStr)
+	if literal := te.parseLiteral(argStr); literal != argStr {
+		return literal
+	}
+
+	argValue, err := te.resolveExpression(argStr, stepResults, execCtx)
+	if err != nil {
+		return nil
+	}
+	return argValue
+}
+
+// resolvePipeline resolves the first stage of a pipeline and passes the value
+// through each filter in turn. A filter is any registered function, called
+// with the piped value as its first argument: "x | truncate(100)" is
+// "truncate(x, 100)".
+func (te *TemplateEngine) resolvePipeline(expression string, stages []string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (interface{}, error) {
+	re := regexp.MustCompile(`^(\w+)\s*(?:\((.*)\))?$`)
+
+	value, err := te.resolveExpression(stages[0], stepResults, execCtx)
+	if err != nil {
+		// A missing value can still be piped into default or coalesce
+		matches := re.FindStringSubmatch(stages[1])
+		if matches == nil || !nullSafeFunctions[matches[1]] {
+			return nil, err
+		}
+		value = nil
+	}
+
+	for _, stage := range stages[1:] {
+		matches := re.FindStringSubmatch(stage)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid filter %q in %q", stage, expression)
+		}
+
+		filterName := matches[1]
+		fn, exists := te.functions[filterName]
+		if !exists {
+			return nil, fmt.Errorf("unknown filter %q in %q", filterName, expression)
+		}
+
+		args := []interface{}{value}
+		if argsStr := strings.TrimSpace(matches[2]); argsStr != "" {
+			for _, argStr := range te.parseArguments(argsStr) {
+				if nullSafeFunctions[filterName] {
+					args = append(args, te.resolveOptionalArgument(argStr, stepResults, execCtx))
+					continue
+				}
+				args = append(args, te.resolveArgument(argStr, stepResults, execCtx))
+			}
+		}
+
+		value, err = fn(args)
+		if err != nil {
+			return nil, fmt.Errorf("filter %q failed in %q: %w", filterName, expression, err)
+		}
+	}
+
+	return value, nil
+}
+
+// splitPipeline splits an expression on the "|" characters that are not
+// inside quotes, parentheses or brackets
+func (te *TemplateEngine) splitPipeline(expression string) []string {
+	var stages []string
+	var current strings.Builder
+	var depth int
+	var quoteChar rune
+
+	for _, r := range expression {
+		switch {
+		case quoteChar != 0:
+			if r == quoteChar {
+				quoteChar = 0
+			}
+		case r == '"' || r == '\'':
+			quoteChar = r
+		case r == '(' || r == '[':
+			depth++
+		case r == ')' || r == ']':
+			depth--
+		case r == '|' && depth == 0:
+			stages = append(stages, strings.TrimSpace(current.String()))
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+
+	return append(stages, strings.TrimSpace(current.String()))
+}
+
 // resolveDotNotation resolves dot notation paths like "step.field.subfield"
 func (te *TemplateEngine) resolveDotNotation(path string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (interface{}, error) {
 	parts := strings.Split(path, ".")
@@ -187,13 +385,11 @@ func (te *TemplateEngine) resolveFunction(expression string, stepResults map[str
 		for _, argStr := range argParts {
 			argStr = strings.TrimSpace(argStr)
 
-			// Resolve argument (could be another expression)
-			argValue, err := te.resolveExpression(argStr, stepResults, execCtx)
-			if err != nil {
-				// Try as literal string if expression resolution fails
-				argValue = te.parseLiteral(argStr)
+			if nullSafeFunctions[funcName] {
+				args = append(args, te.resolveOptionalArgument(argStr, stepResults, execCtx))
+				continue
 			}
-			args = append(args, argValue)
+			args = append(args, te.resolveArgument(argStr, stepResults, execCtx))
 		}
 	}
 
@@ -201,6 +397,24 @@ func (te *TemplateEngine) resolveFunction(expression string, stepResults map[str
 	return fn(args)
 }
 
+// resolveArgument resolves a function argument. Quoted strings, numbers and
+// booleans are literals; anything else is resolved as an expression, falling
+// back to the literal text.
+func (te *TemplateEngine) resolveArgument(argStr string, stepResults map[string]*StepResult, execCtx *ExecutionContext) interface{} {
+	argStr = strings.TrimSpace(argStr)
+	if literal := te.parseLiteral(argStr); literal != argStr {
+		return literal
+	}
+
+	// Resolve argument (could be another expression)
+	argValue, err := te.resolveExpression(argStr, stepResults, execCtx)
+	if err != nil {
+		// Try as literal string if expression resolution fails
+		return argStr
+	}
+	return argValue
+}
+
 // resolveSimpleReference resolves simple step names or context keys
 func (te *TemplateEngine) resolveSimpleReference(name string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (interface{}, error) {
 	// Debug logging for step resolution
@@ -533,6 +747,10 @@ func (te *TemplateEngine) registerBuiltinFunctions() {
 	te.functions["multiply"] = te.multiplyFunction
 	te.functions["divide"] = te.divideFunction
 	te.functions["timestamp"] = te.timestampFunction
+	te.functions["truncate"] = te.truncateFunction
+	te.functions["indent"] = te.indentFunction
+
+	te.registerLibraryFunctions()
 }
 
 // Built-in template functions implementation
@@ -685,9 +903,13 @@ func (te *TemplateEngine) joinFunction(args []interface{}) (interface{}, error)
 	return strings.Join(parts, delimiter), nil
 }
 
+// filterFunction keeps the items whose field (a dot path) equals value:
+// filter(files, "meta.status", "added"). Without a value it keeps items whose
+// field is truthy, or, for items without that field, whose text contains the
+// predicate.
 func (te *TemplateEngine) filterFunction(args []interface{}) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("filter() expects 2 arguments, got %d", len(args))
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("filter() expects 2 or 3 arguments, got %d", len(args))
 	}
 
 	// First argument should be array/slice
@@ -696,13 +918,23 @@ func (te *TemplateEngine) filterFunction(args []interface{}) (interface{}, error
 		return nil, fmt.Errorf("filter() first argument must be array or slice, got %T", args[0])
 	}
 
-	// Second argument is filter predicate (simplified - just check if field exists)
 	predicate := fmt.Sprintf("%v", args[1])
 
 	var result []interface{}
 	for i := 0; i < v.Len(); i++ {
 		item := v.Index(i).Interface()
-		if te.matchesPredicate(item, predicate) {
+		field, err := te.fieldValue(item, predicate)
+
+		var matched bool
+		switch {
+		case len(args) == 3:
+			matched = err == nil && te.valuesEqual(field, args[2])
+		case err == nil:
+			matched = isTruthy(field)
+		default:
+			matched = te.matchesPredicate(item, predicate)
+		}
+		if matched {
 			result = append(result, item)
 		}
 	}
@@ -710,12 +942,36 @@ func (te *TemplateEngine) filterFunction(args []interface{}) (interface{}, error
 	return result, nil
 }
 
+// mapFunction picks a field, which may be a dot path, from every item:
+// map(files, "path"). With no field the items are returned unchanged.
 func (te *TemplateEngine) mapFunction(args []interface{}) (interface{}, error) {
-	// Simplified map function - just returns the array as-is for now
-	if len(args) != 1 {
-		return nil, fmt.Errorf("map() expects 1 argument, got %d", len(args))
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("map() expects 1 or 2 arguments, got %d", len(args))
 	}
-	return args[0], nil
+	if len(args) == 1 {
+		return args[0], nil
+	}
+
+	v := reflect.ValueOf(args[0])
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("map() first argument must be array or slice, got %T", args[0])
+	}
+
+	field, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("map() second argument must be a field name, got %T", args[1])
+	}
+
+	result := make([]interface{}, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item, err := te.fieldValue(v.Index(i).Interface(), field)
+		if err != nil {
+			return nil, fmt.Errorf("map() item %d: %w", i, err)
+		}
+		result[i] = item
+	}
+
+	return result, nil
 }
 
 func (te *TemplateEngine) firstFunction(args []interface{}) (interface{}, error) {
@@ -787,6 +1043,57 @@ func (te *TemplateEngine) splitFunction(args []interface{}) (interface{}, error)
 	return result, nil
 }
 
+// truncateFunction shortens a value to at most n characters, ending it with
+// a suffix (default "...") when cut: truncate(text, 4000)
+func (te *TemplateEngine) truncateFunction(args []interface{}) (interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("truncate() expects 2 or 3 arguments, got %d", len(args))
+	}
+
+	limit, err := te.toFloat64(args[1])
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("truncate() length must be a non-negative number, got %v", args[1])
+	}
+
+	suffix := "..."
+	if len(args) == 3 {
+		suffix = te.formatValue(args[2])
+	}
+
+	runes := []rune(te.formatValue(args[0]))
+	if len(runes) <= int(limit) {
+		return string(runes), nil
+	}
+
+	keep := int(limit) - len([]rune(suffix))
+	if keep < 0 {
+		keep = 0
+	}
+	return string(runes[:keep]) + suffix, nil
+}
+
+// indentFunction prefixes every non-empty line with n spaces: indent(text, 2)
+func (te *TemplateEngine) indentFunction(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("indent() expects 2 arguments, got %d", len(args))
+	}
+
+	width, err := te.toFloat64(args[1])
+	if err != nil || width < 0 {
+		return nil, fmt.Errorf("indent() width must be a non-negative number, got %v", args[1])
+	}
+
+	padding := strings.Repeat(" ", int(width))
+	lines := strings.Split(te.formatValue(args[0]), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = padding + line
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
 // matchesPredicate is a simplified predicate matcher
 func (te *TemplateEngine) matchesPredicate(item interface{}, predicate string) bool {
 	// Simplified implementation - just check if the item contains the predicate string
@@ -0,0 +1,387 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestTemplateEngine() *TemplateEngine {
+	return NewTemplateEngine(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+}
+
+func newTemplateTestResults() map[string]*StepResult {
+	return map[string]*StepResult{
+		"get_diff": {StepName: "get_diff", Success: true, Output: map[string]interface{}{
+			"output": "line one\nline two\nline three",
+		}},
+		"files": {StepName: "files", Success: true, Output: []interface{}{
+			map[string]interface{}{"path": "main.go", "meta": map[string]interface{}{"lines": 10}},
+			map[string]interface{}{"path": "go.mod", "meta": map[string]interface{}{"lines": 3}},
+		}},
+	}
+}
+
+func TestTemplatePipeFilters(t *testing.T) {
+	te := newTestTemplateEngine()
+	results := newTemplateTestResults()
+
+	tests := []struct {
+		name          string
+		expression    string
+		expected      string
+		expectedInErr string
+	}{
+		{
+			name:       "map and join",
+			expression: `files | map("path") | join(", ")`,
+			expected:   "main.go, go.mod",
+		},
+		{
+			name:       "map dot path",
+			expression: `files | map("meta.lines") | join("+")`,
+			expected:   "10+3",
+		},
+		{
+			name:       "truncate and indent",
+			expression: "get_diff.output | truncate(17) | indent(2)",
+			expected:   "  line one\n  line ...",
+		},
+		{
+			name:       "filter without arguments",
+			expression: "files | len",
+			expected:   "2",
+		},
+		{
+			name:       "pipe inside quotes is not a filter",
+			expression: `files | map("path") | join(" | ")`,
+			expected:   "main.go | go.mod",
+		},
+		{
+			name:          "unknown filter",
+			expression:    "files | shout",
+			expectedInErr: `unknown filter "shout"`,
+		},
+		{
+			name:          "failing filter is named",
+			expression:    `get_diff.output | truncate("many")`,
+			expectedInErr: `filter "truncate" failed`,
+		},
+		{
+			name:          "invalid filter syntax",
+			expression:    "files | join(,",
+			expectedInErr: "invalid filter",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := te.resolveExpression(tt.expression, results, &ExecutionContext{Data: map[string]interface{}{}})
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual := te.formatValue(value); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateWithFilters(t *testing.T) {
+	te := newTestTemplateEngine()
+
+	rendered, err := te.RenderTemplate(`Changed: {files | map("path") | join(", ")}; kept {unknown | shout}`,
+		newTemplateTestResults(), &ExecutionContext{Data: map[string]interface{}{}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "Changed: main.go, go.mod; kept {unknown | shout}"
+	if rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+}
+
+func TestTemplateBlocks(t *testing.T) {
+	te := newTestTemplateEngine()
+	results := newTemplateTestResults()
+	execCtx := &ExecutionContext{Data: map[string]interface{}{
+		"feedback": "Too long",
+		"empty":    "",
+		"attempt":  3,
+		"labels":   map[string]interface{}{"b": 2, "a": 1},
+	}}
+
+	tests := []struct {
+		name          string
+		template      string
+		expected      string
+		expectedInErr string
+	}{
+		{
+			name:     "if with existing value",
+			template: "Write it.{% if feedback %} Previous feedback: {feedback}{% endif %}",
+			expected: "Write it. Previous feedback: Too long",
+		},
+		{
+			name:     "if with missing value",
+			template: "Write it.{% if missing %} Previous feedback: {missing}{% endif %}",
+			expected: "Write it.",
+		},
+		{
+			name:     "elif and else",
+			template: "{% if empty %}a{% elif attempt > 5 %}b{% elif attempt >= 3 and not missing %}c{% else %}d{% endif %}",
+			expected: "c",
+		},
+		{
+			name:     "comparisons",
+			template: `{% if feedback == "Too long" %}yes{% endif %}{% if attempt != 3 or empty %}no{% endif %}`,
+			expected: "yes",
+		},
+		{
+			name:     "for with loop metadata",
+			template: `{% for file in files %}{loop.index}/{loop.length} {file.path}{% if not loop.last %}, {% endif %}{% endfor %}`,
+			expected: "1/2 main.go, 2/2 go.mod",
+		},
+		{
+			name:     "nested loops and first",
+			template: `{% for file in files %}{% if loop.first %}[{% endif %}{file.path}{% for l in labels %}:{l.key}{% endfor %}{% endfor %}]`,
+			expected: "[main.go:a:bgo.mod:a:b]",
+		},
+		{
+			name:     "whitespace control",
+			template: "Files:\n{%- for file in files %}\n- {file.path}\n{%- endfor %}\nDone",
+			expected: "Files:\n- main.go\n- go.mod\nDone",
+		},
+		{
+			name:     "loop over missing value",
+			template: "{% for x in missing %}{x}{% endfor %}none",
+			expected: "none",
+		},
+		{
+			name:     "inserted values are not parsed again",
+			template: "{% for v in values %}{v}{% endfor %}",
+			expected: "{feedback}",
+		},
+		{
+			name:          "unclosed if",
+			template:      "{% if feedback %}text",
+			expectedInErr: "missing {% endif %}",
+		},
+		{
+			name:          "stray end tag",
+			template:      "text{% endfor %}",
+			expectedInErr: "unexpected {% endfor %}",
+		},
+		{
+			name:          "loop over a string",
+			template:      "{% for c in feedback %}{c}{% endfor %}",
+			expectedInErr: "cannot loop over string",
+		},
+	}
+
+	execCtx.Data["values"] = []interface{}{"{feedback}"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := te.RenderTemplate(tt.template, results, execCtx)
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rendered != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, rendered)
+			}
+		})
+	}
+}
+
+func TestTemplateEscapes(t *testing.T) {
+	te := newTestTemplateEngine()
+	execCtx := &ExecutionContext{Data: map[string]interface{}{"name": "report"}}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "escaped braces",
+			template: `Return \{"name": "{name}"\}`,
+			expected: `Return {"name": "report"}`,
+		},
+		{
+			name:     "escaped block tag",
+			template: `Use \{% if x %\} in templates`,
+			expected: `Use {% if x %} in templates`,
+		},
+		{
+			name:     "other backslashes are kept",
+			template: `C:\temp\{name}`,
+			expected: `C:\temp{name}`,
+		},
+		{
+			name:     "raw section",
+			template: "Example:{% raw %} {\"name\": \"{name}\"} {% if %}{% endraw %} for {name}",
+			expected: "Example: {\"name\": \"{name}\"} {% if %} for report",
+		},
+		{
+			name:     "raw section with whitespace control",
+			template: "Code:\n{%- raw -%}\n  func main() { fmt.Println(x) }\n{%- endraw %}",
+			expected: "Code:func main() { fmt.Println(x) }",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := te.RenderTemplate(tt.template, map[string]*StepResult{}, execCtx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rendered != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, rendered)
+			}
+		})
+	}
+
+	if _, err := te.RenderTemplate("{% raw %}{name}", map[string]*StepResult{}, execCtx); err == nil {
+		t.Error("Expected an error for an unclosed raw section")
+	}
+}
+
+func TestTemplateExpressionsWithBraces(t *testing.T) {
+	te := newTestTemplateEngine()
+	execCtx := &ExecutionContext{Data: map[string]interface{}{
+		"name":   "report",
+		"issues": []interface{}{map[string]interface{}{"id": 1.0, "title": "crash"}},
+	}}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "multi-select hash in a query",
+			template: `{query("[0].{n: id, t: title}", issues) | json}`,
+			expected: `{"n":1,"t":"crash"}`,
+		},
+		{
+			name:     "closing brace inside a string",
+			template: `{replace(name, "report", "}")}!`,
+			expected: `}!`,
+		},
+		{
+			name:     "unbalanced brace before a placeholder",
+			template: `{ it's {name}`,
+			expected: `{ it's report`,
+		},
+		{
+			name:     "JSON that is not an expression",
+			template: `{"a": {"b": 1}} {name}`,
+			expected: `{"a": {"b": 1}} report`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := te.RenderTemplate(tt.template, map[string]*StepResult{}, execCtx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rendered != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, rendered)
+			}
+		})
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	te := newTestTemplateEngine()
+	execCtx := &ExecutionContext{Data: map[string]interface{}{"subject": "Fix parser", "body": nil}}
+	template := "{subject}\n\n{body}\n{get_diff.summary}{% if missing %}{missing}{% endif %}"
+
+	rendered, err := te.RenderTemplate(template, newTemplateTestResults(), execCtx)
+	if err != nil {
+		t.Fatalf("Unexpected error in lenient mode: %v", err)
+	}
+	if expected := "Fix parser\n\n\n{get_diff.summary}"; rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+
+	_, err = te.WithStrict(true).RenderTemplate(template, newTemplateTestResults(), execCtx)
+	var unresolved *UnresolvedReferencesError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("Expected an UnresolvedReferencesError, got %v", err)
+	}
+
+	var expressions []string
+	for _, ref := range unresolved.References {
+		expressions = append(expressions, ref.Expression)
+	}
+	if strings.Join(expressions, ",") != "body,get_diff.summary" {
+		t.Errorf("Expected body and get_diff.summary to be unresolved, got %v", expressions)
+	}
+	if !strings.Contains(err.Error(), "{get_diff.summary} (failed to access field 'summary'") {
+		t.Errorf("Expected the error to explain each reference, got %v", err)
+	}
+}
+
+func TestStrictTemplatesInSteps(t *testing.T) {
+	tests := []struct {
+		name        string
+		global      bool
+		stepSetting interface{}
+		expectError bool
+	}{
+		{name: "lenient by default"},
+		{name: "strict step", stepSetting: true, expectError: true},
+		{name: "strict agent", global: true, expectError: true},
+		{name: "step opts out of strict agent", global: true, stepSetting: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := newChatTestServer(t, "done", &requests)
+			defer server.Close()
+
+			engine := newBudgetTestEngine(t, server.URL)
+			engine.SetStrictTemplates(tt.global)
+
+			config := map[string]interface{}{"prompt": "Write a commit message for {changes.summary}"}
+			if tt.stepSetting != nil {
+				config["strict_templates"] = tt.stepSetting
+			}
+			step := Step{Name: "commit", Type: "llm", Config: config}
+
+			_, err := engine.executeStep(context.Background(), step, newBudgetTestContext(map[string]interface{}{}), make(map[string]*StepResult))
+			if tt.expectError {
+				if err == nil || !strings.Contains(err.Error(), "{changes.summary}") {
+					t.Errorf("Expected an error naming {changes.summary}, got %v", err)
+				}
+				if len(requests) != 0 {
+					t.Errorf("Expected no LLM request, got %d", len(requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+package generic
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Template function library
+//
+// Functions are called as {name(arg, ...)} or used as filters, where the
+// piped value is the first argument: {title | upper}. Quoted arguments are
+// strings, bare numbers and true/false are literals, and anything else is
+// resolved as a reference.
+//
+//	default(value, fallback)          fallback when value is missing, null or ""
+//	coalesce(value, ...)              first value that is not missing, null or ""
+//	upper(text), lower(text)          change case
+//	trim(text[, cutset])              strip whitespace, or the characters in cutset
+//	replace(text, old, new)           replace every occurrence of old
+//	regex_find(text, pattern[, n])    first match, or its capture group n; "" if none
+//	regex_replace(text, pattern, rep) replace matches; rep may use $1 for groups
+//	truncate(text, chars[, suffix])   cut to chars characters including suffix ("...")
+//	truncate_tokens(text, n[, suffix])
+//	                                  cut to about n tokens
+//	indent(text, n)                   indent non-empty lines by n spaces
+//	json(value[, n])                  encode as JSON, indented by n spaces if given
+//	from_json(text)                   decode JSON text
+//	yaml(value)                       encode as YAML with sorted keys
+//	base64(text), sha256(text)        base64 encoding, hex SHA-256 digest
+//	date(value[, layout])             format a time, RFC 3339 string, unix seconds or "now"
+//	                                  with a Go layout (default "2006-01-02")
+//	env(name[, fallback])             environment variable
+//	basename(path), dirname(path)     last element and directory of a path
+//	sort_by(list[, field[, "desc"]])  sort by a field path, numbers numerically
+//	group_by(list, field)             map of field value to the items that have it
+//	unique(list[, field])             drop items whose value (or field) repeats
+//	sum(list[, field])                add up numbers
+//	keys(map), values(map)            keys in sorted order, values in key order
+//	query(expr, data)                 JMESPath, or JSONPath when expr starts with "$"
+//
+// Field arguments are dot paths into each item, such as "meta.lines".
+
+// nullSafeFunctions receive nil for references that do not resolve, rather
+// than failing or receiving the reference text
+var nullSafeFunctions = map[string]bool{
+	"default":  true,
+	"coalesce": true,
+}
+
+// registerLibraryFunctions adds the general purpose functions
+func (te *TemplateEngine) registerLibraryFunctions() {
+	te.functions["default"] = te.defaultFunction
+	te.functions["coalesce"] = te.coalesceFunction
+	te.functions["upper"] = te.stringFunction("upper", strings.ToUpper)
+	te.functions["lower"] = te.stringFunction("lower", strings.ToLower)
+	te.functions["trim"] = te.trimFunction
+	te.functions["replace"] = te.replaceFunction
+	te.functions["regex_find"] = te.regexFindFunction
+	te.functions["regex_replace"] = te.regexReplaceFunction
+	te.functions["truncate_tokens"] = te.truncateTokensFunction
+	te.functions["json"] = te.jsonFunction
+	te.functions["from_json"] = te.fromJSONFunction
+	te.functions["yaml"] = te.yamlFunction
+	te.functions["base64"] = te.stringFunction("base64", func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	})
+	te.functions["sha256"] = te.stringFunction("sha256", func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	})
+	te.functions["date"] = te.dateFunction
+	te.functions["env"] = te.envFunction
+	te.functions["basename"] = te.stringFunction("basename", filepath.Base)
+	te.functions["dirname"] = te.stringFunction("dirname", filepath.Dir)
+	te.functions["sort_by"] = te.sortByFunction
+	te.functions["group_by"] = te.groupByFunction
+	te.functions["unique"] = te.uniqueFunction
+	te.functions["sum"] = te.sumFunction
+	te.functions["keys"] = te.keysFunction
+	te.functions["values"] = te.valuesFunction
+	te.functions["query"] = te.queryFunction
+}
+
+// checkArgs reports a call with fewer than minArgs or more than maxArgs
+// arguments; a negative maxArgs means no upper bound
+func checkArgs(name string, args []interface{}, minArgs, maxArgs int) error {
+	if len(args) >= minArgs && (maxArgs < 0 || len(args) <= maxArgs) {
+		return nil
+	}
+	switch {
+	case maxArgs < 0:
+		return fmt.Errorf("%s() expects at least %d argument(s), got %d", name, minArgs, len(args))
+	case minArgs == maxArgs:
+		return fmt.Errorf("%s() expects %d argument(s), got %d", name, minArgs, len(args))
+	default:
+		return fmt.Errorf("%s() expects %d to %d arguments, got %d", name, minArgs, maxArgs, len(args))
+	}
+}
+
+// isEmptyValue reports whether default and coalesce should skip a value
+func isEmptyValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	str, ok := value.(string)
+	return ok && str == ""
+}
+
+// stringFunction wraps a one-argument string transform
+func (te *TemplateEngine) stringFunction(name string, transform func(string) string) TemplateFunction {
+	return func(args []interface{}) (interface{}, error) {
+		if err := checkArgs(name, args, 1, 1); err != nil {
+			return nil, err
+		}
+		return transform(te.formatValue(args[0])), nil
+	}
+}
+
+func (te *TemplateEngine) defaultFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("default", args, 2, 2); err != nil {
+		return nil, err
+	}
+	if isEmptyValue(args[0]) {
+		return args[1], nil
+	}
+	return args[0], nil
+}
+
+func (te *TemplateEngine) coalesceFunction(args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if !isEmptyValue(arg) {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+func (te *TemplateEngine) trimFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("trim", args, 1, 2); err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		return strings.Trim(te.formatValue(args[0]), te.formatValue(args[1])), nil
+	}
+	return strings.TrimSpace(te.formatValue(args[0])), nil
+}
+
+func (te *TemplateEngine) replaceFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("replace", args, 3, 3); err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(te.formatValue(args[0]), te.formatValue(args[1]), te.formatValue(args[2])), nil
+}
+
+func (te *TemplateEngine) regexFindFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("regex_find", args, 2, 3); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(te.formatValue(args[1]))
+	if err != nil {
+		return nil, fmt.Errorf("regex_find() pattern: %w", err)
+	}
+
+	group := 0
+	if len(args) == 3 {
+		n, err := te.toFloat64(args[2])
+		if err != nil || n < 0 || int(n) > re.NumSubexp() {
+			return nil, fmt.Errorf("regex_find() group must be between 0 and %d, got %v", re.NumSubexp(), args[2])
+		}
+		group = int(n)
+	}
+
+	matches := re.FindStringSubmatch(te.formatValue(args[0]))
+	if matches == nil {
+		return "", nil
+	}
+	return matches[group], nil
+}
+
+func (te *TemplateEngine) regexReplaceFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("regex_replace", args, 3, 3); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(te.formatValue(args[1]))
+	if err != nil {
+		return nil, fmt.Errorf("regex_replace() pattern: %w", err)
+	}
+	return re.ReplaceAllString(te.formatValue(args[0]), te.formatValue(args[2])), nil
+}
+
+// truncateTokensFunction truncates to the characters that n tokens cover,
+// using the same estimate as the context budget
+func (te *TemplateEngine) truncateTokensFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("truncate_tokens", args, 2, 3); err != nil {
+		return nil, err
+	}
+	tokens, err := te.toFloat64(args[1])
+	if err != nil || tokens < 0 {
+		return nil, fmt.Errorf("truncate_tokens() token count must be a non-negative number, got %v", args[1])
+	}
+
+	truncateArgs := append([]interface{}{args[0], int(tokens) * charsPerToken}, args[2:]...)
+	return te.truncateFunction(truncateArgs)
+}
+
+func (te *TemplateEngine) jsonFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("json", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	var err error
+	if len(args) == 2 {
+		width, convErr := te.toFloat64(args[1])
+		if convErr != nil || width < 0 {
+			return nil, fmt.Errorf("json() indent must be a non-negative number, got %v", args[1])
+		}
+		data, err = json.MarshalIndent(args[0], "", strings.Repeat(" ", int(width)))
+	} else {
+		data, err = json.Marshal(args[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("json() failed to encode %T: %w", args[0], err)
+	}
+	return string(data), nil
+}
+
+func (te *TemplateEngine) fromJSONFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("from_json", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(te.formatValue(args[0])), &value); err != nil {
+		return nil, fmt.Errorf("from_json() invalid JSON: %w", err)
+	}
+	return value, nil
+}
+
+func (te *TemplateEngine) yamlFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("yaml", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	// Round-trip through JSON so structs and typed slices become plain values
+	data, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("yaml() failed to encode %T: %w", args[0], err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("yaml() failed to encode %T: %w", args[0], err)
+	}
+
+	encoded, err := encodeYAML(value)
+	if err != nil {
+		return nil, fmt.Errorf("yaml() %w", err)
+	}
+	return strings.TrimSuffix(encoded, "\n"), nil
+}
+
+// dateFunction formats a time.Time, an RFC 3339 string, unix seconds or
+// "now" with a Go layout
+func (te *TemplateEngine) dateFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("date", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	layout := "2006-01-02"
+	if len(args) == 2 {
+		layout = te.formatValue(args[1])
+	}
+
+	var t time.Time
+	switch v := args[0].(type) {
+	case time.Time:
+		t = v
+	case string:
+		if v == "now" {
+			t = time.Now()
+			break
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if parsed, err = time.Parse("2006-01-02", v); err != nil {
+				return nil, fmt.Errorf("date() cannot parse %q as an RFC 3339 time or date", v)
+			}
+		}
+		t = parsed
+	default:
+		seconds, err := te.toFloat64(v)
+		if err != nil {
+			return nil, fmt.Errorf("date() expects a time, date string or unix seconds, got %T", args[0])
+		}
+		t = time.Unix(int64(seconds), 0).UTC()
+	}
+
+	return t.Format(layout), nil
+}
+
+func (te *TemplateEngine) envFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("env", args, 1, 2); err != nil {
+		return nil, err
+	}
+	if value, ok := os.LookupEnv(te.formatValue(args[0])); ok {
+		return value, nil
+	}
+	if len(args) == 2 {
+		return args[1], nil
+	}
+	return "", nil
+}
+
+// listArg returns a list argument's items
+func (te *TemplateEngine) listArg(name string, value interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s() first argument must be array or slice, got %T", name, value)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// fieldArg returns the optional field path argument at index i
+func fieldArg(name string, args []interface{}, i int) (string, error) {
+	if len(args) <= i {
+		return "", nil
+	}
+	field, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("%s() field must be a string, got %T", name, args[i])
+	}
+	return field, nil
+}
+
+// fieldValue follows a dot path into item; an empty path returns the item
+func (te *TemplateEngine) fieldValue(item interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return item, nil
+	}
+	for _, part := range strings.Split(path, ".") {
+		var err error
+		item, err = te.getField(item, part)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return item, nil
+}
+
+// compareValues orders numbers numerically and everything else as text
+func (te *TemplateEngine) compareValues(a, b interface{}) int {
+	_, aIsString := a.(string)
+	_, bIsString := b.(string)
+	if !aIsString && !bIsString {
+		numA, errA := te.toFloat64(a)
+		numB, errB := te.toFloat64(b)
+		if errA == nil && errB == nil {
+			switch {
+			case numA < numB:
+				return -1
+			case numA > numB:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(te.formatValue(a), te.formatValue(b))
+}
+
+func (te *TemplateEngine) sortByFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("sort_by", args, 1, 3); err != nil {
+		return nil, err
+	}
+	items, err := te.listArg("sort_by", args[0])
+	if err != nil {
+		return nil, err
+	}
+	field, err := fieldArg("sort_by", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	descending := len(args) == 3 && te.formatValue(args[2]) == "desc"
+
+	sortKeys := make([]interface{}, len(items))
+	for i, item := range items {
+		if sortKeys[i], err = te.fieldValue(item, field); err != nil {
+			return nil, fmt.Errorf("sort_by() item %d: %w", i, err)
+		}
+	}
+
+	indexes := make([]int, len(items))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		cmp := te.compareValues(sortKeys[indexes[i]], sortKeys[indexes[j]])
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	sorted := make([]interface{}, len(items))
+	for i, index := range indexes {
+		sorted[i] = items[index]
+	}
+	return sorted, nil
+}
+
+func (te *TemplateEngine) groupByFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("group_by", args, 2, 2); err != nil {
+		return nil, err
+	}
+	items, err := te.listArg("group_by", args[0])
+	if err != nil {
+		return nil, err
+	}
+	field, err := fieldArg("group_by", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]interface{})
+	for i, item := range items {
+		key, err := te.fieldValue(item, field)
+		if err != nil {
+			return nil, fmt.Errorf("group_by() item %d: %w", i, err)
+		}
+		name := te.formatValue(key)
+		group, _ := groups[name].([]interface{})
+		groups[name] = append(group, item)
+	}
+	return groups, nil
+}
+
+func (te *TemplateEngine) uniqueFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("unique", args, 1, 2); err != nil {
+		return nil, err
+	}
+	items, err := te.listArg("unique", args[0])
+	if err != nil {
+		return nil, err
+	}
+	field, err := fieldArg("unique", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	result := make([]interface{}, 0, len(items))
+	for i, item := range items {
+		key, err := te.fieldValue(item, field)
+		if err != nil {
+			return nil, fmt.Errorf("unique() item %d: %w", i, err)
+		}
+		if name := te.formatValue(key); !seen[name] {
+			seen[name] = true
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (te *TemplateEngine) sumFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("sum", args, 1, 2); err != nil {
+		return nil, err
+	}
+	items, err := te.listArg("sum", args[0])
+	if err != nil {
+		return nil, err
+	}
+	field, err := fieldArg("sum", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0.0
+	for i, item := range items {
+		value, err := te.fieldValue(item, field)
+		if err != nil {
+			return nil, fmt.Errorf("sum() item %d: %w", i, err)
+		}
+		number, err := te.toFloat64(value)
+		if err != nil {
+			return nil, fmt.Errorf("sum() item %d: %w", i, err)
+		}
+		total += number
+	}
+
+	if total == float64(int(total)) {
+		return int(total), nil
+	}
+	return total, nil
+}
+
+// mapArg returns a map argument's sorted keys along with the map
+func mapArg(name string, value interface{}) (map[string]interface{}, []string, error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("%s() argument must be a map, got %T", name, value)
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return m, keys, nil
+}
+
+func (te *TemplateEngine) keysFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("keys", args, 1, 1); err != nil {
+		return nil, err
+	}
+	_, keys, err := mapArg("keys", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		result[i] = key
+	}
+	return result, nil
+}
+
+func (te *TemplateEngine) valuesFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("values", args, 1, 1); err != nil {
+		return nil, err
+	}
+	m, keys, err := mapArg("values", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]interface{}, len(keys))
+	for i, key := range keys {
+		result[i] = m[key]
+	}
+	return result, nil
+}
+
+func (te *TemplateEngine) queryFunction(args []interface{}) (interface{}, error) {
+	if err := checkArgs("query", args, 2, 2); err != nil {
+		return nil, err
+	}
+	expression, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("query() expression must be a string, got %T", args[0])
+	}
+	return evaluateQuery(expression, args[1])
+}
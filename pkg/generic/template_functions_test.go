@@ -0,0 +1,106 @@
+package generic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplateFunctionLibrary(t *testing.T) {
+	t.Setenv("TEMPLATE_TEST_VAR", "from env")
+
+	te := newTestTemplateEngine()
+	results := newTemplateTestResults()
+	execCtx := &ExecutionContext{Data: map[string]interface{}{
+		"title":   "  Fix Parser  ",
+		"empty":   "",
+		"nothing": nil,
+		"path":    "pkg/generic/template_engine.go",
+		"payload": `{"name": "agent", "tags": ["a", "b"]}`,
+		"issues": []interface{}{
+			map[string]interface{}{"file": "b.go", "severity": "high", "count": 2},
+			map[string]interface{}{"file": "a.go", "severity": "low", "count": 10},
+			map[string]interface{}{"file": "b.go", "severity": "low", "count": 1},
+		},
+		"config": map[string]interface{}{"b": 2, "a": "one", "list": []interface{}{1, map[string]interface{}{"x": "yes"}}},
+	}}
+
+	tests := []struct {
+		name          string
+		expression    string
+		expected      string
+		expectedInErr string
+	}{
+		// default and coalesce
+		{name: "default for missing reference", expression: `default(missing, "n/a")`, expected: "n/a"},
+		{name: "default for empty string", expression: `empty | default("n/a")`, expected: "n/a"},
+		{name: "default keeps value", expression: `path | basename | default("n/a")`, expected: "template_engine.go"},
+		{name: "default piped from missing", expression: `missing.field | default("none")`, expected: "none"},
+		{name: "coalesce", expression: `coalesce(missing, nothing, empty, "fallback", "later")`, expected: "fallback"},
+
+		// strings
+		{name: "upper and trim", expression: "title | trim | upper", expected: "FIX PARSER"},
+		{name: "lower", expression: `lower("MiXeD")`, expected: "mixed"},
+		{name: "trim cutset", expression: `trim("--x--", "-")`, expected: "x"},
+		{name: "replace", expression: `replace(path, "/", "::")`, expected: "pkg::generic::template_engine.go"},
+		{name: "regex_find", expression: `regex_find(path, "(\w+)\.go$", 1)`, expected: "template_engine"},
+		{name: "regex_find without match", expression: `regex_find(path, "\.py$")`, expected: ""},
+		{name: "regex_replace", expression: `regex_replace("a1b22", "[0-9]+", "#")`, expected: "a#b#"},
+		{name: "invalid regex", expression: `regex_find(path, "(")`, expectedInErr: "regex_find() pattern"},
+		{name: "truncate_tokens", expression: `truncate_tokens("abcdefghijkl", 2, "~")`, expected: "abcdefg~"},
+
+		// encoding
+		{name: "json", expression: "json(config.list)", expected: `[1,{"x":"yes"}]`},
+		{name: "json indented", expression: `json(from_json("[1]"), 2)`, expected: "[\n  1\n]"},
+		{name: "from_json piped", expression: `payload | from_json | keys | join(",")`, expected: "name,tags"},
+		{name: "invalid from_json", expression: `from_json("{oops")`, expectedInErr: "invalid JSON"},
+		{name: "yaml", expression: "yaml(config)", expected: "a: one\nb: 2\nlist:\n  - 1\n  - x: \"yes\""},
+		{name: "base64", expression: `base64("agent")`, expected: "YWdlbnQ="},
+		{name: "sha256", expression: `sha256("agent")`, expected: "d4f0bc5a29de06b510f9aa428f1eedba926012b591fef7a518e776a7c9bd1824"},
+
+		// dates, environment and paths
+		{name: "date from unix seconds", expression: `date(86400)`, expected: "1970-01-02"},
+		{name: "date with layout", expression: `date("2024-03-05T10:30:00Z", "Jan 2, 2006 15:04")`, expected: "Mar 5, 2024 10:30"},
+		{name: "invalid date", expression: `date("yesterday")`, expectedInErr: "cannot parse"},
+		{name: "env", expression: `env("TEMPLATE_TEST_VAR")`, expected: "from env"},
+		{name: "env fallback", expression: `env("TEMPLATE_TEST_UNSET", "fallback")`, expected: "fallback"},
+		{name: "dirname", expression: "dirname(path)", expected: "pkg/generic"},
+
+		// collections
+		{name: "sort_by number", expression: `sort_by(issues, "count") | map("count") | join(",")`, expected: "1,2,10"},
+		{name: "sort_by descending", expression: `sort_by(issues, "file", "desc") | map("file") | join(",")`, expected: "b.go,b.go,a.go"},
+		{name: "sort_by values", expression: `sort_by(split("c,a,b", ",")) | join("")`, expected: "abc"},
+		{name: "group_by", expression: `group_by(issues, "severity") | keys | join(",")`, expected: "high,low"},
+		{name: "group_by items", expression: `group_by(issues, "severity") | values | last | len`, expected: "2"},
+		{name: "unique by field", expression: `unique(issues, "file") | len`, expected: "2"},
+		{name: "unique values", expression: `unique(split("a,b,a", ",")) | join(",")`, expected: "a,b"},
+		{name: "sum", expression: `sum(issues, "count")`, expected: "13"},
+		{name: "sum of non-numbers", expression: `sum(issues, "file")`, expectedInErr: "sum() item 0"},
+		{name: "values", expression: `values(config) | len`, expected: "3"},
+		{name: "keys of non-map", expression: "keys(path)", expectedInErr: "must be a map"},
+
+		// deep map and filter
+		{name: "map nested field", expression: `files | map("meta.lines") | sum`, expected: "13"},
+		{name: "filter by field value", expression: `filter(issues, "severity", "low") | map("file") | join(",")`, expected: "a.go,b.go"},
+		{name: "filter by nested number", expression: `filter(files, "meta.lines", 3) | map("path") | join(",")`, expected: "go.mod"},
+		{name: "filter by text", expression: `filter(split("main.go,go.mod", ","), ".go") | join(",")`, expected: "main.go"},
+		{name: "wrong argument count", expression: `upper("a", "b")`, expectedInErr: "upper() expects 1 argument(s), got 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := te.resolveExpression(tt.expression, results, execCtx)
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v (value %v)", tt.expectedInErr, err, value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual := te.formatValue(value); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package generic
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RegisterMacros registers config-defined macros as template functions. A
+// macro renders its template with only its parameters in scope, strictly, so
+// a reference to anything else fails the step that calls it:
+//
+//	"template_functions": {
+//	  "jira_link": {"params": ["id"], "template": "https://jira.example.com/browse/{id}"}
+//	}
+//
+// Macros may call functions and other macros, but not recursively.
+func (te *TemplateEngine) RegisterMacros(macros map[string]TemplateMacro) error {
+	names := make([]string, 0, len(macros))
+	for name := range macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		macro := macros[name]
+		if !functionName.MatchString(name) {
+			return fmt.Errorf("invalid template function name %q", name)
+		}
+		if _, _, _, err := parseTemplateNodes(tokenizeTemplate(macro.Template), 0); err != nil {
+			return fmt.Errorf("template function %s: invalid template: %w", name, err)
+		}
+		for _, param := range macro.Params {
+			if !functionName.MatchString(strings.TrimSuffix(param, "?")) {
+				return fmt.Errorf("template function %s: invalid parameter name %q", name, param)
+			}
+		}
+	}
+
+	if cycle := findMacroCycle(names, macros); cycle != nil {
+		return fmt.Errorf("template functions call each other recursively: %s", strings.Join(cycle, " -> "))
+	}
+
+	for _, name := range names {
+		macro := macros[name]
+		signature := FunctionSignature{Params: macro.Params, Description: macro.Description}
+		if err := te.RegisterFunction(name, te.macroFunction(macro), signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// macroFunction renders a macro with its arguments bound to its parameters.
+// Optional parameters that were not passed are left unbound, so the macro
+// can test them with {% if param %}.
+func (te *TemplateEngine) macroFunction(macro TemplateMacro) TemplateFunction {
+	strict := te.WithStrict(true)
+
+	return func(args []interface{}) (interface{}, error) {
+		scope := make(map[string]*StepResult, len(macro.Params))
+		for i, param := range macro.Params {
+			if i >= len(args) {
+				break
+			}
+			name := strings.TrimSuffix(param, "?")
+			scope[name] = &StepResult{StepName: name, Success: true, Output: args[i]}
+		}
+
+		return strict.RenderTemplate(macro.Template, scope, &ExecutionContext{Data: map[string]interface{}{}})
+	}
+}
+
+// findMacroCycle returns the names along a chain of macros that call back
+// into themselves, or nil
+func findMacroCycle(names []string, macros map[string]TemplateMacro) []string {
+	calls := make(map[string][]string, len(names))
+	for _, name := range names {
+		for _, callee := range names {
+			call := regexp.MustCompile(`(\b` + callee + `\s*\(|\|\s*` + callee + `\b)`)
+			if call.MatchString(macros[name].Template) {
+				calls[name] = append(calls[name], callee)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(names))
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, step := range path {
+				if step == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case done:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, callee := range calls[name] {
+			if cycle := visit(callee); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
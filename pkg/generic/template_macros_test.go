@@ -0,0 +1,148 @@
+package generic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFunction(t *testing.T) {
+	te := newTestTemplateEngine()
+
+	jiraLink := func(args []interface{}) (interface{}, error) {
+		return fmt.Sprintf("https://jira.example.com/browse/%v", args[0]), nil
+	}
+	if err := te.RegisterFunction("jira_link", jiraLink, FunctionSignature{Params: []string{"id"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	joinAll := func(args []interface{}) (interface{}, error) {
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = fmt.Sprint(arg)
+		}
+		return strings.Join(parts, "-"), nil
+	}
+	if err := te.RegisterFunction("join_all", joinAll, FunctionSignature{Params: []string{"first", "rest"}, Variadic: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := te.RegisterFunction("upper", jiraLink, FunctionSignature{}); err == nil {
+		t.Error("Expected an error when replacing a built-in function")
+	}
+	if err := te.RegisterFunction("bad-name", jiraLink, FunctionSignature{}); err == nil {
+		t.Error("Expected an error for an invalid name")
+	}
+
+	tests := []struct {
+		name          string
+		expression    string
+		expected      string
+		expectedInErr string
+	}{
+		{name: "call", expression: `jira_link("ABC-1")`, expected: "https://jira.example.com/browse/ABC-1"},
+		{name: "filter", expression: `ticket | jira_link | upper`, expected: "HTTPS://JIRA.EXAMPLE.COM/BROWSE/ABC-2"},
+		{name: "variadic", expression: `join_all("a", "b", "c")`, expected: "a-b-c"},
+		{name: "too few arguments", expression: `join_all("a")`, expectedInErr: "join_all() expects at least 2 argument(s), got 1"},
+		{name: "too many arguments", expression: `jira_link("a", "b")`, expectedInErr: "jira_link() expects 1 argument(s), got 2"},
+	}
+
+	execCtx := &ExecutionContext{Data: map[string]interface{}{"ticket": "ABC-2"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := te.resolveExpression(tt.expression, map[string]*StepResult{}, execCtx)
+			if tt.expectedInErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual := te.formatValue(value); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRegisterMacros(t *testing.T) {
+	te := newTestTemplateEngine()
+	err := te.RegisterMacros(map[string]TemplateMacro{
+		"jira_link": {Params: []string{"id"}, Template: "https://jira.example.com/browse/{id | upper}"},
+		"ticket_line": {
+			Params:   []string{"id", "title?"},
+			Template: "- [{id}]({jira_link(id)}){% if title %}: {title}{% endif %}",
+		},
+		"broken": {Params: []string{"id"}, Template: "{id} {missing}"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	execCtx := &ExecutionContext{Data: map[string]interface{}{
+		"tickets": []interface{}{"abc-1", "abc-2"},
+	}}
+
+	rendered, err := te.RenderTemplate(`{ticket_line("abc-1", "Fix login")}
+{% for t in tickets %}{t | ticket_line}
+{% endfor %}`, map[string]*StepResult{}, execCtx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `- [abc-1](https://jira.example.com/browse/ABC-1): Fix login
+- [abc-1](https://jira.example.com/browse/ABC-1)
+- [abc-2](https://jira.example.com/browse/ABC-2)
+`
+	if rendered != expected {
+		t.Errorf("Expected %q, got %q", expected, rendered)
+	}
+
+	_, err = te.WithStrict(true).RenderTemplate(`{broken("x")}`, map[string]*StepResult{}, execCtx)
+	if err == nil || !strings.Contains(err.Error(), "{missing}") {
+		t.Errorf("Expected the macro's unresolved reference to be reported, got %v", err)
+	}
+}
+
+func TestRegisterMacrosErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		macros        map[string]TemplateMacro
+		expectedInErr string
+	}{
+		{
+			name:          "invalid template",
+			macros:        map[string]TemplateMacro{"link": {Template: "{% if x %}open"}},
+			expectedInErr: "template function link: invalid template",
+		},
+		{
+			name:          "invalid parameter",
+			macros:        map[string]TemplateMacro{"link": {Params: []string{"a-b"}, Template: "{a}"}},
+			expectedInErr: `invalid parameter name "a-b"`,
+		},
+		{
+			name: "recursion",
+			macros: map[string]TemplateMacro{
+				"a": {Params: []string{"x"}, Template: "{b(x)}"},
+				"b": {Params: []string{"x"}, Template: "{x | a}"},
+			},
+			expectedInErr: "recursively: a -> b -> a",
+		},
+		{
+			name:          "built-in name",
+			macros:        map[string]TemplateMacro{"join": {Template: "x"}},
+			expectedInErr: "already registered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestTemplateEngine().RegisterMacros(tt.macros)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedInErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedInErr, err)
+			}
+		})
+	}
+}
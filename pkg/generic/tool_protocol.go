@@ -0,0 +1,273 @@
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alantheprice/agent/pkg/interfaces/types"
+)
+
+// Text tool protocol
+//
+// Models without native function calling get the tools described in the
+// system prompt and answer in a ReAct-style format:
+//
+//	Thought: I need to see the config loader
+//	Action: read_file
+//	Action Input: {"path": "pkg/generic/config.go"}
+//
+// The tool result is sent back as an "Observation:" user message, and the
+// loop ends when the model replies with "Final Answer:".
+
+// maxToolProtocolRepairs is how many times in a row a malformed reply is
+// answered with a repair prompt before giving up
+const maxToolProtocolRepairs = 2
+
+// errNoToolProtocolStep marks replies that contain neither an Action nor a
+// Final Answer
+var errNoToolProtocolStep = errors.New("reply contains neither an Action nor a Final Answer")
+
+// toolProtocolLabels matches the protocol labels at the start of a line,
+// tolerating markdown decoration such as "**Action:**" or "- Action:".
+// "action input" must come before "action" in the alternation.
+var toolProtocolLabels = regexp.MustCompile(`(?im)^[ \t>*_#-]*(thought|action input|action|observation|final answer)[ \t*_]*:[ \t*_]*`)
+
+// ToolProtocolStep is one parsed reply in the text tool protocol
+type ToolProtocolStep struct {
+	Thought     string
+	Action      string
+	ActionInput map[string]interface{}
+	FinalAnswer string
+	IsFinal     bool
+}
+
+// buildToolProtocolPrompt describes the tools and the reply format
+func buildToolProtocolPrompt(tools []ToolDefinition) string {
+	var sb strings.Builder
+	sb.WriteString("You can use tools to help answer. To call a tool, reply with exactly:\n\n")
+	sb.WriteString("Thought: <your reasoning>\n")
+	sb.WriteString("Action: <tool name>\n")
+	sb.WriteString("Action Input: <JSON object with the tool parameters>\n\n")
+	sb.WriteString("Then stop and wait. The tool result will be sent back as:\n\n")
+	sb.WriteString("Observation: <tool result>\n\n")
+	sb.WriteString("Call one tool per reply and never write the Observation yourself. ")
+	sb.WriteString("When you have enough information, reply with:\n\n")
+	sb.WriteString("Thought: <your reasoning>\n")
+	sb.WriteString("Final Answer: <your answer>\n\n")
+	sb.WriteString("Available tools:\n")
+
+	for _, tool := range tools {
+		schema, err := json.Marshal(tool.Parameters)
+		if err != nil {
+			schema = []byte("{}")
+		}
+		fmt.Fprintf(&sb, "\n- %s: %s\n  Parameters (JSON Schema): %s\n", tool.Name, tool.Description, schema)
+	}
+
+	return sb.String()
+}
+
+// ParseToolProtocolStep parses a reply in the text tool protocol. It accepts
+// decorated labels, code-fenced or prose-wrapped JSON input and the
+// "Action: tool({...})" shorthand, and ignores any Observation the model
+// invents after its Action.
+func ParseToolProtocolStep(reply string) (*ToolProtocolStep, error) {
+	matches := toolProtocolLabels.FindAllStringSubmatchIndex(reply, -1)
+
+	sections := make(map[string]string)
+	for i, match := range matches {
+		label := strings.ToLower(reply[match[2]:match[3]])
+		if label == "observation" {
+			break
+		}
+
+		end := len(reply)
+		if i+1 < len(matches) && label != "final answer" {
+			end = matches[i+1][0]
+		}
+
+		// Keep the first occurrence of each label
+		if _, seen := sections[label]; !seen {
+			sections[label] = strings.TrimSpace(reply[match[1]:end])
+		}
+
+		// An Action ends the reply; anything after it waits for the observation
+		if label == "final answer" || (label == "action input" && sections["action"] != "") {
+			break
+		}
+	}
+
+	step := &ToolProtocolStep{Thought: sections["thought"]}
+
+	if action, ok := sections["action"]; ok && action != "" {
+		name, inlineInput := splitActionCall(action)
+		if name == "" {
+			return nil, fmt.Errorf("Action is missing a tool name")
+		}
+
+		input, hasInput := sections["action input"]
+		if !hasInput {
+			input = inlineInput
+		}
+
+		params, err := parseActionInput(input)
+		if err != nil {
+			return nil, err
+		}
+
+		step.Action = name
+		step.ActionInput = params
+		return step, nil
+	}
+
+	if answer, ok := sections["final answer"]; ok {
+		step.FinalAnswer = answer
+		step.IsFinal = true
+		return step, nil
+	}
+
+	return nil, errNoToolProtocolStep
+}
+
+// splitActionCall separates "read_file" or "read_file({...})" into the tool
+// name and any inline input
+func splitActionCall(action string) (string, string) {
+	line, _, _ := strings.Cut(action, "\n")
+	line = strings.TrimSpace(line)
+
+	inlineInput := ""
+	if open := strings.Index(line, "("); open > 0 && strings.HasSuffix(line, ")") {
+		inlineInput = line[open+1 : len(line)-1]
+		line = line[:open]
+	}
+
+	return strings.Trim(line, "`\"' .[]"), inlineInput
+}
+
+// parseActionInput decodes the tool parameters from an Action Input section
+func parseActionInput(input string) (map[string]interface{}, error) {
+	input = stripCodeFence(strings.TrimSpace(input))
+	if input == "" || strings.EqualFold(input, "none") {
+		return map[string]interface{}{}, nil
+	}
+
+	params := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(input), &params); err == nil {
+		return params, nil
+	}
+
+	// Models often wrap the JSON in prose; fall back to the outermost braces
+	start := strings.Index(input, "{")
+	end := strings.LastIndex(input, "}")
+	if start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(input[start:end+1]), &params); err == nil {
+			return params, nil
+		}
+	}
+
+	if len(input) > 200 {
+		input = input[:200] + "..."
+	}
+	return nil, fmt.Errorf("Action Input is not a JSON object: %s", input)
+}
+
+// stripCodeFence removes a surrounding ``` fence, with or without a language tag
+func stripCodeFence(text string) string {
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+
+	_, body, found := strings.Cut(text, "\n")
+	if !found {
+		return strings.Trim(text, "`")
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(body), "```"))
+}
+
+// runTextToolLoop drives the tool loop through the text protocol for models
+// without native function calling
+func (we *WorkflowEngine) runTextToolLoop(ctx context.Context, client *LLMClient, messages []Message, tools []ToolDefinition, allowedTools []string, config LLMWithToolsConfig, result *LLMWithToolsResult) (*LLMWithToolsResult, error) {
+	protocolPrompt := buildToolProtocolPrompt(tools)
+	if len(messages) > 0 && messages[0].Role == "system" {
+		messages[0].Content += "\n\n" + protocolPrompt
+	} else {
+		messages = append([]Message{{Role: "system", Content: protocolPrompt}}, messages...)
+	}
+
+	repairs := 0
+	limitReached := false
+
+	for {
+		response, err := client.Chat(ctx, messages)
+		if err != nil {
+			return nil, fmt.Errorf("LLM call failed: %w", err)
+		}
+
+		result.TotalTokens += response.TokensUsed
+		result.TotalCost += response.Cost
+
+		step, err := ParseToolProtocolStep(response.Content)
+		if err != nil {
+			if repairs >= maxToolProtocolRepairs {
+				// A model that keeps answering in plain prose has most likely
+				// just answered the question
+				if errors.Is(err, errNoToolProtocolStep) {
+					we.logger.Warn("Model ignored the tool protocol, using its reply as the final answer")
+					result.FinalResponse = strings.TrimSpace(response.Content)
+					return result, nil
+				}
+				return nil, fmt.Errorf("could not parse tool protocol reply after %d repair attempts: %w", repairs, err)
+			}
+
+			repairs++
+			we.logger.Debug("Requesting tool protocol repair", "attempt", repairs, "error", err)
+			messages = append(messages,
+				Message{Role: "assistant", Content: response.Content},
+				Message{Role: "user", Content: fmt.Sprintf("Your previous reply did not follow the required format (%v). "+
+					"Reply again with either\n\nThought: ...\nAction: <tool name>\nAction Input: <JSON object>\n\n"+
+					"or\n\nThought: ...\nFinal Answer: <your answer>", err)},
+			)
+			continue
+		}
+		repairs = 0
+
+		if step.IsFinal {
+			result.FinalResponse = step.FinalAnswer
+			return result, nil
+		}
+
+		// Replay the parsed step rather than the raw reply, so observations the
+		// model invented never enter the history
+		actionInput, _ := json.Marshal(step.ActionInput)
+		assistantTurn := fmt.Sprintf("Thought: %s\nAction: %s\nAction Input: %s", step.Thought, step.Action, actionInput)
+		messages = append(messages, Message{Role: "assistant", Content: assistantTurn})
+
+		if result.ToolCallsUsed >= config.MaxToolCalls {
+			if limitReached {
+				return nil, fmt.Errorf("model kept calling tools after the tool call limit of %d", config.MaxToolCalls)
+			}
+			limitReached = true
+			messages = append(messages, Message{Role: "user", Content: "Observation: " + toolLimitMessage + ". Reply with a Final Answer."})
+			continue
+		}
+
+		call := types.ToolCall{
+			ID:   fmt.Sprintf("call_%d", result.ToolCallsUsed+1),
+			Type: "function",
+			Function: types.ToolCallFunction{
+				Name:      step.Action,
+				Arguments: string(actionInput),
+			},
+		}
+
+		content, err := we.runToolCall(ctx, call, allowedTools, config, result)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, Message{Role: "user", Content: "Observation: " + content})
+	}
+}
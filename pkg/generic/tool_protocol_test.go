@@ -0,0 +1,116 @@
+package generic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseToolProtocolStep(t *testing.T) {
+	tests := []struct {
+		name           string
+		reply          string
+		expectedAction string
+		expectedInput  map[string]interface{}
+		expectedFinal  string
+		expectError    bool
+	}{
+		{
+			name:           "well-formed action",
+			reply:          "Thought: I should read the config\nAction: read_file\nAction Input: {\"path\": \"config.go\"}",
+			expectedAction: "read_file",
+			expectedInput:  map[string]interface{}{"path": "config.go"},
+		},
+		{
+			name:           "markdown decoration and code fence",
+			reply:          "**Thought:** checking\n**Action:** `list_files`\n**Action Input:**\n```json\n{\"path\": \"pkg\"}\n```",
+			expectedAction: "list_files",
+			expectedInput:  map[string]interface{}{"path": "pkg"},
+		},
+		{
+			name:           "invented observation is ignored",
+			reply:          "Thought: read it\nAction: read_file\nAction Input: {\"path\": \"a.go\"}\nObservation: package a\nFinal Answer: it is package a",
+			expectedAction: "read_file",
+			expectedInput:  map[string]interface{}{"path": "a.go"},
+		},
+		{
+			name:           "inline call syntax",
+			reply:          "Action: read_file({\"path\": \"b.go\"})",
+			expectedAction: "read_file",
+			expectedInput:  map[string]interface{}{"path": "b.go"},
+		},
+		{
+			name:           "json wrapped in prose",
+			reply:          "action: read_file\naction input: the input is {\"path\": \"c.go\"} as requested",
+			expectedAction: "read_file",
+			expectedInput:  map[string]interface{}{"path": "c.go"},
+		},
+		{
+			name:           "action without input",
+			reply:          "Thought: look around\nAction: git_status",
+			expectedAction: "git_status",
+			expectedInput:  map[string]interface{}{},
+		},
+		{
+			name:          "final answer spanning lines",
+			reply:         "Thought: I know enough\nFinal Answer: Looks good.\n\n- no issues found",
+			expectedFinal: "Looks good.\n\n- no issues found",
+		},
+		{
+			name:        "invalid action input",
+			reply:       "Action: read_file\nAction Input: path=config.go",
+			expectError: true,
+		},
+		{
+			name:        "plain prose",
+			reply:       "The change looks fine to me.",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, err := ParseToolProtocolStep(tt.reply)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got step %+v", step)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if tt.expectedFinal != "" {
+				if !step.IsFinal || step.FinalAnswer != tt.expectedFinal {
+					t.Errorf("Expected final answer %q, got %+v", tt.expectedFinal, step)
+				}
+				return
+			}
+
+			if step.IsFinal {
+				t.Fatalf("Expected an action, got final answer %q", step.FinalAnswer)
+			}
+			if step.Action != tt.expectedAction {
+				t.Errorf("Expected action %q, got %q", tt.expectedAction, step.Action)
+			}
+			if !reflect.DeepEqual(step.ActionInput, tt.expectedInput) {
+				t.Errorf("Expected input %v, got %v", tt.expectedInput, step.ActionInput)
+			}
+		})
+	}
+}
+
+func TestBuildToolProtocolPrompt(t *testing.T) {
+	prompt := buildToolProtocolPrompt([]ToolDefinition{{
+		Name:        "read_file",
+		Description: "Read contents of a file",
+		Parameters:  objectSchema([]string{"path"}, map[string]interface{}{"path": stringProperty("File path")}),
+	}})
+
+	for _, expected := range []string{"Action Input:", "Final Answer:", "- read_file: Read contents of a file", `"required":["path"]`} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("Expected prompt to contain %q", expected)
+		}
+	}
+}
@@ -23,6 +23,13 @@ type GenericTool interface {
 	Execute(ctx context.Context, params map[string]interface{}) (interface{}, error)
 }
 
+// SchemaTool is implemented by tools that describe their parameters with a
+// JSON Schema, so they can be offered to an LLM through function calling
+type SchemaTool interface {
+	GenericTool
+	Parameters() map[string]interface{}
+}
+
 // ToolRegistry manages available tools
 type ToolRegistry struct {
 	tools                map[string]GenericTool
@@ -36,6 +43,7 @@ type ToolRegistry struct {
 type BuiltinTool struct {
 	name        string
 	description string
+	parameters  map[string]interface{}
 	executor    func(ctx context.Context, params map[string]interface{}) (interface{}, error)
 }
 
@@ -62,18 +70,95 @@ func (tr *ToolRegistry) registerBuiltinTools() {
 		name:        "read_file",
 		description: "Read contents of a file",
 		executor:    tr.executeReadFile,
+		parameters: objectSchema([]string{"path"}, map[string]interface{}{
+			"path":     stringProperty("Path of the file to read, relative to the working directory"),
+			"max_size": integerProperty("Maximum file size in bytes"),
+		}),
 	}
 
 	tr.tools["write_file"] = &BuiltinTool{
 		name:        "write_file",
 		description: "Write content to a file",
 		executor:    tr.executeWriteFile,
+		parameters: objectSchema([]string{"path", "content"}, map[string]interface{}{
+			"path":               stringProperty("Path of the file to write, relative to the working directory"),
+			"content":            stringProperty("Content to write"),
+			"create_directories": booleanProperty("Create missing parent directories"),
+			"create_backup":      booleanProperty("Copy an existing file to <path>.backup first"),
+		}),
+	}
+
+	tr.tools["apply_patch"] = &BuiltinTool{
+		name:        "apply_patch",
+		description: "Apply a unified diff to files, changing only the lines it touches",
+		executor:    tr.executeApplyPatch,
+		parameters: objectSchema([]string{"patch"}, map[string]interface{}{
+			"patch":   stringProperty("Unified diff with ---/+++ file headers and @@ hunks"),
+			"dry_run": booleanProperty("Check that the patch applies without changing any file"),
+			"fuzz":    integerProperty("Context lines that may be ignored at each end of a hunk (default 2)"),
+		}),
+	}
+
+	tr.tools["edit_file"] = &BuiltinTool{
+		name:        "edit_file",
+		description: "Edit part of a file by exact search/replace or by line range, returning a diff of the change",
+		executor:    tr.executeEditFile,
+		parameters: objectSchema([]string{"path", "edits"}, map[string]interface{}{
+			"path": stringProperty("Path of the file to edit"),
+			"edits": map[string]interface{}{
+				"type":        "array",
+				"description": "Edits to apply together; line numbers and old_text refer to the file before any of them",
+				"items": objectSchema(nil, map[string]interface{}{
+					"old_text":    stringProperty("Exact text to replace; must occur once unless replace_all is set"),
+					"new_text":    stringProperty("Replacement or inserted text"),
+					"replace_all": booleanProperty("Replace every occurrence of old_text"),
+					"start_line":  integerProperty("First line to replace or delete"),
+					"end_line":    integerProperty("Last line to replace or delete (defaults to start_line)"),
+					"insert_line": integerProperty("Insert new_text before this line; one past the last line appends"),
+				}),
+			},
+			"dry_run": booleanProperty("Return the diff without changing the file"),
+			"backup":  booleanProperty("Copy the file to <path>.backup first (default true)"),
+		}),
 	}
 
 	tr.tools["list_files"] = &BuiltinTool{
 		name:        "list_files",
 		description: "List files in a directory",
 		executor:    tr.executeListFiles,
+		parameters: objectSchema(nil, map[string]interface{}{
+			"path": stringProperty("Directory to list (defaults to the working directory)"),
+		}),
+	}
+
+	tr.tools["find_files"] = &BuiltinTool{
+		name:        "find_files",
+		description: "Find files by .gitignore-style glob, skipping ignored and blocked paths",
+		executor:    tr.executeFindFiles,
+		parameters: objectSchema([]string{"pattern"}, map[string]interface{}{
+			"pattern":         stringProperty("Glob in .gitignore syntax such as *.go or cmd/**/main.go; a list of globs is also accepted"),
+			"path":            stringProperty("Directory to search (defaults to the working directory)"),
+			"type":            enumProperty("Kind of entry to return (default file)", "file", "dir", "any"),
+			"max_results":     integerProperty("Maximum number of paths to return (default 500)"),
+			"include_ignored": booleanProperty("Also search paths that .gitignore files ignore"),
+		}),
+	}
+
+	tr.tools["search_code"] = &BuiltinTool{
+		name:        "search_code",
+		description: "Search file contents by regular expression, returning the path, line and text of each match",
+		executor:    tr.executeSearchCode,
+		parameters: objectSchema([]string{"pattern"}, map[string]interface{}{
+			"pattern":         stringProperty("Regular expression (RE2 syntax) to search for"),
+			"literal":         booleanProperty("Treat pattern as plain text"),
+			"ignore_case":     booleanProperty("Match case-insensitively"),
+			"path":            stringProperty("Directory to search (defaults to the working directory)"),
+			"include":         stringProperty("Only search files matching this .gitignore-style glob; a list is also accepted"),
+			"exclude":         stringProperty("Skip files matching this .gitignore-style glob; a list is also accepted"),
+			"context_lines":   integerProperty("Lines of context to return before and after each match (at most 10)"),
+			"max_matches":     integerProperty("Maximum number of matches to return (default 100)"),
+			"include_ignored": booleanProperty("Also search paths that .gitignore files ignore"),
+		}),
 	}
 
 	// Shell operations
@@ -81,6 +166,10 @@ func (tr *ToolRegistry) registerBuiltinTools() {
 		name:        "shell_command",
 		description: "Execute a shell command",
 		executor:    tr.executeShellCommand,
+		parameters: objectSchema([]string{"command"}, map[string]interface{}{
+			"command": stringProperty("Command to run with bash -c"),
+			"timeout": integerProperty("Timeout in seconds"),
+		}),
 	}
 
 	// User interaction
@@ -88,6 +177,32 @@ func (tr *ToolRegistry) registerBuiltinTools() {
 		name:        "ask_user",
 		description: "Ask user for input",
 		executor:    tr.executeAskUser,
+		parameters: objectSchema([]string{"question"}, map[string]interface{}{
+			"question":         stringProperty("Question to show the user"),
+			"default_response": stringProperty("Answer to use when input is closed"),
+			"timeout":          integerProperty("Timeout in seconds"),
+		}),
+	}
+
+	// Network
+	tr.tools["http_request"] = &BuiltinTool{
+		name:        "http_request",
+		description: "Send an HTTP request to a host in security.allowed_hosts, returning the status, headers and body (parsed when JSON)",
+		executor:    tr.executeHTTPRequest,
+		parameters: objectSchema([]string{"url"}, map[string]interface{}{
+			"url":                  stringProperty("http or https URL"),
+			"method":               stringProperty("HTTP method (default GET, or POST when a body is given)"),
+			"headers":              map[string]interface{}{"type": "object", "description": "Request headers"},
+			"query":                map[string]interface{}{"type": "object", "description": "Query parameters added to the URL; list values repeat the parameter"},
+			"body":                 map[string]interface{}{"description": "Request body; strings are sent as they are, other values as JSON"},
+			"body_type":            enumProperty("Encoding of the body", "json", "form", "text"),
+			"timeout":              integerProperty("Timeout of each attempt in seconds (default 30)"),
+			"retries":              integerProperty("Retries after a 429 or 5xx response, or a failed connection for idempotent methods (default 2)"),
+			"retry_non_idempotent": booleanProperty("Also retry POST and PATCH after a failed connection or timeout"),
+			"retry_delay_ms":       integerProperty("Delay before the first retry, doubling after each (default 500)"),
+			"max_response_bytes":   integerProperty("Response body size cap; longer bodies are truncated (default 5MB)"),
+			"fail_on_error_status": booleanProperty("Fail on 4xx and 5xx responses (default true)"),
+		}),
 	}
 
 	// Data processing
@@ -95,43 +210,120 @@ func (tr *ToolRegistry) registerBuiltinTools() {
 		name:        "json_parse",
 		description: "Parse JSON data",
 		executor:    tr.executeJSONParse,
+		parameters: objectSchema([]string{"json"}, map[string]interface{}{
+			"json": stringProperty("JSON text to parse"),
+		}),
 	}
 
 	tr.tools["json_format"] = &BuiltinTool{
 		name:        "json_format",
 		description: "Format data as JSON",
 		executor:    tr.executeJSONFormat,
+		parameters: objectSchema([]string{"data"}, map[string]interface{}{
+			"data":    map[string]interface{}{"description": "Value to format"},
+			"indent":  stringProperty("Indentation string"),
+			"compact": booleanProperty("Produce compact output"),
+		}),
 	}
 
 	// Git operations
 	tr.tools["git_status"] = &BuiltinTool{
 		name:        "git_status",
-		description: "Get git repository status",
+		description: "Get git repository status: branch, ahead/behind counts and staged, unstaged, untracked and conflicted files",
 		executor:    tr.executeGitStatus,
+		parameters:  objectSchema(nil, map[string]interface{}{}),
+	}
+
+	tr.tools["git_log"] = &BuiltinTool{
+		name:        "git_log",
+		description: "List commits, newest first",
+		executor:    tr.executeGitLog,
+		parameters: objectSchema(nil, map[string]interface{}{
+			"limit":  integerProperty("Maximum number of commits (default 20, 0 for all)"),
+			"ref":    stringProperty("Revision or range to list, such as main or v1.0..HEAD"),
+			"path":   stringProperty("Only commits touching this path"),
+			"author": stringProperty("Only commits whose author matches this pattern"),
+			"since":  stringProperty("Only commits after this date, such as 2024-01-31 or \"2 weeks ago\""),
+		}),
+	}
+
+	tr.tools["git_branch"] = &BuiltinTool{
+		name:        "git_branch",
+		description: "List branches and the current one, optionally creating a branch first",
+		executor:    tr.executeGitBranch,
+		parameters: objectSchema(nil, map[string]interface{}{
+			"name": stringProperty("Branch to create at HEAD"),
+		}),
+	}
+
+	tr.tools["git_checkout"] = &BuiltinTool{
+		name:        "git_checkout",
+		description: "Switch to a branch",
+		executor:    tr.executeGitCheckout,
+		parameters: objectSchema([]string{"branch"}, map[string]interface{}{
+			"branch": stringProperty("Branch to switch to"),
+			"create": booleanProperty("Create the branch at HEAD first"),
+		}),
+	}
+
+	tr.tools["git_show"] = &BuiltinTool{
+		name:        "git_show",
+		description: "Show a commit with its changed files and patch",
+		executor:    tr.executeGitShow,
+		parameters: objectSchema(nil, map[string]interface{}{
+			"rev":  stringProperty("Commit to show (defaults to HEAD)"),
+			"diff": booleanProperty("Include the patch (default true)"),
+		}),
+	}
+
+	tr.tools["git_blame"] = &BuiltinTool{
+		name:        "git_blame",
+		description: "Show the commit and author that last changed each line of a file",
+		executor:    tr.executeGitBlame,
+		parameters: objectSchema([]string{"path"}, map[string]interface{}{
+			"path":       stringProperty("File to blame"),
+			"start_line": integerProperty("First line to blame"),
+			"end_line":   integerProperty("Last line to blame"),
+		}),
 	}
 
 	tr.tools["git_diff"] = &BuiltinTool{
 		name:        "git_diff",
 		description: "Get git diff for staged changes",
 		executor:    tr.executeGitDiff,
+		parameters: objectSchema(nil, map[string]interface{}{
+			"type": enumProperty("Which changes to diff", "staged", "unstaged", "all"),
+		}),
 	}
 
 	tr.tools["git_commit"] = &BuiltinTool{
 		name:        "git_commit",
 		description: "Execute git commit with message",
 		executor:    tr.executeGitCommit,
+		parameters: objectSchema([]string{"message"}, map[string]interface{}{
+			"message": stringProperty("Commit message"),
+		}),
 	}
 
 	tr.tools["embedding_ingest"] = &BuiltinTool{
 		name:        "embedding_ingest",
 		description: "Build embeddings for workspace files",
 		executor:    tr.executeEmbeddingIngest,
+		parameters: objectSchema([]string{"source_name"}, map[string]interface{}{
+			"source_name": stringProperty("Name of the embedding data source"),
+		}),
 	}
 
 	tr.tools["embedding_search"] = &BuiltinTool{
 		name:        "embedding_search",
 		description: "Search files using semantic similarity",
 		executor:    tr.executeEmbeddingSearch,
+		parameters: objectSchema([]string{"query", "source_name"}, map[string]interface{}{
+			"query":          stringProperty("Text to search for"),
+			"source_name":    stringProperty("Name of the embedding data source"),
+			"limit":          integerProperty("Maximum number of results"),
+			"min_similarity": numberProperty("Minimum similarity between 0 and 1"),
+		}),
 	}
 }
 
@@ -194,10 +386,63 @@ func (bt *BuiltinTool) Description() string {
 	return bt.description
 }
 
+// Parameters returns the JSON Schema for the tool's parameters
+func (bt *BuiltinTool) Parameters() map[string]interface{} {
+	if bt.parameters == nil {
+		return objectSchema(nil, map[string]interface{}{})
+	}
+	return bt.parameters
+}
+
 func (bt *BuiltinTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	return bt.executor(ctx, params)
 }
 
+// ToolSchema returns the JSON Schema describing a tool's parameters. Tools
+// that don't implement SchemaTool accept any object.
+func ToolSchema(tool GenericTool) map[string]interface{} {
+	if schemaTool, ok := tool.(SchemaTool); ok {
+		return schemaTool.Parameters()
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": true,
+	}
+}
+
+// Schema helpers for built-in tool parameters
+
+func objectSchema(required []string, properties map[string]interface{}) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func stringProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func integerProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "description": description}
+}
+
+func numberProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "number", "description": description}
+}
+
+func booleanProperty(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "boolean", "description": description}
+}
+
+func enumProperty(description string, values ...string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description, "enum": values}
+}
+
 // Built-in tool executors
 func (tr *ToolRegistry) executeReadFile(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	path, ok := params["path"].(string)
@@ -541,20 +786,64 @@ func (tr *ToolRegistry) validateFilePath(path string) error {
 		return fmt.Errorf("invalid path: %w", err)
 	}
 
-	// TODO: Check against allowed_paths from security configuration
-	// For now, allow paths in current directory and subdirectories
+	if tr.blockedPath(absPath) {
+		return fmt.Errorf("path blocked by security configuration: %s", absPath)
+	}
+
+	if tr.security != nil && tr.security.Enabled {
+		// Configured allowed paths replace the working directory default
+		// when security is enabled; blocked paths always apply
+		if len(tr.security.AllowedPaths) > 0 {
+			for _, allowed := range tr.security.AllowedPaths {
+				if pathWithin(absPath, allowed) {
+					return nil
+				}
+			}
+			return fmt.Errorf("path outside allowed directories: %s", absPath)
+		}
+	}
+
+	// Otherwise allow paths in the current directory and subdirectories
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
 	}
 
-	if !strings.HasPrefix(absPath, currentDir) {
+	if !pathWithin(absPath, currentDir) {
 		return fmt.Errorf("path outside allowed directories: %s", absPath)
 	}
 
 	return nil
 }
 
+// pathWithin reports whether the absolute path is dir or inside it; a
+// relative dir is resolved against the working directory. A dir with glob
+// characters, such as "./output/*", matches a path when the path or one of
+// its parent directories matches the pattern.
+func pathWithin(path, dir string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	if strings.ContainsAny(dir, "*?[") {
+		for candidate := path; ; {
+			if matched, _ := filepath.Match(absDir, candidate); matched {
+				return true
+			}
+			parent := filepath.Dir(candidate)
+			if parent == candidate {
+				return false
+			}
+			candidate = parent
+		}
+	}
+	rel, err := filepath.Rel(absDir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // isPathAllowed checks if a path is allowed (simpler version of validateFilePath)
 func (tr *ToolRegistry) isPathAllowed(path string) bool {
 	err := tr.validateFilePath(path)
@@ -585,14 +874,6 @@ func (tr *ToolRegistry) copyFile(src, dst string) error {
 
 // Git tool implementations
 
-func (tr *ToolRegistry) executeGitStatus(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	// Execute git status command using shell_command
-	return tr.executeShellCommand(ctx, map[string]interface{}{
-		"command": "git status --porcelain",
-		"timeout": 30.0,
-	})
-}
-
 func (tr *ToolRegistry) executeGitDiff(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	// Default to staged changes, but allow customization
 	command := "git diff --staged"
@@ -0,0 +1,52 @@
+package generic
+
+import (
+	"context"
+	"testing"
+)
+
+// The allowed_paths below are copied from the configs in examples/
+func TestValidateFilePathAllowedPaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		security *Security
+		path     string
+		allowed  bool
+	}{
+		{"web_scraper_demo output file", &Security{Enabled: true, AllowedPaths: []string{"./output/*"}}, "./output/scraped_web_content.html", true},
+		{"web_scraper_demo nested output file", &Security{Enabled: true, AllowedPaths: []string{"./output/*"}}, "output/2024/page.html", true},
+		{"web_scraper_demo outside output", &Security{Enabled: true, AllowedPaths: []string{"./output/*"}}, "notes.txt", false},
+		{"web_scraper_demo similar prefix", &Security{Enabled: true, AllowedPaths: []string{"./output/*"}}, "output2/page.html", false},
+		{"web_scraper data file", &Security{Enabled: true, AllowedPaths: []string{"./output/*", "./data/*", "./examples/*"}}, "data/items.json", true},
+		{"data_analyzer report", &Security{Enabled: true, AllowedPaths: []string{"./data", "./reports", "./.agent"}}, "reports/summary.md", true},
+		{"data_analyzer blocked system path", &Security{Enabled: true, AllowedPaths: []string{"./data", "./reports", "./.agent"}, BlockedPaths: []string{"/etc", "/usr", "/var"}}, "/etc/passwd", false},
+		{"git_workflow_assistant working directory", &Security{Enabled: true, AllowedPaths: []string{".git/", "./"}}, "pkg/generic/tool_registry.go", true},
+		{"allow list ignored while security is disabled", &Security{AllowedPaths: []string{"./output/*"}}, "notes.txt", true},
+		{"blocked paths apply while security is disabled", &Security{BlockedPaths: []string{"secrets/*"}}, "secrets/key.txt", false},
+		{"working directory default while security is disabled", &Security{AllowedPaths: []string{"/"}}, "/etc/hosts", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newPatchTestRegistry(t, tt.security)
+			err := registry.validateFilePath(tt.path)
+			if (err == nil) != tt.allowed {
+				t.Errorf("Expected allowed %v for %s, got %v", tt.allowed, tt.path, err)
+			}
+		})
+	}
+}
+
+func TestWriteFileExampleAllowedPaths(t *testing.T) {
+	registry := newPatchTestRegistry(t, &Security{Enabled: true, AllowedPaths: []string{"./output/*"}, MaxFileSize: "5MB"})
+
+	_, err := registry.executeWriteFile(context.Background(), map[string]interface{}{
+		"path": "./output/scraped_web_content.html", "content": "<html></html>", "create_directories": true,
+	})
+	if err != nil {
+		t.Fatalf("write_file to the demo's output path failed: %v", err)
+	}
+	if got := readPatchTestFile(t, "output/scraped_web_content.html"); got != "<html></html>" {
+		t.Errorf("Unexpected content %q", got)
+	}
+}
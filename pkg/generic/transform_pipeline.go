@@ -95,14 +95,35 @@ func (tp *TransformPipeline) executeTransform(transform Transform, stepResults m
 		return fmt.Errorf("transformer '%s' not found", transform.Transform)
 	}
 
+	// Resolve params that name further sources
+	params := transform.Params
+	if sourced, ok := transformer.(SourceParamTransformer); ok {
+		params = make(map[string]interface{}, len(transform.Params))
+		for k, v := range transform.Params {
+			params[k] = v
+		}
+		for _, name := range sourced.SourceParams() {
+			if ref, ok := params[name].(string); ok {
+				if params[name], err = tp.resolveSource(ref, stepResults, execCtx); err != nil {
+					return fmt.Errorf("failed to resolve %s source '%s': %w", name, ref, err)
+				}
+			}
+		}
+	}
+
 	// Validate parameters
-	err = transformer.ValidateParams(transform.Params)
+	err = transformer.ValidateParams(params)
 	if err != nil {
 		return fmt.Errorf("invalid parameters for transformer '%s': %w", transform.Transform, err)
 	}
 
 	// Execute transformation
-	result, err := transformer.Transform(sourceData, transform.Params)
+	var result interface{}
+	if contextual, ok := transformer.(ExecutionTransformer); ok {
+		result, err = contextual.TransformInContext(execCtx, sourceData, params)
+	} else {
+		result, err = transformer.Transform(sourceData, params)
+	}
 	if err != nil {
 		return fmt.Errorf("transformation '%s' failed: %w", transform.Transform, err)
 	}
@@ -119,8 +140,17 @@ func (tp *TransformPipeline) executeTransform(transform Transform, stepResults m
 	return nil
 }
 
-// resolveSource resolves source data using template expressions
+// resolveSource resolves source data using template expressions. Lists and
+// maps are passed on as they are so record transforms keep their structure;
+// other values are rendered as text.
 func (tp *TransformPipeline) resolveSource(source string, stepResults map[string]*StepResult, execCtx *ExecutionContext) (interface{}, error) {
+	if value, err := tp.templateEngine.resolveExpression(strings.TrimSpace(source), stepResults, execCtx); err == nil {
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return value, nil
+		}
+	}
+
 	// Use template engine to resolve the source expression
 	sourceTemplate := "{" + source + "}"
 	resolved, err := tp.templateEngine.RenderTemplate(sourceTemplate, stepResults, execCtx)
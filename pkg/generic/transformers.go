@@ -19,6 +19,43 @@ type Transformer interface {
 	Description() string
 }
 
+// SourceParamTransformer is implemented by transformers that combine their
+// input with further data, such as join. The pipeline resolves the string
+// values of the named params as sources, like the transform's own source,
+// before validating and calling the transformer.
+type SourceParamTransformer interface {
+	Transformer
+	SourceParams() []string
+}
+
+// textInput gives the text of a transformer's input. Sources that resolve to
+// lists or maps are handed to transformers as they are, so text transformers
+// render them here: a list becomes one line per item, and maps and other
+// values become JSON.
+func textInput(input interface{}) (string, error) {
+	switch v := input.(type) {
+	case string:
+		return v, nil
+	case []interface{}:
+		lines := make([]string, len(v))
+		for i, item := range v {
+			line, err := textInput(item)
+			if err != nil {
+				return "", err
+			}
+			lines[i] = line
+		}
+		return strings.Join(lines, "\n"), nil
+	case []string:
+		return strings.Join(v, "\n"), nil
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", fmt.Errorf("input must be text, got %T", input)
+	}
+	return string(data), nil
+}
+
 // TransformRegistry manages available transformers
 type TransformRegistry struct {
 	transformers map[string]Transformer
@@ -71,6 +108,11 @@ func (tr *TransformRegistry) registerBuiltinTransformers() {
 	tr.RegisterTransformer(&DataSorter{})
 	tr.RegisterTransformer(&RegexExtractor{})
 	tr.RegisterTransformer(&StringProcessor{})
+	tr.RegisterTransformer(&QueryTransformer{})
+	tr.RegisterTransformer(&MarkdownExtractor{})
+	tr.RegisterTransformer(&DiffParser{})
+	tr.registerRelationalTransformers()
+	tr.registerFormatTransformers()
 }
 
 // Built-in Transformers
@@ -89,9 +131,9 @@ func (le *LineExtractor) ValidateParams(params map[string]interface{}) error {
 }
 
 func (le *LineExtractor) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
-	inputStr, ok := input.(string)
-	if !ok {
-		return nil, fmt.Errorf("input must be string, got %T", input)
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
 	}
 
 	pattern, ok := params["pattern"].(string)
@@ -141,13 +183,13 @@ func (jp *JSONParser) ValidateParams(params map[string]interface{}) error {
 }
 
 func (jp *JSONParser) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
-	inputStr, ok := input.(string)
-	if !ok {
-		return nil, fmt.Errorf("input must be string, got %T", input)
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
 	}
 
 	var result interface{}
-	err := json.Unmarshal([]byte(inputStr), &result)
+	err = json.Unmarshal([]byte(inputStr), &result)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
@@ -580,9 +622,9 @@ func (re *RegexExtractor) ValidateParams(params map[string]interface{}) error {
 }
 
 func (re *RegexExtractor) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
-	inputStr, ok := input.(string)
-	if !ok {
-		return nil, fmt.Errorf("input must be string, got %T", input)
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
 	}
 
 	pattern := params["pattern"].(string)
@@ -629,9 +671,9 @@ func (sp *StringProcessor) ValidateParams(params map[string]interface{}) error {
 }
 
 func (sp *StringProcessor) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
-	inputStr, ok := input.(string)
-	if !ok {
-		return nil, fmt.Errorf("input must be string, got %T", input)
+	inputStr, err := textInput(input)
+	if err != nil {
+		return nil, err
 	}
 
 	operation := params["operation"].(string)
@@ -666,3 +708,24 @@ func (sp *StringProcessor) Transform(input interface{}, params map[string]interf
 		return nil, fmt.Errorf("unsupported operation: %s", operation)
 	}
 }
+
+// QueryTransformer selects and reshapes data with a JMESPath or JSONPath
+// expression; string input is decoded as JSON first
+type QueryTransformer struct{}
+
+func (qt *QueryTransformer) Name() string { return "query" }
+func (qt *QueryTransformer) Description() string {
+	return "Query structured data with a JMESPath or JSONPath ($...) expression"
+}
+
+func (qt *QueryTransformer) ValidateParams(params map[string]interface{}) error {
+	expression, ok := params["expression"].(string)
+	if !ok || expression == "" {
+		return fmt.Errorf("expression parameter is required")
+	}
+	return nil
+}
+
+func (qt *QueryTransformer) Transform(input interface{}, params map[string]interface{}) (interface{}, error) {
+	return evaluateQuery(params["expression"].(string), input)
+}
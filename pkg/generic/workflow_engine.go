@@ -2,23 +2,48 @@ package generic
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"math/rand"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/alantheprice/agent/pkg/interfaces/types"
+	"github.com/alantheprice/agent/pkg/providers/prompts"
 )
 
 // WorkflowEngine executes workflows
 type WorkflowEngine struct {
 	toolRegistry      *ToolRegistry
 	llmClient         *LLMClient
+	llmPool           *LLMClientPool
 	validator         *Validator
 	templateEngine    *TemplateEngine
 	transformPipeline *TransformPipeline
+	prompts           *prompts.Manager
 	logger            *slog.Logger
+	output            io.Writer
+	interactive       bool
+	strictTemplates   bool
+	builtinSteps      map[string]builtinStep
+	externalSteps     map[string]*externalRunner
+}
+
+// stepExecutor runs a step of a built-in type; metadata is the step result's
+// metadata
+type stepExecutor func(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, metadata map[string]interface{}) (interface{}, error)
+
+// builtinStep is a built-in step type. parallel marks the types a parallel
+// step can run.
+type builtinStep struct {
+	execute  stepExecutor
+	parallel bool
 }
 
 // NewWorkflowEngine creates a new workflow engine
@@ -27,14 +52,122 @@ func NewWorkflowEngine(workflows []Workflow, toolRegistry *ToolRegistry, llmClie
 	transformRegistry := NewTransformRegistry(logger)
 	transformPipeline := NewTransformPipeline(transformRegistry, templateEngine, logger)
 
-	return &WorkflowEngine{
+	engine := &WorkflowEngine{
 		toolRegistry:      toolRegistry,
 		llmClient:         llmClient,
+		llmPool:           NewLLMClientPool(llmClient, logger),
 		validator:         validator,
 		templateEngine:    templateEngine,
 		transformPipeline: transformPipeline,
+		prompts:           prompts.NewManager(defaultPromptsDir),
 		logger:            logger,
-	}, nil
+		output:            os.Stdout,
+	}
+	engine.builtinSteps = engine.newBuiltinSteps()
+	transformRegistry.registerLLMTransformers(engine)
+	transformRegistry.RegisterTransformer(&Reshaper{templates: templateEngine})
+	if toolRegistry != nil {
+		transformRegistry.RegisterTransformer(&CSVParser{validatePath: toolRegistry.validateFilePath})
+	}
+
+	return engine, nil
+}
+
+// newBuiltinSteps lists the built-in step types. It is the one list of them:
+// executeStep, parallel steps and the check that external step types do not
+// replace a built-in one all use it.
+func (we *WorkflowEngine) newBuiltinSteps() map[string]builtinStep {
+	// withoutMetadata adapts executors that do not record metadata
+	withoutMetadata := func(execute func(context.Context, Step, *ExecutionContext, map[string]*StepResult) (interface{}, error)) stepExecutor {
+		return func(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, _ map[string]interface{}) (interface{}, error) {
+			return execute(ctx, step, execCtx, previousResults)
+		}
+	}
+
+	return map[string]builtinStep{
+		"tool":           {execute: withoutMetadata(we.executeToolStep), parallel: true},
+		"llm":            {execute: we.executeLLMStep, parallel: true},
+		"llm_display":    {execute: we.executeLLMDisplayStep, parallel: true},
+		"chat":           {execute: we.executeChatStep, parallel: true},
+		"llm_with_tools": {execute: withoutMetadata(we.executeLLMWithToolsStep)},
+		"display":        {execute: withoutMetadata(we.executeDisplayStep), parallel: true},
+		"script":         {execute: withoutMetadata(we.executeScriptStep)},
+		"condition":      {execute: withoutMetadata(we.executeConditionStep), parallel: true},
+		"loop": {execute: func(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, metadata map[string]interface{}) (interface{}, error) {
+			output, err := we.executeLoopStep(ctx, step, execCtx, previousResults)
+			// Add loop metadata
+			if loopResult, ok := output.(*LoopResult); ok && err == nil {
+				metadata["iterations"] = loopResult.Iterations
+				metadata["break_reason"] = loopResult.BreakReason
+			}
+			return output, err
+		}},
+		"parallel": {execute: withoutMetadata(we.executeParallelStep)},
+		"http":     {execute: withoutMetadata(we.executeHTTPStep), parallel: true},
+	}
+}
+
+// SetInteractive enables interactive mode, in which llm steps stream their
+// tokens to the terminal unless the step sets "stream": false
+func (we *WorkflowEngine) SetInteractive(interactive bool) {
+	we.interactive = interactive
+}
+
+// SetStrictTemplates makes unresolved template references fail steps instead
+// of logging a warning. Steps override it with "strict_templates".
+func (we *WorkflowEngine) SetStrictTemplates(strict bool) {
+	we.strictTemplates = strict
+}
+
+// RegisterTemplateFunction adds a function to the templates of every step
+func (we *WorkflowEngine) RegisterTemplateFunction(name string, fn TemplateFunction, signature FunctionSignature) error {
+	return we.templateEngine.RegisterFunction(name, fn, signature)
+}
+
+// RegisterTemplateMacros adds config-defined macros to the templates of every step
+func (we *WorkflowEngine) RegisterTemplateMacros(macros map[string]TemplateMacro) error {
+	return we.templateEngine.RegisterMacros(macros)
+}
+
+// stepTemplates returns the template engine for a step, strict when the step
+// or the agent asks for strict templates
+func (we *WorkflowEngine) stepTemplates(step Step) *TemplateEngine {
+	strict := we.strictTemplates
+	if value, ok := step.Config["strict_templates"].(bool); ok {
+		strict = value
+	}
+	return we.templateEngine.WithStrict(strict)
+}
+
+// renderConfigValue renders the strings in a step config value, including
+// those nested in maps and lists, as templates
+func (we *WorkflowEngine) renderConfigValue(step Step, value interface{}, previousResults map[string]*StepResult, execCtx *ExecutionContext) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return we.stepTemplates(step).RenderTemplate(v, previousResults, execCtx)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			renderedItem, err := we.renderConfigValue(step, item, previousResults, execCtx)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = renderedItem
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			renderedItem, err := we.renderConfigValue(step, item, previousResults, execCtx)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = renderedItem
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
 }
 
 // Execute executes a workflow
@@ -144,8 +277,15 @@ func (we *WorkflowEngine) executeStep(ctx context.Context, step Step, execCtx *E
 		Metadata:      make(map[string]interface{}),
 	}
 
+	step, err := we.resolvePromptRefs(step, result.Metadata)
+	if err != nil {
+		result.Success = false
+		result.Error = err
+		return result, err
+	}
+
 	// Execute pre-transforms (context transforms)
-	err := we.transformPipeline.ExecutePreTransforms(step, previousResults, execCtx)
+	err = we.transformPipeline.ExecutePreTransforms(step, previousResults, execCtx)
 	if err != nil {
 		result.Success = false
 		result.Error = err
@@ -188,33 +328,11 @@ func (we *WorkflowEngine) executeStep(ctx context.Context, step Step, execCtx *E
 		var output interface{}
 		var err error
 
-		switch step.Type {
-		case "tool":
-			output, err = we.executeToolStep(ctx, step, execCtx, previousResults)
-		case "llm":
-			output, err = we.executeLLMStep(ctx, step, execCtx, previousResults)
-		case "llm_display":
-			output, err = we.executeLLMDisplayStep(ctx, step, execCtx, previousResults)
-		case "llm_with_tools":
-			output, err = we.executeLLMWithToolsStep(ctx, step, execCtx, previousResults)
-		case "display":
-			output, err = we.executeDisplayStep(ctx, step, execCtx, previousResults)
-		case "script":
-			output, err = we.executeScriptStep(ctx, step, execCtx, previousResults)
-		case "condition":
-			output, err = we.executeConditionStep(ctx, step, execCtx, previousResults)
-		case "loop":
-			output, err = we.executeLoopStep(ctx, step, execCtx, previousResults)
-			// Add loop metadata
-			if err == nil && output != nil {
-				if loopResult, ok := output.(*LoopResult); ok {
-					result.Metadata["iterations"] = loopResult.Iterations
-					result.Metadata["break_reason"] = loopResult.BreakReason
-				}
-			}
-		case "parallel":
-			output, err = we.executeParallelStep(ctx, step, execCtx, previousResults)
-		default:
+		if builtin, ok := we.builtinSteps[step.Type]; ok {
+			output, err = builtin.execute(ctx, step, execCtx, previousResults, result.Metadata)
+		} else if runner, ok := we.externalSteps[step.Type]; ok {
+			output, err = we.executeExternalStep(ctx, runner, step, execCtx, previousResults)
+		} else {
 			err = fmt.Errorf("unsupported step type: %s", step.Type)
 		}
 
@@ -271,7 +389,11 @@ func (we *WorkflowEngine) executeToolStep(ctx context.Context, step Step, execCt
 		for k, v := range stepParams {
 			// Process string values through template engine
 			if stringVal, ok := v.(string); ok {
-				renderedVal, err := we.templateEngine.RenderTemplate(stringVal, previousResults, execCtx)
+				renderedVal, err := we.stepTemplates(step).RenderTemplate(stringVal, previousResults, execCtx)
+				var unresolved *UnresolvedReferencesError
+				if errors.As(err, &unresolved) {
+					return nil, fmt.Errorf("failed to render tool parameter %s: %w", k, err)
+				}
 				if err != nil {
 					we.logger.Warn("Failed to render template in tool parameter", "step", step.Name, "param", k, "error", err)
 					params[k] = v // Use original value if template fails
@@ -293,83 +415,322 @@ func (we *WorkflowEngine) executeToolStep(ctx context.Context, step Step, execCt
 }
 
 // executeLLMStep executes an LLM step
-func (we *WorkflowEngine) executeLLMStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult) (interface{}, error) {
+func (we *WorkflowEngine) executeLLMStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, metadata map[string]interface{}) (interface{}, error) {
+	format, err := parseResponseFormat(step.Config["response_format"])
+	if err != nil {
+		return nil, err
+	}
+	if format != nil {
+		return we.executeStructuredLLMStep(ctx, step, execCtx, previousResults, metadata, *format)
+	}
+
+	var stream io.Writer
+	if we.shouldStream(step) {
+		stream = we.output
+	}
+
+	response, err := we.completeLLMStep(ctx, step, execCtx, previousResults, stream)
+	if err != nil {
+		return nil, err
+	}
+	if stream != nil {
+		fmt.Fprintln(we.output)
+	}
+
+	we.recordLLMUsage(execCtx, metadata, response)
+
+	return response.Content, nil
+}
+
+// executeStructuredLLMStep runs an llm step with a response_format and returns
+// the decoded JSON instead of the raw reply, so later steps can address its
+// fields directly
+func (we *WorkflowEngine) executeStructuredLLMStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, metadata map[string]interface{}, format types.ResponseFormat) (interface{}, error) {
+	client, err := we.llmClientForStep(step)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := we.buildLLMMessages(ctx, step, client, execCtx, previousResults)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRepairs := defaultStructuredRepairs
+	if value, ok := step.Config["max_repairs"].(float64); ok && value >= 0 {
+		maxRepairs = int(value)
+	}
+
+	value, response, err := client.ChatStructured(ctx, messages, format, maxRepairs)
+	if err != nil {
+		return nil, err
+	}
+
+	we.recordLLMUsage(execCtx, metadata, response)
+	metadata["response_format"] = format.Type
+	metadata["repairs"] = response.Metadata["repairs"]
+
+	return value, nil
+}
+
+// executeLLMDisplayStep executes an LLM step and streams the output to the user
+func (we *WorkflowEngine) executeLLMDisplayStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, metadata map[string]interface{}) (interface{}, error) {
+	// Check the prompt before printing the header so a misconfigured step
+	// doesn't leave a dangling banner on the terminal
+	if _, ok := step.Config["prompt"].(string); !ok {
+		return nil, fmt.Errorf("prompt not specified in step config")
+	}
+
+	fmt.Fprintln(we.output, "=== LLM ANALYSIS RESULTS ===")
+	fmt.Fprintln(we.output)
+
+	response, err := we.completeLLMStep(ctx, step, execCtx, previousResults, we.output)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintln(we.output)
+	fmt.Fprintln(we.output, "=== END ANALYSIS RESULTS ===")
+	fmt.Fprintln(we.output)
+
+	we.recordLLMUsage(execCtx, metadata, response)
+
+	return response.Content, nil
+}
+
+// completeLLMStep renders the step prompts and sends them to the LLM. When
+// stream is non-nil, response tokens are written to it as they arrive.
+func (we *WorkflowEngine) completeLLMStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, stream io.Writer) (*LLMResponse, error) {
+	client, err := we.llmClientForStep(step)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := we.buildLLMMessages(ctx, step, client, execCtx, previousResults)
+	if err != nil {
+		return nil, err
+	}
+
+	if stream != nil {
+		return client.ChatStream(ctx, messages, stream)
+	}
+	return client.Chat(ctx, messages)
+}
+
+// buildLLMMessages renders the step's prompt and system prompt into messages
+// that fit the model's context window. The step's system prompt wins over the
+// agent-wide default.
+func (we *WorkflowEngine) buildLLMMessages(ctx context.Context, step Step, client *LLMClient, execCtx *ExecutionContext, previousResults map[string]*StepResult) ([]Message, error) {
 	prompt, ok := step.Config["prompt"].(string)
 	if !ok {
 		return nil, fmt.Errorf("prompt not specified in step config")
 	}
 
-	// Template rendering for prompt with context variables
-	renderedPrompt, err := we.templateEngine.RenderTemplate(prompt, previousResults, execCtx)
+	var parts []*promptPart
+
+	systemPrompt, _ := step.Config["system_prompt"].(string)
+	if systemPrompt == "" {
+		systemPrompt = client.config.SystemPrompt
+	}
+	if systemPrompt != "" {
+		part, err := we.templatedPart(step, "system", systemPrompt, previousResults, execCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render system prompt template: %w", err)
+		}
+		parts = append(parts, part)
+	}
+
+	part, err := we.templatedPart(step, "user", prompt, previousResults, execCtx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render prompt template: %w", err)
 	}
+	parts = append(parts, part)
 
-	// Check for system prompt in step config
-	var response *LLMResponse
+	budgeter, err := we.newContextBudgeter(step, client, execCtx, ContextStrategyTruncate)
+	if err != nil {
+		return nil, err
+	}
+	if budgeter == nil {
+		return renderParts(parts), nil
+	}
+	return budgeter.fit(ctx, parts)
+}
 
-	if systemPrompt, ok := step.Config["system_prompt"].(string); ok && systemPrompt != "" {
-		// Render system prompt template if provided
-		renderedSystemPrompt, err := we.templateEngine.RenderTemplate(systemPrompt, previousResults, execCtx)
+// llmClientForStep picks the client for a step. Steps may name a provider and
+// model directly, or a model_role that is looked up in llm.specialized_models,
+// and may override temperature and max_tokens.
+func (we *WorkflowEngine) llmClientForStep(step Step) (*LLMClient, error) {
+	provider, _ := step.Config["provider"].(string)
+	model, _ := step.Config["model"].(string)
+
+	if role, ok := step.Config["model_role"].(string); ok && role != "" {
+		if provider != "" || model != "" {
+			return nil, fmt.Errorf("step %s sets model_role together with provider or model", step.Name)
+		}
+		var err error
+		provider, model, err = we.llmPool.ResolveModelRole(role)
 		if err != nil {
-			return nil, fmt.Errorf("failed to render system prompt template: %w", err)
+			return nil, err
 		}
-		response, err = we.llmClient.CompleteWithSystem(ctx, renderedSystemPrompt, renderedPrompt)
-	} else {
-		response, err = we.llmClient.Complete(ctx, renderedPrompt)
 	}
+
+	client, err := we.llmPool.Get(provider, model)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update metrics
+	temperature, hasTemperature := step.Config["temperature"].(float64)
+	maxTokens, hasMaxTokens := step.Config["max_tokens"].(float64)
+	if !hasTemperature && !hasMaxTokens {
+		return client, nil
+	}
+
+	if !hasTemperature {
+		temperature = client.config.Temperature
+	}
+	tokens := client.config.MaxTokens
+	if hasMaxTokens {
+		tokens = int(maxTokens)
+	}
+
+	return client.WithParameters(temperature, tokens), nil
+}
+
+// shouldStream reports whether an llm step should stream tokens to the
+// terminal. An explicit "stream" setting wins over interactive mode.
+func (we *WorkflowEngine) shouldStream(step Step) bool {
+	if stream, ok := step.Config["stream"].(bool); ok {
+		return stream
+	}
+	return we.interactive
+}
+
+// recordLLMUsage adds the response usage to the execution metrics and step metadata
+func (we *WorkflowEngine) recordLLMUsage(execCtx *ExecutionContext, metadata map[string]interface{}, response *LLMResponse) {
 	execCtx.Metrics.LLMTokensUsed += response.TokensUsed
 	execCtx.Metrics.LLMCost += response.Cost
 
-	return response.Content, nil
+	metadata["tokens_used"] = response.TokensUsed
+	metadata["cost"] = response.Cost
+	metadata["model"] = response.Model
+	if provider, ok := response.Metadata["provider"].(string); ok {
+		metadata["provider"] = provider
+	}
+	if streamed, ok := response.Metadata["streamed"].(bool); ok {
+		metadata["streamed"] = streamed
+	}
 }
 
-// executeLLMDisplayStep executes an LLM step and displays the output to the user
-func (we *WorkflowEngine) executeLLMDisplayStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult) (interface{}, error) {
-	prompt, ok := step.Config["prompt"].(string)
-	if !ok {
-		return nil, fmt.Errorf("prompt not specified in step config")
+// executeChatStep continues a named conversation thread (default: the step
+// name). Each run appends the templated "messages" and "prompt" to the thread,
+// sends the whole history to the LLM and records the assistant reply, so later
+// steps and loop iterations build on earlier turns instead of starting over.
+func (we *WorkflowEngine) executeChatStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult, metadata map[string]interface{}) (interface{}, error) {
+	thread, _ := step.Config["thread"].(string)
+	if thread == "" {
+		thread = step.Name
 	}
 
-	// Template rendering for prompt with context variables
-	renderedPrompt, err := we.templateEngine.RenderTemplate(prompt, previousResults, execCtx)
+	store := execCtx.conversations()
+	if reset, ok := step.Config["reset"].(bool); ok && reset {
+		store.Reset(thread)
+	}
+
+	client, err := we.llmClientForStep(step)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render prompt template: %w", err)
+		return nil, err
 	}
 
-	// Check for system prompt in step config
-	var response *LLMResponse
+	history := store.Messages(thread)
+	parts := make([]*promptPart, 0, len(history)+2)
+	for _, message := range history {
+		parts = append(parts, &promptPart{Role: message.Role, Content: message.Content, History: true})
+	}
+
+	// The system prompt only opens a new thread; it is not repeated per turn
+	if len(history) == 0 {
+		systemPrompt, _ := step.Config["system_prompt"].(string)
+		if systemPrompt == "" {
+			systemPrompt = client.config.SystemPrompt
+		}
+		if systemPrompt != "" {
+			part, err := we.templatedPart(step, "system", systemPrompt, previousResults, execCtx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render system prompt template: %w", err)
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	if rawMessages, ok := step.Config["messages"].([]interface{}); ok {
+		for i, raw := range rawMessages {
+			msgMap, ok := raw.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("message %d must be an object with role and content", i)
+			}
+			role, _ := msgMap["role"].(string)
+			content, _ := msgMap["content"].(string)
+			if role != "system" && role != "user" && role != "assistant" {
+				return nil, fmt.Errorf("message %d has unsupported role %q", i, role)
+			}
+			part, err := we.templatedPart(step, role, content, previousResults, execCtx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render message %d template: %w", i, err)
+			}
+			parts = append(parts, part)
+		}
+	}
 
-	if systemPrompt, ok := step.Config["system_prompt"].(string); ok && systemPrompt != "" {
-		// Render system prompt template if provided
-		renderedSystemPrompt, err := we.templateEngine.RenderTemplate(systemPrompt, previousResults, execCtx)
+	// opening_prompt replaces prompt on a thread's first turn, so the bulk
+	// context can be sent once and later turns only carry follow-ups
+	prompt, _ := step.Config["prompt"].(string)
+	if openingPrompt, ok := step.Config["opening_prompt"].(string); ok && openingPrompt != "" && len(history) == 0 {
+		prompt = openingPrompt
+	}
+	if prompt != "" {
+		part, err := we.templatedPart(step, "user", prompt, previousResults, execCtx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to render system prompt template: %w", err)
+			return nil, fmt.Errorf("failed to render prompt template: %w", err)
 		}
-		response, err = we.llmClient.CompleteWithSystem(ctx, renderedSystemPrompt, renderedPrompt)
-	} else {
-		response, err = we.llmClient.Complete(ctx, renderedPrompt)
+		parts = append(parts, part)
 	}
+
+	if len(parts) == len(history) || parts[len(parts)-1].Role == "system" {
+		return nil, fmt.Errorf("chat step %s has no user message: set prompt or messages", step.Name)
+	}
+
+	messages := renderParts(parts)
+	budgeter, err := we.newContextBudgeter(step, client, execCtx, ContextStrategyDropOldest)
 	if err != nil {
 		return nil, err
 	}
+	if budgeter != nil {
+		if messages, err = budgeter.fit(ctx, parts); err != nil {
+			return nil, err
+		}
+	}
 
-	// Update metrics
-	execCtx.Metrics.LLMTokensUsed += response.TokensUsed
-	execCtx.Metrics.LLMCost += response.Cost
+	// The new turn is what follows the history, as sent after any truncation
+	turn := renderParts(parts[len(history):])
 
-	// Display the LLM response to the user
-	fmt.Println("=== LLM ANALYSIS RESULTS ===")
-	fmt.Println()
-	fmt.Print(response.Content)
-	fmt.Println()
-	fmt.Println("=== END ANALYSIS RESULTS ===")
-	fmt.Println()
+	var response *LLMResponse
+	if we.shouldStream(step) {
+		response, err = client.ChatStream(ctx, messages, we.output)
+		fmt.Fprintln(we.output)
+	} else {
+		response, err = client.Chat(ctx, messages)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+
+	// Only record the turn once the reply arrives, so a failed request can be
+	// retried without duplicating the user's message
+	store.Append(thread, append(turn, Message{Role: "assistant", Content: response.Content})...)
+
+	we.recordLLMUsage(execCtx, metadata, response)
+	metadata["thread"] = thread
+	metadata["message_count"] = len(messages) + 1
 
 	return response.Content, nil
 }
@@ -381,6 +742,7 @@ type LLMWithToolsConfig struct {
 	AllowedPaths    []string `json:"allowed_paths"`
 	MaxFileSize     int      `json:"max_file_size"`
 	FailOnToolError bool     `json:"fail_on_tool_error"`
+	ToolMode        string   `json:"tool_mode"`
 }
 
 // ToolExecution represents a single tool execution
@@ -399,15 +761,11 @@ type LLMWithToolsResult struct {
 	ToolCallsUsed  int             `json:"tool_calls_used"`
 	TotalTokens    int             `json:"total_tokens"`
 	TotalCost      float64         `json:"total_cost"`
+	ToolMode       string          `json:"tool_mode"`
 }
 
 // executeLLMWithToolsStep executes an LLM step with tool access and proper controls
 func (we *WorkflowEngine) executeLLMWithToolsStep(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult) (interface{}, error) {
-	prompt, ok := step.Config["prompt"].(string)
-	if !ok {
-		return nil, fmt.Errorf("prompt not specified in step config")
-	}
-
 	// Parse configuration with defaults
 	config := LLMWithToolsConfig{
 		MaxToolCalls:    3,     // Default max tool calls to prevent loops
@@ -426,6 +784,9 @@ func (we *WorkflowEngine) executeLLMWithToolsStep(ctx context.Context, step Step
 		if failOnError, ok := configMap["fail_on_tool_error"].(bool); ok {
 			config.FailOnToolError = failOnError
 		}
+		if toolMode, ok := configMap["tool_mode"].(string); ok {
+			config.ToolMode = toolMode
+		}
 		if tools, ok := configMap["allowed_tools"].([]interface{}); ok {
 			for _, tool := range tools {
 				if toolStr, ok := tool.(string); ok {
@@ -442,14 +803,18 @@ func (we *WorkflowEngine) executeLLMWithToolsStep(ctx context.Context, step Step
 		}
 	}
 
-	// Template rendering for prompt with context variables
-	renderedPrompt, err := we.templateEngine.RenderTemplate(prompt, previousResults, execCtx)
+	client, err := we.llmClientForStep(step)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render prompt template: %w", err)
+		return nil, err
+	}
+
+	messages, err := we.buildLLMMessages(ctx, step, client, execCtx, previousResults)
+	if err != nil {
+		return nil, err
 	}
 
 	// Execute LLM with tools in a controlled manner
-	result, err := we.executeLLMWithToolsControlled(ctx, renderedPrompt, config, execCtx)
+	result, err := we.executeLLMWithToolsControlled(ctx, client, messages, config)
 	if err != nil {
 		return nil, fmt.Errorf("LLM with tools execution failed: %w", err)
 	}
@@ -460,19 +825,22 @@ func (we *WorkflowEngine) executeLLMWithToolsStep(ctx context.Context, step Step
 		"tool_calls_made", result.ToolCallsUsed,
 		"response_length", len(result.FinalResponse))
 
-	// Display the response (keeping display for now but using structured logging)
-	fmt.Println("=== LLM ANALYSIS WITH TOOLS ===")
-	fmt.Println()
-	fmt.Print(result.FinalResponse)
-	fmt.Println()
+	fmt.Fprintln(we.output, "=== LLM ANALYSIS WITH TOOLS ===")
+	fmt.Fprintln(we.output)
+	fmt.Fprint(we.output, result.FinalResponse)
+	fmt.Fprintln(we.output)
 	if len(result.ToolExecutions) > 0 {
-		fmt.Println("=== TOOL EXECUTIONS ===")
+		fmt.Fprintln(we.output, "=== TOOL EXECUTIONS ===")
 		for _, execution := range result.ToolExecutions {
-			fmt.Printf("Tool: %s\nResult: %s\n\n", execution.Tool, execution.Result)
+			if execution.Success {
+				fmt.Fprintf(we.output, "Tool: %s %v\n\n", execution.Tool, execution.Params)
+			} else {
+				fmt.Fprintf(we.output, "Tool: %s %v (FAILED)\nError: %s\n\n", execution.Tool, execution.Params, execution.Error)
+			}
 		}
 	}
-	fmt.Println("=== END ANALYSIS ===")
-	fmt.Println()
+	fmt.Fprintln(we.output, "=== END ANALYSIS ===")
+	fmt.Fprintln(we.output)
 
 	// Update metrics
 	execCtx.Metrics.LLMTokensUsed += result.TotalTokens
@@ -481,377 +849,221 @@ func (we *WorkflowEngine) executeLLMWithToolsStep(ctx context.Context, step Step
 	return result.FinalResponse, nil
 }
 
-// executeLLMWithToolsControlled executes LLM with proper tool controls and security
-func (we *WorkflowEngine) executeLLMWithToolsControlled(ctx context.Context, prompt string, config LLMWithToolsConfig, execCtx *ExecutionContext) (*LLMWithToolsResult, error) {
-	result := &LLMWithToolsResult{
-		ToolExecutions: []ToolExecution{},
-		ToolCallsUsed:  0,
+// executeLLMWithToolsControlled offers the allowed tools to the LLM and runs
+// its tool calls until it gives a final answer or MaxToolCalls is used up.
+// Models with native tool support use function calling; others fall back to
+// the text protocol in tool_protocol.go.
+func (we *WorkflowEngine) executeLLMWithToolsControlled(ctx context.Context, client *LLMClient, messages []Message, config LLMWithToolsConfig) (*LLMWithToolsResult, error) {
+	// Security: only offer allowed tools, or use safe defaults
+	allowedTools := config.AllowedTools
+	if len(allowedTools) == 0 {
+		allowedTools = []string{"read_file", "list_files"}
 	}
 
-	// Get initial LLM response
-	response, err := we.llmClient.Complete(ctx, prompt)
-	if err != nil {
-		return nil, fmt.Errorf("initial LLM call failed: %w", err)
+	tools := we.toolDefinitions(allowedTools)
+	if len(tools) == 0 {
+		return nil, fmt.Errorf("none of the allowed tools are available: %v", allowedTools)
 	}
 
-	result.TotalTokens += response.TokensUsed
-	result.TotalCost += response.Cost
-	result.FinalResponse = response.Content
-
-	// Check if the LLM is requesting tool usage using improved detection
-	if we.shouldExecuteToolsImproved(response.Content) && result.ToolCallsUsed < config.MaxToolCalls {
-		we.logger.Info("LLM response indicates tool usage needed", "response_sample", response.Content[:min(200, len(response.Content))])
-
-		// Execute tools based on LLM response with security controls
-		toolResults, err := we.executeToolsSecurely(ctx, response.Content, config, execCtx)
-		if err != nil {
-			if config.FailOnToolError {
-				return nil, fmt.Errorf("tool execution failed: %w", err)
-			}
-			we.logger.Warn("Tool execution failed but continuing", "error", err)
-			result.ToolExecutions = append(result.ToolExecutions, ToolExecution{
-				Tool:    "unknown",
-				Success: false,
-				Error:   err.Error(),
-			})
-		} else {
-			result.ToolExecutions = append(result.ToolExecutions, toolResults...)
-		}
-
-		result.ToolCallsUsed = len(result.ToolExecutions)
-
-		// If we have tool results, get follow-up response from LLM
-		if len(result.ToolExecutions) > 0 {
-			toolResultText := we.formatToolResults(result.ToolExecutions)
-			followUpPrompt := fmt.Sprintf("%s\n\nTool execution results:\n%s\n\nBased on these results, please provide your final analysis:",
-				prompt, toolResultText)
-
-			followUpResponse, err := we.llmClient.Complete(ctx, followUpPrompt)
-			if err != nil {
-				we.logger.Error("Follow-up LLM call failed", "error", err)
-				// Don't fail the entire step, just log and use original response
-			} else {
-				result.FinalResponse = followUpResponse.Content
-				result.TotalTokens += followUpResponse.TokensUsed
-				result.TotalCost += followUpResponse.Cost
-			}
+	mode := config.ToolMode
+	switch mode {
+	case "", "auto":
+		mode = "text"
+		if client.ModelInfo().SupportsTools {
+			mode = "native"
 		}
+	case "native", "text":
+	default:
+		return nil, fmt.Errorf("unsupported tool_mode: %s (expected auto, native or text)", config.ToolMode)
 	}
 
-	return result, nil
-}
+	we.logger.Debug("Running LLM with tools", "tool_mode", mode, "provider", client.config.Provider, "model", client.config.Model)
 
-// shouldExecuteToolsImproved determines if the LLM response indicates tool usage with better heuristics
-func (we *WorkflowEngine) shouldExecuteToolsImproved(response string) bool {
-	// More sophisticated pattern matching with context awareness
-	response = strings.ToLower(response)
-
-	// Look for explicit tool usage intentions
-	toolIndicators := []string{
-		"let me check",
-		"i'll examine",
-		"let me look at",
-		"i need to verify",
-		"let me search",
-		"i should read",
-		"let me find",
-		"i'll investigate",
-	}
-
-	fileOperations := []string{
-		"read the file",
-		"examine the code",
-		"look at the implementation",
-		"check the source",
-		"verify the code",
-	}
-
-	// Check for tool indicators
-	for _, indicator := range toolIndicators {
-		if strings.Contains(response, indicator) {
-			return true
-		}
+	result := &LLMWithToolsResult{
+		ToolExecutions: []ToolExecution{},
+		ToolCallsUsed:  0,
+		ToolMode:       mode,
 	}
 
-	// Check for file operation intentions
-	for _, operation := range fileOperations {
-		if strings.Contains(response, operation) {
-			return true
-		}
+	if mode == "text" {
+		return we.runTextToolLoop(ctx, client, messages, tools, allowedTools, config, result)
 	}
-
-	return false
+	return we.runNativeToolLoop(ctx, client, messages, tools, allowedTools, config, result)
 }
 
-// executeToolsSecurely executes tools with proper security controls
-func (we *WorkflowEngine) executeToolsSecurely(ctx context.Context, response string, config LLMWithToolsConfig, execCtx *ExecutionContext) ([]ToolExecution, error) {
-	var executions []ToolExecution
-	response = strings.ToLower(response)
-
-	// Security: Only execute if we have allowed tools configured, or use safe defaults
-	allowedTools := config.AllowedTools
-	if len(allowedTools) == 0 {
-		// Safe defaults
-		allowedTools = []string{"read_file", "list_files"}
-	}
-
-	// Check for file reading requests with security controls
-	if strings.Contains(response, "read") || strings.Contains(response, "file") || strings.Contains(response, "code") {
-		if we.isToolAllowed("read_file", allowedTools) {
-			files := we.determineFilesToRead(response, config.AllowedPaths)
-
-			for _, file := range files {
-				if !we.isPathAllowed(file, config.AllowedPaths) {
-					we.logger.Warn("File access denied by security policy", "file", file)
-					continue
-				}
+// runNativeToolLoop drives the tool loop through the provider's function
+// calling API, answering every tool call with a tool message
+func (we *WorkflowEngine) runNativeToolLoop(ctx context.Context, client *LLMClient, messages []Message, tools []ToolDefinition, allowedTools []string, config LLMWithToolsConfig, result *LLMWithToolsResult) (*LLMWithToolsResult, error) {
+	for {
+		response, err := client.ChatWithTools(ctx, messages, tools)
+		if err != nil {
+			return nil, fmt.Errorf("LLM call failed: %w", err)
+		}
 
-				execution := we.executeReadFileTool(ctx, file, config.MaxFileSize)
-				executions = append(executions, execution)
+		result.TotalTokens += response.TokensUsed
+		result.TotalCost += response.Cost
+		result.FinalResponse = response.Content
 
-				if len(executions) >= config.MaxToolCalls {
-					break
-				}
-			}
+		// No tool calls (or no tools left to offer) means this is the final answer
+		if len(response.ToolCalls) == 0 || len(tools) == 0 {
+			return result, nil
 		}
-	}
-
-	// Check for directory listing requests with security controls
-	if strings.Contains(response, "list") || strings.Contains(response, "directory") {
-		if we.isToolAllowed("list_files", allowedTools) {
-			directories := we.determineDirectoriesToList(response, config.AllowedPaths)
 
-			for _, dir := range directories {
-				if !we.isPathAllowed(dir, config.AllowedPaths) {
-					we.logger.Warn("Directory access denied by security policy", "directory", dir)
-					continue
-				}
+		messages = append(messages, Message{Role: "assistant", Content: response.Content, ToolCalls: response.ToolCalls})
 
-				execution := we.executeListFilesTool(ctx, dir)
-				executions = append(executions, execution)
+		for _, call := range response.ToolCalls {
+			// Every tool call needs an answer, even the ones over budget
+			if result.ToolCallsUsed >= config.MaxToolCalls {
+				messages = append(messages, Message{Role: "tool", ToolCallID: call.ID, Content: toolLimitMessage})
+				continue
+			}
 
-				if len(executions) >= config.MaxToolCalls {
-					break
-				}
+			content, err := we.runToolCall(ctx, call, allowedTools, config, result)
+			if err != nil {
+				return nil, err
 			}
+			messages = append(messages, Message{Role: "tool", ToolCallID: call.ID, Content: content})
 		}
-	}
 
-	return executions, nil
-}
-
-// Helper functions for security and tool execution
-func (we *WorkflowEngine) isToolAllowed(tool string, allowedTools []string) bool {
-	if len(allowedTools) == 0 {
-		return false // Default deny if no tools specified
-	}
-	for _, allowed := range allowedTools {
-		if allowed == tool {
-			return true
+		// Out of budget: ask once more without tools to force a final answer
+		if result.ToolCallsUsed >= config.MaxToolCalls {
+			tools = nil
 		}
 	}
-	return false
 }
 
-func (we *WorkflowEngine) isPathAllowed(path string, allowedPaths []string) bool {
-	if len(allowedPaths) == 0 {
-		// Default safe paths if none specified
-		safePaths := []string{"pkg/", "./pkg/", "cmd/", "./cmd/", "examples/", "./examples/"}
-		allowedPaths = safePaths
-	}
+// toolLimitMessage answers tool calls made after MaxToolCalls is used up
+const toolLimitMessage = "Error: tool call limit reached, answer with the information you already have"
 
-	for _, allowed := range allowedPaths {
-		if strings.HasPrefix(path, allowed) {
-			return true
+// runToolCall executes a tool call, records it in result and returns the text
+// to send back to the LLM. An error is only returned when the tool failed and
+// the step is configured to fail on tool errors.
+func (we *WorkflowEngine) runToolCall(ctx context.Context, call types.ToolCall, allowedTools []string, config LLMWithToolsConfig, result *LLMWithToolsResult) (string, error) {
+	execution, err := we.executeToolCall(ctx, call, allowedTools, config)
+	result.ToolExecutions = append(result.ToolExecutions, execution)
+	result.ToolCallsUsed++
+
+	if err != nil {
+		if config.FailOnToolError {
+			return "", fmt.Errorf("tool %s failed: %w", execution.Tool, err)
 		}
+		we.logger.Warn("Tool execution failed but continuing", "tool", execution.Tool, "error", err)
 	}
-	return false
-}
 
-func (we *WorkflowEngine) determineFilesToRead(response string, allowedPaths []string) []string {
-	// Safe defaults for key files to examine
-	defaultFiles := []string{
-		"pkg/generic/workflow_engine.go",
-		"pkg/generic/template_engine.go",
-		"pkg/generic/tool_registry.go",
+	if !execution.Success {
+		return "Error: " + execution.Error, nil
 	}
+	return execution.Result, nil
+}
 
-	// TODO: Implement more sophisticated file path extraction from LLM response
-	// For now, return safe defaults
-	var validFiles []string
-	for _, file := range defaultFiles {
-		if we.isPathAllowed(file, allowedPaths) {
-			validFiles = append(validFiles, file)
+// toolDefinitions builds function-calling definitions for the allowed tools
+// that are available in the registry
+func (we *WorkflowEngine) toolDefinitions(allowedTools []string) []ToolDefinition {
+	var definitions []ToolDefinition
+	for _, name := range allowedTools {
+		tool, exists := we.toolRegistry.GetTool(name)
+		if !exists {
+			we.logger.Warn("Allowed tool is not available", "tool", name)
+			continue
 		}
+		definitions = append(definitions, ToolDefinition{
+			Name:        name,
+			Description: tool.Description(),
+			Parameters:  ToolSchema(tool),
+		})
 	}
-
-	return validFiles
+	return definitions
 }
 
-func (we *WorkflowEngine) determineDirectoriesToList(response string, allowedPaths []string) []string {
-	// Safe defaults for directories to list
-	defaultDirs := []string{"pkg/generic", "cmd"}
-
-	var validDirs []string
-	for _, dir := range defaultDirs {
-		if we.isPathAllowed(dir, allowedPaths) {
-			validDirs = append(validDirs, dir)
-		}
-	}
+// toolPathParams are the tool parameters checked against allowed_paths
+var toolPathParams = []string{"path", "file_path", "directory"}
 
-	return validDirs
-}
+// executeToolCall runs a single tool call from the LLM. Calls rejected by the
+// tool or path policy are reported in the returned execution so the LLM can
+// adjust; only failures of the tool itself are returned as errors.
+func (we *WorkflowEngine) executeToolCall(ctx context.Context, call types.ToolCall, allowedTools []string, config LLMWithToolsConfig) (ToolExecution, error) {
+	execution := ToolExecution{Tool: call.Function.Name}
 
-func (we *WorkflowEngine) executeReadFileTool(ctx context.Context, filePath string, maxSize int) ToolExecution {
-	tool, exists := we.toolRegistry.GetTool("read_file")
-	if !exists {
-		return ToolExecution{
-			Tool:    "read_file",
-			Success: false,
-			Error:   "read_file tool not available",
+	params := make(map[string]interface{})
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &params); err != nil {
+			execution.Error = fmt.Sprintf("invalid arguments for %s: %v", call.Function.Name, err)
+			return execution, nil
 		}
 	}
+	execution.Params = params
 
-	params := map[string]interface{}{
-		"path":     filePath,
-		"max_size": maxSize,
-	}
-
-	result, err := tool.Execute(ctx, params)
-	if err != nil {
-		return ToolExecution{
-			Tool:    "read_file",
-			Params:  params,
-			Success: false,
-			Error:   err.Error(),
-		}
+	if !we.isToolAllowed(call.Function.Name, allowedTools) {
+		we.logger.Warn("Tool call denied by security policy", "tool", call.Function.Name)
+		execution.Error = fmt.Sprintf("tool %s is not allowed", call.Function.Name)
+		return execution, nil
 	}
 
-	// Format the result for display
-	var resultText string
-	if resultMap, ok := result.(map[string]interface{}); ok {
-		if content, hasContent := resultMap["content"].(string); hasContent {
-			if len(content) > 2000 {
-				content = content[:2000] + "\n... (truncated)"
-			}
-			resultText = fmt.Sprintf("Content of %s:\n%s", filePath, content)
+	for _, key := range toolPathParams {
+		if path, ok := params[key].(string); ok && !we.isPathAllowed(path, config.AllowedPaths) {
+			we.logger.Warn("Path access denied by security policy", "tool", call.Function.Name, "path", path)
+			execution.Error = fmt.Sprintf("access to %s is not allowed", path)
+			return execution, nil
 		}
 	}
 
-	return ToolExecution{
-		Tool:    "read_file",
-		Params:  params,
-		Result:  resultText,
-		Success: true,
+	// The step's file size limit always wins over what the LLM asks for
+	if call.Function.Name == "read_file" && config.MaxFileSize > 0 {
+		params["max_size"] = float64(config.MaxFileSize)
 	}
-}
 
-func (we *WorkflowEngine) executeListFilesTool(ctx context.Context, directory string) ToolExecution {
-	tool, exists := we.toolRegistry.GetTool("list_files")
+	tool, exists := we.toolRegistry.GetTool(call.Function.Name)
 	if !exists {
-		return ToolExecution{
-			Tool:    "list_files",
-			Success: false,
-			Error:   "list_files tool not available",
-		}
+		execution.Error = fmt.Sprintf("tool %s is not available", call.Function.Name)
+		return execution, nil
 	}
 
-	params := map[string]interface{}{
-		"path": directory,
+	output, err := tool.Execute(ctx, params)
+	if err != nil {
+		execution.Error = err.Error()
+		return execution, err
 	}
 
-	result, err := tool.Execute(ctx, params)
+	resultJSON, err := json.Marshal(output)
 	if err != nil {
-		return ToolExecution{
-			Tool:    "list_files",
-			Params:  params,
-			Success: false,
-			Error:   err.Error(),
-		}
+		execution.Result = fmt.Sprintf("%v", output)
+	} else {
+		execution.Result = string(resultJSON)
 	}
+	execution.Success = true
 
-	resultText := fmt.Sprintf("Files in %s: %v", directory, result)
-
-	return ToolExecution{
-		Tool:    "list_files",
-		Params:  params,
-		Result:  resultText,
-		Success: true,
-	}
+	return execution, nil
 }
 
-func (we *WorkflowEngine) formatToolResults(executions []ToolExecution) string {
-	var results []string
-	for _, execution := range executions {
-		if execution.Success {
-			results = append(results, fmt.Sprintf("Tool: %s\n%s", execution.Tool, execution.Result))
-		} else {
-			results = append(results, fmt.Sprintf("Tool: %s (FAILED)\nError: %s", execution.Tool, execution.Error))
+// Helper functions for security and tool execution
+func (we *WorkflowEngine) isToolAllowed(tool string, allowedTools []string) bool {
+	if len(allowedTools) == 0 {
+		return false // Default deny if no tools specified
+	}
+	for _, allowed := range allowedTools {
+		if allowed == tool {
+			return true
 		}
 	}
-	return strings.Join(results, "\n\n")
+	return false
 }
 
-// executeToolsBasedOnLLMResponse executes tools based on LLM response analysis
-func (we *WorkflowEngine) executeToolsBasedOnLLMResponse(ctx context.Context, response string, execCtx *ExecutionContext, previousResults map[string]*StepResult) (string, error) {
-	results := []string{}
-
-	// Simple pattern matching for common operations
-	// In a full implementation, this would use proper function calling
-
-	// Check for file reading requests
-	if strings.Contains(strings.ToLower(response), "read") && strings.Contains(strings.ToLower(response), "file") {
-		// Extract potential file paths or suggest reading key files
-		keyFiles := []string{
-			"pkg/generic/workflow_engine.go",
-			"pkg/generic/template_engine.go",
-			"pkg/generic/tool_registry.go",
-		}
-
-		for _, file := range keyFiles {
-			if tool, exists := we.toolRegistry.GetTool("read_file"); exists {
-				params := map[string]interface{}{
-					"path":     file,
-					"max_size": 10240, // 10KB limit
-				}
-				result, err := tool.Execute(ctx, params)
-				if err != nil {
-					results = append(results, fmt.Sprintf("Failed to read %s: %v", file, err))
-				} else {
-					if resultMap, ok := result.(map[string]interface{}); ok {
-						if content, hasContent := resultMap["content"].(string); hasContent {
-							// Truncate content for display
-							if len(content) > 2000 {
-								content = content[:2000] + "\n... (truncated)"
-							}
-							results = append(results, fmt.Sprintf("Content of %s:\n%s", file, content))
-						}
-					}
-				}
-			}
-		}
+// isPathAllowed checks a path against allowed path prefixes. Paths are
+// cleaned first so "pkg/../../etc" cannot slip past a "pkg/" prefix.
+func (we *WorkflowEngine) isPathAllowed(path string, allowedPaths []string) bool {
+	if len(allowedPaths) == 0 {
+		// Default safe paths if none specified
+		allowedPaths = []string{"pkg/", "cmd/", "examples/"}
 	}
 
-	// Check for directory listing requests
-	if strings.Contains(strings.ToLower(response), "list") || strings.Contains(strings.ToLower(response), "directory") {
-		if tool, exists := we.toolRegistry.GetTool("list_files"); exists {
-			params := map[string]interface{}{
-				"path": "pkg/generic",
-			}
-			result, err := tool.Execute(ctx, params)
-			if err != nil {
-				results = append(results, fmt.Sprintf("Failed to list files: %v", err))
-			} else {
-				results = append(results, fmt.Sprintf("Files in pkg/generic/: %v", result))
-			}
+	cleanPath := filepath.Clean(path)
+	for _, allowed := range allowedPaths {
+		cleanAllowed := filepath.Clean(allowed)
+		if cleanPath == cleanAllowed || strings.HasPrefix(cleanPath, cleanAllowed+string(filepath.Separator)) {
+			return true
 		}
 	}
-
-	if len(results) == 0 {
-		return "No specific tool executions were triggered based on the response.", nil
-	}
-
-	return strings.Join(results, "\n\n"), nil
+	return false
 }
 
 // executeDisplayStep executes a display step that shows static text to the user
@@ -866,7 +1078,7 @@ func (we *WorkflowEngine) executeDisplayStep(ctx context.Context, step Step, exe
 	}
 
 	// Template rendering for text with context variables
-	renderedText, err := we.templateEngine.RenderTemplate(text, previousResults, execCtx)
+	renderedText, err := we.stepTemplates(step).RenderTemplate(text, previousResults, execCtx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render display text template: %w", err)
 	}
@@ -887,7 +1099,7 @@ func (we *WorkflowEngine) executeConditionStep(ctx context.Context, step Step, e
 	}
 
 	// Render the condition template with current context
-	renderedCondition, err := we.templateEngine.RenderTemplate(conditionExpr, previousResults, execCtx)
+	renderedCondition, err := we.stepTemplates(step).RenderTemplate(conditionExpr, previousResults, execCtx)
 	if err != nil {
 		return false, fmt.Errorf("failed to render condition template: %w", err)
 	}
@@ -1127,9 +1339,10 @@ func (we *WorkflowEngine) parseLoopConfig(config map[string]interface{}) (*LoopC
 func (we *WorkflowEngine) createIterationContext(baseCtx *ExecutionContext, loopResult *LoopResult, iteration int) *ExecutionContext {
 	// Create a new context that inherits from base context
 	iterationCtx := &ExecutionContext{
-		Data:        make(map[string]interface{}),
-		StepResults: baseCtx.StepResults,
-		Metrics:     baseCtx.Metrics,
+		Data:          make(map[string]interface{}),
+		StepResults:   baseCtx.StepResults,
+		Metrics:       baseCtx.Metrics,
+		Conversations: baseCtx.conversations(),
 	}
 
 	// Copy base context data
@@ -1300,20 +1513,18 @@ func (we *WorkflowEngine) executeParallelStep(ctx context.Context, step Step, ex
 
 // executeStepByType executes a step based on its type (helper for parallel execution)
 func (we *WorkflowEngine) executeStepByType(ctx context.Context, step Step, execCtx *ExecutionContext, previousResults map[string]*StepResult) (interface{}, error) {
-	switch step.Type {
-	case "tool":
-		return we.executeToolStep(ctx, step, execCtx, previousResults)
-	case "llm":
-		return we.executeLLMStep(ctx, step, execCtx, previousResults)
-	case "llm_display":
-		return we.executeLLMDisplayStep(ctx, step, execCtx, previousResults)
-	case "display":
-		return we.executeDisplayStep(ctx, step, execCtx, previousResults)
-	case "condition":
-		return we.executeConditionStep(ctx, step, execCtx, previousResults)
-	default:
-		return nil, fmt.Errorf("unsupported step type for parallel execution: %s", step.Type)
+	step, err := we.resolvePromptRefs(step, make(map[string]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	if builtin, ok := we.builtinSteps[step.Type]; ok && builtin.parallel {
+		return builtin.execute(ctx, step, execCtx, previousResults, make(map[string]interface{}))
+	}
+	if runner, ok := we.externalSteps[step.Type]; ok {
+		return we.executeExternalStep(ctx, runner, step, execCtx, previousResults)
 	}
+	return nil, fmt.Errorf("unsupported step type for parallel execution: %s", step.Type)
 }
 
 // buildDependencyGraph builds a dependency graph for workflow steps using topological sorting
@@ -2,11 +2,17 @@ package generic
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/alantheprice/agent/pkg/interfaces/types"
 )
 
 func TestNewWorkflowEngine(t *testing.T) {
@@ -1047,3 +1053,440 @@ func TestDisplayStep(t *testing.T) {
 		})
 	}
 }
+
+func TestLLMDisplayStepStreaming(t *testing.T) {
+	server := newStreamingTestServer(t, []string{"Looks ", "good"}, &OpenAIUsage{TotalTokens: 12}, nil)
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	toolRegistry, _ := NewToolRegistry(map[string]Tool{}, &Security{Enabled: false}, logger)
+	validator, _ := NewValidator(Validation{Enabled: false}, logger)
+
+	engine, _ := NewWorkflowEngine([]Workflow{}, toolRegistry, newTestLLMClient(t, server.URL), validator, logger)
+
+	var output strings.Builder
+	engine.output = &output
+
+	step := Step{
+		Name: "review",
+		Type: "llm_display",
+		Config: map[string]interface{}{
+			"prompt": "Review this change",
+		},
+	}
+
+	execCtx := &ExecutionContext{
+		Context:     context.Background(),
+		SessionID:   "test-session",
+		StartTime:   time.Now(),
+		Data:        make(map[string]interface{}),
+		Variables:   make(map[string]string),
+		StepResults: make(map[string]*StepResult),
+		Metrics:     &ExecutionMetrics{},
+	}
+
+	result, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Output != "Looks good" {
+		t.Errorf("Expected output %q, got %v", "Looks good", result.Output)
+	}
+	if !strings.Contains(output.String(), "=== LLM ANALYSIS RESULTS ===\n\nLooks good\n") {
+		t.Errorf("Expected streamed tokens between the banners, got %q", output.String())
+	}
+	if result.Metadata["tokens_used"] != 12 {
+		t.Errorf("Expected tokens_used 12, got %v", result.Metadata["tokens_used"])
+	}
+	if execCtx.Metrics.LLMTokensUsed != 12 {
+		t.Errorf("Expected 12 tokens recorded in metrics, got %d", execCtx.Metrics.LLMTokensUsed)
+	}
+}
+
+func TestChatStep(t *testing.T) {
+	var requests []map[string]interface{}
+	server := newChatTestServer(t, "feat: add chat step", &requests)
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	toolRegistry, _ := NewToolRegistry(map[string]Tool{}, &Security{Enabled: false}, logger)
+	validator, _ := NewValidator(Validation{Enabled: false}, logger)
+
+	engine, _ := NewWorkflowEngine([]Workflow{}, toolRegistry, newTestLLMClient(t, server.URL), validator, logger)
+
+	execCtx := &ExecutionContext{
+		Context:     context.Background(),
+		SessionID:   "test-session",
+		StartTime:   time.Now(),
+		Data:        map[string]interface{}{"diff": "+added line"},
+		Variables:   make(map[string]string),
+		StepResults: make(map[string]*StepResult),
+		Metrics:     &ExecutionMetrics{},
+	}
+	previousResults := make(map[string]*StepResult)
+
+	chatStep := Step{
+		Name: "commit_message",
+		Type: "chat",
+		Config: map[string]interface{}{
+			"thread":         "commit",
+			"system_prompt":  "You write commit messages.",
+			"opening_prompt": "Write a commit message for {diff}",
+			"prompt":         "Make it shorter.",
+		},
+	}
+
+	// roles flattens a request's messages into role:content pairs
+	roles := func(request map[string]interface{}) []string {
+		var result []string
+		messages, _ := request["messages"].([]interface{})
+		for _, message := range messages {
+			msg, _ := message.(map[string]interface{})
+			result = append(result, fmt.Sprintf("%v:%v", msg["role"], msg["content"]))
+		}
+		return result
+	}
+
+	// Loop iterations get their own context but must share the thread
+	for iteration := 0; iteration < 2; iteration++ {
+		iterationCtx := engine.createIterationContext(execCtx, &LoopResult{StepResults: make(map[string]interface{})}, iteration)
+		result, err := engine.executeStep(context.Background(), chatStep, iterationCtx, previousResults)
+		if err != nil {
+			t.Fatalf("Unexpected error on turn %d: %v", iteration+1, err)
+		}
+		if result.Output != "feat: add chat step" {
+			t.Errorf("Expected assistant reply as output, got %v", result.Output)
+		}
+		if result.Metadata["thread"] != "commit" {
+			t.Errorf("Expected thread metadata, got %v", result.Metadata["thread"])
+		}
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+
+	first := strings.Join(roles(requests[0]), "|")
+	if first != "system:You write commit messages.|user:Write a commit message for +added line" {
+		t.Errorf("Unexpected first turn: %s", first)
+	}
+
+	second := strings.Join(roles(requests[1]), "|")
+	expected := first + "|assistant:feat: add chat step|user:Make it shorter."
+	if second != expected {
+		t.Errorf("Expected second turn to continue the thread\nexpected: %s\ngot:      %s", expected, second)
+	}
+
+	// reset starts the thread over with the opening prompt and templated messages
+	requests = nil
+	chatStep.Config["reset"] = true
+	chatStep.Config["messages"] = []interface{}{
+		map[string]interface{}{"role": "user", "content": "Here is an example: fix: typo"},
+		map[string]interface{}{"role": "assistant", "content": "Understood."},
+	}
+	if _, err := engine.executeStep(context.Background(), chatStep, execCtx, previousResults); err != nil {
+		t.Fatalf("Unexpected error after reset: %v", err)
+	}
+	if got := len(roles(requests[0])); got != 4 {
+		t.Errorf("Expected system, example pair and opening prompt after reset, got %d messages", got)
+	}
+
+	t.Run("missing user message", func(t *testing.T) {
+		step := Step{
+			Name:   "empty_chat",
+			Type:   "chat",
+			Config: map[string]interface{}{"system_prompt": "Hello"},
+		}
+		if _, err := engine.executeStep(context.Background(), step, execCtx, previousResults); err == nil {
+			t.Error("Expected error for chat step without a user message")
+		}
+	})
+
+	t.Run("invalid message role", func(t *testing.T) {
+		step := Step{
+			Name: "bad_role",
+			Type: "chat",
+			Config: map[string]interface{}{
+				"messages": []interface{}{map[string]interface{}{"role": "tool", "content": "x"}},
+			},
+		}
+		if _, err := engine.executeStep(context.Background(), step, execCtx, previousResults); err == nil {
+			t.Error("Expected error for unsupported message role")
+		}
+	})
+}
+
+func TestLLMWithToolsStep(t *testing.T) {
+	toolCall := func(id, name, arguments string) types.ToolCall {
+		return types.ToolCall{ID: id, Type: "function", Function: types.ToolCallFunction{Name: name, Arguments: arguments}}
+	}
+
+	tests := []struct {
+		name              string
+		toolConfig        map[string]interface{}
+		responses         []OpenAIMessage
+		expectError       bool
+		expectedRequests  int
+		expectedToolReply string
+		expectedSuccess   []bool
+		expectToolsDrop   bool
+	}{
+		{
+			name: "tool call answered with tool message",
+			toolConfig: map[string]interface{}{
+				"allowed_tools": []interface{}{"read_file"},
+				"allowed_paths": []interface{}{"config.go"},
+				"max_file_size": 1048576.0,
+			},
+			responses: []OpenAIMessage{
+				{Role: "assistant", ToolCalls: []types.ToolCall{toolCall("call_1", "read_file", `{"path": "config.go"}`)}},
+				{Role: "assistant", Content: "The config looks fine."},
+			},
+			expectedRequests:  2,
+			expectedToolReply: "package generic",
+			expectedSuccess:   []bool{true},
+		},
+		{
+			name: "disallowed tool and path are reported to the LLM",
+			toolConfig: map[string]interface{}{
+				"allowed_tools": []interface{}{"read_file"},
+				"allowed_paths": []interface{}{"pkg/"},
+			},
+			responses: []OpenAIMessage{
+				{Role: "assistant", ToolCalls: []types.ToolCall{
+					toolCall("call_1", "shell_command", `{"command": "rm -rf /"}`),
+					toolCall("call_2", "read_file", `{"path": "pkg/../../etc/passwd"}`),
+				}},
+				{Role: "assistant", Content: "I could not read the files."},
+			},
+			expectedRequests:  2,
+			expectedToolReply: "Error: access to pkg/../../etc/passwd is not allowed",
+			expectedSuccess:   []bool{false, false},
+		},
+		{
+			name: "tool call limit forces a final answer",
+			toolConfig: map[string]interface{}{
+				"allowed_tools":  []interface{}{"list_files"},
+				"allowed_paths":  []interface{}{"."},
+				"max_tool_calls": 1.0,
+			},
+			responses: []OpenAIMessage{
+				{Role: "assistant", ToolCalls: []types.ToolCall{
+					toolCall("call_1", "list_files", `{"path": "."}`),
+					toolCall("call_2", "list_files", `{"path": "."}`),
+				}},
+				{Role: "assistant", Content: "Done."},
+			},
+			expectedRequests:  2,
+			expectedToolReply: "Error: tool call limit reached, answer with the information you already have",
+			expectedSuccess:   []bool{true},
+			expectToolsDrop:   true,
+		},
+		{
+			name: "tool failure fails the step by default",
+			toolConfig: map[string]interface{}{
+				"allowed_tools": []interface{}{"read_file"},
+				"allowed_paths": []interface{}{"missing.go"},
+			},
+			responses: []OpenAIMessage{
+				{Role: "assistant", ToolCalls: []types.ToolCall{toolCall("call_1", "read_file", `{"path": "missing.go"}`)}},
+			},
+			expectError:      true,
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				requests = append(requests, body)
+
+				message := tt.responses[min(len(requests), len(tt.responses))-1]
+				json.NewEncoder(w).Encode(OpenAIResponse{
+					Choices: []OpenAIChoice{{Message: message}},
+					Usage:   OpenAIUsage{TotalTokens: 10},
+				})
+			}))
+			defer server.Close()
+
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			toolRegistry, _ := NewToolRegistry(map[string]Tool{}, &Security{Enabled: false}, logger)
+			validator, _ := NewValidator(Validation{Enabled: false}, logger)
+			engine, _ := NewWorkflowEngine([]Workflow{}, toolRegistry, newTestLLMClient(t, server.URL), validator, logger)
+
+			var output strings.Builder
+			engine.output = &output
+
+			step := Step{
+				Name: "review",
+				Type: "llm_with_tools",
+				Config: map[string]interface{}{
+					"prompt":      "Review the config",
+					"tool_config": tt.toolConfig,
+				},
+			}
+
+			execCtx := &ExecutionContext{
+				Context:     context.Background(),
+				SessionID:   "test-session",
+				StartTime:   time.Now(),
+				Data:        make(map[string]interface{}),
+				Variables:   make(map[string]string),
+				StepResults: make(map[string]*StepResult),
+				Metrics:     &ExecutionMetrics{},
+			}
+
+			result, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult))
+			if len(requests) != tt.expectedRequests {
+				t.Fatalf("Expected %d requests, got %d", tt.expectedRequests, len(requests))
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			final := tt.responses[len(tt.responses)-1].Content
+			if result.Output != final {
+				t.Errorf("Expected final answer %q, got %v", final, result.Output)
+			}
+
+			// The first request offers the allowed tools with their schemas
+			tools, _ := requests[0]["tools"].([]interface{})
+			if len(tools) != 1 {
+				t.Fatalf("Expected exactly the allowed tool to be offered, got %v", requests[0]["tools"])
+			}
+			function, _ := tools[0].(map[string]interface{})["function"].(map[string]interface{})
+			if _, hasSchema := function["parameters"].(map[string]interface{})["properties"]; !hasSchema {
+				t.Errorf("Expected tool parameters schema, got %v", function["parameters"])
+			}
+
+			// The follow-up request answers the tool calls with tool messages
+			messages, _ := requests[1]["messages"].([]interface{})
+			last, _ := messages[len(messages)-1].(map[string]interface{})
+			if last["role"] != "tool" || !strings.Contains(fmt.Sprint(last["content"]), tt.expectedToolReply) {
+				t.Errorf("Expected tool reply containing %q, got %v", tt.expectedToolReply, last)
+			}
+			if last["tool_call_id"] == "" {
+				t.Error("Expected tool reply to reference the tool call")
+			}
+			if _, offered := requests[1]["tools"]; offered == tt.expectToolsDrop {
+				t.Errorf("Expected tools offered on follow-up: %v", !tt.expectToolsDrop)
+			}
+
+			var executions []bool
+			for _, line := range strings.Split(output.String(), "\n") {
+				if strings.HasPrefix(line, "Tool: ") {
+					executions = append(executions, !strings.HasSuffix(line, "(FAILED)"))
+				}
+			}
+			if fmt.Sprint(executions) != fmt.Sprint(tt.expectedSuccess) {
+				t.Errorf("Expected tool executions %v, got %v", tt.expectedSuccess, executions)
+			}
+		})
+	}
+}
+
+func TestLLMWithToolsTextProtocol(t *testing.T) {
+	replies := []string{
+		"Let me check the config first.",
+		"Thought: I need the config\nAction: read_file\nAction Input: {\"path\": \"config.go\"}\nObservation: made up",
+		"Thought: I have what I need\nFinal Answer: The config is fine.",
+	}
+
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		reply := replies[min(len(requests), len(replies))-1]
+		json.NewEncoder(w).Encode(OpenAIResponse{
+			Choices: []OpenAIChoice{{Message: OpenAIMessage{Role: "assistant", Content: reply}}},
+			Usage:   OpenAIUsage{TotalTokens: 10},
+		})
+	}))
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	toolRegistry, _ := NewToolRegistry(map[string]Tool{}, &Security{Enabled: false}, logger)
+	validator, _ := NewValidator(Validation{Enabled: false}, logger)
+
+	// A model without native tools selects the text protocol automatically
+	llmClient := newTestLLMClient(t, server.URL)
+	llmClient.config.ProviderConfig["supports_tools"] = false
+
+	engine, _ := NewWorkflowEngine([]Workflow{}, toolRegistry, llmClient, validator, logger)
+	engine.output = &strings.Builder{}
+
+	step := Step{
+		Name: "review",
+		Type: "llm_with_tools",
+		Config: map[string]interface{}{
+			"prompt": "Review the config",
+			"tool_config": map[string]interface{}{
+				"allowed_tools": []interface{}{"read_file"},
+				"allowed_paths": []interface{}{"config.go"},
+				"max_file_size": 1048576.0,
+			},
+		},
+	}
+
+	execCtx := &ExecutionContext{
+		Context:     context.Background(),
+		SessionID:   "test-session",
+		StartTime:   time.Now(),
+		Data:        make(map[string]interface{}),
+		Variables:   make(map[string]string),
+		StepResults: make(map[string]*StepResult),
+		Metrics:     &ExecutionMetrics{},
+	}
+
+	result, err := engine.executeStep(context.Background(), step, execCtx, make(map[string]*StepResult))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Output != "The config is fine." {
+		t.Errorf("Expected final answer as output, got %v", result.Output)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+
+	lastMessage := func(request map[string]interface{}) map[string]interface{} {
+		messages, _ := request["messages"].([]interface{})
+		last, _ := messages[len(messages)-1].(map[string]interface{})
+		return last
+	}
+
+	if _, offered := requests[0]["tools"]; offered {
+		t.Error("Expected no native tools in text mode")
+	}
+	messages, _ := requests[0]["messages"].([]interface{})
+	system, _ := messages[0].(map[string]interface{})
+	if !strings.Contains(fmt.Sprint(system["content"]), "- read_file:") {
+		t.Errorf("Expected system prompt to describe the tools, got %v", system["content"])
+	}
+
+	if repair := fmt.Sprint(lastMessage(requests[1])["content"]); !strings.Contains(repair, "did not follow the required format") {
+		t.Errorf("Expected a repair prompt after the malformed reply, got %q", repair)
+	}
+
+	observation := lastMessage(requests[2])
+	if observation["role"] != "user" || !strings.HasPrefix(fmt.Sprint(observation["content"]), "Observation: {") {
+		t.Errorf("Expected the tool result as an observation, got %v", observation)
+	}
+	if strings.Contains(fmt.Sprint(requests[2]["messages"]), "made up") {
+		t.Error("Expected the invented observation to be dropped from the history")
+	}
+}
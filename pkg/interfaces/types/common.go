@@ -65,11 +65,12 @@ type ImageData struct {
 
 // ModelInfo contains information about an LLM model
 type ModelInfo struct {
-	Name           string `json:"name"`
-	Provider       string `json:"provider"`
-	MaxTokens      int    `json:"max_tokens"`
-	SupportsTools  bool   `json:"supports_tools"`
-	SupportsImages bool   `json:"supports_images"`
+	Name             string `json:"name"`
+	Provider         string `json:"provider"`
+	MaxTokens        int    `json:"max_tokens"`
+	SupportsTools    bool   `json:"supports_tools"`
+	SupportsImages   bool   `json:"supports_images"`
+	SupportsJSONMode bool   `json:"supports_json_mode"`
 }
 
 // WorkspaceContext represents the context of a workspace
@@ -107,6 +108,23 @@ type RequestOptions struct {
 	MaxTokens   int           `json:"max_tokens,omitempty"`
 	Timeout     time.Duration `json:"timeout,omitempty"`
 	Stream      bool          `json:"stream,omitempty"`
+	// ResponseFormat constrains the response to JSON; nil means free text
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// Response format types
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat describes the shape an LLM response must take
+type ResponseFormat struct {
+	Type   string                 `json:"type"`             // "text", "json_object" or "json_schema"
+	Name   string                 `json:"name,omitempty"`   // schema name, required by some providers for json_schema
+	Schema map[string]interface{} `json:"schema,omitempty"` // JSON Schema for json_schema
+	Strict bool                   `json:"strict,omitempty"` // ask the provider to enforce the schema exactly
 }
 
 // ResponseMetadata contains metadata about an LLM response
@@ -39,6 +39,7 @@ type ProviderCapabilities struct {
 	SupportsTools      bool `json:"supports_tools"`
 	SupportsImages     bool `json:"supports_images"`
 	SupportsStream     bool `json:"supports_stream"`
+	SupportsJSONMode   bool `json:"supports_json_mode,omitempty"`
 	SupportsEmbeddings bool `json:"supports_embeddings,omitempty"`
 	MaxTokens          int  `json:"max_tokens"`
 }
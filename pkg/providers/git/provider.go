@@ -0,0 +1,578 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alantheprice/agent/pkg/interfaces"
+)
+
+// Provider implements the GitProvider interface for the repository in one
+// directory. It drives the git binary with machine-readable output formats
+// (porcelain status, NUL-separated fields) and parses them into structured
+// results, so callers never scrape human-oriented text.
+type Provider struct {
+	dir     string
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// CommitDetails is a commit with its parents, changed files and patch
+type CommitDetails struct {
+	interfaces.GitCommit
+	Parents []string
+	Files   []ChangedFile
+	Diff    string
+}
+
+// ChangedFile is a file touched by a commit
+type ChangedFile struct {
+	Path    string
+	OldPath string // set for renames and copies
+	Status  string // added, modified, deleted, renamed, copied or type_changed
+}
+
+// BlameLine is one line of a file with the commit that last changed it
+type BlameLine struct {
+	Line    int
+	Hash    string
+	Author  string
+	Email   string
+	Date    time.Time
+	Summary string
+	Content string
+}
+
+// LogOptions narrows the commits Log returns
+type LogOptions struct {
+	Limit  int    // maximum number of commits, 0 for all
+	Ref    string // revision or range to start from, HEAD by default
+	Path   string // only commits touching this path
+	Author string // only commits whose author matches this pattern
+	Since  string // only commits after this date, in any format git accepts
+}
+
+// NewProvider creates a provider for the repository in dir, or in the
+// working directory when dir is empty
+func NewProvider(dir string) *Provider {
+	return &Provider{dir: dir, ctx: context.Background(), timeout: 30 * time.Second}
+}
+
+// WithContext returns a provider for the same repository whose commands are
+// cancelled with ctx
+func (p *Provider) WithContext(ctx context.Context) *Provider {
+	copy := *p
+	copy.ctx = ctx
+	return &copy
+}
+
+// run executes git in the provider's directory and returns its stdout
+func (p *Provider) run(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = p.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_MERGE_AUTOEDIT=no", "LC_ALL=C")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return stdout.String(), fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return stdout.String(), fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// checkArg rejects values git would read as options
+func checkArg(kind, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("%s cannot be empty", kind)
+	}
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("invalid %s %q", kind, value)
+	}
+	return nil
+}
+
+// InitRepository initializes a new Git repository
+func (p *Provider) InitRepository(path string) error {
+	if err := checkArg("path", path); err != nil {
+		return err
+	}
+	_, err := p.run("init", "--", path)
+	return err
+}
+
+// CloneRepository clones a remote repository
+func (p *Provider) CloneRepository(url, path string) error {
+	if err := checkArg("url", url); err != nil {
+		return err
+	}
+	if err := checkArg("path", path); err != nil {
+		return err
+	}
+	_, err := p.run("clone", "--", url, path)
+	return err
+}
+
+// GetStatus returns the status of the repository
+func (p *Provider) GetStatus() (*interfaces.GitStatus, error) {
+	output, err := p.run("status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(output)
+}
+
+// parseStatus reads `git status --porcelain=v2 --branch -z`
+func parseStatus(output string) (*interfaces.GitStatus, error) {
+	status := &interfaces.GitStatus{
+		Staged:     []string{},
+		Unstaged:   []string{},
+		Untracked:  []string{},
+		Conflicted: []string{},
+	}
+
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if entry == "" {
+			continue
+		}
+
+		switch entry[0] {
+		case '#':
+			fields := strings.Fields(entry)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[1] {
+			case "branch.head":
+				status.Branch = fields[2]
+			case "branch.ab":
+				if len(fields) == 4 {
+					status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[2], "+"))
+					status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[3], "-"))
+				}
+			}
+		case '1', '2':
+			// 1 XY sub mH mI mW hH hI path
+			// 2 XY sub mH mI mW hH hI score path, then the original path
+			fieldCount := 9
+			if entry[0] == '2' {
+				fieldCount = 10
+				i++
+			}
+			fields := strings.SplitN(entry, " ", fieldCount)
+			if len(fields) != fieldCount {
+				return nil, fmt.Errorf("unexpected status entry %q", entry)
+			}
+			xy, path := fields[1], fields[fieldCount-1]
+			if xy[0] != '.' {
+				status.Staged = append(status.Staged, path)
+			}
+			if xy[1] != '.' {
+				status.Unstaged = append(status.Unstaged, path)
+			}
+		case 'u':
+			fields := strings.SplitN(entry, " ", 11)
+			if len(fields) != 11 {
+				return nil, fmt.Errorf("unexpected status entry %q", entry)
+			}
+			status.Conflicted = append(status.Conflicted, fields[10])
+		case '?':
+			status.Untracked = append(status.Untracked, strings.TrimPrefix(entry, "? "))
+		}
+	}
+
+	status.Clean = len(status.Staged)+len(status.Unstaged)+len(status.Untracked)+len(status.Conflicted) == 0
+	return status, nil
+}
+
+// AddFiles adds files to the staging area; no patterns stages everything
+func (p *Provider) AddFiles(patterns []string) error {
+	if len(patterns) == 0 {
+		_, err := p.run("add", "--all")
+		return err
+	}
+	_, err := p.run(append([]string{"add", "--"}, patterns...)...)
+	return err
+}
+
+// CommitChanges creates a commit with staged changes
+func (p *Provider) CommitChanges(message string) error {
+	if strings.TrimSpace(message) == "" {
+		return fmt.Errorf("commit message cannot be empty")
+	}
+	_, err := p.run("commit", "--message", message)
+	return err
+}
+
+// CreateBranch creates a new branch at HEAD
+func (p *Provider) CreateBranch(name string) error {
+	if err := checkArg("branch name", name); err != nil {
+		return err
+	}
+	_, err := p.run("branch", name)
+	return err
+}
+
+// CheckoutBranch switches to a branch
+func (p *Provider) CheckoutBranch(name string) error {
+	if err := checkArg("branch name", name); err != nil {
+		return err
+	}
+	_, err := p.run("switch", name)
+	return err
+}
+
+// GetBranches returns a list of branches
+func (p *Provider) GetBranches() ([]string, error) {
+	output, err := p.run("for-each-ref", "--format=%(refname:short)", "refs/heads")
+	if err != nil {
+		return nil, err
+	}
+	return splitLines(output), nil
+}
+
+// GetCurrentBranch returns the current branch name, or HEAD when detached
+func (p *Provider) GetCurrentBranch() (string, error) {
+	output, err := p.run("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err == nil {
+		return strings.TrimSpace(output), nil
+	}
+	if _, headErr := p.run("rev-parse", "--verify", "--quiet", "HEAD"); headErr == nil {
+		return "HEAD", nil
+	}
+	return "", err
+}
+
+// GetCommitHistory returns commit history
+func (p *Provider) GetCommitHistory(limit int) ([]interfaces.GitCommit, error) {
+	return p.Log(LogOptions{Limit: limit})
+}
+
+// commitFormat separates a commit's fields with unit separators and ends it
+// with a record separator, which commit messages do not contain
+const commitFormat = "--format=%H%x1f%h%x1f%an%x1f%ae%x1f%aI%x1f%P%x1f%B%x1e"
+
+// Log returns the commits matching opts, newest first. A repository without
+// commits has no history rather than an error.
+func (p *Provider) Log(opts LogOptions) ([]interfaces.GitCommit, error) {
+	args := []string{"log", commitFormat}
+	if opts.Limit > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(opts.Limit))
+	}
+	if opts.Author != "" {
+		args = append(args, "--author="+opts.Author)
+	}
+	if opts.Since != "" {
+		args = append(args, "--since="+opts.Since)
+	}
+	if opts.Ref != "" {
+		if err := checkArg("ref", opts.Ref); err != nil {
+			return nil, err
+		}
+		args = append(args, opts.Ref)
+	} else if _, err := p.run("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		return []interfaces.GitCommit{}, nil
+	}
+	args = append(args, "--")
+	if opts.Path != "" {
+		args = append(args, opts.Path)
+	}
+
+	output, err := p.run(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []interfaces.GitCommit{}
+	for _, record := range strings.Split(output, "\x1e") {
+		record = strings.TrimLeft(record, "\n")
+		if record == "" {
+			continue
+		}
+		details, err := parseCommit(record)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, details.GitCommit)
+	}
+	return commits, nil
+}
+
+// parseCommit reads one record written with commitFormat
+func parseCommit(record string) (*CommitDetails, error) {
+	fields := strings.SplitN(record, "\x1f", 7)
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("unexpected log record %q", record)
+	}
+	date, err := time.Parse(time.RFC3339, fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit date %q: %w", fields[4], err)
+	}
+	return &CommitDetails{
+		GitCommit: interfaces.GitCommit{
+			Hash:      fields[0],
+			ShortHash: fields[1],
+			Author:    fields[2],
+			Email:     fields[3],
+			Date:      date,
+			Message:   strings.TrimRight(fields[6], "\n"),
+		},
+		Parents: strings.Fields(fields[5]),
+	}, nil
+}
+
+// GetDiff returns the diff between commits or working tree: from and to
+// compares two revisions, from alone compares a revision with the working
+// tree, and neither compares HEAD with the working tree
+func (p *Provider) GetDiff(from, to string) (string, error) {
+	args := []string{"diff"}
+	switch {
+	case from == "" && to != "":
+		return "", fmt.Errorf("a from revision is required to diff against %s", to)
+	case from == "":
+		args = append(args, "HEAD")
+	default:
+		for _, rev := range []string{from, to} {
+			if rev == "" {
+				continue
+			}
+			if err := checkArg("revision", rev); err != nil {
+				return "", err
+			}
+			args = append(args, rev)
+		}
+	}
+	return p.run(append(args, "--")...)
+}
+
+// Show returns a commit with its parents, changed files and, when
+// includeDiff is set, its patch
+func (p *Provider) Show(rev string, includeDiff bool) (*CommitDetails, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if err := checkArg("revision", rev); err != nil {
+		return nil, err
+	}
+
+	output, err := p.run("log", "--max-count=1", commitFormat, rev, "--")
+	if err != nil {
+		return nil, err
+	}
+	details, err := parseCommit(strings.TrimSuffix(strings.TrimRight(output, "\n"), "\x1e"))
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = p.run("show", "--format=", "--name-status", "-z", "--find-renames", details.Hash, "--")
+	if err != nil {
+		return nil, err
+	}
+	details.Files = parseNameStatus(output)
+
+	if includeDiff {
+		if details.Diff, err = p.run("show", "--format=", "--patch", "--find-renames", details.Hash, "--"); err != nil {
+			return nil, err
+		}
+	}
+	return details, nil
+}
+
+// fileStatuses names the status letters of --name-status
+var fileStatuses = map[byte]string{
+	'A': "added", 'M': "modified", 'D': "deleted", 'R': "renamed", 'C': "copied", 'T': "type_changed",
+}
+
+// parseNameStatus reads `--name-status -z`, where renames and copies are
+// followed by both paths
+func parseNameStatus(output string) []ChangedFile {
+	files := []ChangedFile{}
+	fields := strings.Split(strings.TrimLeft(output, "\n"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		code := fields[i]
+		if code == "" {
+			break
+		}
+		status, ok := fileStatuses[code[0]]
+		if !ok {
+			status = strings.ToLower(code)
+		}
+		file := ChangedFile{Path: fields[i+1], Status: status}
+		if (code[0] == 'R' || code[0] == 'C') && i+2 < len(fields) {
+			file.OldPath, file.Path = fields[i+1], fields[i+2]
+			i++
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// Blame returns who last changed each line of path at HEAD. startLine and
+// endLine limit the range when positive.
+func (p *Provider) Blame(path string, startLine, endLine int) ([]BlameLine, error) {
+	if err := checkArg("path", path); err != nil {
+		return nil, err
+	}
+	args := []string{"blame", "--porcelain"}
+	if startLine > 0 || endLine > 0 {
+		start, end := strconv.Itoa(max(startLine, 1)), ""
+		if endLine > 0 {
+			end = strconv.Itoa(endLine)
+		}
+		args = append(args, "-L", start+","+end)
+	}
+	output, err := p.run(append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBlame(output)
+}
+
+// parseBlame reads `git blame --porcelain`, in which each line has a header
+// naming its commit, the commit's details follow only the first line blamed
+// on it, and the content comes last, indented by a tab
+func parseBlame(output string) ([]BlameLine, error) {
+	commits := map[string]*BlameLine{}
+	lines := []BlameLine{}
+	var commit *BlameLine
+	number := 0
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			if commit == nil {
+				return nil, fmt.Errorf("blame content without a header")
+			}
+			blamed := *commit
+			blamed.Line, blamed.Content = number, line[1:]
+			lines = append(lines, blamed)
+			commit = nil
+			continue
+		}
+
+		if commit == nil {
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			var err error
+			if number, err = strconv.Atoi(fields[2]); err != nil {
+				return nil, fmt.Errorf("invalid blame header %q", line)
+			}
+			if commit = commits[fields[0]]; commit == nil {
+				commit = &BlameLine{Hash: fields[0]}
+				commits[fields[0]] = commit
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			commit.Author = value
+		case "author-mail":
+			commit.Email = strings.Trim(value, "<>")
+		case "author-time":
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+				commit.Date = time.Unix(seconds, 0).UTC()
+			}
+		case "summary":
+			commit.Summary = value
+		}
+	}
+	return lines, nil
+}
+
+// Push pushes changes to remote repository
+func (p *Provider) Push(remote, branch string) error {
+	args, err := remoteArgs("push", remote, branch)
+	if err != nil {
+		return err
+	}
+	_, err = p.run(args...)
+	return err
+}
+
+// Pull pulls changes from remote repository
+func (p *Provider) Pull(remote, branch string) error {
+	args, err := remoteArgs("pull", remote, branch)
+	if err != nil {
+		return err
+	}
+	_, err = p.run(append(args[:1], append([]string{"--no-edit"}, args[1:]...)...)...)
+	return err
+}
+
+// remoteArgs builds push and pull arguments; the remote defaults to origin
+// and the branch to git's configured default
+func remoteArgs(command, remote, branch string) ([]string, error) {
+	if remote == "" {
+		remote = "origin"
+	}
+	if err := checkArg("remote", remote); err != nil {
+		return nil, err
+	}
+	args := []string{command, remote}
+	if branch != "" {
+		if err := checkArg("branch name", branch); err != nil {
+			return nil, err
+		}
+		args = append(args, branch)
+	}
+	return args, nil
+}
+
+// IsRepository checks if the path is a Git repository
+func (p *Provider) IsRepository(path string) bool {
+	if path == "" {
+		path = "."
+	}
+	if !filepath.IsAbs(path) && p.dir != "" {
+		path = filepath.Join(p.dir, path)
+	}
+	output, err := (&Provider{dir: path, ctx: p.ctx, timeout: p.timeout}).run("rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(output) == "true"
+}
+
+// GetRemotes returns configured remotes and their fetch URLs
+func (p *Provider) GetRemotes() (map[string]string, error) {
+	output, err := p.run("remote", "--verbose")
+	if err != nil {
+		return nil, err
+	}
+	remotes := map[string]string{}
+	for _, line := range splitLines(output) {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[2] == "(fetch)" {
+			remotes[fields[0]] = fields[1]
+		}
+	}
+	return remotes, nil
+}
+
+func splitLines(output string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Verify Provider implements GitProvider interface
+var _ interfaces.GitProvider = (*Provider)(nil)
@@ -0,0 +1,231 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestRepository creates an empty repository with a fixed identity and
+// no user or system configuration
+func newTestRepository(t *testing.T) (*Provider, string) {
+	t.Helper()
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Ana Tester")
+	t.Setenv("GIT_AUTHOR_EMAIL", "ana@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Ana Tester")
+	t.Setenv("GIT_COMMITTER_EMAIL", "ana@example.com")
+
+	dir := t.TempDir()
+	provider := NewProvider(dir)
+	if err := provider.InitRepository("."); err != nil {
+		t.Fatalf("InitRepository failed: %v", err)
+	}
+	if _, err := provider.run("symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+		t.Fatalf("Failed to name the initial branch: %v", err)
+	}
+	return provider, dir
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commitTestFiles(t *testing.T, provider *Provider, dir, message string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		writeTestFile(t, dir, name, content)
+	}
+	if err := provider.AddFiles(nil); err != nil {
+		t.Fatalf("AddFiles failed: %v", err)
+	}
+	if err := provider.CommitChanges(message); err != nil {
+		t.Fatalf("CommitChanges failed: %v", err)
+	}
+}
+
+func TestProviderStatus(t *testing.T) {
+	provider, dir := newTestRepository(t)
+
+	status, err := provider.GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status.Branch != "main" || !status.Clean {
+		t.Errorf("Expected a clean main branch, got %+v", status)
+	}
+
+	commitTestFiles(t, provider, dir, "Initial commit", map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n"})
+	writeTestFile(t, dir, "a.txt", "changed\n")
+	writeTestFile(t, dir, "b.txt", "staged\n")
+	writeTestFile(t, dir, "new file.txt", "new\n")
+	if err := provider.AddFiles([]string{"b.txt"}); err != nil {
+		t.Fatalf("AddFiles failed: %v", err)
+	}
+	if _, err := provider.run("mv", "c.txt", "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err = provider.GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status.Clean {
+		t.Errorf("Expected a dirty tree")
+	}
+	if expected := []string{"b.txt", "renamed.txt"}; !reflect.DeepEqual(status.Staged, expected) {
+		t.Errorf("Expected staged %v, got %v", expected, status.Staged)
+	}
+	if expected := []string{"a.txt"}; !reflect.DeepEqual(status.Unstaged, expected) {
+		t.Errorf("Expected unstaged %v, got %v", expected, status.Unstaged)
+	}
+	if expected := []string{"new file.txt"}; !reflect.DeepEqual(status.Untracked, expected) {
+		t.Errorf("Expected untracked %v, got %v", expected, status.Untracked)
+	}
+}
+
+func TestProviderBranchesAndHistory(t *testing.T) {
+	provider, dir := newTestRepository(t)
+
+	commits, err := provider.GetCommitHistory(10)
+	if err != nil || len(commits) != 0 {
+		t.Fatalf("Expected no history in an empty repository, got %v, %v", commits, err)
+	}
+
+	commitTestFiles(t, provider, dir, "Initial commit", map[string]string{"main.go": "package main\n"})
+	if err := provider.CreateBranch("feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if err := provider.CheckoutBranch("feature"); err != nil {
+		t.Fatalf("CheckoutBranch failed: %v", err)
+	}
+	commitTestFiles(t, provider, dir, "Add helper\n\nThe helper returns one.", map[string]string{"helper.go": "package main\n\nfunc helper() int { return 1 }\n"})
+
+	branch, err := provider.GetCurrentBranch()
+	if err != nil || branch != "feature" {
+		t.Errorf("Expected branch feature, got %q, %v", branch, err)
+	}
+	branches, err := provider.GetBranches()
+	if err != nil || !reflect.DeepEqual(branches, []string{"feature", "main"}) {
+		t.Errorf("Unexpected branches %v, %v", branches, err)
+	}
+
+	commits, err = provider.GetCommitHistory(0)
+	if err != nil {
+		t.Fatalf("GetCommitHistory failed: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits, got %d", len(commits))
+	}
+	latest := commits[0]
+	if latest.Message != "Add helper\n\nThe helper returns one." || latest.Author != "Ana Tester" || latest.Email != "ana@example.com" {
+		t.Errorf("Unexpected commit %+v", latest)
+	}
+	if len(latest.Hash) != 40 || !strings.HasPrefix(latest.Hash, latest.ShortHash) || latest.Date.IsZero() {
+		t.Errorf("Unexpected commit identity %+v", latest)
+	}
+
+	filtered, err := provider.Log(LogOptions{Ref: "main", Path: "main.go"})
+	if err != nil || len(filtered) != 1 || filtered[0].Message != "Initial commit" {
+		t.Errorf("Unexpected filtered log %v, %v", filtered, err)
+	}
+
+	diff, err := provider.GetDiff("main", "feature")
+	if err != nil || !strings.Contains(diff, "+func helper() int { return 1 }") {
+		t.Errorf("Unexpected diff %q, %v", diff, err)
+	}
+	if _, err := provider.GetDiff("", "feature"); err == nil {
+		t.Errorf("Expected an error without a from revision")
+	}
+	if err := provider.CheckoutBranch("--orphan"); err == nil {
+		t.Errorf("Expected option-like branch names to be rejected")
+	}
+}
+
+func TestProviderShowAndBlame(t *testing.T) {
+	provider, dir := newTestRepository(t)
+	commitTestFiles(t, provider, dir, "Initial commit", map[string]string{"notes.txt": "one\ntwo\n", "old.txt": "keep me\n"})
+
+	t.Setenv("GIT_AUTHOR_NAME", "Bo Reviewer")
+	t.Setenv("GIT_AUTHOR_EMAIL", "bo@example.com")
+	if _, err := provider.run("mv", "old.txt", "new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	commitTestFiles(t, provider, dir, "Edit notes", map[string]string{"notes.txt": "one\nTWO\nthree\n"})
+
+	details, err := provider.Show("", true)
+	if err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	if details.Message != "Edit notes" || details.Author != "Bo Reviewer" || len(details.Parents) != 1 {
+		t.Errorf("Unexpected commit %+v", details.GitCommit)
+	}
+	expected := []ChangedFile{{Path: "new.txt", OldPath: "old.txt", Status: "renamed"}, {Path: "notes.txt", Status: "modified"}}
+	if !reflect.DeepEqual(details.Files, expected) {
+		t.Errorf("Expected files %+v, got %+v", expected, details.Files)
+	}
+	if !strings.Contains(details.Diff, "+TWO") {
+		t.Errorf("Expected the patch, got %q", details.Diff)
+	}
+
+	lines, err := provider.Blame("notes.txt", 0, 0)
+	if err != nil {
+		t.Fatalf("Blame failed: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %+v", lines)
+	}
+	authors := []string{lines[0].Author, lines[1].Author, lines[2].Author}
+	if !reflect.DeepEqual(authors, []string{"Ana Tester", "Bo Reviewer", "Bo Reviewer"}) {
+		t.Errorf("Unexpected authors %v", authors)
+	}
+	if lines[1].Line != 2 || lines[1].Content != "TWO" || lines[1].Summary != "Edit notes" || lines[1].Hash != details.Hash {
+		t.Errorf("Unexpected blame line %+v", lines[1])
+	}
+
+	ranged, err := provider.Blame("notes.txt", 2, 2)
+	if err != nil || len(ranged) != 1 || ranged[0].Content != "TWO" || ranged[0].Email != "bo@example.com" {
+		t.Errorf("Unexpected ranged blame %+v, %v", ranged, err)
+	}
+}
+
+func TestProviderRemotes(t *testing.T) {
+	upstream, dir := newTestRepository(t)
+	commitTestFiles(t, upstream, dir, "Initial commit", map[string]string{"README.md": "# Test\n"})
+
+	clones := t.TempDir()
+	if err := NewProvider(clones).CloneRepository(dir, "copy"); err != nil {
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	clone := NewProvider(filepath.Join(clones, "copy"))
+
+	if !clone.IsRepository("") || NewProvider(clones).IsRepository("") {
+		t.Errorf("IsRepository did not tell the clone from its parent directory")
+	}
+	remotes, err := clone.GetRemotes()
+	if err != nil || remotes["origin"] != dir {
+		t.Errorf("Expected origin %s, got %v, %v", dir, remotes, err)
+	}
+
+	commitTestFiles(t, clone, filepath.Join(clones, "copy"), "Update readme", map[string]string{"README.md": "# Test\n\nMore.\n"})
+	status, err := clone.GetStatus()
+	if err != nil || status.Ahead != 1 || status.Behind != 0 {
+		t.Errorf("Expected to be one commit ahead, got %+v, %v", status, err)
+	}
+	if err := clone.Push("", "main:incoming"); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if branches, _ := upstream.GetBranches(); !reflect.DeepEqual(branches, []string{"incoming", "main"}) {
+		t.Errorf("Expected the pushed branch upstream, got %v", branches)
+	}
+}
@@ -302,6 +302,8 @@ func (p *Provider) buildRequest(messages []types.Message, options types.RequestO
 		request.Temperature = &options.Temperature
 	}
 
+	request.ResponseFormat = toOpenAIResponseFormat(options.ResponseFormat)
+
 	return json.Marshal(request)
 }
 
@@ -330,6 +332,45 @@ type OpenAIRequest struct {
 	MaxTokens   *int            `json:"max_tokens,omitempty"`
 	Temperature *float64        `json:"temperature,omitempty"`
 	Stream      bool            `json:"stream,omitempty"`
+
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIResponseFormat is the response_format field of a chat completion request
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	Strict bool                   `json:"strict,omitempty"`
+}
+
+// toOpenAIResponseFormat maps a response format onto response_format. Free
+// text is the API default, so it is left out of the request.
+func toOpenAIResponseFormat(format *types.ResponseFormat) *OpenAIResponseFormat {
+	if format == nil || format.Type == "" || format.Type == types.ResponseFormatText {
+		return nil
+	}
+
+	if format.Type == types.ResponseFormatJSONSchema && format.Schema != nil {
+		name := format.Name
+		if name == "" {
+			name = "response"
+		}
+		return &OpenAIResponseFormat{
+			Type: types.ResponseFormatJSONSchema,
+			JSONSchema: &OpenAIJSONSchema{
+				Name:   name,
+				Schema: format.Schema,
+				Strict: format.Strict,
+			},
+		}
+	}
+
+	return &OpenAIResponseFormat{Type: types.ResponseFormatJSONObject}
 }
 
 type OpenAIMessage struct {
@@ -0,0 +1,102 @@
+package prompts
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Versioned prompts are stored as "<name>@<version>.txt" next to unversioned
+// "<name>.txt" prompts, and referenced as "name@version". A reference without
+// a version, or with "latest", resolves to the highest version, falling back
+// to the unversioned prompt.
+
+// ParseRef splits a prompt reference into its name and version
+func ParseRef(ref string) (name, version string) {
+	if idx := strings.LastIndex(ref, "@"); idx >= 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
+
+// Versions returns the versions available for a prompt, oldest first
+func (m *Manager) Versions(name string) []string {
+	prefix := name + "@"
+
+	var versions []string
+	for _, key := range m.ListPrompts() {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			versions = append(versions, key[len(prefix):])
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return compareVersions(versions[i], versions[j]) < 0
+	})
+	return versions
+}
+
+// Resolve maps a prompt reference to the stored prompt it names
+func (m *Manager) Resolve(ref string) (string, error) {
+	name, version := ParseRef(ref)
+	if name == "" {
+		return "", fmt.Errorf("prompt reference '%s' has no name", ref)
+	}
+
+	if version == "" || version == "latest" {
+		if versions := m.Versions(name); len(versions) > 0 {
+			return name + "@" + versions[len(versions)-1], nil
+		}
+		return name, nil
+	}
+
+	return name + "@" + version, nil
+}
+
+// LoadRef loads the prompt a reference resolves to, returning its content and
+// the resolved "name@version" key
+func (m *Manager) LoadRef(ref string) (string, string, error) {
+	key, err := m.Resolve(ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	content, err := m.LoadPrompt(key)
+	if err != nil {
+		return "", "", err
+	}
+	return content, key, nil
+}
+
+// compareVersions orders versions such as "1", "v2" and "1.10.0" by their
+// numeric parts, falling back to string order for other labels
+func compareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var partA, partB string
+		if i < len(partsA) {
+			partA = partsA[i]
+		}
+		if i < len(partsB) {
+			partB = partsB[i]
+		}
+
+		numA, errA := strconv.Atoi(partA)
+		numB, errB := strconv.Atoi(partB)
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case partA != partB:
+			return strings.Compare(partA, partB)
+		}
+	}
+	return 0
+}